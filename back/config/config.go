@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"os"
 	"reflect"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -21,22 +22,39 @@ type Config_t struct {
 
 	ISDebugMode string `env:"IS_DEBUG_MODE"`
 
+	// OIDCIssuer はトークンを発行するOIDCプロバイダーのURL。起動時にディスカバリーを行う
+	OIDCIssuer string `env:"OIDC_ISSUER" envDefault:"https://auth.walnuts.dev"`
+	// OIDCClientIDs と OIDCAudience のどれかがトークンのaudに含まれていれば受け付ける。カンマ区切り
+	OIDCClientIDs []string `env:"OIDC_CLIENT_IDS" envDefault:"238653199337193865@walnuts.dev"`
+	OIDCAudience  string   `env:"OIDC_AUDIENCE" envDefault:""`
+	// OIDCRequiredScopes はトークンのscope(またはscp)に含まれている必要があるスコープ。カンマ区切り
+	OIDCRequiredScopes []string `env:"OIDC_REQUIRED_SCOPES" envDefault:""`
+
 	ServerPort string
+	// TrashRetentionDays はゴミ箱のマネープールを完全に削除するまでの日数。0以下なら削除しない
+	TrashRetentionDays int
 }
 
 var Config = Config_t{}
 
 func LoadConfig() error {
 	serverport := flag.String("port", "8080", "server port")
+	trashRetentionDays := flag.Int("trash-retention-days", 30, "days to keep deleted money pools before purging them, 0 to keep forever")
 	flag.Parse()
 	Config.ServerPort = *serverport
+	Config.TrashRetentionDays = *trashRetentionDays
 
 	err := godotenv.Load(".env")
 	if err != nil {
 		slog.Debug("Error loading .env file")
 	}
 
-	t := reflect.TypeOf(Config)
+	return loadEnv(&Config)
+}
+
+// loadEnv sets the fields of config that have an env tag from the environment variables.
+func loadEnv(config *Config_t) error {
+	t := reflect.TypeOf(*config)
 	for i := 0; i < t.NumField(); i++ {
 		fieldName := t.Field(i).Name
 		tag, ok := t.Field(i).Tag.Lookup("env")
@@ -45,9 +63,29 @@ func LoadConfig() error {
 		}
 		v, ok := os.LookupEnv(tag)
 		if !ok {
-			return fmt.Errorf("%s is not set", tag)
+			// envDefaultがある項目は省略できる
+			v, ok = t.Field(i).Tag.Lookup("envDefault")
+			if !ok {
+				return fmt.Errorf("%s is not set", tag)
+			}
+		}
+		field := reflect.ValueOf(config).Elem().FieldByName(fieldName)
+		if field.Kind() == reflect.Slice {
+			field.Set(reflect.ValueOf(splitList(v)))
+			continue
 		}
-		reflect.ValueOf(&Config).Elem().FieldByName(fieldName).SetString(v)
+		field.SetString(v)
 	}
 	return nil
 }
+
+// splitList splits a comma separated value into its non-empty elements.
+func splitList(v string) []string {
+	list := []string{}
+	for _, e := range strings.Split(v, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
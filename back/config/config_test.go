@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// setRequiredEnv sets the variables that have no default.
+func setRequiredEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{
+		"POSTGRES_ADMIN_USER", "POSTGRES_ADMIN_PASSWORD", "POSTGRES_USER", "POSTGRES_PASSWORD",
+		"POSTGRES_DB", "POSTGRES_HOST", "POSTGRES_PORT", "IS_DEBUG_MODE",
+	} {
+		t.Setenv(name, "x")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("OIDC_CLIENT_IDS", " web@example.com, ,cli@example.com,")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if Config.OIDCIssuer != "https://auth.walnuts.dev" {
+		t.Errorf("OIDCIssuer = %q, want the envDefault", Config.OIDCIssuer)
+	}
+	if want := []string{"web@example.com", "cli@example.com"}; !reflect.DeepEqual(Config.OIDCClientIDs, want) {
+		t.Errorf("OIDCClientIDs = %q, want %q", Config.OIDCClientIDs, want)
+	}
+	if len(Config.OIDCRequiredScopes) != 0 {
+		t.Errorf("OIDCRequiredScopes = %q, want empty", Config.OIDCRequiredScopes)
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		setRequiredEnv(t)
+		var config Config_t
+		if err := loadEnv(&config); err != nil {
+			t.Fatalf("loadEnv() error = %v", err)
+		}
+		if config.OIDCIssuer != "https://auth.walnuts.dev" || config.OIDCAudience != "" {
+			t.Errorf("OIDCIssuer = %q, OIDCAudience = %q, want the envDefaults", config.OIDCIssuer, config.OIDCAudience)
+		}
+		if want := []string{"238653199337193865@walnuts.dev"}; !reflect.DeepEqual(config.OIDCClientIDs, want) {
+			t.Errorf("OIDCClientIDs = %q, want %q", config.OIDCClientIDs, want)
+		}
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		setRequiredEnv(t)
+		t.Setenv("OIDC_ISSUER", "https://issuer.example.com")
+		t.Setenv("OIDC_AUDIENCE", "openchokin-api")
+		t.Setenv("OIDC_REQUIRED_SCOPES", "openid,payments")
+		// 空の値を設定した場合はデフォルトではなく空のリストになる
+		t.Setenv("OIDC_CLIENT_IDS", "")
+		var config Config_t
+		if err := loadEnv(&config); err != nil {
+			t.Fatalf("loadEnv() error = %v", err)
+		}
+		if config.OIDCIssuer != "https://issuer.example.com" || config.OIDCAudience != "openchokin-api" {
+			t.Errorf("OIDCIssuer = %q, OIDCAudience = %q", config.OIDCIssuer, config.OIDCAudience)
+		}
+		if want := []string{"openid", "payments"}; !reflect.DeepEqual(config.OIDCRequiredScopes, want) {
+			t.Errorf("OIDCRequiredScopes = %q, want %q", config.OIDCRequiredScopes, want)
+		}
+		if len(config.OIDCClientIDs) != 0 {
+			t.Errorf("OIDCClientIDs = %q, want empty", config.OIDCClientIDs)
+		}
+	})
+
+	t.Run("missing required variable", func(t *testing.T) {
+		setRequiredEnv(t)
+		// setRequiredEnvのt.Setenvで元に戻るので、ここで消しても他のテストには影響しない
+		unsetEnv(t, "POSTGRES_DB")
+		var config Config_t
+		if err := loadEnv(&config); err == nil {
+			t.Fatal("loadEnv() error = nil, want an error for POSTGRES_DB")
+		}
+	})
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", []string{}},
+		{"a", []string{"a"}},
+		{" a , b ,,c, ", []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		if got := splitList(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitList(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// unsetEnv removes an environment variable for the rest of the test. Call t.Setenv on it first so that it is restored.
+func unsetEnv(t *testing.T, name string) {
+	t.Helper()
+	if err := os.Unsetenv(name); err != nil {
+		t.Fatal(err)
+	}
+}
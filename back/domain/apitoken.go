@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// NewAPIToken stores a new personal access token. Only the hash of the token is stored.
+func (d *dbImpl) NewAPIToken(token APIToken) (APIToken, error) {
+	query := `INSERT INTO api_token (user_id, name, token_hash, prefix, scopes, expires_at)
+			  VALUES ($1, $2, $3, $4, $5, $6)
+			  RETURNING id, created_at`
+	err := d.db.QueryRow(query, token.UserID, token.Name, token.TokenHash, token.Prefix, token.Scopes, token.ExpiresAt).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return APIToken{}, fmt.Errorf("failed to create api token: %v", err)
+	}
+	return token, nil
+}
+
+// GetAPITokensByUserID retrieves the tokens of a user, newest first, including revoked and expired ones.
+func (d *dbImpl) GetAPITokensByUserID(userID string) ([]APIToken, error) {
+	var tokens []APIToken
+	query := `SELECT * FROM api_token WHERE user_id = $1 ORDER BY id DESC`
+	err := d.db.Select(&tokens, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching api tokens: %v", err)
+	}
+	return tokens, nil
+}
+
+// GetAPITokenByHash retrieves the token with the given hash.
+func (d *dbImpl) GetAPITokenByHash(tokenHash string) (APIToken, error) {
+	var token APIToken
+	err := d.db.Get(&token, `SELECT * FROM api_token WHERE token_hash = $1`, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIToken{}, fmt.Errorf("%w: api token", ErrNotFound)
+	}
+	if err != nil {
+		return APIToken{}, fmt.Errorf("error fetching api token: %v", err)
+	}
+	return token, nil
+}
+
+// RevokeAPIToken revokes a token of the user. Revoking a token twice keeps the first revocation time.
+func (d *dbImpl) RevokeAPIToken(id string, userID string, revokedAt time.Time) error {
+	query := `UPDATE api_token SET revoked_at = COALESCE(revoked_at, $3) WHERE id = $1 AND user_id = $2`
+	result, err := d.db.Exec(query, id, userID, revokedAt)
+	if err != nil {
+		return fmt.Errorf("could not revoke api token: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not determine rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: api token %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+// TouchAPIToken records when a token was last used.
+func (d *dbImpl) TouchAPIToken(id string, usedAt time.Time) error {
+	_, err := d.db.Exec(`UPDATE api_token SET last_used_at = $2 WHERE id = $1`, id, usedAt)
+	if err != nil {
+		return fmt.Errorf("error updating api token: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Audit builds the audit logs of a change. It is called inside the transaction of the change, so that the change
+// and its audit logs are committed together. changed is the entity after the change, with the ID it has just been
+// given for a creation, or its ID if the method takes only the ID. A nil Audit records nothing.
+type Audit[T any] func(changed T) ([]AuditLog, error)
+
+// writeAudit inserts the audit logs built by audit in the transaction of the change.
+func writeAudit[T any](tx sqlx.Execer, audit Audit[T], changed T) error {
+	if audit == nil {
+		return nil
+	}
+	auditLogs, err := audit(changed)
+	if err != nil {
+		return err
+	}
+	for _, auditLog := range auditLogs {
+		if err := insertAuditLog(tx, auditLog); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertAuditLog inserts an audit log in the transaction of the change.
+func insertAuditLog(db sqlx.Execer, auditLog AuditLog) error {
+	query := `INSERT INTO audit_log (actor_id, action, entity_type, entity_id, money_pool_id, before, after)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := db.Exec(query, auditLog.ActorID, auditLog.Action, auditLog.EntityType, auditLog.EntityID,
+		auditLog.MoneyPoolID, auditLog.Before, auditLog.After)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit log of %s %s: %v", auditLog.EntityType, auditLog.EntityID, err)
+	}
+	return nil
+}
+
+// GetAuditLogs retrieves the audit logs matching the filter, newest first.
+func (d *dbImpl) GetAuditLogs(filter AuditLogFilter) ([]AuditLog, error) {
+	var conditions []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.MoneyPoolID != nil {
+		conditions = append(conditions, "money_pool_id = "+arg(*filter.MoneyPoolID))
+	}
+	if filter.EntityType != "" {
+		conditions = append(conditions, "entity_type = "+arg(filter.EntityType))
+	}
+	if filter.EntityID != "" {
+		conditions = append(conditions, "entity_id = "+arg(filter.EntityID))
+	}
+	if filter.BeforeID != nil {
+		conditions = append(conditions, "id < "+arg(*filter.BeforeID))
+	}
+	if len(conditions) == 0 {
+		return nil, fmt.Errorf("audit logs must be filtered by money pool or entity")
+	}
+
+	query := `SELECT id, actor_id, action, entity_type, entity_id, money_pool_id, before, after, created_at
+			  FROM audit_log WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY id DESC`
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+
+	var auditLogs []AuditLog
+	err := d.db.Select(&auditLogs, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching audit logs: %v", err)
+	}
+	return auditLogs, nil
+}
@@ -0,0 +1,474 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// BackupVersion はバックアップの形式のバージョンです。形式を変えたら上げて、RestoreBackupで古い形式も読めるようにします。
+const BackupVersion = 1
+
+// Backup はユーザーが所有するデータ一式です。IDはバックアップ元のIDで、復元時に新しいIDに振り直されます。
+type Backup struct {
+	Version      int       `json:"version"`
+	CreatedAt    time.Time `json:"created_at"`
+	UserID       string    `json:"user_id"`
+	BaseCurrency string    `json:"base_currency"`
+
+	Stores            []BackupNamedEntity      `json:"stores"`
+	Items             []BackupNamedEntity      `json:"items"`
+	Labels            []BackupNamedEntity      `json:"labels"`
+	MoneyProviders    []BackupMoneyProvider    `json:"money_providers"`
+	UserGroups        []BackupNamedEntity      `json:"user_groups"`
+	UserGroupMembers  []BackupUserGroupMember  `json:"user_group_members"`
+	MoneyPools        []BackupMoneyPool        `json:"money_pools"`
+	PublicationScopes []BackupPublicationScope `json:"publication_scopes"`
+	RecurringPayments []BackupRecurringPayment `json:"recurring_payments"`
+	Transfers         []BackupTransfer         `json:"transfers"`
+	Payments          []BackupPayment          `json:"payments"`
+	PaymentItems      []BackupPaymentItem      `json:"payment_items"`
+	PaymentLabels     []BackupPaymentLabel     `json:"payment_labels"`
+	ExchangeRates     []BackupExchangeRate     `json:"exchange_rates"`
+}
+
+// BackupNamedEntity is a store, item, label or user group, which only have a name.
+type BackupNamedEntity struct {
+	ID   string `db:"id" json:"id"`
+	Name string `db:"name" json:"name"`
+}
+
+type BackupMoneyProvider struct {
+	ID       string `db:"id" json:"id"`
+	Name     string `db:"name" json:"name"`
+	Balance  Money  `db:"balance" json:"balance"`
+	Currency string `db:"currency" json:"currency"`
+}
+
+type BackupUserGroupMember struct {
+	GroupID string `db:"group_id" json:"group_id"`
+	UserID  string `db:"user_id" json:"user_id"`
+}
+
+type BackupMoneyPool struct {
+	ID              string     `db:"id" json:"id"`
+	Name            string     `db:"name" json:"name"`
+	Description     string     `db:"description" json:"description"`
+	Type            string     `db:"type" json:"type"`
+	Emoji           string     `db:"emoji" json:"emoji"`
+	Currency        string     `db:"currency" json:"currency"`
+	IsDeleted       bool       `db:"is_deleted" json:"is_deleted"`
+	DeletedAt       *time.Time `db:"deleted_at" json:"deleted_at"`
+	MoneyProviderID *string    `db:"money_provider_id" json:"money_provider_id"`
+	BudgetAmount    *Money     `db:"budget_amount" json:"budget_amount"`
+	BudgetPeriod    *string    `db:"budget_period" json:"budget_period"`
+	BudgetRollover  bool       `db:"budget_rollover" json:"budget_rollover"`
+	BudgetStartDate *time.Time `db:"budget_start_date" json:"budget_start_date"`
+}
+
+type BackupPublicationScope struct {
+	MoneyPoolID string `db:"pool_id" json:"money_pool_id"`
+	GroupID     string `db:"group_id" json:"group_id"`
+}
+
+type BackupRecurringPayment struct {
+	ID              string     `db:"id" json:"id"`
+	MoneyPoolID     string     `db:"money_pool_id" json:"money_pool_id"`
+	Title           string     `db:"title" json:"title"`
+	Amount          Money      `db:"amount" json:"amount"`
+	Description     string     `db:"description" json:"description"`
+	StoreID         *string    `db:"store_id" json:"store_id"`
+	Frequency       string     `db:"frequency" json:"frequency"`
+	IntervalCount   int        `db:"interval_count" json:"interval_count"`
+	Weekday         *int       `db:"weekday" json:"weekday"`
+	NthWeek         *int       `db:"nth_week" json:"nth_week"`
+	StartDate       time.Time  `db:"start_date" json:"start_date"`
+	EndDate         *time.Time `db:"end_date" json:"end_date"`
+	OccurrenceCount *int       `db:"occurrence_count" json:"occurrence_count"`
+	IsPaused        bool       `db:"is_paused" json:"is_paused"`
+	GeneratedUntil  *time.Time `db:"generated_until" json:"generated_until"`
+}
+
+type BackupTransfer struct {
+	ID          string    `db:"id" json:"id"`
+	Date        time.Time `db:"date" json:"date"`
+	Title       string    `db:"title" json:"title"`
+	Description string    `db:"description" json:"description"`
+	IsPlanned   bool      `db:"is_planned" json:"is_planned"`
+}
+
+type BackupPayment struct {
+	ID                 string     `db:"id" json:"id"`
+	MoneyPoolID        string     `db:"money_pool_id" json:"money_pool_id"`
+	Date               time.Time  `db:"date" json:"date"`
+	Title              string     `db:"title" json:"title"`
+	Amount             Money      `db:"amount" json:"amount"`
+	Description        string     `db:"description" json:"description"`
+	IsPlanned          bool       `db:"is_planned" json:"is_planned"`
+	StoreID            *string    `db:"store_id" json:"store_id"`
+	RecurringPaymentID *string    `db:"recurring_payment_id" json:"recurring_payment_id"`
+	TransferID         *string    `db:"transfer_id" json:"transfer_id"`
+	PlannedDate        *time.Time `db:"planned_date" json:"planned_date"`
+	PlannedAmount      *Money     `db:"planned_amount" json:"planned_amount"`
+}
+
+type BackupPaymentItem struct {
+	PaymentID string `db:"payment_id" json:"payment_id"`
+	ItemID    string `db:"item_id" json:"item_id"`
+	Quantity  int64  `db:"quantity" json:"quantity"`
+	UnitPrice Money  `db:"unit_price" json:"unit_price"`
+}
+
+type BackupPaymentLabel struct {
+	PaymentID string `db:"payment_id" json:"payment_id"`
+	LabelID   string `db:"label_id" json:"label_id"`
+}
+
+type BackupExchangeRate struct {
+	FromCurrency string    `db:"from_currency" json:"from_currency"`
+	ToCurrency   string    `db:"to_currency" json:"to_currency"`
+	Rate         Rate      `db:"rate" json:"rate"`
+	ValidFrom    time.Time `db:"valid_from" json:"valid_from"`
+}
+
+// GetBackup reads everything the user owns, including deleted money pools.
+// All tables are read in one repeatable read transaction so that the backup is consistent.
+func (d *dbImpl) GetBackup(userID string) (Backup, error) {
+	tx, err := d.db.BeginTxx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return Backup{}, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	backup := Backup{Version: BackupVersion, CreatedAt: time.Now(), UserID: userID}
+	err = tx.Get(&backup.BaseCurrency, `SELECT base_currency FROM users WHERE id = $1`, userID)
+	if err != nil {
+		return Backup{}, fmt.Errorf("error fetching user: %v", err)
+	}
+
+	// 所有するマネープールの支払いなどは、マネープールを通して絞り込む
+	const ownPools = `SELECT id FROM money_pool WHERE owner_id = $1`
+	queries := []struct {
+		name  string
+		dest  interface{}
+		query string
+	}{
+		{"stores", &backup.Stores, `SELECT id, name FROM store WHERE creator_id = $1 ORDER BY id`},
+		{"items", &backup.Items, `SELECT id, name FROM item WHERE creator_id = $1 ORDER BY id`},
+		{"labels", &backup.Labels, `SELECT id, name FROM label WHERE creator_id = $1 ORDER BY id`},
+		{"money providers", &backup.MoneyProviders, `SELECT id, name, balance, currency FROM money_provider WHERE creator_id = $1 ORDER BY id`},
+		{"user groups", &backup.UserGroups, `SELECT id, name FROM user_groups WHERE creator_id = $1 ORDER BY id`},
+		{"user group members", &backup.UserGroupMembers, `SELECT ugm.group_id, ugm.user_id FROM user_group_membership ugm
+				  JOIN user_groups g ON g.id = ugm.group_id WHERE g.creator_id = $1 ORDER BY ugm.group_id, ugm.user_id`},
+		{"money pools", &backup.MoneyPools, `SELECT id, name, COALESCE(description, '') AS description, type, emoji, currency, is_deleted, deleted_at,
+				  money_provider_id, budget_amount, budget_period, budget_rollover, budget_start_date
+				  FROM money_pool WHERE owner_id = $1 ORDER BY id`},
+		{"publication scopes", &backup.PublicationScopes, `SELECT pool_id, group_id FROM restricted_publication_scope
+				  WHERE pool_id IN (` + ownPools + `) ORDER BY pool_id, group_id`},
+		{"recurring payments", &backup.RecurringPayments, `SELECT id, money_pool_id, title, amount, COALESCE(description, '') AS description, store_id,
+				  frequency, interval_count, weekday, nth_week, start_date, end_date, occurrence_count, is_paused, generated_until
+				  FROM recurring_payment WHERE money_pool_id IN (` + ownPools + `) ORDER BY id`},
+		{"transfers", &backup.Transfers, `SELECT id, date, title, COALESCE(description, '') AS description, is_planned
+				  FROM transfer WHERE creator_id = $1 ORDER BY id`},
+		{"payments", &backup.Payments, `SELECT id, money_pool_id, date, title, amount, COALESCE(description, '') AS description, is_planned, store_id,
+				  recurring_payment_id, transfer_id, planned_date, planned_amount
+				  FROM payment WHERE money_pool_id IN (` + ownPools + `) ORDER BY id`},
+		{"payment items", &backup.PaymentItems, `SELECT payment_id, item_id, quantity, unit_price FROM item_payment
+				  WHERE payment_id IN (SELECT id FROM payment WHERE money_pool_id IN (` + ownPools + `)) ORDER BY payment_id, item_id`},
+		{"payment labels", &backup.PaymentLabels, `SELECT payment_id, label_id FROM payment_label
+				  WHERE payment_id IN (SELECT id FROM payment WHERE money_pool_id IN (` + ownPools + `)) ORDER BY payment_id, label_id`},
+		{"exchange rates", &backup.ExchangeRates, `SELECT from_currency, to_currency, rate, valid_from FROM exchange_rate
+				  WHERE creator_id = $1 ORDER BY from_currency, to_currency, valid_from`},
+	}
+	for _, q := range queries {
+		if err := tx.Select(q.dest, q.query, userID); err != nil {
+			return Backup{}, fmt.Errorf("error fetching %s for backup: %v", q.name, err)
+		}
+	}
+	return backup, nil
+}
+
+// HasUserData reports whether the user owns any money pool, money provider, user group, store, item or label.
+func (d *dbImpl) HasUserData(userID string) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM money_pool WHERE owner_id = $1)
+			  OR EXISTS (SELECT 1 FROM money_provider WHERE creator_id = $1)
+			  OR EXISTS (SELECT 1 FROM user_groups WHERE creator_id = $1)
+			  OR EXISTS (SELECT 1 FROM store WHERE creator_id = $1)
+			  OR EXISTS (SELECT 1 FROM item WHERE creator_id = $1)
+			  OR EXISTS (SELECT 1 FROM label WHERE creator_id = $1)`
+	err := d.db.Get(&exists, query, userID)
+	if err != nil {
+		return false, fmt.Errorf("error checking data of user %s: %v", userID, err)
+	}
+	return exists, nil
+}
+
+// backupIDMap maps the IDs in a backup to the IDs of the restored rows.
+type backupIDMap map[string]string
+
+func (m backupIDMap) get(kind string, id string) (string, error) {
+	newID, ok := m[id]
+	if !ok {
+		return "", fmt.Errorf("backup refers to unknown %s %s", kind, id)
+	}
+	return newID, nil
+}
+
+func (m backupIDMap) getOptional(kind string, id *string) (*string, error) {
+	if id == nil {
+		return nil, nil
+	}
+	newID, err := m.get(kind, *id)
+	if err != nil {
+		return nil, err
+	}
+	return &newID, nil
+}
+
+// restoreNamedEntities inserts stores, items or labels of the user. With merge, an existing one with the same name is reused.
+func restoreNamedEntities(tx *sqlx.Tx, table string, userID string, entities []BackupNamedEntity, merge bool) (backupIDMap, error) {
+	ids := make(backupIDMap, len(entities))
+	for _, entity := range entities {
+		var id string
+		if merge {
+			err := tx.Get(&id, `SELECT id FROM `+table+` WHERE creator_id = $1 AND name = $2 ORDER BY id LIMIT 1`, userID, entity.Name)
+			if err != nil && err != sql.ErrNoRows {
+				return nil, fmt.Errorf("error looking up %s %s: %v", table, entity.Name, err)
+			}
+		}
+		if id == "" {
+			err := tx.QueryRow(`INSERT INTO `+table+` (name, creator_id) VALUES ($1, $2) RETURNING id`, entity.Name, userID).Scan(&id)
+			if err != nil {
+				return nil, fmt.Errorf("failed to restore %s %s: %v", table, entity.Name, err)
+			}
+		}
+		ids[entity.ID] = id
+	}
+	return ids, nil
+}
+
+// RestoreBackup re-creates the data of a backup under userID in a single transaction, assigning new IDs.
+// Without merge the base currency is restored too and the account is expected to be empty.
+// With merge everything is added next to the existing data; stores, items and labels with the same name are reused
+// and existing exchange rates are kept.
+// Members of user groups are restored only if the user exists; the backed up user itself becomes userID.
+func (d *dbImpl) RestoreBackup(userID string, backup Backup, merge bool) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	err = restoreBackup(tx, userID, backup, merge)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit restore: %v", err)
+	}
+	return nil
+}
+
+func restoreBackup(tx *sqlx.Tx, userID string, backup Backup, merge bool) error {
+	_, err := tx.Exec(`INSERT INTO users (id) VALUES ($1) ON CONFLICT (id) DO NOTHING`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %v", err)
+	}
+	if !merge && backup.BaseCurrency != "" {
+		_, err = tx.Exec(`UPDATE users SET base_currency = $1 WHERE id = $2`, backup.BaseCurrency, userID)
+		if err != nil {
+			return fmt.Errorf("failed to restore base currency: %v", err)
+		}
+	}
+
+	stores, err := restoreNamedEntities(tx, "store", userID, backup.Stores, merge)
+	if err != nil {
+		return err
+	}
+	items, err := restoreNamedEntities(tx, "item", userID, backup.Items, merge)
+	if err != nil {
+		return err
+	}
+	labels, err := restoreNamedEntities(tx, "label", userID, backup.Labels, merge)
+	if err != nil {
+		return err
+	}
+
+	providers := make(backupIDMap, len(backup.MoneyProviders))
+	for _, provider := range backup.MoneyProviders {
+		var id string
+		err := tx.QueryRow(`INSERT INTO money_provider (name, creator_id, balance, currency) VALUES ($1, $2, $3, $4) RETURNING id`,
+			provider.Name, userID, provider.Balance, provider.Currency).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("failed to restore money provider %s: %v", provider.Name, err)
+		}
+		if err := insertBalanceSnapshot(tx, id, provider.Balance); err != nil {
+			return err
+		}
+		providers[provider.ID] = id
+	}
+
+	groups := make(backupIDMap, len(backup.UserGroups))
+	for _, group := range backup.UserGroups {
+		var id string
+		err := tx.QueryRow(`INSERT INTO user_groups (name, creator_id) VALUES ($1, $2) RETURNING id`, group.Name, userID).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("failed to restore user group %s: %v", group.Name, err)
+		}
+		groups[group.ID] = id
+	}
+	for _, member := range backup.UserGroupMembers {
+		groupID, err := groups.get("user group", member.GroupID)
+		if err != nil {
+			return err
+		}
+		memberID := member.UserID
+		if memberID == backup.UserID {
+			memberID = userID
+		}
+		_, err = tx.Exec(`INSERT INTO user_group_membership (group_id, user_id)
+				  SELECT $1::bigint, $2::bigint WHERE EXISTS (SELECT 1 FROM users WHERE id = $2::bigint)
+				  ON CONFLICT DO NOTHING`, groupID, memberID)
+		if err != nil {
+			return fmt.Errorf("failed to restore member %s of user group %s: %v", memberID, groupID, err)
+		}
+	}
+
+	pools := make(backupIDMap, len(backup.MoneyPools))
+	for _, pool := range backup.MoneyPools {
+		providerID, err := providers.getOptional("money provider", pool.MoneyProviderID)
+		if err != nil {
+			return err
+		}
+		var id string
+		err = tx.QueryRow(`INSERT INTO money_pool (name, description, type, owner_id, emoji, currency, is_deleted, deleted_at,
+				  money_provider_id, budget_amount, budget_period, budget_rollover, budget_start_date)
+				  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id`,
+			pool.Name, pool.Description, pool.Type, userID, pool.Emoji, pool.Currency, pool.IsDeleted, pool.DeletedAt,
+			providerID, pool.BudgetAmount, pool.BudgetPeriod, pool.BudgetRollover, pool.BudgetStartDate).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("failed to restore money pool %s: %v", pool.Name, err)
+		}
+		pools[pool.ID] = id
+	}
+	for _, scope := range backup.PublicationScopes {
+		poolID, err := pools.get("money pool", scope.MoneyPoolID)
+		if err != nil {
+			return err
+		}
+		groupID, err := groups.get("user group", scope.GroupID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO restricted_publication_scope (pool_id, group_id) VALUES ($1, $2)`, poolID, groupID)
+		if err != nil {
+			return fmt.Errorf("failed to restore publication scope of money pool %s: %v", poolID, err)
+		}
+	}
+
+	rules := make(backupIDMap, len(backup.RecurringPayments))
+	for _, rule := range backup.RecurringPayments {
+		poolID, err := pools.get("money pool", rule.MoneyPoolID)
+		if err != nil {
+			return err
+		}
+		storeID, err := stores.getOptional("store", rule.StoreID)
+		if err != nil {
+			return err
+		}
+		var id string
+		err = tx.QueryRow(`INSERT INTO recurring_payment (money_pool_id, creator_id, title, amount, description, store_id, frequency, interval_count,
+				  weekday, nth_week, start_date, end_date, occurrence_count, is_paused, generated_until)
+				  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING id`,
+			poolID, userID, rule.Title, rule.Amount, rule.Description, storeID, rule.Frequency, rule.IntervalCount,
+			rule.Weekday, rule.NthWeek, rule.StartDate, rule.EndDate, rule.OccurrenceCount, rule.IsPaused, rule.GeneratedUntil).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("failed to restore recurring payment %s: %v", rule.Title, err)
+		}
+		rules[rule.ID] = id
+	}
+
+	transfers := make(backupIDMap, len(backup.Transfers))
+	for _, transfer := range backup.Transfers {
+		var id string
+		err := tx.QueryRow(`INSERT INTO transfer (creator_id, date, title, description, is_planned) VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+			userID, transfer.Date, transfer.Title, transfer.Description, transfer.IsPlanned).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("failed to restore transfer %s: %v", transfer.Title, err)
+		}
+		transfers[transfer.ID] = id
+	}
+
+	payments := make(backupIDMap, len(backup.Payments))
+	for _, payment := range backup.Payments {
+		poolID, err := pools.get("money pool", payment.MoneyPoolID)
+		if err != nil {
+			return err
+		}
+		storeID, err := stores.getOptional("store", payment.StoreID)
+		if err != nil {
+			return err
+		}
+		ruleID, err := rules.getOptional("recurring payment", payment.RecurringPaymentID)
+		if err != nil {
+			return err
+		}
+		transferID, err := transfers.getOptional("transfer", payment.TransferID)
+		if err != nil {
+			return err
+		}
+		var id string
+		err = tx.QueryRow(`INSERT INTO payment (money_pool_id, date, title, amount, description, is_planned, store_id,
+				  recurring_payment_id, transfer_id, planned_date, planned_amount)
+				  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`,
+			poolID, payment.Date, payment.Title, payment.Amount, payment.Description, payment.IsPlanned, storeID,
+			ruleID, transferID, payment.PlannedDate, payment.PlannedAmount).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("failed to restore payment %s: %v", payment.Title, err)
+		}
+		payments[payment.ID] = id
+	}
+	for _, item := range backup.PaymentItems {
+		paymentID, err := payments.get("payment", item.PaymentID)
+		if err != nil {
+			return err
+		}
+		itemID, err := items.get("item", item.ItemID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO item_payment (payment_id, item_id, quantity, unit_price) VALUES ($1, $2, $3, $4)`,
+			paymentID, itemID, item.Quantity, item.UnitPrice)
+		if err != nil {
+			return fmt.Errorf("failed to restore item of payment %s: %v", paymentID, err)
+		}
+	}
+	for _, label := range backup.PaymentLabels {
+		paymentID, err := payments.get("payment", label.PaymentID)
+		if err != nil {
+			return err
+		}
+		labelID, err := labels.get("label", label.LabelID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO payment_label (payment_id, label_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, paymentID, labelID)
+		if err != nil {
+			return fmt.Errorf("failed to restore label of payment %s: %v", paymentID, err)
+		}
+	}
+
+	for _, rate := range backup.ExchangeRates {
+		_, err := tx.Exec(`INSERT INTO exchange_rate (creator_id, from_currency, to_currency, rate, valid_from) VALUES ($1, $2, $3, $4, $5)
+				  ON CONFLICT (creator_id, from_currency, to_currency, valid_from) DO NOTHING`,
+			userID, rate.FromCurrency, rate.ToCurrency, rate.Rate, rate.ValidFrom)
+		if err != nil {
+			return fmt.Errorf("failed to restore exchange rate %s/%s: %v", rate.FromCurrency, rate.ToCurrency, err)
+		}
+	}
+	return nil
+}
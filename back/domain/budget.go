@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// BudgetPeriodRange returns the first and last day of the budget period containing date.
+// Weeks start on Monday, months and years are calendar months and years.
+func BudgetPeriodRange(period string, date time.Time) (time.Time, time.Time) {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	switch period {
+	case BudgetPeriodWeekly:
+		start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 6)
+	case BudgetPeriodYearly:
+		start := time.Date(day.Year(), 1, 1, 0, 0, 0, 0, day.Location())
+		return start, start.AddDate(1, 0, -1)
+	default:
+		start := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+		return start, start.AddDate(0, 1, -1)
+	}
+}
+
+// SetMoneyPoolBudget writes the budget columns of a money pool. A nil BudgetAmount removes the budget.
+func (d *dbImpl) SetMoneyPoolBudget(moneyPool MoneyPool, audit Audit[MoneyPool]) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	query := `UPDATE money_pool SET budget_amount = $1, budget_period = $2, budget_rollover = $3, budget_start_date = $4, version = version + 1
+			  WHERE id = $5 AND is_deleted = false`
+	result, err := tx.Exec(query, moneyPool.BudgetAmount, moneyPool.BudgetPeriod, moneyPool.BudgetRollover, moneyPool.BudgetStartDate, moneyPool.ID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not set budget of money pool: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not determine rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		tx.Rollback()
+		return fmt.Errorf("no rows affected, perhaps the money pool with id %s does not exist", moneyPool.ID)
+	}
+
+	err = writeAudit(tx, audit, moneyPool)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetMoneyPoolDailySpending sums up the expenses (negative payments, as positive amounts) of a money pool per day
+// between from and to (inclusive). Transfers to other pools are not spending and are not counted.
+func (d *dbImpl) GetMoneyPoolDailySpending(moneyPoolID string, from time.Time, to time.Time, planned bool) ([]DailyTotal, error) {
+	query := `SELECT date, -SUM(amount) AS amount FROM payment
+			  WHERE money_pool_id = $1 AND date >= $2 AND date <= $3 AND is_planned = $4 AND amount < 0 AND transfer_id IS NULL
+			  GROUP BY date ORDER BY date`
+	var totals []DailyTotal
+	err := d.db.Select(&totals, query, moneyPoolID, from, to, planned)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching spending of money pool %s: %v", moneyPoolID, err)
+	}
+	return totals, nil
+}
@@ -4,8 +4,8 @@ import "time"
 
 // getMoneyPoolBalanceInternal is a helper function that constructs the SQL query for retrieving the money pool balance.
 // It is used to avoid repetition in public methods.
-func (d *dbImpl) getMoneyPoolBalanceInternal(moneyPoolID string, date *time.Time, includePlanned bool) (float64, error) {
-	var balance float64
+func (d *dbImpl) getMoneyPoolBalanceInternal(moneyPoolID string, date *time.Time, includePlanned bool) (Money, error) {
+	var balance Money
 	query := `SELECT COALESCE(SUM(amount), 0) FROM payment WHERE money_pool_id = $1`
 	args := []interface{}{moneyPoolID}
 
@@ -22,20 +22,47 @@ func (d *dbImpl) getMoneyPoolBalanceInternal(moneyPoolID string, date *time.Time
 
 	err := d.db.Get(&balance, query, args...)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 
 	return balance, nil
 }
 
+// GetMoneyPoolDailyTotals sums up the payments of a money pool per day up to date (or all days if date is nil).
+// It is used to convert the balance of a pool into another currency with the rate of each day.
+// If excludeTransfers is true, the legs of transfers between money pools are not counted.
+func (d *dbImpl) GetMoneyPoolDailyTotals(moneyPoolID string, date *time.Time, includePlanned bool, excludeTransfers bool) ([]DailyTotal, error) {
+	query := `SELECT date, SUM(amount) AS amount FROM payment WHERE money_pool_id = $1`
+	args := []interface{}{moneyPoolID}
+
+	if date != nil {
+		query += ` AND date <= $2`
+		args = append(args, *date)
+	}
+	if !includePlanned {
+		query += ` AND is_planned = false`
+	}
+	if excludeTransfers {
+		query += ` AND transfer_id IS NULL`
+	}
+	query += ` GROUP BY date ORDER BY date`
+
+	var totals []DailyTotal
+	err := d.db.Select(&totals, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
+
 // GetMoneyPoolBalance calculates the total amount of payments associated with the specified moneyPoolID.
 // If includePlanned is true, it includes the planned payments in the calculation.
-func (d *dbImpl) GetMoneyPoolBalance(moneyPoolID string, includePlanned bool) (float64, error) {
+func (d *dbImpl) GetMoneyPoolBalance(moneyPoolID string, includePlanned bool) (Money, error) {
 	return d.getMoneyPoolBalanceInternal(moneyPoolID, nil, includePlanned)
 }
 
 // GetMoneyPoolBalanceOfDate calculates the total amount of payments for a moneyPoolID up to a certain date.
 // If includePlanned is true, it includes the planned payments in the calculation.
-func (d *dbImpl) GetMoneyPoolBalanceOfDate(moneyPoolID string, date time.Time, includePlanned bool) (float64, error) {
+func (d *dbImpl) GetMoneyPoolBalanceOfDate(moneyPoolID string, date time.Time, includePlanned bool) (Money, error) {
 	return d.getMoneyPoolBalanceInternal(moneyPoolID, &date, includePlanned)
 }
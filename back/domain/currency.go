@@ -0,0 +1,142 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// DefaultCurrency は通貨が指定されていない場合の通貨です。既存のデータはすべて円として扱います。
+const DefaultCurrency = "JPY"
+
+// RateScale はDBの DECIMAL(24,10) に合わせた為替レートの小数点以下の桁数です。
+const RateScale = 10
+
+// IsValidCurrencyCode reports whether code looks like an ISO 4217 currency code such as "JPY" or "USD".
+func IsValidCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizeCurrencyCode upper-cases code and falls back to DefaultCurrency if it is empty.
+func NormalizeCurrencyCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return DefaultCurrency
+	}
+	return code
+}
+
+// Rate is an exact exchange rate with RateScale fractional digits.
+// Like Money it is written to JSON as a decimal string.
+type Rate struct {
+	units int64
+}
+
+// ParseRate parses a positive decimal string such as "149.85".
+func ParseRate(s string) (Rate, error) {
+	units, err := parseFixed(s, RateScale)
+	if err != nil {
+		return Rate{}, err
+	}
+	if units <= 0 {
+		return Rate{}, fmt.Errorf("exchange rate %q must be positive", s)
+	}
+	return Rate{units: units}, nil
+}
+
+func (r Rate) IsZero() bool { return r.units == 0 }
+
+func (r Rate) String() string {
+	return formatFixed(r.units, RateScale)
+}
+
+func (r Rate) Value() (driver.Value, error) {
+	return r.String(), nil
+}
+
+func (r *Rate) Scan(value interface{}) error {
+	var str string
+	switch v := value.(type) {
+	case []byte:
+		str = string(v)
+	case string:
+		str = v
+	default:
+		return fmt.Errorf("cannot scan %T into Rate", value)
+	}
+	parsed, err := ParseRate(str)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	str := string(data)
+	if strings.HasPrefix(str, `"`) {
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+	}
+	parsed, err := ParseRate(str)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// Convert multiplies the amount by the rate, rounding half away from zero to MoneyScale digits.
+// It returns ErrMoneyOverflow if the converted amount is out of range.
+func (m Money) Convert(rate Rate) (Money, error) {
+	num := new(big.Int).Mul(big.NewInt(m.units), big.NewInt(rate.units))
+	units, ok := divRound(num, big.NewInt(pow10(RateScale)))
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %s * %s", ErrMoneyOverflow, m, rate)
+	}
+	return Money{units: units}, nil
+}
+
+// ConvertInverse divides the amount by the rate, i.e. converts with the rate of the opposite direction.
+// It returns ErrMoneyOverflow if the converted amount is out of range.
+func (m Money) ConvertInverse(rate Rate) (Money, error) {
+	num := new(big.Int).Mul(big.NewInt(m.units), big.NewInt(pow10(RateScale)))
+	units, ok := divRound(num, big.NewInt(rate.units))
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %s / %s", ErrMoneyOverflow, m, rate)
+	}
+	return Money{units: units}, nil
+}
+
+// divRound divides num by den (den > 0), rounding half away from zero.
+// ok is false if the quotient does not fit in an int64.
+func divRound(num *big.Int, den *big.Int) (quotient int64, ok bool) {
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	// |rem| * 2 >= den なら絶対値の大きい方に丸める
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	if !quo.IsInt64() {
+		return 0, false
+	}
+	return quo.Int64(), true
+}
@@ -1,11 +1,18 @@
 package domain
 
 import (
+	"errors"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
+// ErrNotFound は指定されたIDの行がない場合に返されます。
+var ErrNotFound = errors.New("not found")
+
+// ErrVersionConflict は更新しようとした行が、読み込んだ後に他の更新で変わっていた場合に返されます。
+var ErrVersionConflict = errors.New("version conflict")
+
 type dbImpl struct {
 	db *sqlx.DB
 }
@@ -17,48 +24,125 @@ func NewDB(db *sqlx.DB) DB {
 	}
 }
 
+// DB is the persistence of the domain.
+// The methods that take an audit record the audit logs it builds in the same transaction as the change.
 type DB interface {
 	NewUser(user User) (User, error)
 	GetUser(id string) (User, error)
-	UpdateUser(user User) error
+	UpdateUser(user User) error            // 基準通貨とユーザーが編集できるプロフィールを更新する
+	UpdateUserClaims(user User) error      // OIDCのクレームから取得したプロフィールを更新する
+	GetUsers(ids []string) ([]User, error) // 存在しないIDは無視する
+	GetUserByEmail(email string) (User, error)
+	GetUserByHandle(handle string) (User, error)
 
-	NewMoneyPool(moneyPool MoneyPool) (MoneyPool, error)
+	NewMoneyPool(moneyPool MoneyPool, audit Audit[MoneyPool]) (MoneyPool, error)
 	GetMoneyPool(id string) (MoneyPool, error)
 	GetMoneyPoolsByUserID(userID string) ([]MoneyPool, error)
-	UpdateMoneyPool(moneyPool MoneyPool) error
-	DeleteMoneyPool(id string) error
-	ShareMoneyPoolWithUserGroups(id string, shareUserGruopIDs []string) error
+	GetMoneyPoolsSharedWithUser(userID string) ([]MoneyPool, error) // 他のユーザーのrestrictedなマネープールのうち、ユーザーのグループに公開されているもの
+	UpdateMoneyPool(moneyPool MoneyPool, audit Audit[MoneyPool]) error
+	DeleteMoneyPool(id string, audit Audit[string]) error // ゴミ箱に移す（is_deletedを立てる）
+	GetDeletedMoneyPoolsByUserID(userID string) ([]MoneyPool, error)
+	GetDeletedMoneyPool(id string) (MoneyPool, error)
+	GetMoneyPoolIDsDeletedBefore(date time.Time) ([]string, error)
+	RestoreMoneyPool(id string, audit Audit[string]) error // ゴミ箱から戻す
+	PurgeMoneyPool(id string, audit Audit[string]) error   // ゴミ箱のマネープールを支払いなどと一緒に完全に削除する
+	ShareMoneyPoolWithUserGroups(id string, shareUserGruopIDs []string, audit Audit[string]) error
 	IsMoneyPoolSharedWithUser(id string, userID string) (bool, error)
+	GetMoneyPoolPublicationScope(id string) ([]UserGroup, error)
+	GetMoneyPoolPaymentStats(id string) (PaymentStats, error)
 
-	NewMoneyProvider(moneyProvider MoneyProvider) (MoneyProvider, error)
+	SetMoneyPoolProvider(moneyPoolID string, moneyProviderID *string, audit Audit[string]) error // マネープールをマネープロバイダーに割り当てる（nilで割り当て解除）
+
+	NewMoneyProvider(moneyProvider MoneyProvider, audit Audit[MoneyProvider]) (MoneyProvider, error)
 	GetMoneyProvider(id string) (MoneyProvider, error)
 	GetMoneyProvidersByUserID(userID string) ([]MoneyProvider, error)
-	UpdateMoneyProvider(moneyProvider MoneyProvider) error
-	DeleteMoneyProvider(id string) error
+	UpdateMoneyProvider(moneyProvider MoneyProvider, audit Audit[MoneyProvider]) error
+	DeleteMoneyProvider(id string, audit Audit[string]) error
+	GetMoneyProviderBalanceHistory(moneyProviderID string, from time.Time, to time.Time) ([]MoneyProviderBalanceSnapshot, error)
+	GetMoneyProviderBalanceAt(moneyProviderID string, at time.Time) (Money, error) // at の直前の残高
 
 	NewStore(store Store) (Store, error)
 	GetStore(id string) (Store, error)
 	GetStoresByUserID(userID string) ([]Store, error)
 	UpdateStore(store Store) error
+	DeleteStore(id string) error
 
 	NewItem(item Item) (Item, error)
 	GetItem(id string) (Item, error)
 	GetItemsByUserID(userID string) ([]Item, error)
+	GetItemByName(userID string, name string) (Item, error)
 	UpdateItem(item Item) error
 
-	NewPayment(payment Payment) (Payment, error)
+	NewLabel(label Label) (Label, error)
+	GetLabel(id string) (Label, error)
+	GetLabelsByUserID(userID string) ([]Label, error)
+	UpdateLabel(label Label) error
+	DeleteLabel(id string) error
+	GetPaymentLabels(paymentID string) ([]PaymentLabel, error)
+	GetPaymentLabelsByPaymentIDs(paymentIDs []string) ([]PaymentLabel, error)
+	GetLabelTotals(userID string, from time.Time, to time.Time, includePlanned bool) ([]LabelTotal, error) // ラベルごとの期間内の取引金額の合計
+
+	GetPaymentItems(paymentID string) ([]ItemPayment, error)
+	GetPaymentItemsByPaymentIDs(paymentIDs []string) ([]ItemPayment, error)
+
+	NewPayment(payment Payment, audit Audit[Payment]) (Payment, error)
+	NewPayments(payments []Payment, audit Audit[Payment]) ([]Payment, error) // 明細・ラベルのない支払いを1つのトランザクションでまとめて作成する
 	GetPayment(id string) (Payment, error)
-	GetPaymentsByMoneyPoolID(moneyPoolID string) ([]Payment, error)
-	UpdatePayment(payment Payment) error
-	DeletePayment(id string) error
+	GetPayments(filter PaymentFilter) ([]Payment, error)                     // 絞り込み・並び替え・ページングした支払い一覧
+	GetPaymentDailyTotals(filter PaymentFilter) ([]PaymentDailyTotal, error) // 絞り込んだ支払いのマネープールごと・日ごとの合計。ページングは無視する
+	UpdatePayment(payment Payment, audit Audit[Payment]) error
+	GetOverduePlannedPayments(userID string, before time.Time) ([]Payment, error) // beforeより前の日付のまま実績になっていない予定の支払い
+	DeletePayment(id string, audit Audit[string]) error
+
+	SearchPayments(loginUserID string, terms []string, from *time.Time, to *time.Time, limit int) ([]SearchPaymentResult, error) // 閲覧できるマネープールの支払いを検索する
+	SearchMoneyPools(loginUserID string, terms []string, limit int) ([]MoneyPool, error)
+	SearchStores(userID string, terms []string, limit int) ([]Store, error)
+
+	NewTransfer(transfer Transfer, audit Audit[Transfer]) (Transfer, error) // 振替と両方のレッグを1つのトランザクションで作成する
+	GetTransfer(id string) (Transfer, error)
+	GetTransfersByUserID(userID string) ([]Transfer, error)
+	UpdateTransfer(transfer Transfer, audit Audit[Transfer]) error
+	DeleteTransfer(id string, audit Audit[string]) error
 
-	GetMoneyPoolBalance(moneyPoolID string, includeExpceted bool) (float64, error)                       // transactionからマネープールの残高を計算する
-	GetMoneyPoolBalanceOfDate(moneyPoolID string, date time.Time, includeExpceted bool) (float64, error) // transactionからマネープールの残高を計算する（ある日までの）
+	SetMoneyPoolBudget(moneyPool MoneyPool, audit Audit[MoneyPool]) error                                           // 予算の列だけを更新する
+	GetMoneyPoolDailySpending(moneyPoolID string, from time.Time, to time.Time, planned bool) ([]DailyTotal, error) // 日ごとの支出（振替を除く）
 
-	NewUserGroup(userGroup UserGroup) (UserGroup, error)
+	GetMoneyPoolBalance(moneyPoolID string, includeExpceted bool) (Money, error)                                                   // transactionからマネープールの残高を計算する
+	GetMoneyPoolBalanceOfDate(moneyPoolID string, date time.Time, includeExpceted bool) (Money, error)                             // transactionからマネープールの残高を計算する（ある日までの）
+	GetMoneyPoolDailyTotals(moneyPoolID string, date *time.Time, includePlanned bool, excludeTransfers bool) ([]DailyTotal, error) // 日ごとの取引金額の合計（通貨換算用）
+
+	NewRecurringPayment(rule RecurringPayment, until time.Time, audit RecurringPaymentAudit) (RecurringPayment, error) // untilまでの予定の支払いも作成する
+	GetRecurringPayment(id string) (RecurringPayment, error)
+	GetRecurringPaymentsByUserID(userID string) ([]RecurringPayment, error)
+	GetActiveRecurringPaymentIDs() ([]string, error)
+	UpdateRecurringPayment(rule RecurringPayment, from time.Time, until time.Time, audit RecurringPaymentAudit) error // from以降の予定の支払いは削除され、untilまで再生成される
+	DeleteRecurringPayment(id string, from time.Time, audit RecurringPaymentAudit) error                              // from以降の予定の支払いも削除する
+	GenerateRecurringPayments(id string, until time.Time, audit RecurringPaymentAudit) (int, error)                   // untilまでの未作成の発生分を予定の支払いとして作成する
+
+	NewExchangeRates(rates []ExchangeRate) ([]ExchangeRate, error)
+	GetExchangeRate(id string) (ExchangeRate, error)
+	GetExchangeRatesByUserID(userID string) ([]ExchangeRate, error)
+	DeleteExchangeRate(id string) error
+
+	NewReconciliation(reconciliation Reconciliation) (Reconciliation, error)
+	GetReconciliationsByUserID(userID string) ([]Reconciliation, error)
+
+	NewUserGroup(userGroup UserGroup, memberIDs []string, audit Audit[UserGroup]) (UserGroup, error)
 	GetUserGroups(userID string) ([]UserGroup, error)
 	GetUserGroup(id string) (UserGroup, error)
 	GetUserGroupMembers(id string) ([]User, error)
-	UpdateUserGroup(id string, name string, memberIDs []string) (UserGroup, error)
-	DeleteUserGroup(id string) error
+	UpdateUserGroup(id string, name string, memberIDs []string, audit Audit[string]) (UserGroup, error)
+	DeleteUserGroup(id string, audit Audit[string]) error
+
+	GetAuditLogs(filter AuditLogFilter) ([]AuditLog, error) // 新しい順
+
+	NewAPIToken(token APIToken) (APIToken, error)
+	GetAPITokensByUserID(userID string) ([]APIToken, error) // 失効したものも含めて新しい順
+	GetAPITokenByHash(tokenHash string) (APIToken, error)
+	RevokeAPIToken(id string, userID string, revokedAt time.Time) error
+	TouchAPIToken(id string, usedAt time.Time) error // 最終利用日時を更新する
+
+	GetBackup(userID string) (Backup, error)                      // ユーザーが所有するデータ一式を読み込む（削除済みのマネープールも含む）
+	HasUserData(userID string) (bool, error)                      // マネープールなどを1つでも所有しているか
+	RestoreBackup(userID string, backup Backup, merge bool) error // IDを振り直してバックアップを1つのトランザクションで復元する
 }
@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// NewExchangeRates stores exchange rates in a single transaction.
+// A rate for the same currency pair and date replaces the existing one.
+func (d *dbImpl) NewExchangeRates(rates []ExchangeRate) ([]ExchangeRate, error) {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	query := `INSERT INTO exchange_rate (creator_id, from_currency, to_currency, rate, valid_from)
+			  VALUES ($1, $2, $3, $4, $5)
+			  ON CONFLICT (creator_id, from_currency, to_currency, valid_from) DO UPDATE SET rate = EXCLUDED.rate
+			  RETURNING id`
+	created := make([]ExchangeRate, 0, len(rates))
+	for _, rate := range rates {
+		err := tx.QueryRow(query, rate.CreatorID, rate.FromCurrency, rate.ToCurrency, rate.Rate, rate.ValidFrom).Scan(&rate.ID)
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to store exchange rate %s/%s of %s: %v", rate.FromCurrency, rate.ToCurrency, rate.ValidFrom.Format("2006-01-02"), err)
+		}
+		created = append(created, rate)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit exchange rates: %v", err)
+	}
+	return created, nil
+}
+
+// GetExchangeRate retrieves a single exchange rate by its ID.
+func (d *dbImpl) GetExchangeRate(id string) (ExchangeRate, error) {
+	var rate ExchangeRate
+	query := `SELECT id, creator_id, from_currency, to_currency, rate, valid_from FROM exchange_rate WHERE id = $1`
+	err := d.db.Get(&rate, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ExchangeRate{}, fmt.Errorf("%w: exchange rate %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return ExchangeRate{}, fmt.Errorf("error fetching exchange rate: %v", err)
+	}
+	return rate, nil
+}
+
+// GetExchangeRatesByUserID retrieves all exchange rates registered by a specific user, oldest first.
+func (d *dbImpl) GetExchangeRatesByUserID(userID string) ([]ExchangeRate, error) {
+	var rates []ExchangeRate
+	query := `SELECT id, creator_id, from_currency, to_currency, rate, valid_from FROM exchange_rate
+			  WHERE creator_id = $1
+			  ORDER BY from_currency, to_currency, valid_from`
+	err := d.db.Select(&rates, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching exchange rates: %v", err)
+	}
+	return rates, nil
+}
+
+func (d *dbImpl) DeleteExchangeRate(id string) error {
+	result, err := d.db.Exec(`DELETE FROM exchange_rate WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("could not delete exchange rate: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not determine rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no rows affected, perhaps the exchange rate with id %s does not exist", id)
+	}
+	return nil
+}
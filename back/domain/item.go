@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"database/sql"
 	"fmt"
 
 	"github.com/pkg/errors"
@@ -24,6 +25,9 @@ func (d *dbImpl) NewItem(item Item) (Item, error) {
 func (d *dbImpl) GetItem(id string) (Item, error) {
 	var item Item
 	err := d.db.Get(&item, "SELECT * FROM item WHERE id = $1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Item{}, fmt.Errorf("%w: item %s", ErrNotFound, id)
+	}
 	if err != nil {
 		return Item{}, fmt.Errorf("error fetching item: %v", err)
 	}
@@ -40,6 +44,19 @@ func (d *dbImpl) GetItemsByUserID(userID string) ([]Item, error) {
 	return items, nil
 }
 
+// GetItemByName retrieves an item created by a specific user by its name.
+func (d *dbImpl) GetItemByName(userID string, name string) (Item, error) {
+	var item Item
+	err := d.db.Get(&item, "SELECT * FROM item WHERE creator_id = $1 AND name = $2 ORDER BY id LIMIT 1", userID, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Item{}, fmt.Errorf("%w: item %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return Item{}, fmt.Errorf("error fetching item by name: %v", err)
+	}
+	return item, nil
+}
+
 // UpdateItem updates an existing item.
 func (d *dbImpl) UpdateItem(item Item) error {
 	// Use positional parameters with $1, $2, etc.
@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// insertPaymentItems inserts the line items of a payment within the given transaction.
+// Items without an ItemID are new items named ItemName. They are created in the same transaction for the owner of the payment's
+// money pool, and their IDs are set in items.
+func insertPaymentItems(tx *sqlx.Tx, paymentID string, items []ItemPayment) error {
+	newItemQuery := `INSERT INTO item (name, creator_id)
+					 SELECT $1, mp.owner_id FROM payment p JOIN money_pool mp ON mp.id = p.money_pool_id WHERE p.id = $2
+					 RETURNING id`
+	query := `INSERT INTO item_payment (payment_id, item_id, quantity, unit_price) VALUES ($1, $2, $3, $4)`
+	for i := range items {
+		item := &items[i]
+		if item.ItemID == "" {
+			if err := tx.QueryRow(newItemQuery, item.ItemName, paymentID).Scan(&item.ItemID); err != nil {
+				return fmt.Errorf("failed to create item %s for payment %s: %v", item.ItemName, paymentID, err)
+			}
+		}
+		_, err := tx.Exec(query, paymentID, item.ItemID, item.Quantity, item.UnitPrice)
+		if err != nil {
+			return fmt.Errorf("failed to add item %s to payment %s: %v", item.ItemID, paymentID, err)
+		}
+	}
+	return nil
+}
+
+// GetPaymentItems retrieves the line items of a payment together with the item names.
+func (d *dbImpl) GetPaymentItems(paymentID string) ([]ItemPayment, error) {
+	var items []ItemPayment
+	query := `SELECT ip.payment_id, ip.item_id, i.name AS item_name, ip.quantity, ip.unit_price
+			  FROM item_payment ip
+			  JOIN item i ON i.id = ip.item_id
+			  WHERE ip.payment_id = $1
+			  ORDER BY i.name`
+	err := d.db.Select(&items, query, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching items of payment %s: %v", paymentID, err)
+	}
+	return items, nil
+}
+
+// GetPaymentItemsByPaymentIDs retrieves the line items of the given payments at once.
+func (d *dbImpl) GetPaymentItemsByPaymentIDs(paymentIDs []string) ([]ItemPayment, error) {
+	var items []ItemPayment
+	query := `SELECT ip.payment_id, ip.item_id, i.name AS item_name, ip.quantity, ip.unit_price
+			  FROM item_payment ip
+			  JOIN item i ON i.id = ip.item_id
+			  WHERE ip.payment_id = ANY($1::bigint[])
+			  ORDER BY i.name`
+	err := d.db.Select(&items, query, pq.Array(paymentIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching payment items: %v", err)
+	}
+	return items, nil
+}
@@ -0,0 +1,142 @@
+package domain
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+func (d *dbImpl) NewLabel(label Label) (Label, error) {
+	query := `INSERT INTO label (name, creator_id)
+			  VALUES ($1, $2)
+			  RETURNING id`
+	err := d.db.QueryRow(query, label.Name, label.CreatorID).Scan(&label.ID)
+	if err != nil {
+		return Label{}, fmt.Errorf("failed to create new Label: %v", err)
+	}
+	return label, nil
+}
+
+// GetLabel retrieves a single label by its ID.
+func (d *dbImpl) GetLabel(id string) (Label, error) {
+	var label Label
+	query := `SELECT id, name, creator_id FROM label WHERE id = $1`
+	err := d.db.Get(&label, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Label{}, fmt.Errorf("%w: label %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return Label{}, fmt.Errorf("error fetching label: %v", err)
+	}
+	return label, nil
+}
+
+// GetLabelsByUserID retrieves all labels created by a specific user.
+func (d *dbImpl) GetLabelsByUserID(userID string) ([]Label, error) {
+	var labels []Label
+	query := `SELECT id, name, creator_id FROM label WHERE creator_id = $1 ORDER BY name`
+	err := d.db.Select(&labels, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching labels: %v", err)
+	}
+	return labels, nil
+}
+
+// UpdateLabel updates an existing label's details.
+func (d *dbImpl) UpdateLabel(label Label) error {
+	query := `UPDATE label SET name = $1 WHERE id = $2`
+	_, err := d.db.Exec(query, label.Name, label.ID)
+	if err != nil {
+		return fmt.Errorf("error updating label: %v", err)
+	}
+	return nil
+}
+
+// DeleteLabel deletes a label. The label is removed from all payments by the cascading foreign key.
+func (d *dbImpl) DeleteLabel(id string) error {
+	result, err := d.db.Exec(`DELETE FROM label WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("could not delete label: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not determine rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no rows affected, perhaps the label with id %s does not exist", id)
+	}
+	return nil
+}
+
+// insertPaymentLabels attaches labels to a payment within the given transaction.
+func insertPaymentLabels(tx *sqlx.Tx, paymentID string, labelIDs []string) error {
+	query := `INSERT INTO payment_label (payment_id, label_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	for _, labelID := range labelIDs {
+		_, err := tx.Exec(query, paymentID, labelID)
+		if err != nil {
+			return fmt.Errorf("failed to add label %s to payment %s: %v", labelID, paymentID, err)
+		}
+	}
+	return nil
+}
+
+// GetPaymentLabels retrieves the labels attached to a payment.
+func (d *dbImpl) GetPaymentLabels(paymentID string) ([]PaymentLabel, error) {
+	var labels []PaymentLabel
+	query := `SELECT pl.payment_id, pl.label_id, l.name AS label_name
+			  FROM payment_label pl
+			  JOIN label l ON l.id = pl.label_id
+			  WHERE pl.payment_id = $1
+			  ORDER BY l.name`
+	err := d.db.Select(&labels, query, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching labels of payment %s: %v", paymentID, err)
+	}
+	return labels, nil
+}
+
+// GetPaymentLabelsByPaymentIDs retrieves the labels of the given payments at once.
+func (d *dbImpl) GetPaymentLabelsByPaymentIDs(paymentIDs []string) ([]PaymentLabel, error) {
+	var labels []PaymentLabel
+	query := `SELECT pl.payment_id, pl.label_id, l.name AS label_name
+			  FROM payment_label pl
+			  JOIN label l ON l.id = pl.label_id
+			  WHERE pl.payment_id = ANY($1::bigint[])
+			  ORDER BY l.name`
+	err := d.db.Select(&labels, query, pq.Array(paymentIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching payment labels: %v", err)
+	}
+	return labels, nil
+}
+
+// GetLabelTotals sums up the payments of each label of the user between from and to (inclusive).
+// Only payments in money pools that have not been deleted are counted.
+func (d *dbImpl) GetLabelTotals(userID string, from time.Time, to time.Time, includePlanned bool) ([]LabelTotal, error) {
+	plannedCondition := ""
+	if !includePlanned {
+		plannedCondition = " AND p.is_planned = false"
+	}
+
+	var totals []LabelTotal
+	query := `SELECT l.id AS label_id, l.name AS label_name, COALESCE(SUM(p.amount), 0) AS total, COUNT(p.id) AS payment_count
+			  FROM label l
+			  LEFT JOIN (
+				  payment_label pl
+				  JOIN payment p ON p.id = pl.payment_id AND p.date >= $2 AND p.date <= $3` + plannedCondition + `
+				  JOIN money_pool mp ON mp.id = p.money_pool_id AND mp.is_deleted = false
+			  ) ON pl.label_id = l.id
+			  WHERE l.creator_id = $1
+			  GROUP BY l.id, l.name
+			  ORDER BY l.name`
+	err := d.db.Select(&totals, query, userID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("error calculating label totals: %v", err)
+	}
+	return totals, nil
+}
@@ -0,0 +1,262 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MoneyScale はDBの DECIMAL(19,4) に合わせた小数点以下の桁数です。
+const MoneyScale = 4
+
+const moneyUnit = 10000 // 10^MoneyScale
+
+// ErrMoneyOverflow は計算結果の金額がMoneyで表せる範囲を超えた場合に返されます。
+var ErrMoneyOverflow = errors.New("amount of money is out of range")
+
+// Money is an exact decimal amount of money with MoneyScale fractional digits.
+// It is stored as an integer number of 1/10000 units so that sums never drift.
+// In JSON it is written as a decimal string such as "-1234.5" and read from either a string or a number.
+type Money struct {
+	units int64
+}
+
+// NewMoneyFromInt returns a Money of a whole amount, e.g. yen. v must be within ±922337203685477.
+func NewMoneyFromInt(v int64) Money {
+	return Money{units: v * moneyUnit}
+}
+
+// ParseMoney parses a decimal string such as "1234", "-12.5" or "0.0001".
+// More than MoneyScale fractional digits are rejected instead of being rounded.
+func ParseMoney(s string) (Money, error) {
+	units, err := parseFixed(s, MoneyScale)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{units: units}, nil
+}
+
+// parseFixed parses a decimal string into an integer number of 10^-scale units.
+func parseFixed(s string, scale int) (int64, error) {
+	str := strings.TrimSpace(s)
+	if str == "" {
+		return 0, errors.New("empty decimal value")
+	}
+
+	negative := false
+	switch str[0] {
+	case '-':
+		negative = true
+		str = str[1:]
+	case '+':
+		str = str[1:]
+	}
+
+	intPart, fracPart, hasDot := strings.Cut(str, ".")
+	if intPart == "" && (!hasDot || fracPart == "") {
+		return 0, fmt.Errorf("invalid decimal value %q", s)
+	}
+	if len(fracPart) > scale {
+		return 0, fmt.Errorf("decimal value %q has more than %d fractional digits", s, scale)
+	}
+	for _, part := range []string{intPart, fracPart} {
+		for _, r := range part {
+			if r < '0' || r > '9' {
+				return 0, fmt.Errorf("invalid decimal value %q", s)
+			}
+		}
+	}
+
+	unit := pow10(scale)
+	var whole int64
+	if intPart != "" {
+		var err error
+		whole, err = strconv.ParseInt(intPart, 10, 64)
+		if err != nil || whole > (1<<63-1)/unit {
+			return 0, fmt.Errorf("decimal value %q is out of range", s)
+		}
+	}
+
+	var frac int64
+	if fracPart != "" {
+		fracPart += strings.Repeat("0", scale-len(fracPart))
+		frac, _ = strconv.ParseInt(fracPart, 10, 64)
+	}
+
+	// wholeだけでなく、小数部を足した結果も範囲に収まるか調べる
+	if whole*unit > math.MaxInt64-frac {
+		return 0, fmt.Errorf("decimal value %q is out of range", s)
+	}
+	units := whole*unit + frac
+	if negative {
+		units = -units
+	}
+	return units, nil
+}
+
+// formatFixed formats an integer number of 10^-scale units without trailing fractional zeros.
+func formatFixed(units int64, scale int) string {
+	unit := pow10(scale)
+	sign := ""
+	if units < 0 {
+		sign = "-"
+	}
+	whole := units / unit
+	frac := units % unit
+	if whole < 0 {
+		whole = -whole
+	}
+	if frac < 0 {
+		frac = -frac
+	}
+	if frac == 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+	fracStr := strings.TrimRight(fmt.Sprintf("%0*d", scale, frac), "0")
+	return fmt.Sprintf("%s%d.%s", sign, whole, fracStr)
+}
+
+func pow10(n int) int64 {
+	v := int64(1)
+	for i := 0; i < n; i++ {
+		v *= 10
+	}
+	return v
+}
+
+// MustParseMoney is like ParseMoney but panics on invalid input. It is meant for constants.
+func MustParseMoney(s string) Money {
+	m, err := ParseMoney(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Add returns m + o, or ErrMoneyOverflow if the sum is out of range.
+func (m Money) Add(o Money) (Money, error) {
+	if (o.units > 0 && m.units > math.MaxInt64-o.units) || (o.units < 0 && m.units < math.MinInt64-o.units) {
+		return Money{}, fmt.Errorf("%w: %s + %s", ErrMoneyOverflow, m, o)
+	}
+	return Money{units: m.units + o.units}, nil
+}
+
+// Sub returns m - o, or ErrMoneyOverflow if the difference is out of range.
+func (m Money) Sub(o Money) (Money, error) {
+	if (o.units < 0 && m.units > math.MaxInt64+o.units) || (o.units > 0 && m.units < math.MinInt64+o.units) {
+		return Money{}, fmt.Errorf("%w: %s - %s", ErrMoneyOverflow, m, o)
+	}
+	return Money{units: m.units - o.units}, nil
+}
+
+func (m Money) Neg() Money { return Money{units: -m.units} }
+
+// Mul multiplies the amount by an integer such as a quantity, or returns ErrMoneyOverflow if the product is out of range.
+func (m Money) Mul(n int64) (Money, error) {
+	if m.units == 0 || n == 0 {
+		return Money{}, nil
+	}
+	units := m.units * n
+	if units/n != m.units || (n == -1 && m.units == math.MinInt64) {
+		return Money{}, fmt.Errorf("%w: %s * %d", ErrMoneyOverflow, m, n)
+	}
+	return Money{units: units}, nil
+}
+
+func (m Money) Abs() Money {
+	if m.units < 0 {
+		return m.Neg()
+	}
+	return m
+}
+
+// Cmp returns -1, 0 or +1 depending on whether m is less than, equal to or greater than o.
+func (m Money) Cmp(o Money) int {
+	switch {
+	case m.units < o.units:
+		return -1
+	case m.units > o.units:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (m Money) Equal(o Money) bool { return m.units == o.units }
+func (m Money) IsZero() bool       { return m.units == 0 }
+func (m Money) IsNegative() bool   { return m.units < 0 }
+
+// Sign returns -1, 0 or +1.
+func (m Money) Sign() int { return m.Cmp(Money{}) }
+
+// Units returns the amount in 1/10000 units.
+func (m Money) Units() int64 { return m.units }
+
+// String formats the amount without trailing fractional zeros, e.g. "12345" or "-0.5".
+func (m Money) String() string {
+	return formatFixed(m.units, MoneyScale)
+}
+
+// Value implements driver.Valuer so that Money is written to DECIMAL columns without going through float64.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan implements sql.Scanner for DECIMAL and integer columns.
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = Money{}
+		return nil
+	case []byte:
+		parsed, err := ParseMoney(string(v))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case string:
+		parsed, err := ParseMoney(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case int64:
+		if v > math.MaxInt64/moneyUnit || v < math.MinInt64/moneyUnit {
+			return fmt.Errorf("%w: %d", ErrMoneyOverflow, v)
+		}
+		*m = NewMoneyFromInt(v)
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Money", value)
+	}
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON accepts both "1234.5" and 1234.5. Numbers are parsed from their literal text, never via float64.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	str := string(data)
+	if str == "null" {
+		return nil
+	}
+	if strings.HasPrefix(str, `"`) {
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+	}
+	parsed, err := ParseMoney(str)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
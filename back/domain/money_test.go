@@ -0,0 +1,298 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "1234", want: 12340000},
+		{in: "-12.5", want: -125000},
+		{in: "0.0001", want: 1},
+		{in: "+3", want: 30000},
+		{in: " 7 ", want: 70000},
+		{in: ".5", want: 5000},
+		{in: "5.", want: 50000},
+		{in: "-0", want: 0},
+		{in: "922337203685477.5807", want: math.MaxInt64},
+		{in: "-922337203685477.5807", want: -math.MaxInt64},
+		{in: "", wantErr: true},
+		{in: "-", wantErr: true},
+		{in: ".", wantErr: true},
+		{in: "1.23456", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "1e3", wantErr: true},
+		{in: "1,000", wantErr: true},
+		{in: "--1", wantErr: true},
+		{in: "922337203685477.5808", wantErr: true},
+		{in: "922337203685477.9999", wantErr: true},
+		{in: "-922337203685477.9999", wantErr: true},
+		{in: "922337203685478", wantErr: true},
+		{in: "99999999999999999999", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseMoney(%q) = %d units, want an error", tt.in, got.Units())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMoney(%q) error = %v", tt.in, err)
+			continue
+		}
+		if got.Units() != tt.want {
+			t.Errorf("ParseMoney(%q) = %d units, want %d", tt.in, got.Units(), tt.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		units int64
+		want  string
+	}{
+		{0, "0"},
+		{12345 * moneyUnit, "12345"},
+		{-5000, "-0.5"},
+		{12300, "1.23"},
+		{1, "0.0001"},
+		{-1, "-0.0001"},
+		{math.MaxInt64, "922337203685477.5807"},
+		{math.MinInt64, "-922337203685477.5808"},
+	}
+	for _, tt := range tests {
+		if got := (Money{units: tt.units}).String(); got != tt.want {
+			t.Errorf("Money{%d}.String() = %q, want %q", tt.units, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	maxMoney := Money{units: math.MaxInt64}
+	minMoney := Money{units: math.MinInt64}
+	unit := Money{units: 1}
+
+	tests := []struct {
+		name    string
+		op      func() (Money, error)
+		want    string
+		wantErr bool
+	}{
+		{name: "add", op: func() (Money, error) { return MustParseMoney("0.1").Add(MustParseMoney("0.2")) }, want: "0.3"},
+		{name: "add negative", op: func() (Money, error) { return MustParseMoney("100").Add(MustParseMoney("-250.5")) }, want: "-150.5"},
+		{name: "add up to max", op: func() (Money, error) { return Money{units: math.MaxInt64 - 1}.Add(unit) }, want: "922337203685477.5807"},
+		{name: "add overflow", op: func() (Money, error) { return maxMoney.Add(unit) }, wantErr: true},
+		{name: "add underflow", op: func() (Money, error) { return minMoney.Add(unit.Neg()) }, wantErr: true},
+		{name: "sub", op: func() (Money, error) { return MustParseMoney("1").Sub(MustParseMoney("0.0001")) }, want: "0.9999"},
+		{name: "sub down to min", op: func() (Money, error) { return Money{units: math.MinInt64 + 1}.Sub(unit) }, want: "-922337203685477.5808"},
+		{name: "sub overflow", op: func() (Money, error) { return maxMoney.Sub(unit.Neg()) }, wantErr: true},
+		{name: "sub underflow", op: func() (Money, error) { return minMoney.Sub(unit) }, wantErr: true},
+		{name: "mul", op: func() (Money, error) { return MustParseMoney("12.5").Mul(3) }, want: "37.5"},
+		{name: "mul negative", op: func() (Money, error) { return MustParseMoney("12.5").Mul(-2) }, want: "-25"},
+		{name: "mul by zero", op: func() (Money, error) { return maxMoney.Mul(0) }, want: "0"},
+		{name: "mul max by one", op: func() (Money, error) { return maxMoney.Mul(1) }, want: "922337203685477.5807"},
+		{name: "mul overflow", op: func() (Money, error) { return maxMoney.Mul(2) }, wantErr: true},
+		{name: "mul large overflow", op: func() (Money, error) { return MustParseMoney("10000").Mul(math.MaxInt64 / 1000) }, wantErr: true},
+		{name: "mul min by minus one", op: func() (Money, error) { return minMoney.Mul(-1) }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.op()
+			if tt.wantErr {
+				if !errors.Is(err, ErrMoneyOverflow) {
+					t.Errorf("got %s, %v, want ErrMoneyOverflow", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyConvert(t *testing.T) {
+	maxMoney := Money{units: math.MaxInt64}
+
+	tests := []struct {
+		name    string
+		amount  Money
+		rate    string
+		inverse bool
+		want    string
+		wantErr bool
+	}{
+		{name: "convert", amount: MustParseMoney("100"), rate: "149.85", want: "14985"},
+		{name: "convert rounds half away from zero", amount: MustParseMoney("0.0001"), rate: "0.5", want: "0.0001"},
+		{name: "convert negative rounds half away from zero", amount: MustParseMoney("-0.0001"), rate: "0.5", want: "-0.0001"},
+		{name: "convert rounds down", amount: MustParseMoney("0.0001"), rate: "0.4999999999", want: "0"},
+		{name: "convert max by one", amount: maxMoney, rate: "1", want: "922337203685477.5807"},
+		{name: "convert overflow", amount: maxMoney, rate: "2", wantErr: true},
+		{name: "inverse", amount: MustParseMoney("14985"), rate: "149.85", inverse: true, want: "100"},
+		{name: "inverse rounds down", amount: MustParseMoney("1"), rate: "3", inverse: true, want: "0.3333"},
+		{name: "inverse rounds up", amount: MustParseMoney("2"), rate: "3", inverse: true, want: "0.6667"},
+		{name: "inverse negative", amount: MustParseMoney("-2"), rate: "3", inverse: true, want: "-0.6667"},
+		{name: "inverse overflow", amount: maxMoney, rate: "0.5", inverse: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := ParseRate(tt.rate)
+			if err != nil {
+				t.Fatalf("ParseRate(%q) error = %v", tt.rate, err)
+			}
+			var got Money
+			if tt.inverse {
+				got, err = tt.amount.ConvertInverse(rate)
+			} else {
+				got, err = tt.amount.Convert(rate)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrMoneyOverflow) {
+					t.Errorf("got %s, %v, want ErrMoneyOverflow", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(struct {
+		Amount Money `json:"amount"`
+	}{MustParseMoney("-1234.5")})
+	if err != nil {
+		t.Fatalf("Marshal error = %v", err)
+	}
+	if want := `{"amount":"-1234.5"}`; string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: `"12.5"`, want: "12.5"},
+		{in: `12.5`, want: "12.5"},
+		{in: `-3`, want: "-3"},
+		{in: `"922337203685477.5807"`, want: "922337203685477.5807"},
+		{in: `null`, want: "7"},
+		{in: `1e3`, wantErr: true},
+		{in: `0.00001`, wantErr: true},
+		{in: `"922337203685477.9999"`, wantErr: true},
+		{in: `true`, wantErr: true},
+	}
+	for _, tt := range tests {
+		// nullの場合は元の値のまま変わらない
+		got := MustParseMoney("7")
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Unmarshal(%s) = %s, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unmarshal(%s) error = %v", tt.in, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("Unmarshal(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		in       interface{}
+		want     string
+		overflow bool
+		wantErr  bool
+	}{
+		{in: nil, want: "0"},
+		{in: []byte("12.3400"), want: "12.34"},
+		{in: "-0.5000", want: "-0.5"},
+		{in: int64(5), want: "5"},
+		{in: int64(922337203685477), want: "922337203685477"},
+		{in: int64(-922337203685477), want: "-922337203685477"},
+		{in: int64(922337203685478), overflow: true},
+		{in: int64(math.MinInt64), overflow: true},
+		{in: []byte("922337203685477.9999"), wantErr: true},
+		{in: 1.5, wantErr: true},
+	}
+	for _, tt := range tests {
+		var got Money
+		err := got.Scan(tt.in)
+		if tt.overflow {
+			if !errors.Is(err, ErrMoneyOverflow) {
+				t.Errorf("Scan(%v) = %s, %v, want ErrMoneyOverflow", tt.in, got, err)
+			}
+			continue
+		}
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Scan(%v) = %s, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Scan(%v) error = %v", tt.in, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("Scan(%v) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "149.85", want: "149.85"},
+		{in: "0.0000000001", want: "0.0000000001"},
+		{in: "922337203.6854775807", want: "922337203.6854775807"},
+		{in: "0", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "0.00000000001", wantErr: true},
+		{in: "922337203.6854775808", wantErr: true},
+		{in: "922337203.9999999999", wantErr: true},
+		{in: "922337204", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseRate(%q) = %s, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRate(%q) error = %v", tt.in, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("ParseRate(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
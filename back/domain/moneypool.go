@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"time"
@@ -8,21 +9,37 @@ import (
 	"github.com/pkg/errors"
 )
 
-func (d *dbImpl) NewMoneyPool(moneyPool MoneyPool) (MoneyPool, error) {
+func (d *dbImpl) NewMoneyPool(moneyPool MoneyPool, audit Audit[MoneyPool]) (MoneyPool, error) {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return MoneyPool{}, fmt.Errorf("failed to start transaction: %v", err)
+	}
+
 	// クエリ文字列で位置パラメータを使用します。
-	query := `INSERT INTO money_pool (name, description, type, owner_id, emoji, is_deleted)
-			  VALUES ($1, $2, $3, $4, $5, false)
-			  RETURNING id`
-	// QueryRowを使用してIDを取得します。
+	query := `INSERT INTO money_pool (name, description, type, owner_id, emoji, currency, is_deleted)
+			  VALUES ($1, $2, $3, $4, $5, $6, false)
+			  RETURNING id, version`
+	// QueryRowを使用してIDとバージョンを取得します。
 	var returnedID int64
-	err := d.db.QueryRow(query, moneyPool.Name, moneyPool.Description, moneyPool.Type, moneyPool.OwnerID, moneyPool.Emoji).Scan(&returnedID)
+	err = tx.QueryRow(query, moneyPool.Name, moneyPool.Description, moneyPool.Type, moneyPool.OwnerID, moneyPool.Emoji, moneyPool.Currency).Scan(&returnedID, &moneyPool.Version)
 	if err != nil {
+		tx.Rollback()
 		return MoneyPool{}, errors.Wrap(err, "新規MoneyPoolの作成とIDの返却に失敗しました")
 	}
 
 	// 返却されたIDをmoneyPool構造体のIDフィールドに割り当てます。
 	moneyPool.ID = fmt.Sprintf("%d", returnedID)
 
+	err = writeAudit(tx, audit, moneyPool)
+	if err != nil {
+		tx.Rollback()
+		return MoneyPool{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return MoneyPool{}, fmt.Errorf("failed to commit new MoneyPool: %v", err)
+	}
 	return moneyPool, nil
 }
 
@@ -30,6 +47,9 @@ func (d *dbImpl) GetMoneyPool(id string) (MoneyPool, error) {
 	var moneyPool MoneyPool
 	query := `SELECT * FROM money_pool WHERE id = $1 AND is_deleted = false`
 	err := d.db.Get(&moneyPool, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return MoneyPool{}, fmt.Errorf("%w: money pool %s", ErrNotFound, id)
+	}
 	if err != nil {
 		return MoneyPool{}, fmt.Errorf("could not find money pool: %v", err)
 	}
@@ -46,7 +66,7 @@ func (d *dbImpl) GetMoneyPoolsByUserID(userID string) ([]MoneyPool, error) {
 	return moneyPools, nil
 }
 
-func (d *dbImpl) UpdateMoneyPool(moneyPool MoneyPool) error {
+func (d *dbImpl) UpdateMoneyPool(moneyPool MoneyPool, audit Audit[MoneyPool]) error {
 	tx, err := d.db.Beginx()
 	if err != nil {
 		return err
@@ -70,9 +90,26 @@ func (d *dbImpl) UpdateMoneyPool(moneyPool MoneyPool) error {
 	}
 
 	// 名前付きパラメータを位置パラメータに置き換えたクエリを作成します
-	query := `UPDATE money_pool SET name = $2, description = $3, type = $4, owner_id = $5, emoji = $6 WHERE id = $1`
+	// 読み込んだときのバージョンのままの場合だけ更新します
+	query := `UPDATE money_pool SET name = $2, description = $3, type = $4, owner_id = $5, emoji = $6, currency = $7, version = version + 1
+			  WHERE id = $1 AND version = $8`
 	// Execを使用して更新を実行し、パラメータを順番にバインドします
-	_, err = tx.Exec(query, moneyPool.ID, moneyPool.Name, moneyPool.Description, moneyPool.Type, moneyPool.OwnerID, moneyPool.Emoji)
+	result, err := tx.Exec(query, moneyPool.ID, moneyPool.Name, moneyPool.Description, moneyPool.Type, moneyPool.OwnerID, moneyPool.Emoji, moneyPool.Currency, moneyPool.Version)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not determine rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		tx.Rollback()
+		return fmt.Errorf("%w: money pool %s is not at version %d", ErrVersionConflict, moneyPool.ID, moneyPool.Version)
+	}
+
+	err = writeAudit(tx, audit, moneyPool)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -81,7 +118,7 @@ func (d *dbImpl) UpdateMoneyPool(moneyPool MoneyPool) error {
 	return tx.Commit()
 }
 
-func (d *dbImpl) ShareMoneyPoolWithUserGroups(moneyPoolID string, shareUserGroupIDs []string) error {
+func (d *dbImpl) ShareMoneyPoolWithUserGroups(moneyPoolID string, shareUserGroupIDs []string, audit Audit[string]) error {
 	tx, err := d.db.Beginx()
 	if err != nil {
 		return err
@@ -113,26 +150,91 @@ func (d *dbImpl) ShareMoneyPoolWithUserGroups(moneyPoolID string, shareUserGroup
 		}
 	}
 
+	err = writeAudit(tx, audit, moneyPoolID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	return tx.Commit()
 }
 
-func (d *dbImpl) DeleteMoneyPool(id string) error {
-	query := `UPDATE money_pool SET is_deleted = true, deleted_at = $2 WHERE id = $1`
-	result, err := d.db.Exec(query, id, time.Now())
+func (d *dbImpl) DeleteMoneyPool(id string, audit Audit[string]) error {
+	tx, err := d.db.Beginx()
 	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	query := `UPDATE money_pool SET is_deleted = true, deleted_at = $2, version = version + 1 WHERE id = $1`
+	result, err := tx.Exec(query, id, time.Now())
+	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("could not delete money pool: %v", err)
 	}
 
 	// Execの結果から影響を受けた行の数を確認します。Deleteが実行されなかった場合にはエラーを返すことも可能です。
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("could not determine rows affected: %v", err)
 	}
 	if rowsAffected == 0 {
+		tx.Rollback()
 		return fmt.Errorf("no rows affected, nothing to delete")
 	}
 
-	return nil
+	err = writeAudit(tx, audit, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetMoneyPoolPublicationScope retrieves the user groups a restricted money pool is shared with.
+func (d *dbImpl) GetMoneyPoolPublicationScope(id string) ([]UserGroup, error) {
+	var groups []UserGroup
+	query := `SELECT g.id, g.name, g.creator_id
+			  FROM restricted_publication_scope rps
+			  JOIN user_groups g ON g.id = rps.group_id
+			  WHERE rps.pool_id = $1
+			  ORDER BY g.id`
+	err := d.db.Select(&groups, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("could not get publication scope of money pool %s: %v", id, err)
+	}
+	return groups, nil
+}
+
+// GetMoneyPoolsSharedWithUser retrieves the restricted money pools of other users that are shared with one of the user's groups.
+func (d *dbImpl) GetMoneyPoolsSharedWithUser(userID string) ([]MoneyPool, error) {
+	var moneyPools []MoneyPool
+	query := `SELECT mp.* FROM money_pool mp
+			  WHERE NOT mp.is_deleted AND mp.owner_id <> $1 AND mp.type = $2 AND EXISTS (
+				  SELECT 1 FROM restricted_publication_scope rps
+				  JOIN user_group_membership ugm ON ugm.group_id = rps.group_id
+				  WHERE rps.pool_id = mp.id AND ugm.user_id = $1)
+			  ORDER BY mp.id`
+	err := d.db.Select(&moneyPools, query, userID, PublicTypeRestricted)
+	if err != nil {
+		return nil, fmt.Errorf("could not find money pools shared with user: %v", err)
+	}
+	return moneyPools, nil
+}
+
+// GetMoneyPoolPaymentStats counts the payments of a money pool and finds the date of the latest actual payment.
+func (d *dbImpl) GetMoneyPoolPaymentStats(id string) (PaymentStats, error) {
+	var stats PaymentStats
+	query := `SELECT COUNT(*) AS payment_count,
+			  COUNT(*) FILTER (WHERE is_planned) AS planned_count,
+			  MAX(date) FILTER (WHERE NOT is_planned) AS last_payment_date
+			  FROM payment WHERE money_pool_id = $1`
+	err := d.db.Get(&stats, query, id)
+	if err != nil {
+		return PaymentStats{}, fmt.Errorf("could not get payment stats of money pool %s: %v", id, err)
+	}
+	return stats, nil
 }
 
 func (d *dbImpl) IsMoneyPoolSharedWithUser(id string, userID string) (bool, error) {
@@ -140,7 +242,7 @@ func (d *dbImpl) IsMoneyPoolSharedWithUser(id string, userID string) (bool, erro
 
 	// マネープールのタイプをチェックします。
 	var poolType string
-	query := `SELECT type FROM MoneyPool WHERE id = $1`
+	query := `SELECT type FROM money_pool WHERE id = $1`
 	err := d.db.Get(&poolType, query, id)
 	if err != nil {
 		log.Printf("マネープールのタイプの取得に失敗しました: %v", err)
@@ -148,17 +250,17 @@ func (d *dbImpl) IsMoneyPoolSharedWithUser(id string, userID string) (bool, erro
 	}
 	log.Printf("マネープールのタイプ: %s", poolType)
 
-	// マネープールがRestrictedタイプでない場合は、共有されていないと判断します。
-	if poolType != "Restricted" {
-		log.Println("マネープールはRestrictedタイプではありません。共有されていません。")
+	// マネープールがrestrictedタイプでない場合は、共有されていないと判断します。
+	if poolType != PublicTypeRestricted {
+		log.Println("マネープールはrestrictedタイプではありません。共有されていません。")
 		return false, nil
 	}
 
 	// マネープールが特定のユーザーと共有されているかどうかを確認します。
 	query = `
-		SELECT COUNT(*) FROM UserGroupMembership ugm
-		INNER JOIN RestrictedPublicationScope rps ON ugm.GroupID = rps.GroupID
-		WHERE rps.PoolID = $1 AND ugm.UserID = $2
+		SELECT COUNT(*) FROM user_group_membership ugm
+		INNER JOIN restricted_publication_scope rps ON ugm.group_id = rps.group_id
+		WHERE rps.pool_id = $1 AND ugm.user_id = $2
 	`
 	var count int
 	err = d.db.Get(&count, query, id, userID)
@@ -175,3 +277,123 @@ func (d *dbImpl) IsMoneyPoolSharedWithUser(id string, userID string) (bool, erro
 
 	return count > 0, nil
 }
+
+// GetDeletedMoneyPoolsByUserID retrieves the money pools of the user in the trash, most recently deleted first.
+func (d *dbImpl) GetDeletedMoneyPoolsByUserID(userID string) ([]MoneyPool, error) {
+	var moneyPools []MoneyPool
+	query := `SELECT * FROM money_pool WHERE owner_id = $1 AND is_deleted = true ORDER BY deleted_at DESC NULLS LAST, id DESC`
+	err := d.db.Select(&moneyPools, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not find deleted money pools for user: %v", err)
+	}
+	return moneyPools, nil
+}
+
+// GetDeletedMoneyPool retrieves a money pool in the trash.
+func (d *dbImpl) GetDeletedMoneyPool(id string) (MoneyPool, error) {
+	var moneyPool MoneyPool
+	query := `SELECT * FROM money_pool WHERE id = $1 AND is_deleted = true`
+	err := d.db.Get(&moneyPool, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return MoneyPool{}, fmt.Errorf("%w: deleted money pool %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return MoneyPool{}, fmt.Errorf("could not find deleted money pool: %v", err)
+	}
+	return moneyPool, nil
+}
+
+// GetMoneyPoolIDsDeletedBefore retrieves the IDs of the money pools moved to the trash before the date.
+func (d *dbImpl) GetMoneyPoolIDsDeletedBefore(date time.Time) ([]string, error) {
+	var ids []string
+	query := `SELECT id FROM money_pool WHERE is_deleted = true AND deleted_at < $1 ORDER BY id`
+	err := d.db.Select(&ids, query, date)
+	if err != nil {
+		return nil, fmt.Errorf("could not find money pools deleted before %s: %v", date.Format("2006-01-02"), err)
+	}
+	return ids, nil
+}
+
+func (d *dbImpl) RestoreMoneyPool(id string, audit Audit[string]) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	query := `UPDATE money_pool SET is_deleted = false, deleted_at = NULL, version = version + 1 WHERE id = $1 AND is_deleted = true`
+	result, err := tx.Exec(query, id)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not restore money pool: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not determine rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		tx.Rollback()
+		return fmt.Errorf("no rows affected, nothing to restore")
+	}
+
+	err = writeAudit(tx, audit, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeMoneyPool permanently deletes a money pool in the trash with its payments and recurring payments.
+// Transfers with a leg in the pool are deleted too; their legs in other pools are kept as plain payments
+// so that the balances of those pools do not change.
+func (d *dbImpl) PurgeMoneyPool(id string, audit Audit[string]) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	var isDeleted bool
+	err = tx.Get(&isDeleted, `SELECT is_deleted FROM money_pool WHERE id = $1 FOR UPDATE`, id)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not find money pool: %v", err)
+	}
+	if !isDeleted {
+		tx.Rollback()
+		return fmt.Errorf("money pool %s is not in the trash", id)
+	}
+
+	const transfersOfPool = `SELECT transfer_id FROM payment WHERE money_pool_id = $1 AND transfer_id IS NOT NULL`
+	queries := []struct {
+		name  string
+		query string
+	}{
+		{"detach transfer legs", `UPDATE payment SET transfer_id = NULL, version = version + 1 WHERE money_pool_id <> $1 AND transfer_id IN (` + transfersOfPool + `)`},
+		{"delete transfers", `DELETE FROM transfer WHERE id IN (` + transfersOfPool + `)`},
+		{"delete payment items", `DELETE FROM item_payment WHERE payment_id IN (SELECT id FROM payment WHERE money_pool_id = $1)`},
+		// payment_labelは支払いの削除で消える
+		{"delete payments", `DELETE FROM payment WHERE money_pool_id = $1`},
+		{"delete recurring payments", `DELETE FROM recurring_payment WHERE money_pool_id = $1`},
+		// restricted_publication_scopeはマネープールの削除で消える
+		{"delete money pool", `DELETE FROM money_pool WHERE id = $1`},
+	}
+	for _, q := range queries {
+		if _, err := tx.Exec(q.query, id); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to %s of money pool %s: %v", q.name, id, err)
+		}
+	}
+
+	err = writeAudit(tx, audit, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit purge of money pool %s: %v", id, err)
+	}
+	return nil
+}
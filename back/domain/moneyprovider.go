@@ -1,60 +1,190 @@
 package domain
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
 )
 
-func (d *dbImpl) NewMoneyProvider(moneyProvider MoneyProvider) (MoneyProvider, error) {
+func (d *dbImpl) NewMoneyProvider(moneyProvider MoneyProvider, audit Audit[MoneyProvider]) (MoneyProvider, error) {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return MoneyProvider{}, fmt.Errorf("failed to start transaction: %v", err)
+	}
+
 	// クエリ文字列で位置パラメータを使用します。
-	query := `INSERT INTO money_provider (name, creator_id, balance)
-              VALUES ($1, $2, $3)
-              RETURNING id`
-	// QueryRowを使用してSQLクエリを実行し、戻り値のIDを取得します。
-	err := d.db.QueryRow(query, moneyProvider.Name, moneyProvider.CreatorID, moneyProvider.Balance).Scan(&moneyProvider.ID)
+	query := `INSERT INTO money_provider (name, creator_id, balance, currency)
+              VALUES ($1, $2, $3, $4)
+              RETURNING id, version`
+	// QueryRowを使用してSQLクエリを実行し、戻り値のIDとバージョンを取得します。
+	err = tx.QueryRow(query, moneyProvider.Name, moneyProvider.CreatorID, moneyProvider.Balance, moneyProvider.Currency).Scan(&moneyProvider.ID, &moneyProvider.Version)
 	if err != nil {
+		tx.Rollback()
 		return MoneyProvider{}, fmt.Errorf("failed to create new MoneyProvider: %v", err)
 	}
+
+	// 最初の残高を履歴に記録します。
+	err = insertBalanceSnapshot(tx, moneyProvider.ID, moneyProvider.Balance)
+	if err != nil {
+		tx.Rollback()
+		return MoneyProvider{}, err
+	}
+
+	err = writeAudit(tx, audit, moneyProvider)
+	if err != nil {
+		tx.Rollback()
+		return MoneyProvider{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return MoneyProvider{}, fmt.Errorf("failed to commit new MoneyProvider: %v", err)
+	}
 	return moneyProvider, nil
 }
 
 // GetMoneyProvider retrieves a money provider by its ID.
 func (d *dbImpl) GetMoneyProvider(id string) (MoneyProvider, error) {
 	var moneyProvider MoneyProvider
-	query := `SELECT id, name, creator_id, balance FROM money_provider WHERE id = $1`
+	query := `SELECT id, name, creator_id, balance, currency, version FROM money_provider WHERE id = $1`
 	err := d.db.Get(&moneyProvider, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return MoneyProvider{}, fmt.Errorf("%w: money provider %s", ErrNotFound, id)
+	}
 	return moneyProvider, err
 }
 
 // GetMoneyProvidersByUserID retrieves all money providers created by a specific user.
 func (d *dbImpl) GetMoneyProvidersByUserID(userID string) ([]MoneyProvider, error) {
 	var moneyProviders []MoneyProvider
-	query := `SELECT id, name, creator_id, balance FROM money_provider WHERE creator_id = $1`
+	query := `SELECT id, name, creator_id, balance, currency, version FROM money_provider WHERE creator_id = $1`
 	err := d.db.Select(&moneyProviders, query, userID)
 	return moneyProviders, err
 }
 
 // UpdateMoneyProvider updates an existing money provider in the database.
-func (d *dbImpl) UpdateMoneyProvider(moneyProvider MoneyProvider) error {
-	query := `UPDATE money_provider SET name = :name, balance = :balance WHERE id = :id`
-	_, err := d.db.NamedExec(query, moneyProvider)
-	return err
+// If the balance changes, the new balance is recorded in the balance history.
+// The money provider is updated only if it is still at moneyProvider.Version, otherwise ErrVersionConflict is returned.
+func (d *dbImpl) UpdateMoneyProvider(moneyProvider MoneyProvider, audit Audit[MoneyProvider]) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	var current struct {
+		Balance Money `db:"balance"`
+		Version int64 `db:"version"`
+	}
+	err = tx.Get(&current, `SELECT balance, version FROM money_provider WHERE id = $1 FOR UPDATE`, moneyProvider.ID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error fetching money provider: %v", err)
+	}
+	if current.Version != moneyProvider.Version {
+		tx.Rollback()
+		return fmt.Errorf("%w: money provider %s is not at version %d", ErrVersionConflict, moneyProvider.ID, moneyProvider.Version)
+	}
+
+	query := `UPDATE money_provider SET name = :name, balance = :balance, currency = :currency, version = version + 1 WHERE id = :id`
+	_, err = tx.NamedExec(query, moneyProvider)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if !current.Balance.Equal(moneyProvider.Balance) {
+		err = insertBalanceSnapshot(tx, moneyProvider.ID, moneyProvider.Balance)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = writeAudit(tx, audit, moneyProvider)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (d *dbImpl) DeleteMoneyProvider(id string) error {
+func insertBalanceSnapshot(tx *sqlx.Tx, moneyProviderID string, balance Money) error {
+	_, err := tx.Exec(`INSERT INTO money_provider_balance_snapshot (money_provider_id, balance) VALUES ($1, $2)`, moneyProviderID, balance)
+	if err != nil {
+		return fmt.Errorf("failed to record balance of money provider %s: %v", moneyProviderID, err)
+	}
+	return nil
+}
+
+// GetMoneyProviderBalanceHistory retrieves the balance snapshots of a money provider recorded in [from, to), oldest first.
+func (d *dbImpl) GetMoneyProviderBalanceHistory(moneyProviderID string, from time.Time, to time.Time) ([]MoneyProviderBalanceSnapshot, error) {
+	var snapshots []MoneyProviderBalanceSnapshot
+	query := `SELECT id, money_provider_id, balance, recorded_at FROM money_provider_balance_snapshot
+			  WHERE money_provider_id = $1 AND recorded_at >= $2 AND recorded_at < $3
+			  ORDER BY recorded_at, id`
+	err := d.db.Select(&snapshots, query, moneyProviderID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching balance history of money provider %s: %v", moneyProviderID, err)
+	}
+	return snapshots, nil
+}
+
+// GetMoneyProviderBalanceAt returns the balance a money provider had just before `at`.
+// For a time before the first snapshot the oldest recorded balance is used, since nothing older is known.
+func (d *dbImpl) GetMoneyProviderBalanceAt(moneyProviderID string, at time.Time) (Money, error) {
+	var balance Money
+	query := `SELECT balance FROM (
+				  (SELECT balance, 0 AS priority FROM money_provider_balance_snapshot
+				   WHERE money_provider_id = $1 AND recorded_at < $2
+				   ORDER BY recorded_at DESC, id DESC LIMIT 1)
+				  UNION ALL
+				  (SELECT balance, 1 AS priority FROM money_provider_balance_snapshot
+				   WHERE money_provider_id = $1
+				   ORDER BY recorded_at, id LIMIT 1)
+				  UNION ALL
+				  (SELECT balance, 2 AS priority FROM money_provider WHERE id = $1)
+			  ) s
+			  ORDER BY priority LIMIT 1`
+	err := d.db.Get(&balance, query, moneyProviderID, at)
+	if err != nil {
+		return Money{}, fmt.Errorf("error fetching balance of money provider %s at %s: %v", moneyProviderID, at.Format(time.RFC3339), err)
+	}
+	return balance, nil
+}
+
+func (d *dbImpl) DeleteMoneyProvider(id string, audit Audit[string]) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+
 	query := `DELETE FROM money_provider WHERE id = $1`
-	result, err := d.db.Exec(query, id)
+	result, err := tx.Exec(query, id)
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("could not delete money provider: %v", err)
 	}
 
 	// 結果から影響を受けた行の数を確認します。
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("could not determine rows affected: %v", err)
 	}
 	if rowsAffected == 0 {
+		tx.Rollback()
 		return fmt.Errorf("no rows affected, perhaps the money provider with id %s does not exist", id)
 	}
 
-	return nil
+	err = writeAudit(tx, audit, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
@@ -1,57 +1,339 @@
 package domain
 
-import "fmt"
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func (d *dbImpl) NewPayment(payment Payment, audit Audit[Payment]) (Payment, error) {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return Payment{}, fmt.Errorf("failed to start transaction: %v", err)
+	}
 
-func (d *dbImpl) NewPayment(payment Payment) (Payment, error) {
 	// クエリ文字列で位置パラメータを使用します。$1、$2...はそれぞれの値のプレースホルダーです。
 	query := `INSERT INTO payment (money_pool_id, date, title, amount, description, is_planned, store_id)
 			  VALUES ($1, $2, $3, $4, $5, $6, $7)
 			  RETURNING id`
 	// QueryRowを使用してSQLクエリを実行し、戻り値のIDを取得します。
-	err := d.db.QueryRow(query, payment.MoneyPoolID, payment.Date, payment.Title, payment.Amount, payment.Description, payment.IsPlanned, payment.StoreID).Scan(&payment.ID)
+	err = tx.QueryRow(query, payment.MoneyPoolID, payment.Date, payment.Title, payment.Amount, payment.Description, payment.IsPlanned, payment.StoreID).Scan(&payment.ID)
 	if err != nil {
+		tx.Rollback()
 		return Payment{}, fmt.Errorf("failed to create new Payment: %v", err)
 	}
+
+	// 明細を同じトランザクションで登録します。
+	err = insertPaymentItems(tx, payment.ID, payment.Items)
+	if err != nil {
+		tx.Rollback()
+		return Payment{}, err
+	}
+
+	err = insertPaymentLabels(tx, payment.ID, payment.LabelIDs)
+	if err != nil {
+		tx.Rollback()
+		return Payment{}, err
+	}
+	for i := range payment.Items {
+		payment.Items[i].PaymentID = payment.ID
+	}
+
+	err = writeAudit(tx, audit, payment)
+	if err != nil {
+		tx.Rollback()
+		return Payment{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Payment{}, fmt.Errorf("failed to commit new Payment: %v", err)
+	}
 	return payment, nil
 }
 
+// NewPayments stores several payments without items or labels in a single transaction, e.g. rows imported from a CSV.
+// Either all payments are stored or none.
+func (d *dbImpl) NewPayments(payments []Payment, audit Audit[Payment]) ([]Payment, error) {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	query := `INSERT INTO payment (money_pool_id, date, title, amount, description, is_planned, store_id)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7)
+			  RETURNING id`
+	created := make([]Payment, 0, len(payments))
+	for _, payment := range payments {
+		err := tx.QueryRow(query, payment.MoneyPoolID, payment.Date, payment.Title, payment.Amount, payment.Description, payment.IsPlanned, payment.StoreID).Scan(&payment.ID)
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to create payment %s of %s: %v", payment.Title, payment.Date.Format("2006-01-02"), err)
+		}
+		err = writeAudit(tx, audit, payment)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		created = append(created, payment)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit payments: %v", err)
+	}
+	return created, nil
+}
+
 // GetPayment retrieves a single payment by its ID.
 func (d *dbImpl) GetPayment(id string) (Payment, error) {
 	var payment Payment
-	query := `SELECT id, money_pool_id, date, title, amount, description, is_planned, store_id FROM payment WHERE id = $1`
+	query := `SELECT p.id, p.money_pool_id, p.date, p.title, p.amount, p.description, p.is_planned, p.store_id, s.name AS store_name, p.recurring_payment_id,
+			  p.planned_date, p.planned_amount, p.transfer_id, p.version
+			  FROM payment p
+			  LEFT JOIN store s ON s.id = p.store_id
+			  WHERE p.id = $1`
 	err := d.db.Get(&payment, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Payment{}, fmt.Errorf("%w: payment %s", ErrNotFound, id)
+	}
 	if err != nil {
 		return Payment{}, fmt.Errorf("error fetching payment: %v", err)
 	}
 	return payment, nil
 }
 
-// GetPaymentsByMoneyPoolID retrieves all payments associated with a specific money pool.
-func (d *dbImpl) GetPaymentsByMoneyPoolID(moneyPoolID string) ([]Payment, error) {
+// paymentSortColumns maps each sort order to the column compared with the cursor and the direction.
+var paymentSortColumns = map[string]struct {
+	column string
+	desc   bool
+}{
+	PaymentSortDateDesc:   {"p.date", true},
+	PaymentSortDateAsc:    {"p.date", false},
+	PaymentSortAmountDesc: {"p.amount", true},
+	PaymentSortAmountAsc:  {"p.amount", false},
+}
+
+// IsValidPaymentSort reports whether sort is one of the PaymentSort constants.
+func IsValidPaymentSort(sort string) bool {
+	_, ok := paymentSortColumns[sort]
+	return ok
+}
+
+// escapeLike escapes the wildcard characters of LIKE so that s is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// paymentFilterConditions returns the WHERE conditions of the filter on the payment table p, without the cursor.
+// arg adds a query argument and returns its placeholder.
+func paymentFilterConditions(filter PaymentFilter, arg func(v interface{}) string) []string {
+	var conditions []string
+	conditions = append(conditions, "p.money_pool_id = ANY("+arg(pq.Array(filter.MoneyPoolIDs))+"::bigint[])")
+	if filter.From != nil {
+		conditions = append(conditions, "p.date >= "+arg(*filter.From))
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "p.date <= "+arg(*filter.To))
+	}
+	if filter.MinAmount != nil {
+		conditions = append(conditions, "p.amount >= "+arg(*filter.MinAmount))
+	}
+	if filter.MaxAmount != nil {
+		conditions = append(conditions, "p.amount <= "+arg(*filter.MaxAmount))
+	}
+	if filter.IsPlanned != nil {
+		conditions = append(conditions, "p.is_planned = "+arg(*filter.IsPlanned))
+	}
+	if filter.Title != "" {
+		conditions = append(conditions, `p.title ILIKE '%' || `+arg(escapeLike(filter.Title))+` || '%' ESCAPE '\'`)
+	}
+	if filter.StoreID != nil {
+		conditions = append(conditions, "p.store_id = "+arg(*filter.StoreID))
+	}
+	if filter.LabelID != nil {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM payment_label pl WHERE pl.payment_id = p.id AND pl.label_id = "+arg(*filter.LabelID)+")")
+	}
+	return conditions
+}
+
+// GetPayments retrieves the payments matching the filter.
+// Pagination is keyset based: pass the last payment of the previous page as filter.After.
+func (d *dbImpl) GetPayments(filter PaymentFilter) ([]Payment, error) {
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	conditions := paymentFilterConditions(filter, arg)
+
+	sort, ok := paymentSortColumns[filter.Sort]
+	if !ok {
+		sort = paymentSortColumns[PaymentSortDateDesc]
+	}
+	direction, comparison := "ASC", ">"
+	if sort.desc {
+		direction, comparison = "DESC", "<"
+	}
+	if filter.After != nil {
+		var value string
+		if sort.column == "p.date" {
+			value = arg(filter.After.Date) + "::date"
+		} else {
+			value = arg(filter.After.Amount) + "::numeric"
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, p.id) %s (%s, %s::bigint)", sort.column, comparison, value, arg(filter.After.ID)))
+	}
+
+	query := `SELECT p.id, p.money_pool_id, p.date, p.title, p.amount, p.description, p.is_planned, p.store_id, s.name AS store_name, p.recurring_payment_id,
+			  p.planned_date, p.planned_amount, p.transfer_id, p.version
+			  FROM payment p
+			  LEFT JOIN store s ON s.id = p.store_id
+			  WHERE ` + strings.Join(conditions, " AND ") + `
+			  ORDER BY ` + sort.column + ` ` + direction + `, p.id ` + direction
+	if filter.Limit > 0 {
+		query += ` LIMIT ` + arg(filter.Limit)
+	}
+
 	var payments []Payment
-	query := `SELECT id, money_pool_id, date, title, amount, description, is_planned, store_id FROM payment WHERE money_pool_id = $1 ORDER BY date DESC`
-	err := d.db.Select(&payments, query, moneyPoolID)
+	err := d.db.Select(&payments, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching payments: %v", err)
 	}
 	return payments, nil
 }
 
+// GetPaymentDailyTotals sums up the payments matching the filter per money pool and day, leaving out the legs of transfers.
+// The sort order, cursor and limit of the filter are ignored, so the totals do not depend on the page.
+func (d *dbImpl) GetPaymentDailyTotals(filter PaymentFilter) ([]PaymentDailyTotal, error) {
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	conditions := append(paymentFilterConditions(filter, arg), "p.transfer_id IS NULL")
+
+	query := `SELECT p.money_pool_id, p.date, SUM(p.amount) AS amount
+			  FROM payment p
+			  WHERE ` + strings.Join(conditions, " AND ") + `
+			  GROUP BY p.money_pool_id, p.date
+			  ORDER BY p.date, p.money_pool_id`
+
+	var totals []PaymentDailyTotal
+	err := d.db.Select(&totals, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching payment totals: %v", err)
+	}
+	return totals, nil
+}
+
 // UpdatePayment updates an existing payment's details.
-func (d *dbImpl) UpdatePayment(payment Payment) error {
-	query := `UPDATE payment SET money_pool_id = $1, date = $2, title = $3, amount = $4, description = $5, is_planned = $6, store_id = $7 WHERE id = $8`
-	_, err := d.db.Exec(query, payment.MoneyPoolID, payment.Date, payment.Title, payment.Amount, payment.Description, payment.IsPlanned, payment.StoreID, payment.ID)
+// If payment.Items or payment.LabelIDs is not nil, the line items or labels of the payment are replaced as well.
+// PlannedDate and PlannedAmount are written as they are, so realizing a planned payment is also done with this method.
+// The payment is updated only if it is still at payment.Version, otherwise ErrVersionConflict is returned.
+func (d *dbImpl) UpdatePayment(payment Payment, audit Audit[Payment]) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	query := `UPDATE payment SET money_pool_id = $1, date = $2, title = $3, amount = $4, description = $5, is_planned = $6, store_id = $7,
+			  planned_date = $8, planned_amount = $9, version = version + 1
+			  WHERE id = $10 AND version = $11`
+	result, err := tx.Exec(query, payment.MoneyPoolID, payment.Date, payment.Title, payment.Amount, payment.Description, payment.IsPlanned, payment.StoreID,
+		payment.PlannedDate, payment.PlannedAmount, payment.ID, payment.Version)
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("error updating payment: %v", err)
 	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not determine rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		tx.Rollback()
+		return fmt.Errorf("%w: payment %s is not at version %d", ErrVersionConflict, payment.ID, payment.Version)
+	}
+
+	if payment.Items != nil {
+		_, err = tx.Exec(`DELETE FROM item_payment WHERE payment_id = $1`, payment.ID)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error clearing payment items: %v", err)
+		}
+		err = insertPaymentItems(tx, payment.ID, payment.Items)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if payment.LabelIDs != nil {
+		_, err = tx.Exec(`DELETE FROM payment_label WHERE payment_id = $1`, payment.ID)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error clearing payment labels: %v", err)
+		}
+		err = insertPaymentLabels(tx, payment.ID, payment.LabelIDs)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = writeAudit(tx, audit, payment)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing payment update: %v", err)
+	}
 	return nil
 }
 
-func (d *dbImpl) DeletePayment(id string) error {
+// GetOverduePlannedPayments retrieves the planned payments of the user's money pools dated before `before`, oldest first.
+func (d *dbImpl) GetOverduePlannedPayments(userID string, before time.Time) ([]Payment, error) {
+	var payments []Payment
+	query := `SELECT p.id, p.money_pool_id, p.date, p.title, p.amount, p.description, p.is_planned, p.store_id, s.name AS store_name, p.recurring_payment_id,
+			  p.planned_date, p.planned_amount, p.transfer_id, p.version
+			  FROM payment p
+			  JOIN money_pool mp ON mp.id = p.money_pool_id
+			  LEFT JOIN store s ON s.id = p.store_id
+			  WHERE mp.owner_id = $1 AND NOT mp.is_deleted AND p.is_planned AND p.date < $2
+			  ORDER BY p.date, p.id`
+	err := d.db.Select(&payments, query, userID, before)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching overdue planned payments: %v", err)
+	}
+	return payments, nil
+}
+
+func (d *dbImpl) DeletePayment(id string, audit Audit[string]) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	// 外部キー制約に違反しないよう、先に明細を削除します。
+	_, err = tx.Exec(`DELETE FROM item_payment WHERE payment_id = $1`, id)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting items of payment with id %s: %v", id, err)
+	}
+
 	// DELETE SQL文を実行します。
 	query := `DELETE FROM payment WHERE id = $1`
-	result, err := d.db.Exec(query, id)
+	result, err := tx.Exec(query, id)
 	if err != nil {
+		tx.Rollback()
 		// SQL実行エラーを返します。
 		return fmt.Errorf("error deleting payment with id %s: %v", id, err)
 	}
@@ -59,15 +341,23 @@ func (d *dbImpl) DeletePayment(id string) error {
 	// 影響を受けた行の数を確認します。
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
+		tx.Rollback()
 		// 影響を受けた行数の確認エラーを返します。
 		return fmt.Errorf("error getting rows affected during deletion of payment with id %s: %v", id, err)
 	}
 
 	if rowsAffected == 0 {
+		tx.Rollback()
 		// 削除する行がなかった場合、エラーを返します。
 		return fmt.Errorf("no payment found with id %s", id)
 	}
 
+	err = writeAudit(tx, audit, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// 削除が成功した場合、nilを返します。
-	return nil
+	return tx.Commit()
 }
@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"fmt"
+)
+
+// SetMoneyPoolProvider allocates a money pool to a money provider, or removes the allocation if moneyProviderID is nil.
+func (d *dbImpl) SetMoneyPoolProvider(moneyPoolID string, moneyProviderID *string, audit Audit[string]) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	result, err := tx.Exec(`UPDATE money_pool SET money_provider_id = $1, version = version + 1 WHERE id = $2 AND is_deleted = false`, moneyProviderID, moneyPoolID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not allocate money pool to money provider: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not determine rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		tx.Rollback()
+		return fmt.Errorf("no rows affected, perhaps the money pool with id %s does not exist", moneyPoolID)
+	}
+
+	err = writeAudit(tx, audit, moneyPoolID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// NewReconciliation records a reconciliation and its entries in a single transaction.
+func (d *dbImpl) NewReconciliation(reconciliation Reconciliation) (Reconciliation, error) {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return Reconciliation{}, fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	query := `INSERT INTO reconciliation (creator_id, reconciled_at, note)
+			  VALUES ($1, $2, $3)
+			  RETURNING id`
+	err = tx.QueryRow(query, reconciliation.CreatorID, reconciliation.ReconciledAt, reconciliation.Note).Scan(&reconciliation.ID)
+	if err != nil {
+		tx.Rollback()
+		return Reconciliation{}, fmt.Errorf("failed to create new Reconciliation: %v", err)
+	}
+
+	entryQuery := `INSERT INTO reconciliation_entry (reconciliation_id, money_provider_id, money_provider_name, currency, provider_balance, allocated_pool_sum, difference)
+				   VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	for i, entry := range reconciliation.Entries {
+		_, err = tx.Exec(entryQuery, reconciliation.ID, entry.MoneyProviderID, entry.MoneyProviderName, entry.Currency, entry.ProviderBalance, entry.AllocatedPoolSum, entry.Difference)
+		if err != nil {
+			tx.Rollback()
+			return Reconciliation{}, fmt.Errorf("failed to add entry of money provider %s to reconciliation: %v", entry.MoneyProviderName, err)
+		}
+		reconciliation.Entries[i].ReconciliationID = reconciliation.ID
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Reconciliation{}, fmt.Errorf("failed to commit new Reconciliation: %v", err)
+	}
+	return reconciliation, nil
+}
+
+// GetReconciliationsByUserID retrieves the reconciliation history of a user with their entries, newest first.
+func (d *dbImpl) GetReconciliationsByUserID(userID string) ([]Reconciliation, error) {
+	var reconciliations []Reconciliation
+	query := `SELECT id, creator_id, reconciled_at, note FROM reconciliation WHERE creator_id = $1 ORDER BY reconciled_at DESC, id DESC`
+	err := d.db.Select(&reconciliations, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching reconciliations: %v", err)
+	}
+
+	var entries []ReconciliationEntry
+	entryQuery := `SELECT e.reconciliation_id, e.money_provider_id, e.money_provider_name, e.currency, e.provider_balance, e.allocated_pool_sum, e.difference
+				   FROM reconciliation_entry e
+				   JOIN reconciliation r ON r.id = e.reconciliation_id
+				   WHERE r.creator_id = $1
+				   ORDER BY e.money_provider_name`
+	err = d.db.Select(&entries, entryQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching reconciliation entries: %v", err)
+	}
+
+	entriesByReconciliation := make(map[string][]ReconciliationEntry)
+	for _, entry := range entries {
+		entriesByReconciliation[entry.ReconciliationID] = append(entriesByReconciliation[entry.ReconciliationID], entry)
+	}
+	for i := range reconciliations {
+		reconciliations[i].Entries = entriesByReconciliation[reconciliations[i].ID]
+	}
+	return reconciliations, nil
+}
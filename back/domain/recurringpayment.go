@@ -0,0 +1,381 @@
+package domain
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const recurringPaymentColumns = `id, money_pool_id, creator_id, title, amount, description, store_id, frequency, interval_count,
+			  weekday, nth_week, start_date, end_date, occurrence_count, is_paused, generated_until`
+
+// Occurrences returns the dates on which the rule occurs after `after` (exclusive, or from the start if it is not valid)
+// up to `until` (inclusive).
+func (r RecurringPayment) Occurrences(after sql.NullTime, until time.Time) []time.Time {
+	var dates []time.Time
+	count := 0
+	// 第N曜日が存在しない月があるため、期間ごとに調べて発生回数を数える
+	for period := 0; ; period++ {
+		date, ok := r.occurrenceInPeriod(period)
+		if date.After(until) || (r.EndDate.Valid && date.After(r.EndDate.Time)) {
+			break
+		}
+		if !ok || date.Before(r.StartDate) {
+			continue
+		}
+		if r.OccurrenceCount != nil && count >= *r.OccurrenceCount {
+			break
+		}
+		count++
+		if !after.Valid || date.After(after.Time) {
+			dates = append(dates, date)
+		}
+	}
+	return dates
+}
+
+// occurrenceInPeriod returns the date of the rule in the n-th period counted from StartDate.
+// ok is false if the rule does not occur in that period, e.g. there is no 5th Monday in the month.
+// Even then the returned date lies within the period so that the caller can stop at the end of the range.
+func (r RecurringPayment) occurrenceInPeriod(n int) (date time.Time, ok bool) {
+	start := r.StartDate
+	interval := r.IntervalCount
+	if interval < 1 {
+		interval = 1
+	}
+
+	switch r.Frequency {
+	case RecurrenceDaily:
+		return start.AddDate(0, 0, n*interval), true
+	case RecurrenceWeekly:
+		return start.AddDate(0, 0, 7*n*interval), true
+	case RecurrenceYearly:
+		return addMonthsClamped(start, 12*n*interval), true
+	default:
+		if r.Weekday != nil && r.NthWeek != nil {
+			firstOfMonth := time.Date(start.Year(), start.Month()+time.Month(n*interval), 1, 0, 0, 0, 0, start.Location())
+			return nthWeekdayOfMonth(firstOfMonth, time.Weekday(*r.Weekday), *r.NthWeek)
+		}
+		return addMonthsClamped(start, n*interval), true
+	}
+}
+
+// addMonthsClamped adds months to t, using the last day of the month if the day does not exist (e.g. 31st or February 29th).
+func addMonthsClamped(t time.Time, months int) time.Time {
+	firstOfMonth := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return firstOfMonth.AddDate(0, 0, day-1)
+}
+
+// nthWeekdayOfMonth returns the nth weekday of the month of firstOfMonth. nth = -1 means the last one.
+func nthWeekdayOfMonth(firstOfMonth time.Time, weekday time.Weekday, nth int) (time.Time, bool) {
+	if nth == -1 {
+		lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+		offset := (int(lastOfMonth.Weekday()) - int(weekday) + 7) % 7
+		return lastOfMonth.AddDate(0, 0, -offset), true
+	}
+	offset := (int(weekday) - int(firstOfMonth.Weekday()) + 7) % 7
+	date := firstOfMonth.AddDate(0, 0, offset+7*(nth-1))
+	if date.Month() != firstOfMonth.Month() {
+		return firstOfMonth.AddDate(0, 1, -1), false
+	}
+	return date, true
+}
+
+// RecurringPaymentAudit builds the audit logs of a change of a recurring payment rule.
+// It is called inside the transaction of the change, so that the change and its audit logs are committed together.
+// rule is the rule after the change, or nil if it was deleted. created and deleted are the planned payments the change created and deleted.
+type RecurringPaymentAudit func(rule *RecurringPayment, created []Payment, deleted []Payment) ([]AuditLog, error)
+
+// writeRecurringPaymentAudit inserts the audit logs built by audit in the transaction of the change.
+func writeRecurringPaymentAudit(tx *sqlx.Tx, audit RecurringPaymentAudit, rule *RecurringPayment, created []Payment, deleted []Payment) error {
+	if audit == nil {
+		return nil
+	}
+	auditLogs, err := audit(rule, created, deleted)
+	if err != nil {
+		return err
+	}
+	for _, auditLog := range auditLogs {
+		if err := insertAuditLog(tx, auditLog); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewRecurringPayment creates a rule and its planned payments up to `until` in one transaction.
+func (d *dbImpl) NewRecurringPayment(rule RecurringPayment, until time.Time, audit RecurringPaymentAudit) (RecurringPayment, error) {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return RecurringPayment{}, fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	query := `INSERT INTO recurring_payment (money_pool_id, creator_id, title, amount, description, store_id, frequency, interval_count,
+			  weekday, nth_week, start_date, end_date, occurrence_count, is_paused, generated_until)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+			  RETURNING id`
+	err = tx.QueryRow(query, rule.MoneyPoolID, rule.CreatorID, rule.Title, rule.Amount, rule.Description, rule.StoreID, rule.Frequency, rule.IntervalCount,
+		rule.Weekday, rule.NthWeek, rule.StartDate, rule.EndDate, rule.OccurrenceCount, rule.IsPaused, rule.GeneratedUntil).Scan(&rule.ID)
+	if err != nil {
+		tx.Rollback()
+		return RecurringPayment{}, fmt.Errorf("failed to create new RecurringPayment: %v", err)
+	}
+
+	var created []Payment
+	if !rule.IsPaused {
+		created, err = generateOccurrences(tx, &rule, until)
+		if err != nil {
+			tx.Rollback()
+			return RecurringPayment{}, err
+		}
+	}
+
+	if err := writeRecurringPaymentAudit(tx, audit, &rule, created, nil); err != nil {
+		tx.Rollback()
+		return RecurringPayment{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return RecurringPayment{}, fmt.Errorf("error committing recurring payment: %v", err)
+	}
+	return rule, nil
+}
+
+// GetRecurringPayment retrieves a single recurring payment rule by its ID.
+func (d *dbImpl) GetRecurringPayment(id string) (RecurringPayment, error) {
+	var rule RecurringPayment
+	query := `SELECT ` + recurringPaymentColumns + ` FROM recurring_payment WHERE id = $1`
+	err := d.db.Get(&rule, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RecurringPayment{}, fmt.Errorf("%w: recurring payment %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return RecurringPayment{}, fmt.Errorf("error fetching recurring payment: %v", err)
+	}
+	return rule, nil
+}
+
+// GetRecurringPaymentsByUserID retrieves all recurring payment rules created by a specific user.
+func (d *dbImpl) GetRecurringPaymentsByUserID(userID string) ([]RecurringPayment, error) {
+	var rules []RecurringPayment
+	query := `SELECT ` + recurringPaymentColumns + ` FROM recurring_payment WHERE creator_id = $1 ORDER BY start_date, id`
+	err := d.db.Select(&rules, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching recurring payments: %v", err)
+	}
+	return rules, nil
+}
+
+// GetActiveRecurringPaymentIDs retrieves the IDs of rules which are not paused and whose money pool is not deleted.
+func (d *dbImpl) GetActiveRecurringPaymentIDs() ([]string, error) {
+	var ids []string
+	query := `SELECT r.id FROM recurring_payment r
+			  JOIN money_pool mp ON mp.id = r.money_pool_id
+			  WHERE NOT r.is_paused AND NOT mp.is_deleted
+			  ORDER BY r.id`
+	err := d.db.Select(&ids, query)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching active recurring payments: %v", err)
+	}
+	return ids, nil
+}
+
+// UpdateRecurringPayment updates a rule, removes its planned payments on or after `from` and,
+// unless the rule is paused, creates them again with the new details up to `until`, all in one transaction.
+func (d *dbImpl) UpdateRecurringPayment(rule RecurringPayment, from time.Time, until time.Time, audit RecurringPaymentAudit) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	query := `UPDATE recurring_payment SET money_pool_id = $1, title = $2, amount = $3, description = $4, store_id = $5, frequency = $6,
+			  interval_count = $7, weekday = $8, nth_week = $9, start_date = $10, end_date = $11, occurrence_count = $12, is_paused = $13,
+			  generated_until = $14
+			  WHERE id = $15`
+	_, err = tx.Exec(query, rule.MoneyPoolID, rule.Title, rule.Amount, rule.Description, rule.StoreID, rule.Frequency,
+		rule.IntervalCount, rule.Weekday, rule.NthWeek, rule.StartDate, rule.EndDate, rule.OccurrenceCount, rule.IsPaused,
+		rule.GeneratedUntil, rule.ID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error updating recurring payment: %v", err)
+	}
+
+	deleted, err := deletePlannedOccurrences(tx, rule.ID, from)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var created []Payment
+	if !rule.IsPaused {
+		created, err = generateOccurrences(tx, &rule, until)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := writeRecurringPaymentAudit(tx, audit, &rule, created, deleted); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing recurring payment update: %v", err)
+	}
+	return nil
+}
+
+// DeleteRecurringPayment deletes a rule together with its planned payments on or after `from`.
+// Payments which already happened are kept and detached from the rule.
+func (d *dbImpl) DeleteRecurringPayment(id string, from time.Time, audit RecurringPaymentAudit) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	deleted, err := deletePlannedOccurrences(tx, id, from)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	result, err := tx.Exec(`DELETE FROM recurring_payment WHERE id = $1`, id)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not delete recurring payment: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not determine rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		tx.Rollback()
+		return fmt.Errorf("no rows affected, perhaps the recurring payment with id %s does not exist", id)
+	}
+
+	if err := writeRecurringPaymentAudit(tx, audit, nil, nil, deleted); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// deletePlannedOccurrences deletes the payments of a rule on or after `from` which are still planned, and returns them.
+func deletePlannedOccurrences(tx *sqlx.Tx, ruleID string, from time.Time) ([]Payment, error) {
+	// 外部キー制約に違反しないよう、先に明細を削除します。ラベルはON DELETE CASCADEで削除されます。
+	_, err := tx.Exec(`DELETE FROM item_payment WHERE payment_id IN (
+			  SELECT id FROM payment WHERE recurring_payment_id = $1 AND is_planned AND date >= $2)`, ruleID, from)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting items of planned payments of recurring payment %s: %v", ruleID, err)
+	}
+	var deleted []Payment
+	err = tx.Select(&deleted, `DELETE FROM payment WHERE recurring_payment_id = $1 AND is_planned AND date >= $2
+			  RETURNING id, money_pool_id, date, title, amount, description, is_planned, store_id, recurring_payment_id,
+			  planned_date, planned_amount, transfer_id, version`, ruleID, from)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting planned payments of recurring payment %s: %v", ruleID, err)
+	}
+	return deleted, nil
+}
+
+// GenerateRecurringPayments creates planned payments for the occurrences of a rule up to `until`
+// that have not been created yet, and returns how many were created.
+// The rule row is locked so that concurrent generators never create the same occurrence twice.
+func (d *dbImpl) GenerateRecurringPayments(id string, until time.Time, audit RecurringPaymentAudit) (int, error) {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	var rule RecurringPayment
+	err = tx.Get(&rule, `SELECT `+recurringPaymentColumns+` FROM recurring_payment WHERE id = $1 FOR UPDATE`, id)
+	if err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("error fetching recurring payment: %v", err)
+	}
+	if rule.IsPaused || (rule.GeneratedUntil.Valid && !rule.GeneratedUntil.Time.Before(until)) {
+		tx.Rollback()
+		return 0, nil
+	}
+
+	created, err := generateOccurrences(tx, &rule, until)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if len(created) > 0 {
+		if err := writeRecurringPaymentAudit(tx, audit, &rule, created, nil); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("error committing recurring payments: %v", err)
+	}
+	return len(created), nil
+}
+
+// generateOccurrences creates planned payments for the occurrences of a rule after its GeneratedUntil up to `until`,
+// and moves GeneratedUntil of the rule to `until`.
+// Dates that already have a payment of the rule are skipped, e.g. an occurrence that was realized before its planned date.
+func generateOccurrences(tx *sqlx.Tx, rule *RecurringPayment, until time.Time) ([]Payment, error) {
+	// 実績にした支払いは日付が変わっていることがあるので、予定していた日で比べる
+	var coveredDates []time.Time
+	err := tx.Select(&coveredDates, `SELECT COALESCE(planned_date, date) FROM payment WHERE recurring_payment_id = $1`, rule.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching payments of recurring payment %s: %v", rule.ID, err)
+	}
+	covered := make(map[string]bool, len(coveredDates))
+	for _, date := range coveredDates {
+		covered[date.Format("2006-01-02")] = true
+	}
+
+	query := `INSERT INTO payment (money_pool_id, date, title, amount, description, is_planned, store_id, recurring_payment_id)
+			  VALUES ($1, $2, $3, $4, $5, TRUE, $6, $7)
+			  RETURNING id, version`
+	var created []Payment
+	for _, date := range rule.Occurrences(rule.GeneratedUntil, until) {
+		if covered[date.Format("2006-01-02")] {
+			continue
+		}
+		payment := Payment{
+			MoneyPoolID:        rule.MoneyPoolID,
+			Date:               date,
+			Title:              rule.Title,
+			Amount:             rule.Amount,
+			Description:        rule.Description,
+			IsPlanned:          true,
+			StoreID:            rule.StoreID,
+			RecurringPaymentID: &rule.ID,
+		}
+		err = tx.QueryRow(query, payment.MoneyPoolID, payment.Date, payment.Title, payment.Amount, payment.Description, payment.StoreID, rule.ID).
+			Scan(&payment.ID, &payment.Version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create payment of recurring payment %s: %v", rule.ID, err)
+		}
+		created = append(created, payment)
+	}
+
+	_, err = tx.Exec(`UPDATE recurring_payment SET generated_until = $1 WHERE id = $2`, until, rule.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error updating generated_until of recurring payment %s: %v", rule.ID, err)
+	}
+	rule.GeneratedUntil = sql.NullTime{Time: until, Valid: true}
+	return created, nil
+}
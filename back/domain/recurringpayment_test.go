@@ -0,0 +1,141 @@
+package domain
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestRecurringPaymentOccurrences(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  RecurringPayment
+		after sql.NullTime
+		until time.Time
+		want  []time.Time
+	}{
+		{
+			name:  "daily",
+			rule:  RecurringPayment{Frequency: RecurrenceDaily, IntervalCount: 1, StartDate: date(2024, 1, 30)},
+			until: date(2024, 2, 2),
+			want:  []time.Time{date(2024, 1, 30), date(2024, 1, 31), date(2024, 2, 1), date(2024, 2, 2)},
+		},
+		{
+			name:  "every other week",
+			rule:  RecurringPayment{Frequency: RecurrenceWeekly, IntervalCount: 2, StartDate: date(2024, 1, 1)},
+			until: date(2024, 1, 31),
+			want:  []time.Time{date(2024, 1, 1), date(2024, 1, 15), date(2024, 1, 29)},
+		},
+		{
+			name:  "monthly on the 31st is clamped to the end of shorter months",
+			rule:  RecurringPayment{Frequency: RecurrenceMonthly, IntervalCount: 1, StartDate: date(2024, 1, 31)},
+			until: date(2024, 4, 30),
+			want:  []time.Time{date(2024, 1, 31), date(2024, 2, 29), date(2024, 3, 31), date(2024, 4, 30)},
+		},
+		{
+			name:  "yearly on February 29th",
+			rule:  RecurringPayment{Frequency: RecurrenceYearly, IntervalCount: 1, StartDate: date(2024, 2, 29)},
+			until: date(2028, 3, 1),
+			want:  []time.Time{date(2024, 2, 29), date(2025, 2, 28), date(2026, 2, 28), date(2027, 2, 28), date(2028, 2, 29)},
+		},
+		{
+			name:  "5th Monday skips months without one",
+			rule:  RecurringPayment{Frequency: RecurrenceMonthly, IntervalCount: 1, StartDate: date(2024, 1, 1), Weekday: intPtr(int(time.Monday)), NthWeek: intPtr(5)},
+			until: date(2024, 4, 30),
+			want:  []time.Time{date(2024, 1, 29), date(2024, 4, 29)},
+		},
+		{
+			name:  "last Friday",
+			rule:  RecurringPayment{Frequency: RecurrenceMonthly, IntervalCount: 1, StartDate: date(2024, 1, 1), Weekday: intPtr(int(time.Friday)), NthWeek: intPtr(-1)},
+			until: date(2024, 3, 31),
+			want:  []time.Time{date(2024, 1, 26), date(2024, 2, 23), date(2024, 3, 29)},
+		},
+		{
+			name:  "nth weekday before the start date is skipped",
+			rule:  RecurringPayment{Frequency: RecurrenceMonthly, IntervalCount: 1, StartDate: date(2024, 1, 15), Weekday: intPtr(int(time.Monday)), NthWeek: intPtr(1)},
+			until: date(2024, 3, 31),
+			want:  []time.Time{date(2024, 2, 5), date(2024, 3, 4)},
+		},
+		{
+			name:  "end date",
+			rule:  RecurringPayment{Frequency: RecurrenceDaily, IntervalCount: 1, StartDate: date(2024, 1, 1), EndDate: sql.NullTime{Time: date(2024, 1, 3), Valid: true}},
+			until: date(2024, 1, 10),
+			want:  []time.Time{date(2024, 1, 1), date(2024, 1, 2), date(2024, 1, 3)},
+		},
+		{
+			name:  "occurrence count includes dates before after",
+			rule:  RecurringPayment{Frequency: RecurrenceDaily, IntervalCount: 1, StartDate: date(2024, 1, 1), OccurrenceCount: intPtr(3)},
+			after: sql.NullTime{Time: date(2024, 1, 1), Valid: true},
+			until: date(2024, 1, 10),
+			want:  []time.Time{date(2024, 1, 2), date(2024, 1, 3)},
+		},
+		{
+			name:  "until before the start date",
+			rule:  RecurringPayment{Frequency: RecurrenceMonthly, IntervalCount: 1, StartDate: date(2024, 1, 1)},
+			until: date(2023, 12, 31),
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Occurrences(tt.after, tt.until); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Occurrences() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddMonthsClamped(t *testing.T) {
+	tests := []struct {
+		t      time.Time
+		months int
+		want   time.Time
+	}{
+		{date(2024, 1, 15), 1, date(2024, 2, 15)},
+		{date(2024, 1, 31), 1, date(2024, 2, 29)},
+		{date(2023, 1, 31), 1, date(2023, 2, 28)},
+		{date(2024, 3, 31), -1, date(2024, 2, 29)},
+		{date(2024, 12, 31), 2, date(2025, 2, 28)},
+		{date(2024, 2, 29), 12, date(2025, 2, 28)},
+	}
+	for _, tt := range tests {
+		if got := addMonthsClamped(tt.t, tt.months); !got.Equal(tt.want) {
+			t.Errorf("addMonthsClamped(%v, %d) = %v, want %v", tt.t, tt.months, got, tt.want)
+		}
+	}
+}
+
+func TestNthWeekdayOfMonth(t *testing.T) {
+	tests := []struct {
+		firstOfMonth time.Time
+		weekday      time.Weekday
+		nth          int
+		want         time.Time
+		wantOK       bool
+	}{
+		{date(2024, 1, 1), time.Monday, 1, date(2024, 1, 1), true},
+		{date(2024, 1, 1), time.Sunday, 1, date(2024, 1, 7), true},
+		{date(2024, 1, 1), time.Wednesday, 3, date(2024, 1, 17), true},
+		{date(2024, 1, 1), time.Monday, 5, date(2024, 1, 29), true},
+		{date(2024, 2, 1), time.Monday, 5, date(2024, 2, 29), false},
+		{date(2024, 2, 1), time.Thursday, 5, date(2024, 2, 29), true},
+		{date(2024, 2, 1), time.Thursday, -1, date(2024, 2, 29), true},
+		{date(2024, 3, 1), time.Sunday, -1, date(2024, 3, 31), true},
+		{date(2024, 3, 1), time.Monday, -1, date(2024, 3, 25), true},
+	}
+	for _, tt := range tests {
+		got, ok := nthWeekdayOfMonth(tt.firstOfMonth, tt.weekday, tt.nth)
+		if !got.Equal(tt.want) || ok != tt.wantOK {
+			t.Errorf("nthWeekdayOfMonth(%v, %v, %d) = %v, %v, want %v, %v", tt.firstOfMonth, tt.weekday, tt.nth, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
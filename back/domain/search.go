@@ -0,0 +1,121 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// visibleMoneyPoolCondition restricts the money pool mp to the ones the user of the given parameter may see,
+// with the same rules as GetMoneyPool: the owner, public pools, and restricted pools shared with one of the user's groups.
+// The parameter is NULL if the user is not logged in.
+func visibleMoneyPoolCondition(userParam string) string {
+	return `NOT mp.is_deleted AND (mp.owner_id = ` + userParam + ` OR mp.type = '` + PublicTypePublic + `'
+			  OR (mp.type = '` + PublicTypeRestricted + `' AND EXISTS (
+				  SELECT 1 FROM restricted_publication_scope rps
+				  JOIN user_group_membership ugm ON ugm.group_id = rps.group_id
+				  WHERE rps.pool_id = mp.id AND ugm.user_id = ` + userParam + `)))`
+}
+
+// searchTermsCondition returns a condition that every term appears in at least one of the columns.
+// The terms are matched as substrings, which also works for Japanese text without word boundaries.
+func searchTermsCondition(terms []string, columns []string, arg func(interface{}) string) string {
+	var conditions []string
+	for _, term := range terms {
+		param := arg("%" + escapeLike(term) + "%")
+		var matches []string
+		for _, column := range columns {
+			matches = append(matches, column+` ILIKE `+param+` ESCAPE '\'`)
+		}
+		conditions = append(conditions, "("+strings.Join(matches, " OR ")+")")
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// SearchPayments searches the payments in the money pools visible to the user whose title, description,
+// money pool name or store name contain all the terms, newest first.
+// loginUserID is empty if the user is not logged in. from and to limit the dates if they are not nil.
+func (d *dbImpl) SearchPayments(loginUserID string, terms []string, from *time.Time, to *time.Time, limit int) ([]SearchPaymentResult, error) {
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var user interface{}
+	if loginUserID != "" {
+		user = loginUserID
+	}
+	conditions := []string{
+		visibleMoneyPoolCondition(arg(user) + "::bigint"),
+		searchTermsCondition(terms, []string{"p.title", "p.description", "mp.name", "s.name"}, arg),
+	}
+	if from != nil {
+		conditions = append(conditions, "p.date >= "+arg(*from))
+	}
+	if to != nil {
+		conditions = append(conditions, "p.date <= "+arg(*to))
+	}
+
+	query := `SELECT p.id, p.money_pool_id, p.date, p.title, p.amount, p.description, p.is_planned, p.store_id, s.name AS store_name, p.recurring_payment_id,
+			  p.planned_date, p.planned_amount, p.transfer_id, p.version, mp.name AS money_pool_name
+			  FROM payment p
+			  JOIN money_pool mp ON mp.id = p.money_pool_id
+			  LEFT JOIN store s ON s.id = p.store_id
+			  WHERE ` + strings.Join(conditions, " AND ") + `
+			  ORDER BY p.date DESC, p.id DESC
+			  LIMIT ` + arg(limit)
+
+	var results []SearchPaymentResult
+	err := d.db.Select(&results, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error searching payments: %v", err)
+	}
+	return results, nil
+}
+
+// SearchMoneyPools searches the money pools visible to the user whose name contains all the terms.
+func (d *dbImpl) SearchMoneyPools(loginUserID string, terms []string, limit int) ([]MoneyPool, error) {
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var user interface{}
+	if loginUserID != "" {
+		user = loginUserID
+	}
+	query := `SELECT mp.* FROM money_pool mp
+			  WHERE ` + visibleMoneyPoolCondition(arg(user)+"::bigint") + ` AND ` + searchTermsCondition(terms, []string{"mp.name"}, arg) + `
+			  ORDER BY mp.name, mp.id
+			  LIMIT ` + arg(limit)
+
+	var moneyPools []MoneyPool
+	err := d.db.Select(&moneyPools, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error searching money pools: %v", err)
+	}
+	return moneyPools, nil
+}
+
+// SearchStores searches the stores created by the user whose name contains all the terms.
+func (d *dbImpl) SearchStores(userID string, terms []string, limit int) ([]Store, error) {
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	query := `SELECT s.id, s.name, s.creator_id FROM store s
+			  WHERE s.creator_id = ` + arg(userID) + ` AND ` + searchTermsCondition(terms, []string{"s.name"}, arg) + `
+			  ORDER BY s.name, s.id
+			  LIMIT ` + arg(limit)
+
+	var stores []Store
+	err := d.db.Select(&stores, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error searching stores: %v", err)
+	}
+	return stores, nil
+}
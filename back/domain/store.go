@@ -1,6 +1,8 @@
 package domain
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 )
 
@@ -22,6 +24,9 @@ func (d *dbImpl) GetStore(id string) (Store, error) {
 	var store Store
 	query := `SELECT id, name, creator_id FROM store WHERE id = $1`
 	err := d.db.Get(&store, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Store{}, fmt.Errorf("%w: store %s", ErrNotFound, id)
+	}
 	if err != nil {
 		return Store{}, fmt.Errorf("error fetching store: %v", err)
 	}
@@ -48,3 +53,36 @@ func (d *dbImpl) UpdateStore(store Store) error {
 	}
 	return nil
 }
+
+// DeleteStore deletes a store. Payments referencing the store are detached from it instead of being deleted.
+func (d *dbImpl) DeleteStore(id string) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	// 外部キー制約に違反しないよう、店舗を参照している支払いから店舗を外します。
+	_, err = tx.Exec(`UPDATE payment SET store_id = NULL, version = version + 1 WHERE store_id = $1`, id)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to detach payments from store %s: %v", id, err)
+	}
+
+	result, err := tx.Exec(`DELETE FROM store WHERE id = $1`, id)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not delete store: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not determine rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		tx.Rollback()
+		return fmt.Errorf("no rows affected, perhaps the store with id %s does not exist", id)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,158 @@
+package domain
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// transferQuery selects transfers together with their two legs. The leg leaving a pool is the negative one.
+const transferQuery = `SELECT t.id, t.creator_id, t.date, t.title, t.description, t.is_planned,
+			  f.id AS from_payment_id, f.money_pool_id AS from_money_pool_id, -f.amount AS from_amount,
+			  tp.id AS to_payment_id, tp.money_pool_id AS to_money_pool_id, tp.amount AS to_amount
+			  FROM transfer t
+			  JOIN payment f ON f.transfer_id = t.id AND f.amount < 0
+			  JOIN payment tp ON tp.transfer_id = t.id AND tp.amount > 0`
+
+// NewTransfer creates a transfer and both of its legs in a single transaction.
+func (d *dbImpl) NewTransfer(transfer Transfer, audit Audit[Transfer]) (Transfer, error) {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return Transfer{}, fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	query := `INSERT INTO transfer (creator_id, date, title, description, is_planned)
+			  VALUES ($1, $2, $3, $4, $5)
+			  RETURNING id`
+	err = tx.QueryRow(query, transfer.CreatorID, transfer.Date, transfer.Title, transfer.Description, transfer.IsPlanned).Scan(&transfer.ID)
+	if err != nil {
+		tx.Rollback()
+		return Transfer{}, fmt.Errorf("failed to create new Transfer: %v", err)
+	}
+
+	legQuery := `INSERT INTO payment (money_pool_id, date, title, amount, description, is_planned, transfer_id)
+				 VALUES ($1, $2, $3, $4, $5, $6, $7)
+				 RETURNING id`
+	err = tx.QueryRow(legQuery, transfer.FromMoneyPoolID, transfer.Date, transfer.Title, transfer.FromAmount.Neg(), transfer.Description, transfer.IsPlanned, transfer.ID).Scan(&transfer.FromPaymentID)
+	if err != nil {
+		tx.Rollback()
+		return Transfer{}, fmt.Errorf("failed to create source leg of transfer: %v", err)
+	}
+	err = tx.QueryRow(legQuery, transfer.ToMoneyPoolID, transfer.Date, transfer.Title, transfer.ToAmount, transfer.Description, transfer.IsPlanned, transfer.ID).Scan(&transfer.ToPaymentID)
+	if err != nil {
+		tx.Rollback()
+		return Transfer{}, fmt.Errorf("failed to create destination leg of transfer: %v", err)
+	}
+
+	err = writeAudit(tx, audit, transfer)
+	if err != nil {
+		tx.Rollback()
+		return Transfer{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Transfer{}, fmt.Errorf("failed to commit new Transfer: %v", err)
+	}
+	return transfer, nil
+}
+
+// GetTransfer retrieves a single transfer with its legs by its ID.
+func (d *dbImpl) GetTransfer(id string) (Transfer, error) {
+	var transfer Transfer
+	err := d.db.Get(&transfer, transferQuery+` WHERE t.id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Transfer{}, fmt.Errorf("%w: transfer %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return Transfer{}, fmt.Errorf("error fetching transfer: %v", err)
+	}
+	return transfer, nil
+}
+
+// GetTransfersByUserID retrieves all transfers created by a specific user, newest first.
+func (d *dbImpl) GetTransfersByUserID(userID string) ([]Transfer, error) {
+	var transfers []Transfer
+	err := d.db.Select(&transfers, transferQuery+` WHERE t.creator_id = $1 ORDER BY t.date DESC, t.id DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching transfers: %v", err)
+	}
+	return transfers, nil
+}
+
+// UpdateTransfer updates a transfer and both of its legs in a single transaction.
+func (d *dbImpl) UpdateTransfer(transfer Transfer, audit Audit[Transfer]) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	query := `UPDATE transfer SET date = $1, title = $2, description = $3, is_planned = $4 WHERE id = $5`
+	_, err = tx.Exec(query, transfer.Date, transfer.Title, transfer.Description, transfer.IsPlanned, transfer.ID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error updating transfer: %v", err)
+	}
+
+	legQuery := `UPDATE payment SET money_pool_id = $1, date = $2, title = $3, amount = $4, description = $5, is_planned = $6, version = version + 1
+				 WHERE id = $7 AND transfer_id = $8`
+	_, err = tx.Exec(legQuery, transfer.FromMoneyPoolID, transfer.Date, transfer.Title, transfer.FromAmount.Neg(), transfer.Description, transfer.IsPlanned, transfer.FromPaymentID, transfer.ID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error updating source leg of transfer: %v", err)
+	}
+	_, err = tx.Exec(legQuery, transfer.ToMoneyPoolID, transfer.Date, transfer.Title, transfer.ToAmount, transfer.Description, transfer.IsPlanned, transfer.ToPaymentID, transfer.ID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error updating destination leg of transfer: %v", err)
+	}
+
+	err = writeAudit(tx, audit, transfer)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing transfer update: %v", err)
+	}
+	return nil
+}
+
+// DeleteTransfer deletes a transfer and both of its legs in a single transaction.
+func (d *dbImpl) DeleteTransfer(id string, audit Audit[string]) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM payment WHERE transfer_id = $1`, id)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting legs of transfer with id %s: %v", id, err)
+	}
+
+	result, err := tx.Exec(`DELETE FROM transfer WHERE id = $1`, id)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting transfer with id %s: %v", id, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error getting rows affected during deletion of transfer with id %s: %v", id, err)
+	}
+	if rowsAffected == 0 {
+		tx.Rollback()
+		return fmt.Errorf("no transfer found with id %s", id)
+	}
+
+	err = writeAudit(tx, audit, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
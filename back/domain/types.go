@@ -5,6 +5,7 @@ import (
 	"database/sql/driver"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 )
 
@@ -36,7 +37,20 @@ const (
 )
 
 type User struct {
-	ID string `db:"id" json:"id"`
+	ID           string `db:"id" json:"id"`
+	BaseCurrency string `db:"base_currency" json:"base_currency"`
+	// OIDCのクレームから取得した値。ログインのたびに更新される。Emailはemail_verifiedのものだけ
+	Email        *string `db:"email" json:"-"`
+	OIDCName     *string `db:"oidc_name" json:"-"`
+	OIDCPicture  *string `db:"oidc_picture" json:"-"`
+	OIDCLocale   *string `db:"oidc_locale" json:"-"`
+	OIDCZoneinfo *string `db:"oidc_zoneinfo" json:"-"`
+	// ユーザーが編集した値。nilの場合はOIDCの値を使う
+	Handle      *string `db:"handle" json:"-"`
+	DisplayName *string `db:"display_name" json:"-"`
+	AvatarURL   *string `db:"avatar_url" json:"-"`
+	Locale      *string `db:"locale" json:"-"`
+	Timezone    *string `db:"timezone" json:"-"`
 }
 
 type UserGroup struct {
@@ -52,15 +66,41 @@ type MoneyPool struct {
 	Type        string       `db:"type"`
 	OwnerID     string       `db:"owner_id"`
 	Emoji       string       `db:"emoji"`
+	Currency    string       `db:"currency"`
 	IsDeleted   bool         `db:"is_deleted"`
 	DeletedAt   sql.NullTime `db:"deleted_at"`
+	// MoneyProviderID はこのマネープールのお金を置いているマネープロバイダー。未割り当ての場合はnil
+	MoneyProviderID *string `db:"money_provider_id"`
+	// 予算。BudgetAmount が nil の場合は予算なし
+	BudgetAmount    *Money     `db:"budget_amount"`
+	BudgetPeriod    *string    `db:"budget_period"`
+	BudgetRollover  bool       `db:"budget_rollover"`
+	BudgetStartDate *time.Time `db:"budget_start_date"`
+	// Version は更新するたびに増える。更新時に読み込んだときのバージョンと異なる場合は ErrVersionConflict になる
+	Version int64 `db:"version"`
 }
 
+const (
+	BudgetPeriodWeekly  string = "weekly"
+	BudgetPeriodMonthly string = "monthly"
+	BudgetPeriodYearly  string = "yearly"
+)
+
 type MoneyProvider struct {
-	ID        string  `db:"id"`
-	Name      string  `db:"name"`
-	CreatorID string  `db:"creator_id"`
-	Balance   float64 `db:"balance"`
+	ID        string `db:"id"`
+	Name      string `db:"name"`
+	CreatorID string `db:"creator_id"`
+	Balance   Money  `db:"balance"`
+	Currency  string `db:"currency"`
+	Version   int64  `db:"version"`
+}
+
+// MoneyProviderBalanceSnapshot はマネープロバイダーの残高が変更された時点の記録です。
+type MoneyProviderBalanceSnapshot struct {
+	ID              string    `db:"id"`
+	MoneyProviderID string    `db:"money_provider_id"`
+	Balance         Money     `db:"balance"`
+	RecordedAt      time.Time `db:"recorded_at"`
 }
 
 type Store struct {
@@ -86,16 +126,187 @@ type Payment struct {
 	MoneyPoolID string    `db:"money_pool_id"`
 	Date        time.Time `db:"date"`
 	Title       string    `db:"title"`
-	Amount      float64   `db:"amount"`
+	Amount      Money     `db:"amount"`
 	Description string    `db:"description"`
 	IsPlanned   bool      `db:"is_planned"`
 	StoreID     *string   `db:"store_id"`
+	// StoreName は store を結合して取得した場合のみ設定される
+	StoreName *string `db:"store_name"`
+	// Items はこの取引の明細。nilの場合、UpdatePaymentは既存の明細を変更しない
+	Items []ItemPayment `db:"-"`
+	// LabelIDs はこの取引に付けるラベル。nilの場合、UpdatePaymentは既存のラベルを変更しない
+	LabelIDs []string `db:"-"`
+	// RecurringPaymentID は定期支払いのルールから作成された場合のルールID
+	RecurringPaymentID *string `db:"recurring_payment_id"`
+	// PlannedDate と PlannedAmount は予定の支払いを実績にしたときの元の予定。実績にしていない場合はnil
+	PlannedDate   *time.Time `db:"planned_date"`
+	PlannedAmount *Money     `db:"planned_amount"`
+	// TransferID はマネープール間の振替のレッグの場合の振替ID。レッグは振替としてのみ変更できる
+	TransferID *string `db:"transfer_id"`
+	Version    int64   `db:"version"`
+}
+
+// SearchPaymentResult は検索で見つかった支払いと、そのマネープールの名前です。
+type SearchPaymentResult struct {
+	Payment
+	MoneyPoolName string `db:"money_pool_name"`
+}
+
+// 支払い一覧の並び順。日付と金額のどちらでも、同じ値の支払いはIDの順に並べます。
+const (
+	PaymentSortDateDesc   string = "date_desc"
+	PaymentSortDateAsc    string = "date_asc"
+	PaymentSortAmountDesc string = "amount_desc"
+	PaymentSortAmountAsc  string = "amount_asc"
+)
+
+// PaymentCursor は支払い一覧のページの区切りで、前のページの最後の支払いを表します。
+type PaymentCursor struct {
+	Date   time.Time
+	Amount Money
+	ID     string
+}
+
+// PaymentFilter は支払い一覧の絞り込み・並び順・ページングの条件です。nilや空の条件は使いません。
+type PaymentFilter struct {
+	MoneyPoolIDs []string
+	// From と To は日付の範囲（両端を含む）
+	From      *time.Time
+	To        *time.Time
+	MinAmount *Money
+	MaxAmount *Money
+	IsPlanned *bool
+	// Title はタイトルの部分一致（大文字小文字を区別しない）
+	Title   string
+	StoreID *string
+	LabelID *string
+	// Sort は PaymentSort〜 のいずれか。空の場合は日付の新しい順
+	Sort string
+	// After が指定された場合、その支払いより後ろから返す
+	After *PaymentCursor
+	// Limit は返す件数の上限。0の場合は上限なし
+	Limit int
+}
+
+// Transfer はマネープール間の振替です。
+// 振替元のプールに -FromAmount、振替先のプールに +ToAmount の支払い（レッグ）として記録されます。
+// 通貨が同じプール間では FromAmount と ToAmount は等しくなります。
+type Transfer struct {
+	ID              string    `db:"id"`
+	CreatorID       string    `db:"creator_id"`
+	Date            time.Time `db:"date"`
+	Title           string    `db:"title"`
+	Description     string    `db:"description"`
+	IsPlanned       bool      `db:"is_planned"`
+	FromPaymentID   string    `db:"from_payment_id"`
+	FromMoneyPoolID string    `db:"from_money_pool_id"`
+	FromAmount      Money     `db:"from_amount"`
+	ToPaymentID     string    `db:"to_payment_id"`
+	ToMoneyPoolID   string    `db:"to_money_pool_id"`
+	ToAmount        Money     `db:"to_amount"`
+}
+
+const (
+	RecurrenceDaily   string = "daily"
+	RecurrenceWeekly  string = "weekly"
+	RecurrenceMonthly string = "monthly"
+	RecurrenceYearly  string = "yearly"
+)
+
+// RecurringPayment は定期的な支払いのルールです。
+// StartDate から Frequency と IntervalCount の間隔で発生し、EndDate または OccurrenceCount に達すると終わります。
+// Weekday と NthWeek が設定されている場合、monthly は「第N何曜日」(NthWeek = -1 は最終週) に発生します。
+type RecurringPayment struct {
+	ID              string       `db:"id"`
+	MoneyPoolID     string       `db:"money_pool_id"`
+	CreatorID       string       `db:"creator_id"`
+	Title           string       `db:"title"`
+	Amount          Money        `db:"amount"`
+	Description     string       `db:"description"`
+	StoreID         *string      `db:"store_id"`
+	Frequency       string       `db:"frequency"`
+	IntervalCount   int          `db:"interval_count"`
+	Weekday         *int         `db:"weekday"`
+	NthWeek         *int         `db:"nth_week"`
+	StartDate       time.Time    `db:"start_date"`
+	EndDate         sql.NullTime `db:"end_date"`
+	OccurrenceCount *int         `db:"occurrence_count"`
+	IsPaused        bool         `db:"is_paused"`
+	GeneratedUntil  sql.NullTime `db:"generated_until"`
+}
+
+// ExchangeRate は FromCurrency 1単位が ToCurrency で Rate になることを表します。
+// ValidFrom 以降、次のレートが有効になるまで使われます。
+type ExchangeRate struct {
+	ID           string    `db:"id"`
+	CreatorID    string    `db:"creator_id"`
+	FromCurrency string    `db:"from_currency"`
+	ToCurrency   string    `db:"to_currency"`
+	Rate         Rate      `db:"rate"`
+	ValidFrom    time.Time `db:"valid_from"`
+}
+
+// Reconciliation はマネープロバイダーの残高とマネープールの残高を照合した記録です。
+type Reconciliation struct {
+	ID           string                `db:"id"`
+	CreatorID    string                `db:"creator_id"`
+	ReconciledAt time.Time             `db:"reconciled_at"`
+	Note         string                `db:"note"`
+	Entries      []ReconciliationEntry `db:"-"`
+}
+
+// ReconciliationEntry は照合時点の1つのマネープロバイダーの結果です。金額はプロバイダーの通貨です。
+type ReconciliationEntry struct {
+	ReconciliationID  string  `db:"reconciliation_id"`
+	MoneyProviderID   *string `db:"money_provider_id"`
+	MoneyProviderName string  `db:"money_provider_name"`
+	Currency          string  `db:"currency"`
+	ProviderBalance   Money   `db:"provider_balance"`
+	AllocatedPoolSum  Money   `db:"allocated_pool_sum"`
+	Difference        Money   `db:"difference"`
+}
+
+// PaymentStats はマネープールの支払いの件数と最終日です。
+type PaymentStats struct {
+	PaymentCount int64 `db:"payment_count"`
+	PlannedCount int64 `db:"planned_count"`
+	// LastPaymentDate は予定ではない支払いの最新の日付。支払いがない場合はnil
+	LastPaymentDate *time.Time `db:"last_payment_date"`
+}
+
+// DailyTotal は1日分の取引金額の合計です。
+type DailyTotal struct {
+	Date   time.Time `db:"date"`
+	Amount Money     `db:"amount"`
+}
+
+// PaymentDailyTotal はマネープールごと・日ごとの支払いの合計です。
+type PaymentDailyTotal struct {
+	MoneyPoolID string    `db:"money_pool_id"`
+	Date        time.Time `db:"date"`
+	Amount      Money     `db:"amount"`
 }
 
 type ItemPayment struct {
 	PaymentID string `db:"payment_id"`
 	ItemID    string `db:"item_id"`
+	ItemName  string `db:"item_name"`
 	Quantity  int64  `db:"quantity"`
+	UnitPrice Money  `db:"unit_price"`
+}
+
+type PaymentLabel struct {
+	PaymentID string `db:"payment_id"`
+	LabelID   string `db:"label_id"`
+	LabelName string `db:"label_name"`
+}
+
+// LabelTotal はラベルごとの取引金額の合計です。
+type LabelTotal struct {
+	LabelID      string `db:"label_id"`
+	LabelName    string `db:"label_name"`
+	Total        Money  `db:"total"`
+	PaymentCount int64  `db:"payment_count"`
 }
 
 type UserGroupMembership struct {
@@ -107,3 +318,66 @@ type RestrictedPublicationScope struct {
 	PoolID  string `db:"pool_id"`
 	GroupID string `db:"group_id"`
 }
+
+// AuditLog は1回の変更の記録です。Before と After は変更前後の値のJSONで、作成ではBefore、削除ではAfterがnilになります。
+type AuditLog struct {
+	ID         string `db:"id"`
+	ActorID    string `db:"actor_id"`
+	Action     string `db:"action"`
+	EntityType string `db:"entity_type"`
+	EntityID   string `db:"entity_id"`
+	// MoneyPoolID は変更が属するマネープール。マネープロバイダーやユーザーグループの場合はnil
+	MoneyPoolID *string   `db:"money_pool_id"`
+	Before      *string   `db:"before"`
+	After       *string   `db:"after"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+const (
+	AuditActionCreate  string = "create"
+	AuditActionUpdate  string = "update"
+	AuditActionDelete  string = "delete"
+	AuditActionRestore string = "restore"
+)
+
+const (
+	AuditEntityPayment          string = "payment"
+	AuditEntityMoneyPool        string = "money_pool"
+	AuditEntityMoneyProvider    string = "money_provider"
+	AuditEntityUserGroup        string = "user_group"
+	AuditEntityPublicationScope string = "publication_scope"
+	AuditEntityTransfer         string = "transfer"
+	AuditEntityRecurringPayment string = "recurring_payment"
+)
+
+// AuditLogFilter は変更履歴の絞り込み条件です。MoneyPoolID を指定するとそのマネープールに属するすべての変更を、
+// EntityType と EntityID を指定するとその1件の変更を返します。BeforeID を指定するとそれより古いものだけを返します。
+type AuditLogFilter struct {
+	MoneyPoolID *string
+	EntityType  string
+	EntityID    string
+	BeforeID    *string
+	Limit       int
+}
+
+// APIToken は個人用アクセストークンです。トークン自体は保存せず、TokenHash にSHA-256のハッシュを持ちます。
+type APIToken struct {
+	ID        string         `db:"id"`
+	UserID    string         `db:"user_id"`
+	Name      string         `db:"name"`
+	TokenHash string         `db:"token_hash"`
+	Prefix    string         `db:"prefix"`
+	Scopes    pq.StringArray `db:"scopes"`
+	// ExpiresAt がnilのトークンは期限がない
+	ExpiresAt  *time.Time `db:"expires_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+// APITokenのスコープ。readはGETだけ、payments:writeは支払いの追加・変更・取り込みも、adminはすべての操作ができる
+const (
+	APITokenScopeRead          string = "read"
+	APITokenScopePaymentsWrite string = "payments:write"
+	APITokenScopeAdmin         string = "admin"
+)
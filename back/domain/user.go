@@ -1,5 +1,30 @@
 package domain
 
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ErrHandleTaken は他のユーザーが使っているハンドルを保存しようとした場合に返されます。
+var ErrHandleTaken = errors.New("handle is already taken")
+
+// releaseEmail removes email from the other users that have it.
+// A verified email address belongs to the user who logged in with it most recently, so the other accounts have a stale one.
+func releaseEmail(tx *sqlx.Tx, userID string, email *string) error {
+	if email == nil {
+		return nil
+	}
+	_, err := tx.Exec(`UPDATE users SET email = NULL WHERE lower(email) = lower($1) AND id <> $2`, *email, userID)
+	if err != nil {
+		return fmt.Errorf("failed to release email of other users: %v", err)
+	}
+	return nil
+}
+
 func (d *dbImpl) NewUser(user User) (User, error) {
 	var newUser User
 	// トランザクションを開始
@@ -8,9 +33,15 @@ func (d *dbImpl) NewUser(user User) (User, error) {
 		return newUser, err
 	}
 
-	// user.IDを持つ行を挿入する。ここではidが文字列として定義されていると仮定します。
-	query := "INSERT INTO users (id) VALUES ($1) RETURNING id"
-	err = tx.QueryRow(query, user.ID).Scan(&newUser.ID)
+	if err := releaseEmail(tx, user.ID, user.Email); err != nil {
+		tx.Rollback()
+		return newUser, err
+	}
+
+	// user.IDを持つ行を挿入する。OIDCのクレームから取得したプロフィールも一緒に保存する
+	query := `INSERT INTO users (id, email, oidc_name, oidc_picture, oidc_locale, oidc_zoneinfo)
+			  VALUES ($1, $2, $3, $4, $5, $6) RETURNING *`
+	err = tx.QueryRowx(query, user.ID, user.Email, user.OIDCName, user.OIDCPicture, user.OIDCLocale, user.OIDCZoneinfo).StructScan(&newUser)
 	if err != nil {
 		tx.Rollback() // エラーがあればロールバック
 		return newUser, err
@@ -29,6 +60,9 @@ func (d *dbImpl) NewUser(user User) (User, error) {
 func (d *dbImpl) GetUser(id string) (User, error) {
 	var user User
 	err := d.db.Get(&user, "SELECT * FROM users WHERE id = $1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, fmt.Errorf("%w: user %s", ErrNotFound, id)
+	}
 	if err != nil {
 		return user, err
 	}
@@ -36,5 +70,78 @@ func (d *dbImpl) GetUser(id string) (User, error) {
 }
 
 func (d *dbImpl) UpdateUser(user User) error {
+	query := `UPDATE users SET base_currency = $2, handle = $3, display_name = $4, avatar_url = $5, locale = $6, timezone = $7
+			  WHERE id = $1`
+	_, err := d.db.Exec(query, user.ID, user.BaseCurrency, user.Handle, user.DisplayName, user.AvatarURL, user.Locale, user.Timezone)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_handle_key" {
+		return fmt.Errorf("%w: %v", ErrHandleTaken, err)
+	}
+	return err
+}
+
+// UpdateUserClaims stores the profile taken from the OIDC claims of the user.
+// The email address is taken away from any other user that still has it.
+func (d *dbImpl) UpdateUserClaims(user User) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	if err := releaseEmail(tx, user.ID, user.Email); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query := `UPDATE users SET email = $2, oidc_name = $3, oidc_picture = $4, oidc_locale = $5, oidc_zoneinfo = $6
+			  WHERE id = $1`
+	_, err = tx.Exec(query, user.ID, user.Email, user.OIDCName, user.OIDCPicture, user.OIDCLocale, user.OIDCZoneinfo)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update user claims: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit user claims: %v", err)
+	}
 	return nil
 }
+
+// GetUsers retrieves the users with the given IDs. IDs of users that do not exist are ignored.
+func (d *dbImpl) GetUsers(ids []string) ([]User, error) {
+	users := []User{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+	err := d.db.Select(&users, `SELECT * FROM users WHERE id = ANY($1::bigint[])`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching users: %v", err)
+	}
+	return users, nil
+}
+
+// GetUserByEmail retrieves the user with the given email address, ignoring case.
+// Email addresses are unique, so at most one user has it.
+func (d *dbImpl) GetUserByEmail(email string) (User, error) {
+	var user User
+	err := d.db.Get(&user, `SELECT * FROM users WHERE lower(email) = lower($1)`, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, fmt.Errorf("%w: user with email %s", ErrNotFound, email)
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("error fetching user: %v", err)
+	}
+	return user, nil
+}
+
+// GetUserByHandle retrieves the user with the given handle.
+func (d *dbImpl) GetUserByHandle(handle string) (User, error) {
+	var user User
+	err := d.db.Get(&user, `SELECT * FROM users WHERE handle = $1`, handle)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, fmt.Errorf("%w: user @%s", ErrNotFound, handle)
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("error fetching user: %v", err)
+	}
+	return user, nil
+}
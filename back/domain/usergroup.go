@@ -1,13 +1,48 @@
 package domain
 
-import "fmt"
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// NewUserGroup creates a user group with its members.
+// The members are inserted in the same transaction as the group. Before, only the group row was inserted and the
+// members given on creation were silently dropped, so a group is either created with all its members or not at all.
+func (d *dbImpl) NewUserGroup(userGroup UserGroup, memberIDs []string, audit Audit[UserGroup]) (UserGroup, error) {
+	// Transaction start
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return UserGroup{}, fmt.Errorf("failed to start transaction: %v", err)
+	}
 
-func (d *dbImpl) NewUserGroup(userGroup UserGroup) (UserGroup, error) {
 	query := `INSERT INTO user_groups (name, creator_id) VALUES ($1, $2) RETURNING id`
-	err := d.db.QueryRow(query, userGroup.Name, userGroup.CreatorID).Scan(&userGroup.ID)
+	err = tx.QueryRow(query, userGroup.Name, userGroup.CreatorID).Scan(&userGroup.ID)
 	if err != nil {
+		tx.Rollback()
 		return UserGroup{}, fmt.Errorf("failed to create user group: %v", err)
 	}
+
+	// Add the members
+	for _, userID := range memberIDs {
+		_, err = tx.Exec(`INSERT INTO user_group_membership (group_id, user_id) VALUES ($1, $2)`, userGroup.ID, userID)
+		if err != nil {
+			tx.Rollback()
+			return UserGroup{}, fmt.Errorf("failed to add user to group: %v", err)
+		}
+	}
+
+	err = writeAudit(tx, audit, userGroup)
+	if err != nil {
+		tx.Rollback()
+		return UserGroup{}, err
+	}
+
+	// Commit transaction
+	err = tx.Commit()
+	if err != nil {
+		return UserGroup{}, fmt.Errorf("failed to commit user group creation: %v", err)
+	}
 	return userGroup, nil
 }
 
@@ -25,6 +60,9 @@ func (d *dbImpl) GetUserGroup(id string) (UserGroup, error) {
 	var userGroup UserGroup
 	query := `SELECT id, name, creator_id FROM user_groups WHERE id = $1`
 	err := d.db.Get(&userGroup, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserGroup{}, fmt.Errorf("%w: user group %s", ErrNotFound, id)
+	}
 	if err != nil {
 		return UserGroup{}, fmt.Errorf("failed to get user group with id %s: %v", id, err)
 	}
@@ -33,7 +71,7 @@ func (d *dbImpl) GetUserGroup(id string) (UserGroup, error) {
 
 func (d *dbImpl) GetUserGroupMembers(groupID string) ([]User, error) {
 	var users []User
-	query := `SELECT u.id FROM users u 
+	query := `SELECT u.* FROM users u 
               JOIN user_group_membership ugm ON u.id = ugm.user_id 
               WHERE ugm.group_id = $1`
 	err := d.db.Select(&users, query, groupID)
@@ -43,7 +81,7 @@ func (d *dbImpl) GetUserGroupMembers(groupID string) ([]User, error) {
 	return users, nil
 }
 
-func (d *dbImpl) UpdateUserGroup(id string, name string, memberIDs []string) (UserGroup, error) {
+func (d *dbImpl) UpdateUserGroup(id string, name string, memberIDs []string, audit Audit[string]) (UserGroup, error) {
 	// Transaction start
 	tx, err := d.db.Beginx()
 	if err != nil {
@@ -74,6 +112,12 @@ func (d *dbImpl) UpdateUserGroup(id string, name string, memberIDs []string) (Us
 		}
 	}
 
+	err = writeAudit(tx, audit, id)
+	if err != nil {
+		tx.Rollback()
+		return UserGroup{}, err
+	}
+
 	// Commit transaction
 	err = tx.Commit()
 	if err != nil {
@@ -83,7 +127,7 @@ func (d *dbImpl) UpdateUserGroup(id string, name string, memberIDs []string) (Us
 	return d.GetUserGroup(id) // Fetch and return the updated user group
 }
 
-func (d *dbImpl) DeleteUserGroup(id string) error {
+func (d *dbImpl) DeleteUserGroup(id string, audit Audit[string]) error {
 	// Transaction start
 	tx, err := d.db.Beginx()
 	if err != nil {
@@ -104,6 +148,12 @@ func (d *dbImpl) DeleteUserGroup(id string) error {
 		return fmt.Errorf("failed to delete user group with id %s: %v", id, err)
 	}
 
+	err = writeAudit(tx, audit, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// Commit transaction
 	err = tx.Commit()
 	if err != nil {
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /tokens
+// ログインユーザーの個人用アクセストークンの一覧。トークン自体は含まない
+func getAPITokens(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	response, err := uc.GetAPITokens(userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// POST /tokens
+// 個人用アクセストークンを作成する。トークンはこのレスポンスでしか返さない
+func createAPITokenHandler(c *gin.Context) {
+	var req struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("loginUserID").(string)
+	response, err := uc.CreateAPIToken(userID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// DELETE /tokens/:token_id
+// 個人用アクセストークンを失効させる
+func revokeAPITokenHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+	tokenID := c.Param("token_id")
+
+	if err := uc.RevokeAPIToken(userID, tokenID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
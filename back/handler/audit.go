@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/walnuts1018/openchokin/back/usecase"
+)
+
+func parseAuditLimit(c *gin.Context) (int, bool) {
+	value := c.Query("limit")
+	if value == "" {
+		return 0, true
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit, should be a positive integer"})
+		return 0, false
+	}
+	return limit, true
+}
+
+func respondAuditLogs(c *gin.Context, response usecase.AuditLogsResponse, err error) {
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GET /moneypools/:moneypool_id/audit?limit=100&before=1234
+// マネープールと、その支払い・振替・公開範囲の変更履歴を新しい順に返す。マネープールの所有者だけが見られる
+func getMoneyPoolAuditLogs(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+	limit, ok := parseAuditLimit(c)
+	if !ok {
+		return
+	}
+	response, err := uc.GetMoneyPoolAuditLogs(userID, c.Param("moneypool_id"), c.Query("before"), limit)
+	respondAuditLogs(c, response, err)
+}
+
+// GET /moneypools/:moneypool_id/payments/:payment_id/audit?limit=100&before=1234
+// 支払いの変更履歴を新しい順に返す。削除された支払いの履歴も見られる
+func getPaymentAuditLogs(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+	limit, ok := parseAuditLimit(c)
+	if !ok {
+		return
+	}
+	response, err := uc.GetPaymentAuditLogs(userID, c.Param("moneypool_id"), c.Param("payment_id"), c.Query("before"), limit)
+	respondAuditLogs(c, response, err)
+}
@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/coreos/go-oidc"
+	"github.com/gin-gonic/gin"
+	"github.com/walnuts1018/openchokin/back/config"
+	"github.com/walnuts1018/openchokin/back/domain"
+	"github.com/walnuts1018/openchokin/back/usecase"
+)
+
+// tokenVerifier verifies the bearer tokens issued by the configured OIDC provider.
+// It is built once at startup; the provider's keys are cached and fetched again when a token is signed with an unknown key,
+// so key rotation does not need a restart.
+type tokenVerifier struct {
+	verifier       *oidc.IDTokenVerifier
+	audiences      []string
+	requiredScopes []string
+}
+
+// newTokenVerifier runs the OIDC discovery of the issuer in cfg.
+func newTokenVerifier(ctx context.Context, cfg config.Config_t) (*tokenVerifier, error) {
+	audiences := slices.Clone(cfg.OIDCClientIDs)
+	if cfg.OIDCAudience != "" {
+		audiences = append(audiences, cfg.OIDCAudience)
+	}
+	if len(audiences) == 0 {
+		return nil, fmt.Errorf("OIDC_CLIENT_IDS or OIDC_AUDIENCE must be set")
+	}
+
+	provider, err := oidc.NewProvider(ctx, cfg.OIDCIssuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider %s: %v", cfg.OIDCIssuer, err)
+	}
+
+	return &tokenVerifier{
+		// audは複数のクライアントIDとオーディエンスのどれかと一致すればよいので、自分で確認する
+		verifier:       provider.Verifier(&oidc.Config{SkipClientIDCheck: true}),
+		audiences:      audiences,
+		requiredScopes: cfg.OIDCRequiredScopes,
+	}, nil
+}
+
+// tokenClaims are the claims of a bearer token used by the API.
+type tokenClaims struct {
+	Sub   string `json:"sub"` // "sub"はOIDCのユーザーIDクレーム
+	Scope string `json:"scope"`
+	// scpはプロバイダーによって文字列か配列になる
+	Scp json.RawMessage `json:"scp"`
+	// プロフィールのクレーム。トークンに含まれていない場合は保存している値のままにする
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Picture  string `json:"picture"`
+	Locale   string `json:"locale"`
+	Zoneinfo string `json:"zoneinfo"`
+	// email_verifiedはプロバイダーによって真偽値か文字列になる
+	EmailVerified json.RawMessage `json:"email_verified"`
+}
+
+// emailVerified reports whether the provider verified the email address of the token.
+func (c tokenClaims) emailVerified() bool {
+	var verified bool
+	if err := json.Unmarshal(c.EmailVerified, &verified); err == nil {
+		return verified
+	}
+	var s string
+	if err := json.Unmarshal(c.EmailVerified, &s); err == nil {
+		return s == "true"
+	}
+	return false
+}
+
+// user returns the user the token belongs to, with the profile taken from its claims.
+// The email address is used only if the provider verified it, as other users look users up by it.
+func (c tokenClaims) user() domain.User {
+	claim := func(value string) *string {
+		if value == "" {
+			return nil
+		}
+		return &value
+	}
+	user := domain.User{
+		ID:           c.Sub,
+		OIDCName:     claim(c.Name),
+		OIDCPicture:  claim(c.Picture),
+		OIDCLocale:   claim(c.Locale),
+		OIDCZoneinfo: claim(c.Zoneinfo),
+	}
+	if c.emailVerified() {
+		user.Email = claim(c.Email)
+	}
+	return user
+}
+
+// scopes returns the scopes granted to the token.
+func (c tokenClaims) scopes() []string {
+	scopes := strings.Fields(c.Scope)
+	var list []string
+	if err := json.Unmarshal(c.Scp, &list); err == nil {
+		return append(scopes, list...)
+	}
+	var s string
+	if err := json.Unmarshal(c.Scp, &s); err == nil {
+		scopes = append(scopes, strings.Fields(s)...)
+	}
+	return scopes
+}
+
+// verify checks the signature, issuer, expiry, audience and scopes of a token and returns its claims.
+func (v *tokenVerifier) verify(ctx context.Context, rawToken string) (tokenClaims, error) {
+	idToken, err := v.verifier.Verify(ctx, rawToken)
+	if err != nil {
+		return tokenClaims{}, err
+	}
+
+	if !slices.ContainsFunc(idToken.Audience, func(aud string) bool { return slices.Contains(v.audiences, aud) }) {
+		return tokenClaims{}, fmt.Errorf("token audience %v is not accepted", idToken.Audience)
+	}
+
+	var claims tokenClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return tokenClaims{}, fmt.Errorf("failed to decode claims: %v", err)
+	}
+	if claims.Sub == "" {
+		return tokenClaims{}, fmt.Errorf("token has no subject")
+	}
+
+	scopes := claims.scopes()
+	for _, scope := range v.requiredScopes {
+		if !slices.Contains(scopes, scope) {
+			return tokenClaims{}, fmt.Errorf("token does not have the scope %s", scope)
+		}
+	}
+	return claims, nil
+}
+
+// publicRoutes は未ログインでも呼び出せるエンドポイント。公開されたマネープールを閲覧するためのもので、それ以外はログインが必要
+var publicRoutes = map[string]bool{
+	"GET /v1/moneypools":                                    true,
+	"GET /v1/moneypools/:moneypool_id":                      true,
+	"GET /v1/moneypools/:moneypool_id/payments/:payment_id": true,
+	"GET /v1/moneyinformation":                              true,
+	"GET /v1/export":                                        true,
+	"GET /v1/search":                                        true,
+}
+
+// isPublicRoute reports whether the matched route can be called without logging in.
+// Requests that match no route are let through so that they get a 404.
+func isPublicRoute(c *gin.Context) bool {
+	return c.FullPath() == "" || publicRoutes[c.Request.Method+" "+c.FullPath()]
+}
+
+// paymentsWriteRoutes はpayments:writeスコープの個人用アクセストークンで変更できるエンドポイントの接頭辞
+var paymentsWriteRoutes = []string{
+	"/v1/moneypools/:moneypool_id/payments",
+	"/v1/moneypools/:moneypool_id/import",
+}
+
+// apiTokenAllows reports whether a personal access token with scopes may call the matched route.
+// Creating tokens always needs an OIDC login, so that a leaked token cannot be used to make more of them.
+// Requests that match no route are let through so that they get a 404.
+func apiTokenAllows(scopes []string, method string, route string) bool {
+	if route == "" {
+		return true
+	}
+	if method == http.MethodPost && route == "/v1/tokens" {
+		return false
+	}
+	if slices.Contains(scopes, domain.APITokenScopeAdmin) {
+		return true
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return slices.Contains(scopes, domain.APITokenScopeRead)
+	}
+	if slices.Contains(scopes, domain.APITokenScopePaymentsWrite) {
+		return slices.ContainsFunc(paymentsWriteRoutes, func(prefix string) bool { return strings.HasPrefix(route, prefix) })
+	}
+	return false
+}
+
+func authMiddleware(verifier *tokenVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Authorizationヘッダーを取得する
+		authHeader := c.GetHeader("Authorization")
+		// "Bearer "で始まる場合、トークンを検証する
+		if strings.HasPrefix(authHeader, "Bearer ") {
+			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+			if strings.HasPrefix(tokenString, usecase.APITokenPrefix) {
+				// 個人用アクセストークンはOIDCのトークンと同じユーザーとして扱い、スコープで呼び出せるエンドポイントを制限する
+				token, err := uc.AuthenticateAPIToken(tokenString)
+				if err != nil {
+					log.Printf("個人用アクセストークンの検証に失敗しました: %v", err)
+					c.Error(err)
+					c.Abort()
+					return
+				}
+				if !apiTokenAllows(token.Scopes, c.Request.Method, c.FullPath()) {
+					c.Error(fmt.Errorf("%w: the api token is not allowed to call %s %s", usecase.ErrForbidden, c.Request.Method, c.Request.URL.Path))
+					c.Abort()
+					return
+				}
+
+				c.Set("loginUserID", token.UserID)
+				log.Printf("個人用アクセストークンによるユーザー認証成功: ユーザーID %s, トークンID %s", token.UserID, token.ID)
+				c.Next()
+				return
+			}
+
+			// 起動時に取得した公開鍵セットでトークンを検証する
+			claims, err := verifier.verify(c.Request.Context(), tokenString)
+			if err != nil {
+				log.Printf("トークンの検証に失敗しました: %v", err)
+				c.Error(fmt.Errorf("%w: invalid bearer token", usecase.ErrUnauthenticated))
+				c.Abort()
+				return
+			}
+
+			// クレームの情報をコンテキストにセットする
+			c.Set("loginUserID", claims.Sub)
+
+			// 初めてのログインならユーザーを作成し、そうでなければクレームのプロフィールを保存する
+			if err := uc.LoginUser(claims.user()); err != nil {
+				log.Printf("ユーザーID %s のログイン処理に失敗しました: %v", claims.Sub, err)
+			}
+
+			log.Printf("ユーザー認証成功: ユーザーID %s", claims.Sub)
+		} else if !isPublicRoute(c) {
+			// 未ログインで呼び出せるのは公開されたマネープールの閲覧だけ
+			c.Error(fmt.Errorf("%w: %s %s requires a bearer token", usecase.ErrUnauthenticated, c.Request.Method, c.Request.URL.Path))
+			c.Abort()
+			return
+		}
+
+		// 次のハンドラーまたはミドルウェアを実行
+		c.Next()
+	}
+}
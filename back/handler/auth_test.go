@@ -0,0 +1,287 @@
+package handler
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/walnuts1018/openchokin/back/config"
+)
+
+// testIssuer is a stand-in OIDC provider that serves the discovery document and a JWKS, and signs tokens with RS256.
+type testIssuer struct {
+	server *httptest.Server
+
+	mu             sync.Mutex
+	keys           map[string]*rsa.PrivateKey
+	discoveryCalls int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	issuer := &testIssuer{keys: map[string]*rsa.PrivateKey{}}
+	issuer.addKey(t, "key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mu.Lock()
+		issuer.discoveryCalls++
+		issuer.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                issuer.server.URL,
+			"authorization_endpoint":                issuer.server.URL + "/authorize",
+			"token_endpoint":                        issuer.server.URL + "/token",
+			"jwks_uri":                              issuer.server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mu.Lock()
+		defer issuer.mu.Unlock()
+		keys := []map[string]string{}
+		for kid, key := range issuer.keys {
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// addKey adds a signing key to the JWKS.
+func (i *testIssuer) addKey(t *testing.T, kid string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keys[kid] = key
+}
+
+// rotateKey replaces all signing keys with a new one.
+func (i *testIssuer) rotateKey(t *testing.T, kid string) {
+	t.Helper()
+	i.mu.Lock()
+	i.keys = map[string]*rsa.PrivateKey{}
+	i.mu.Unlock()
+	i.addKey(t, kid)
+}
+
+// sign returns a token with the given claims signed by the key kid.
+// iss, sub and exp are filled in unless claims sets them.
+func (i *testIssuer) sign(t *testing.T, kid string, claims map[string]any) string {
+	t.Helper()
+	payload := map[string]any{
+		"iss": i.server.URL,
+		"sub": "238653199337193865",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		payload[k] = v
+	}
+
+	encode := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signingInput := encode(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid}) + "." + encode(payload)
+
+	i.mu.Lock()
+	key := i.keys[kid]
+	i.mu.Unlock()
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (i *testIssuer) config(clientIDs []string, audience string, requiredScopes []string) config.Config_t {
+	return config.Config_t{
+		OIDCIssuer:         i.server.URL,
+		OIDCClientIDs:      clientIDs,
+		OIDCAudience:       audience,
+		OIDCRequiredScopes: requiredScopes,
+	}
+}
+
+func TestNewTokenVerifierRequiresAudience(t *testing.T) {
+	issuer := newTestIssuer(t)
+	if _, err := newTokenVerifier(context.Background(), issuer.config(nil, "", nil)); err == nil {
+		t.Fatal("newTokenVerifier() error = nil, want an error when no client ID or audience is set")
+	}
+}
+
+func TestTokenVerifierVerify(t *testing.T) {
+	tests := []struct {
+		name           string
+		clientIDs      []string
+		audience       string
+		requiredScopes []string
+		claims         map[string]any
+		wantErr        bool
+	}{
+		{
+			name:      "first client ID",
+			clientIDs: []string{"web@example.com", "cli@example.com"},
+			claims:    map[string]any{"aud": "web@example.com"},
+		},
+		{
+			name:      "second client ID in an audience list",
+			clientIDs: []string{"web@example.com", "cli@example.com"},
+			claims:    map[string]any{"aud": []string{"other", "cli@example.com"}},
+		},
+		{
+			name:      "unknown audience",
+			clientIDs: []string{"web@example.com", "cli@example.com"},
+			claims:    map[string]any{"aud": "other"},
+			wantErr:   true,
+		},
+		{
+			name:      "OIDCAudience",
+			clientIDs: []string{"web@example.com"},
+			audience:  "openchokin-api",
+			claims:    map[string]any{"aud": "openchokin-api"},
+		},
+		{
+			name:           "scope string",
+			clientIDs:      []string{"web@example.com"},
+			requiredScopes: []string{"openid", "payments"},
+			claims:         map[string]any{"aud": "web@example.com", "scope": "openid profile payments"},
+		},
+		{
+			name:           "scp array",
+			clientIDs:      []string{"web@example.com"},
+			requiredScopes: []string{"openid", "payments"},
+			claims:         map[string]any{"aud": "web@example.com", "scp": []string{"openid", "payments"}},
+		},
+		{
+			name:           "scp string",
+			clientIDs:      []string{"web@example.com"},
+			requiredScopes: []string{"openid", "payments"},
+			claims:         map[string]any{"aud": "web@example.com", "scp": "openid payments"},
+		},
+		{
+			name:           "missing scope",
+			clientIDs:      []string{"web@example.com"},
+			requiredScopes: []string{"openid", "payments"},
+			claims:         map[string]any{"aud": "web@example.com", "scope": "openid"},
+			wantErr:        true,
+		},
+		{
+			name:      "expired",
+			clientIDs: []string{"web@example.com"},
+			claims:    map[string]any{"aud": "web@example.com", "exp": time.Now().Add(-time.Minute).Unix()},
+			wantErr:   true,
+		},
+		{
+			name:      "other issuer",
+			clientIDs: []string{"web@example.com"},
+			claims:    map[string]any{"aud": "web@example.com", "iss": "https://evil.example.com"},
+			wantErr:   true,
+		},
+		{
+			name:      "no subject",
+			clientIDs: []string{"web@example.com"},
+			claims:    map[string]any{"aud": "web@example.com", "sub": ""},
+			wantErr:   true,
+		},
+	}
+
+	issuer := newTestIssuer(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := newTokenVerifier(context.Background(), issuer.config(tt.clientIDs, tt.audience, tt.requiredScopes))
+			if err != nil {
+				t.Fatalf("newTokenVerifier() error = %v", err)
+			}
+			claims, err := verifier.verify(context.Background(), issuer.sign(t, "key-1", tt.claims))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && claims.Sub != "238653199337193865" {
+				t.Errorf("verify() sub = %q", claims.Sub)
+			}
+		})
+	}
+}
+
+func TestTokenVerifierKeyRotation(t *testing.T) {
+	issuer := newTestIssuer(t)
+	verifier, err := newTokenVerifier(context.Background(), issuer.config([]string{"web@example.com"}, "", nil))
+	if err != nil {
+		t.Fatalf("newTokenVerifier() error = %v", err)
+	}
+
+	if _, err := verifier.verify(context.Background(), issuer.sign(t, "key-1", map[string]any{"aud": "web@example.com"})); err != nil {
+		t.Fatalf("verify() with the first key error = %v", err)
+	}
+
+	// 鍵を入れ替えると、知らないkidのトークンが来たときに公開鍵セットを取り直す
+	oldToken := issuer.sign(t, "key-1", map[string]any{"aud": "web@example.com"})
+	issuer.rotateKey(t, "key-2")
+	if _, err := verifier.verify(context.Background(), issuer.sign(t, "key-2", map[string]any{"aud": "web@example.com"})); err != nil {
+		t.Fatalf("verify() with the rotated key error = %v", err)
+	}
+	if _, err := verifier.verify(context.Background(), oldToken); err == nil {
+		t.Fatal("verify() with the removed key error = nil, want an error")
+	}
+
+	issuer.mu.Lock()
+	defer issuer.mu.Unlock()
+	if issuer.discoveryCalls != 1 {
+		t.Errorf("discovery was requested %d times, want once", issuer.discoveryCalls)
+	}
+}
+
+func TestTokenClaimsUser(t *testing.T) {
+	tests := []struct {
+		name          string
+		emailVerified string
+		wantEmail     bool
+	}{
+		{"verified bool", `true`, true},
+		{"verified string", `"true"`, true},
+		{"not verified", `false`, false},
+		{"missing", ``, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := tokenClaims{Sub: "1", Name: "Alice", Email: "alice@example.com"}
+			if tt.emailVerified != "" {
+				claims.EmailVerified = json.RawMessage(tt.emailVerified)
+			}
+			user := claims.user()
+			if (user.Email != nil) != tt.wantEmail {
+				t.Errorf("user().Email = %v, want set %v", user.Email, tt.wantEmail)
+			}
+			if user.OIDCName == nil || *user.OIDCName != "Alice" || user.OIDCPicture != nil {
+				t.Errorf("user() = %+v", user)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/walnuts1018/openchokin/back/domain"
+	"github.com/walnuts1018/openchokin/back/timeJST"
+	"github.com/walnuts1018/openchokin/back/usecase"
+)
+
+// maxBackupSize は復元するバックアップの最大サイズです。支払いの履歴を全部含むので、CSVの取り込みより大きくしている
+const maxBackupSize = 50 << 20
+
+// GET /backup
+// ログインユーザーのデータ一式をJSONファイルとしてダウンロードする
+func getBackupHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	backup, err := uc.GetBackup(userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	filename := "openchokin-backup-" + time.Now().In(timeJST.JST).Format("20060102") + ".json"
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.JSON(http.StatusOK, backup)
+}
+
+// POST /restore?mode=empty|merge
+// GET /backup で作成したJSONをリクエストボディで受け取り、ログインユーザーのデータとして復元する
+func restoreBackupHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	var backup domain.Backup
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxBackupSize)
+	if err := json.NewDecoder(body).Decode(&backup); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "backup is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid backup: " + err.Error()})
+		return
+	}
+
+	response, err := uc.RestoreBackup(userID, backup, c.DefaultQuery("mode", usecase.RestoreModeEmpty))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/walnuts1018/openchokin/back/domain"
+)
+
+// GET /moneypools/:moneypool_id/budget
+// 現在の予算期間の予算・支出・予定の支出・残りを返す。予算が設定されていない場合はnull
+func getMoneyPoolBudget(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	response, err := uc.GetMoneyPoolBudget(userID, c.Param("moneypool_id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// PUT /moneypools/:moneypool_id/budget
+// マネープールの予算を設定する
+func setMoneyPoolBudgetHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	var req struct {
+		Amount domain.Money `json:"amount"`
+		// weekly, monthly, yearly
+		Period string `json:"period"`
+		// trueの場合、使い残しを次の期間に繰り越す
+		Rollover bool `json:"rollover"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := uc.SetMoneyPoolBudget(userID, c.Param("moneypool_id"), req.Amount, req.Period, req.Rollover)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DELETE /moneypools/:moneypool_id/budget
+// マネープールの予算を削除する
+func deleteMoneyPoolBudgetHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	if err := uc.DeleteMoneyPoolBudget(userID, c.Param("moneypool_id")); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
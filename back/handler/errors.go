@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/walnuts1018/openchokin/back/domain"
+	"github.com/walnuts1018/openchokin/back/usecase"
+)
+
+// errorStatus returns the HTTP status for an error returned by the usecase.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, usecase.ErrUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, usecase.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, usecase.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, usecase.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, usecase.ErrValidation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, domain.ErrMoneyOverflow):
+		// 合計や換算の結果が大きすぎる場合。金額の入力が大きすぎるのが原因なので422にする
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// errorMiddleware は、ハンドラーが c.Error で渡したエラーをエラーの種類に応じたステータスにして {"error": "..."} で返す
+// すでにレスポンスを書き始めている場合（書き出しの途中のエラーなど）は何もしない
+func errorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		err := c.Errors.Last().Err
+		status := errorStatus(err)
+		if status == http.StatusUnauthorized {
+			c.Header("WWW-Authenticate", "Bearer")
+		}
+		if status == http.StatusInternalServerError {
+			log.Printf("%s %s でエラーが発生しました: %v", c.Request.Method, c.Request.URL.Path, err)
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/walnuts1018/openchokin/back/domain"
+)
+
+// Handler function for listing the exchange rates of the login user.
+func getExchangeRates(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	response, err := uc.GetExchangeRates(userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Handler function for entering an exchange rate manually.
+func createExchangeRateHandler(c *gin.Context) {
+	var req struct {
+		FromCurrency string      `json:"from_currency"`
+		ToCurrency   string      `json:"to_currency"`
+		Rate         domain.Rate `json:"rate"`
+		ValidFrom    string      `json:"valid_from"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	validFrom, err := time.Parse("2006-01-02", req.ValidFrom)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid valid_from format, should be YYYY-MM-DD"})
+		return
+	}
+
+	userID := c.MustGet("loginUserID").(string)
+	response, err := uc.AddExchangeRate(userID, req.FromCurrency, req.ToCurrency, req.Rate, validFrom)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// Handler function for uploading exchange rates as CSV.
+func importExchangeRatesHandler(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	userID := c.MustGet("loginUserID").(string)
+	response, err := uc.ImportExchangeRatesCSV(userID, file)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// Handler function for deleting an exchange rate.
+func deleteExchangeRateHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+	exchangeRateID := c.Param("exchangerate_id")
+
+	if err := uc.DeleteExchangeRate(userID, exchangeRateID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Handler function for changing the base currency of the login user.
+func updateBaseCurrencyHandler(c *gin.Context) {
+	var req struct {
+		Currency string `json:"currency"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("loginUserID").(string)
+	response, err := uc.SetBaseCurrency(userID, req.Currency)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
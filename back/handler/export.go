@@ -0,0 +1,338 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/walnuts1018/openchokin/back/timeJST"
+	"github.com/walnuts1018/openchokin/back/usecase"
+)
+
+// exportWriter is a usecase.PaymentExportWriter that streams the response in one of the export formats.
+type exportWriter interface {
+	usecase.PaymentExportWriter
+	// started reports whether the response has been started, after which errors cannot be reported as JSON anymore.
+	started() bool
+	// finish completes the response. It also writes an empty export if there were no money pools.
+	finish() error
+}
+
+// exportStream writes the response headers and the beginning of the file once, before the first data.
+type exportStream struct {
+	c           *gin.Context
+	contentType string
+	filename    string
+	isStarted   bool
+}
+
+func (s *exportStream) started() bool {
+	return s.isStarted
+}
+
+func (s *exportStream) start(prologue func(w io.Writer) error) error {
+	if s.isStarted {
+		return nil
+	}
+	s.isStarted = true
+	s.c.Header("Content-Type", s.contentType)
+	s.c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, s.filename))
+	s.c.Status(http.StatusOK)
+	return prologue(s.c.Writer)
+}
+
+func (s *exportStream) flush() {
+	s.c.Writer.Flush()
+}
+
+// csvExportWriter writes one row per payment. The file starts with a BOM so that Excel reads it as UTF-8.
+type csvExportWriter struct {
+	exportStream
+	w *csv.Writer
+}
+
+func (e *csvExportWriter) begin() error {
+	return e.start(func(w io.Writer) error {
+		if _, err := io.WriteString(w, "\ufeff"); err != nil {
+			return err
+		}
+		e.w = csv.NewWriter(w)
+		return e.w.Write([]string{"payment_id", "money_pool_id", "money_pool_name", "date", "title", "amount", "currency",
+			"description", "store", "labels", "is_planned", "transfer_id"})
+	})
+}
+
+func (e *csvExportWriter) BeginMoneyPool(pool usecase.ExportMoneyPool) error {
+	return e.begin()
+}
+
+func (e *csvExportWriter) WritePayment(pool usecase.ExportMoneyPool, payment usecase.ExportPayment) error {
+	transferID := ""
+	if payment.TransferID != nil {
+		transferID = *payment.TransferID
+	}
+	return e.w.Write([]string{payment.ID, pool.ID, pool.Name, payment.Date.Format("2006-01-02"), payment.Title, payment.Amount.String(), pool.Currency,
+		payment.Description, payment.StoreName, strings.Join(payment.Labels, ";"), strconv.FormatBool(payment.IsPlanned), transferID})
+}
+
+func (e *csvExportWriter) EndMoneyPool(pool usecase.ExportMoneyPool) error {
+	e.w.Flush()
+	e.flush()
+	return e.w.Error()
+}
+
+func (e *csvExportWriter) finish() error {
+	if err := e.begin(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// jsonExportPayment is an element of the JSON export.
+type jsonExportPayment struct {
+	ID            string   `json:"id"`
+	MoneyPoolID   string   `json:"money_pool_id"`
+	MoneyPoolName string   `json:"money_pool_name"`
+	Date          string   `json:"date"`
+	Title         string   `json:"title"`
+	Amount        string   `json:"amount"`
+	Currency      string   `json:"currency"`
+	Description   string   `json:"description"`
+	StoreName     string   `json:"store_name"`
+	Labels        []string `json:"labels"`
+	IsPlanned     bool     `json:"is_planned"`
+	TransferID    *string  `json:"transfer_id"`
+}
+
+// jsonExportWriter writes a JSON array of payments, one element at a time.
+type jsonExportWriter struct {
+	exportStream
+	count int
+}
+
+func (e *jsonExportWriter) begin() error {
+	return e.start(func(w io.Writer) error {
+		_, err := io.WriteString(w, "[\n")
+		return err
+	})
+}
+
+func (e *jsonExportWriter) BeginMoneyPool(pool usecase.ExportMoneyPool) error {
+	return e.begin()
+}
+
+func (e *jsonExportWriter) WritePayment(pool usecase.ExportMoneyPool, payment usecase.ExportPayment) error {
+	labels := payment.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+	data, err := json.Marshal(jsonExportPayment{
+		ID:            payment.ID,
+		MoneyPoolID:   pool.ID,
+		MoneyPoolName: pool.Name,
+		Date:          payment.Date.Format("2006-01-02"),
+		Title:         payment.Title,
+		Amount:        payment.Amount.String(),
+		Currency:      pool.Currency,
+		Description:   payment.Description,
+		StoreName:     payment.StoreName,
+		Labels:        labels,
+		IsPlanned:     payment.IsPlanned,
+		TransferID:    payment.TransferID,
+	})
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if _, err := io.WriteString(e.c.Writer, ",\n"); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.c.Writer.Write(data)
+	return err
+}
+
+func (e *jsonExportWriter) EndMoneyPool(pool usecase.ExportMoneyPool) error {
+	e.flush()
+	return nil
+}
+
+func (e *jsonExportWriter) finish() error {
+	if err := e.begin(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.c.Writer, "\n]\n")
+	return err
+}
+
+// ofxExportWriter writes an OFX 2.2 bank statement per money pool.
+// Planned payments are left out because finance tools treat every transaction in a statement as posted.
+type ofxExportWriter struct {
+	exportStream
+	from *time.Time
+	to   *time.Time
+	now  time.Time
+	err  error
+}
+
+// ofxDate formats a date as OFX YYYYMMDD.
+func ofxDate(t time.Time) string {
+	return t.Format("20060102")
+}
+
+// printf writes to the response, keeping the first error so that the element structure can be written without checks.
+func (e *ofxExportWriter) printf(format string, args ...interface{}) {
+	if e.err == nil {
+		_, e.err = fmt.Fprintf(e.c.Writer, format, args...)
+	}
+}
+
+// ofxText escapes s for an OFX element and cuts it to maxRunes characters.
+func ofxText(s string, maxRunes int) string {
+	runes := []rune(s)
+	if len(runes) > maxRunes {
+		runes = runes[:maxRunes]
+	}
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(string(runes)))
+	return b.String()
+}
+
+func (e *ofxExportWriter) begin() error {
+	return e.start(func(w io.Writer) error {
+		e.printf("<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"no\"?>\n")
+		e.printf("<?OFX OFXHEADER=\"200\" VERSION=\"220\" SECURITY=\"NONE\" OLDFILEUID=\"NONE\" NEWFILEUID=\"NONE\"?>\n")
+		e.printf("<OFX>\n<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>")
+		e.printf("<DTSERVER>%s</DTSERVER><LANGUAGE>JPN</LANGUAGE></SONRS></SIGNONMSGSRSV1>\n<BANKMSGSRSV1>\n", e.now.Format("20060102150405"))
+		return e.err
+	})
+}
+
+func (e *ofxExportWriter) BeginMoneyPool(pool usecase.ExportMoneyPool) error {
+	if err := e.begin(); err != nil {
+		return err
+	}
+	start := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	if e.from != nil {
+		start = *e.from
+	}
+	end := e.now
+	if e.to != nil {
+		end = *e.to
+	}
+	e.printf("<STMTTRNRS><TRNUID>%s</TRNUID><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n", ofxText(pool.ID, 36))
+	e.printf("<STMTRS><CURDEF>%s</CURDEF>", ofxText(pool.Currency, 3))
+	e.printf("<BANKACCTFROM><BANKID>OPENCHOKIN</BANKID><ACCTID>%s</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>\n", ofxText(pool.ID, 22))
+	e.printf("<BANKTRANLIST><DTSTART>%s</DTSTART><DTEND>%s</DTEND>\n", ofxDate(start), ofxDate(end))
+	return e.err
+}
+
+func (e *ofxExportWriter) WritePayment(pool usecase.ExportMoneyPool, payment usecase.ExportPayment) error {
+	if payment.IsPlanned {
+		return nil
+	}
+	trnType := "CREDIT"
+	if payment.TransferID != nil {
+		trnType = "XFER"
+	} else if payment.Amount.IsNegative() {
+		trnType = "DEBIT"
+	}
+	var memo []string
+	if payment.StoreName != "" {
+		memo = append(memo, payment.StoreName)
+	}
+	memo = append(memo, payment.Labels...)
+	if payment.Description != "" {
+		memo = append(memo, payment.Description)
+	}
+
+	e.printf("<STMTTRN><TRNTYPE>%s</TRNTYPE><DTPOSTED>%s</DTPOSTED><TRNAMT>%s</TRNAMT><FITID>%s</FITID><NAME>%s</NAME>",
+		trnType, ofxDate(payment.Date), payment.Amount.String(), ofxText(payment.ID, 255), ofxText(payment.Title, 32))
+	if len(memo) > 0 {
+		e.printf("<MEMO>%s</MEMO>", ofxText(strings.Join(memo, " / "), 255))
+	}
+	e.printf("</STMTTRN>\n")
+	return e.err
+}
+
+func (e *ofxExportWriter) EndMoneyPool(pool usecase.ExportMoneyPool) error {
+	e.printf("</BANKTRANLIST>\n<LEDGERBAL><BALAMT>%s</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL></STMTRS></STMTTRNRS>\n",
+		pool.Balance.String(), e.now.Format("20060102150405"))
+	e.flush()
+	return e.err
+}
+
+func (e *ofxExportWriter) finish() error {
+	if err := e.begin(); err != nil {
+		return err
+	}
+	e.printf("</BANKMSGSRSV1>\n</OFX>\n")
+	return e.err
+}
+
+// GET /export
+// 支払いをCSV・JSON・OFXで書き出す。format=csv (既定), json, ofx
+// moneypool_idを指定するとそのマネープールだけ（閲覧できる場合のみ）、省略するとログインユーザーのマネープールと共有されたマネープールをすべて書き出す
+// from, to (YYYY-MM-DD) で期間を指定できる
+func exportPaymentsHandler(c *gin.Context) {
+	loginUserID := ""
+	if userID, exists := c.Get("loginUserID"); exists {
+		var ok bool
+		loginUserID, ok = userID.(string)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "User ID is not a string"})
+			return
+		}
+	}
+
+	var from, to *time.Time
+	for name, dst := range map[string]**time.Time{"from": &from, "to": &to} {
+		if value := c.Query(name); value != "" {
+			date, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name + " format, should be YYYY-MM-DD"})
+				return
+			}
+			*dst = &date
+		}
+	}
+
+	now := time.Now().In(timeJST.JST)
+	filename := "openchokin-payments-" + now.Format("20060102")
+	var w exportWriter
+	switch format := c.DefaultQuery("format", "csv"); format {
+	case "csv":
+		w = &csvExportWriter{exportStream: exportStream{c: c, contentType: "text/csv; charset=utf-8", filename: filename + ".csv"}}
+	case "json":
+		w = &jsonExportWriter{exportStream: exportStream{c: c, contentType: "application/json; charset=utf-8", filename: filename + ".json"}}
+	case "ofx":
+		w = &ofxExportWriter{exportStream: exportStream{c: c, contentType: "application/x-ofx", filename: filename + ".ofx"}, from: from, to: to, now: now}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid format, should be csv, json or ofx"})
+		return
+	}
+
+	err := uc.ExportPayments(loginUserID, c.Query("moneypool_id"), from, to, w)
+	if err == nil {
+		err = w.finish()
+	}
+	if err != nil {
+		if w.started() {
+			// 書き出しを始めた後はステータスコードを変えられないため、途中で打ち切る
+			log.Printf("エクスポートの書き出し中にエラーが発生しました: %v", err)
+			return
+		}
+		c.Error(err)
+		return
+	}
+}
@@ -2,11 +2,9 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"log"
-	"net/http"
-	"strings"
 
-	"github.com/coreos/go-oidc"
 	"github.com/gin-gonic/gin"
 	"github.com/walnuts1018/openchokin/back/config"
 	"github.com/walnuts1018/openchokin/back/domain"
@@ -20,7 +18,7 @@ var (
 func userMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Set("loginUserID", "1")
-		if _, err := uc.GetUser("1"); err != nil {
+		if _, err := uc.GetUser("1"); errors.Is(err, usecase.ErrNotFound) {
 			log.Printf("created new user %s\n", "1")
 			uc.NewUser(domain.User{ID: "1"})
 		}
@@ -28,89 +26,41 @@ func userMiddleware() gin.HandlerFunc {
 	}
 }
 
-func authMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Authorizationヘッダーを取得する
-		authHeader := c.GetHeader("Authorization")
-		// "Bearer "で始まる場合、トークンを検証する
-		if strings.HasPrefix(authHeader, "Bearer ") {
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-
-			// OIDCプロバイダーのURLとクライアント情報
-			issuer := "https://auth.walnuts.dev"
-			clientID := "238653199337193865@walnuts.dev"
-
-			// OIDCプロバイダーの構成情報を取得する
-			provider, err := oidc.NewProvider(context.Background(), issuer)
-			if err != nil {
-				log.Printf("OIDCプロバイダーの取得に失敗しました: %v", err)
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "内部サーバーエラー"})
-				return
-			}
-
-			// 公開鍵セットを取得してトークンを検証する
-			verifier := provider.Verifier(&oidc.Config{ClientID: clientID})
-			idToken, err := verifier.Verify(context.Background(), tokenString)
-			if err != nil {
-				log.Printf("トークンの検証に失敗しました: %v", err)
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "認証エラー"})
-				return
-			}
-
-			// IDトークンのクレームを取得するための構造体
-			var claims struct {
-				Sub string `json:"sub"` // "sub"はOIDCのユーザーIDクレーム
-			}
-
-			// クレームをデコードする
-			if err := idToken.Claims(&claims); err != nil {
-				log.Printf("クレームのデコードに失敗しました: %v", err)
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "クレームデコードエラー"})
-				return
-			}
-
-			// クレームの情報をコンテキストにセットする
-			c.Set("loginUserID", claims.Sub)
-
-			// ユーザーの存在確認と新規作成のロジックは省略...
-			if _, err := uc.GetUser(claims.Sub); err != nil {
-				uc.NewUser(domain.User{ID: claims.Sub})
-			}
-
-			log.Printf("ユーザー認証成功: ユーザーID %s", claims.Sub)
-		} else {
-			log.Printf("AuthorizationヘッダーがBearer形式ではありません。")
-		}
-
-		// 次のハンドラーまたはミドルウェアを実行
-		c.Next()
-	}
-}
-
 func NewHandler(usecase *usecase.Usecase) (*gin.Engine, error) {
 	uc = usecase
 	r := gin.Default()
+	r.Use(errorMiddleware())
 	if config.Config.ISDebugMode == "true" {
 		r.Use(userMiddleware())
 	} else {
-		r.Use(authMiddleware())
+		// OIDCプロバイダーのディスカバリーはリクエストごとではなく起動時に一度だけ行う
+		verifier, err := newTokenVerifier(context.Background(), config.Config)
+		if err != nil {
+			return nil, err
+		}
+		r.Use(authMiddleware(verifier))
 	}
 
 	v1 := r.Group("/v1")
 	{
 		// クエリパラメータtype=summary or detailでサマリーと詳細を分けられる。
-		// 今回はsummaryだけを実装する
+		// detailでは説明、公開範囲、予測残高、支払い件数、最終支払い日、予算の状況も返す
 		// /moneypools?type=summary&user_id=204938384
 		v1.GET("/moneypools", getMoneyPools)
 
 		// パスパラメータで指定されたIDのマネープール情報を返す
 		// クエリパラメータuserIDが必要
+		// 支払いはfrom, to, min_amount, max_amount, status, q, store, labelで絞り込み、sortで並び替えられる
+		// limitを指定するとページングされ、next_cursorをcursorに渡すと次のページを取得できる
+		// ETagはマネープール自体のバージョンで、PATCH /moneypools/:moneypool_id のIf-Matchに使う
 		v1.GET("/moneypools/:moneypool_id", getMoneyPool)
 
 		// クエリパラメータtype=summary or detailでサマリと詳細を分けられる
-		// 今回はsummaryだけを実装する
+		// detailでは残高の推移と割り当てられたマネープールも返す
 		// /moneyproviders?type=summary
 		v1.GET("/moneyproviders", getMoneyProviders)
+		// ETagはマネープロバイダーのバージョンで、PATCH /moneyproviders/:moneyprovider_id のIf-Matchに使う
+		v1.GET("/moneyproviders/:moneyprovider_id", getMoneyProviderHandler)
 
 		// オプションパラメータdateを持つ
 		// /moneyinformation?date=2023-05-15
@@ -118,32 +68,142 @@ func NewHandler(usecase *usecase.Usecase) (*gin.Engine, error) {
 		v1.GET("/moneyinformation", getMoneyInformation)
 
 		// クエリパラメータmonthが必須パラメータである
-		// /payments?month=2023-05
+		// /moneypools/:moneypool_id と同じ絞り込み・並び替え・ページングができる
+		// 日ごと・月の合計は、支払いの日付のレートで基準通貨に換算する
+		// /payments?month=2023-05&status=actual&sort=amount_asc&limit=50
 		v1.GET("/payments", getMonthlyPayments)
 
-		// Paymentの追加・修正・削除
+		// Paymentの取得・追加・修正・削除
+		// PATCHとrealizeはIf-MatchにGETのETagを指定すると、他の更新と競合した場合に412で現在の支払いを返す
+		v1.GET("/moneypools/:moneypool_id/payments/:payment_id", getPaymentHandler)
 		v1.POST("/moneypools/:moneypool_id/payments", postPayment)
 		v1.PATCH("/moneypools/:moneypool_id/payments/:payment_id", updatePaymentHandler)
 		v1.DELETE("/moneypools/:moneypool_id/payments/:payment_id", deletePaymentHandler)
+		// 予定の支払いを実績にする
+		v1.POST("/moneypools/:moneypool_id/payments/:payment_id/realize", realizePaymentHandler)
+		// 銀行やクレジットカードの明細CSVの取り込み（multipart/form-data）
+		// fileのほか、encoding(utf-8/shift_jis), delimiter, skip_rows, has_header, date_column, title_column, description_column,
+		// amount_column または withdrawal_column/deposit_column, amount_sign(expense_negative/expense_positive), is_planned を指定する
+		// 列はヘッダー名か1始まりの列番号で指定する。previewで確認してから、同じ内容とlinesを送って取り込む
+		v1.POST("/moneypools/:moneypool_id/import/preview", previewPaymentImportHandler)
+		v1.POST("/moneypools/:moneypool_id/import", importPaymentsHandler)
+		// 予定日を過ぎても実績になっていない予定の支払い
+		v1.GET("/payments/overdue", getOverduePayments)
+
+		// 支払いの書き出し。format=csv (UTF-8 BOM付き), json, ofx
+		// /export?format=ofx&moneypool_id=1&from=2024-01-01&to=2024-12-31
+		v1.GET("/export", exportPaymentsHandler)
+
+		// 支払い・マネープール・店の横断検索。クエリパラメータqの空白区切りの語をすべて含むものを返す
+		// マネープールの閲覧権限は /moneypools/:moneypool_id と同じ
+		// /search?q=Amazon&from=2024-03-01&to=2024-03-31
+		v1.GET("/search", searchHandler)
+
+		// 定期支払いのルール。ルールから数か月先までの予定の支払いが作成される
+		// /recurringpayments?moneypool_id=1
+		v1.GET("/recurringpayments", getRecurringPayments)
+		v1.POST("/moneypools/:moneypool_id/recurringpayments", createRecurringPaymentHandler)
+		v1.PATCH("/recurringpayments/:recurringpayment_id", updateRecurringPaymentHandler)
+		v1.POST("/recurringpayments/:recurringpayment_id/pause", pauseRecurringPaymentHandler)
+		v1.POST("/recurringpayments/:recurringpayment_id/resume", resumeRecurringPaymentHandler)
+		v1.DELETE("/recurringpayments/:recurringpayment_id", deleteRecurringPaymentHandler)
+
+		// マネープール間の振替。振替元と振替先の支払いはまとめて作成・更新・削除される
+		// 振替の支払いを /moneypools/:moneypool_id/payments/:payment_id で個別に変更することはできない
+		v1.GET("/transfers", getTransfers)
+		v1.GET("/transfers/:transfer_id", getTransfer)
+		v1.POST("/transfers", createTransferHandler)
+		v1.PATCH("/transfers/:transfer_id", updateTransferHandler)
+		v1.DELETE("/transfers/:transfer_id", deleteTransferHandler)
 
 		// MoneyProviderの追加・修正・削除
 		v1.POST("/moneyproviders", createMoneyProviderHandler)
 		v1.PATCH("/moneyproviders/:moneyprovider_id", updateMoneyProviderHandler)
 		v1.DELETE("/moneyproviders/:moneyprovider_id", deleteMoneyProviderHandler)
+		// 残高の推移。残高を変更するたびに記録される
+		// /moneyproviders/1/history?from=2023-01-01&to=2023-12-31
+		v1.GET("/moneyproviders/:moneyprovider_id/history", getMoneyProviderBalanceHistory)
+
+		// 店舗の一覧・追加・修正・削除
+		// 削除された店舗を参照している支払いは店舗なしになる
+		v1.GET("/stores", getStores)
+		v1.POST("/stores", createStoreHandler)
+		v1.PATCH("/stores/:store_id", updateStoreHandler)
+		v1.DELETE("/stores/:store_id", deleteStoreHandler)
+
+		// ラベルの一覧・追加・修正・削除
+		v1.GET("/labels", getLabels)
+		v1.POST("/labels", createLabelHandler)
+		v1.PATCH("/labels/:label_id", updateLabelHandler)
+		v1.DELETE("/labels/:label_id", deleteLabelHandler)
+		// ラベルごとの期間内の支払い合計
+		// /labels/totals?from=2023-05-01&to=2023-05-31
+		v1.GET("/labels/totals", getLabelTotals)
+
+		// 為替レートの一覧・追加・削除
+		// /exchangerates/csv はmultipartのfileフィールドでCSV(from_currency,to_currency,rate,valid_from)を受け取る
+		v1.GET("/exchangerates", getExchangeRates)
+		v1.POST("/exchangerates", createExchangeRateHandler)
+		v1.POST("/exchangerates/csv", importExchangeRatesHandler)
+		v1.DELETE("/exchangerates/:exchangerate_id", deleteExchangeRateHandler)
+		// 合計を表示する基準通貨の設定
+		v1.PUT("/basecurrency", updateBaseCurrencyHandler)
 
 		// MoneyPoolの追加・修正・削除
 		v1.POST("/moneypools", createMoneyPool)
 		v1.PATCH("/moneypools/:moneypool_id", updateMoneyPool)
 		v1.DELETE("/moneypools/:moneypool_id", deleteMoneyPool)
+		// 削除したマネープールはゴミ箱に入り、支払いと一緒に元に戻せる
+		// ゴミ箱に入ってから -trash-retention-days 日（デフォルト30日）を過ぎると、支払いと一緒に完全に削除される
+		v1.GET("/moneypools/trash", getMoneyPoolTrash)
+		v1.POST("/moneypools/:moneypool_id/restore", restoreMoneyPoolHandler)
+		v1.DELETE("/moneypools/:moneypool_id/permanent", purgeMoneyPoolHandler)
+
+		// 変更履歴。支払い・マネープール・マネープロバイダー・ユーザーグループ・公開範囲・振替の作成・更新・削除を、変更前後の値と一緒に記録している
+		// マネープールの所有者だけが見られる。next_beforeをbeforeに渡すと続きの古い履歴を取得できる
+		v1.GET("/moneypools/:moneypool_id/audit", getMoneyPoolAuditLogs)
+		v1.GET("/moneypools/:moneypool_id/payments/:payment_id/audit", getPaymentAuditLogs)
 		// 公開範囲の設定(対象となるマネープールに対して、リクエストのjsonで指定されたユーザーグループに対して)
 		v1.POST("/moneypools/:moneypool_id/publicationscope", changePublicationScope)
 
+		// マネープールの予算。/moneypools?type=summary にも予算の状況が含まれる
+		v1.GET("/moneypools/:moneypool_id/budget", getMoneyPoolBudget)
+		v1.PUT("/moneypools/:moneypool_id/budget", setMoneyPoolBudgetHandler)
+		v1.DELETE("/moneypools/:moneypool_id/budget", deleteMoneyPoolBudgetHandler)
+		// マネープールをマネープロバイダー（口座・財布など）に割り当てる
+		v1.PUT("/moneypools/:moneypool_id/moneyprovider", allocateMoneyPoolHandler)
+		// マネープロバイダーの残高と割り当てられたマネープールの残高の照合と、その履歴
+		v1.GET("/reconciliation", getReconciliation)
+		v1.GET("/reconciliations", getReconciliationHistory)
+		v1.POST("/reconciliations", createReconciliationHandler)
+
+		// ログインユーザーのプロフィール。名前・メールアドレス・アバター・ロケール・タイムゾーンはログインのたびにOIDCのクレームから更新される
+		// PATCHではhandle, display_name, avatar_url, locale, timezoneを変更できる。空文字列を指定するとOIDCの値に戻る
+		v1.GET("/me", getMe)
+		v1.PATCH("/me", updateMe)
+		// ユーザーグループに追加するユーザーをメールアドレスかハンドルで探す。完全一致のみ
+		// /users/lookup?email=alice@example.com
+		v1.GET("/users/lookup", lookupUser)
+
 		// ユーザーグループの編集
-		// これだけで詳細情報を全部取得する
+		// これだけで詳細情報を全部取得する。メンバーは名前とアバターも返す
 		v1.GET("/usergroups", getUserGroups)
 		v1.POST("/usergroups", createUserGroup)
 		v1.PATCH("/usergroups/:usergroup_id", updateUserGroup)
 		v1.DELETE("/usergroups/:usergroup_id", deleteUserGroup)
+
+		// アカウントのバックアップと復元。削除済みのマネープールも含めて1つのJSONにまとめる
+		// 復元ではIDが振り直される。mode=emptyはデータのないアカウントにだけ復元でき、mode=mergeは既存のデータに追加する
+		// /restore?mode=merge
+		v1.GET("/backup", getBackupHandler)
+		v1.POST("/restore", restoreBackupHandler)
+
+		// 個人用アクセストークン。スクリプトなどからAuthorization: Bearerで使う
+		// scopesはread(GETのみ), payments:write(支払いの追加・修正・削除と取り込み), admin(すべて)の組み合わせ
+		// expires_atを省略すると期限なし。トークンの作成はOIDCでログインしているときだけできる
+		v1.GET("/tokens", getAPITokens)
+		v1.POST("/tokens", createAPITokenHandler)
+		v1.DELETE("/tokens/:token_id", revokeAPITokenHandler)
 	}
 	return r, nil
 }
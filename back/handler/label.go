@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler function for listing the labels of the login user.
+func getLabels(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	response, err := uc.GetLabels(userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Handler function for creating a new Label.
+func createLabelHandler(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	userID := c.MustGet("loginUserID").(string)
+	response, err := uc.AddLabel(userID, req.Name)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// Handler function for updating an existing Label.
+func updateLabelHandler(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	userID := c.MustGet("loginUserID").(string)
+	labelID := c.Param("label_id")
+
+	response, err := uc.UpdateLabel(userID, labelID, req.Name)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Handler function for deleting a Label.
+func deleteLabelHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+	labelID := c.Param("label_id")
+
+	if err := uc.DeleteLabel(userID, labelID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GET /labels/totals
+// 指定された期間のラベルごとの支払い合計を取得する
+// include_planned=trueで予定の支払いも含める
+func getLabelTotals(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	from, err := time.Parse("2006-01-02", c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from format, should be YYYY-MM-DD"})
+		return
+	}
+	to, err := time.Parse("2006-01-02", c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to format, should be YYYY-MM-DD"})
+		return
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from"})
+		return
+	}
+	includePlanned := c.Query("include_planned") == "true"
+
+	response, err := uc.GetLabelTotals(userID, from, to, includePlanned)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
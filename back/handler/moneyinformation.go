@@ -9,6 +9,7 @@ import (
 )
 
 // getMoneyInformation は、/moneyinformation エンドポイントのリクエストを処理するハンドラです。
+// オプションパラメータcurrencyで換算先の通貨を指定できる。省略した場合はユーザーの基準通貨になる。
 func getMoneyInformation(c *gin.Context) {
 	queryUserID := c.Query("user_id")
 	if queryUserID == "" {
@@ -33,6 +34,7 @@ func getMoneyInformation(c *gin.Context) {
 
 	// オプショナルなクエリパラメータ 'date' を解析
 	dateParam := c.DefaultQuery("date", "")
+	currency := c.Query("currency")
 	var response usecase.MoneySumResponse
 	var err error
 
@@ -45,15 +47,15 @@ func getMoneyInformation(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
 			return
 		}
-		response, err = uc.GetMoneyInformationOfDate(queryUserID, loginUserID, date)
+		response, err = uc.GetMoneyInformationOfDate(queryUserID, loginUserID, date, currency)
 	} else {
 		// 日付が指定されていない場合は現在の情報を計算
-		response, err = uc.GetMoneyInformation(queryUserID, loginUserID)
+		response, err = uc.GetMoneyInformation(queryUserID, loginUserID, currency)
 	}
 
 	// エラーハンドリング
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
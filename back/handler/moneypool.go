@@ -8,20 +8,23 @@ import (
 )
 
 // getMoneyPools APIのコメント
-// @Summary マネープールの要約情報を取得
+// @Summary マネープールの要約情報または詳細情報を取得
 // @Description ユーザーIDに基づいたマネープールの要約情報を取得します。クエリパラメータとしてtypeとuser_idを受け取ります。
+// @Description type=detailの場合は説明、公開範囲、実績と予測の残高、支払い件数、最終支払い日、予算の状況も返します。
 // @Tags moneypools
 // @Accept  json
 // @Produce  json
 // @Param   type query string false "リクエストタイプ (summary または detail)" Enums(summary, detail) default(summary)
 // @Param   user_id query string true "ユーザーID"
-// @Success 200 {object} MoneyPoolsSummaryResponse "成功したレスポンス"
+// @Param   currency query string false "換算先の通貨 (省略時はユーザーの基準通貨)"
+// @Success 200 {object} MoneyPoolsSummaryResponse "成功したレスポンス (type=summary)"
+// @Success 200 {object} MoneyPoolsDetailResponse "成功したレスポンス (type=detail)"
 // @Failure 400 {object} map[string]string "不正なリクエストパラメータ"
 // @Failure 500 {object} map[string]string "サーバ内部エラー"
 // @Router /v1/moneypools [get]
 func getMoneyPools(c *gin.Context) {
 	queryType := c.DefaultQuery("type", "summary")
-	if queryType != "summary" {
+	if queryType != "summary" && queryType != "detail" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid type parameter"})
 		return
 	}
@@ -45,15 +48,21 @@ func getMoneyPools(c *gin.Context) {
 		}
 	}
 
-	// Retrieve summary information using the userID and loginUserID.
-	summaryResponse, err := uc.GetMoneyPoolsSummary(queryUserID, loginUserID)
+	// Retrieve summary or detail information using the userID and loginUserID.
+	var response any
+	var err error
+	if queryType == "detail" {
+		response, err = uc.GetMoneyPoolsDetail(queryUserID, loginUserID, c.Query("currency"))
+	} else {
+		response, err = uc.GetMoneyPoolsSummary(queryUserID, loginUserID, c.Query("currency"))
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get money pools summary"})
+		c.Error(err)
 		return
 	}
 
-	// Send the retrieved summary information in the response.
-	c.JSON(http.StatusOK, summaryResponse)
+	// Send the retrieved information in the response.
+	c.JSON(http.StatusOK, response)
 }
 
 // getMoneyPool APIのコメント
@@ -64,6 +73,17 @@ func getMoneyPools(c *gin.Context) {
 // @Produce  json
 // @Param   user_id       query    string  true  "ユーザーID"
 // @Param   moneypool_id  path     string  true  "マネープールID"
+// @Param   from          query    string  false "この日付以降の支払い (YYYY-MM-DD)"
+// @Param   to            query    string  false "この日付以前の支払い (YYYY-MM-DD)"
+// @Param   min_amount    query    string  false "金額の下限"
+// @Param   max_amount    query    string  false "金額の上限"
+// @Param   status        query    string  false "予定か実績か" Enums(planned, actual)
+// @Param   q             query    string  false "タイトルの部分一致"
+// @Param   store         query    string  false "店IDによる支払いの絞り込み"
+// @Param   label         query    string  false "ラベルIDによる支払いの絞り込み"
+// @Param   sort          query    string  false "並び順" Enums(date_desc, date_asc, amount_desc, amount_asc) default(date_desc)
+// @Param   limit         query    int     false "1ページの件数 (最大1000、省略時は全件)"
+// @Param   cursor        query    string  false "前のページのnext_cursor"
 // @Success 200 {object}  MoneyPoolResponse "成功時にマネープール情報を返す"
 // @Failure 400 {object}  map[string]string      "ユーザーIDが不正である場合のエラーメッセージを返す"
 // @Failure 500 {object}  map[string]string      "サーバー内部エラーが発生した場合のエラーメッセージを返す"
@@ -90,15 +110,21 @@ func getMoneyPool(c *gin.Context) {
 		}
 	}
 
+	query, err := parsePaymentQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Call the use case with the userID and loginUserID to get the money pool.
-	response, err := uc.GetMoneyPool(queryUserID, loginUserID, moneyPoolID)
+	response, err := uc.GetMoneyPool(queryUserID, loginUserID, moneyPoolID, query)
 	if err != nil {
-		// Handle the error, e.g., by logging and returning an appropriate HTTP status code.
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		c.Error(err)
 		return
 	}
 
-	// Return the response.
+	// Return the response with the version of the money pool as its ETag.
+	setETag(c, response.Version)
 	c.JSON(http.StatusOK, response)
 }
 
@@ -121,6 +147,8 @@ func createMoneyPool(c *gin.Context) {
 		Description string `json:"description"`
 		Type        string `json:"type"`
 		Emoji       string `json:"emoji"`
+		// 省略した場合はJPY
+		Currency string `json:"currency"`
 	}
 	if err := c.BindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -130,9 +158,9 @@ func createMoneyPool(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "request type does not match any options"})
 		return
 	}
-	response, err := uc.AddMoneyPool(userID, request.Name, request.Description, request.Type, request.Emoji)
+	response, err := uc.AddMoneyPool(userID, request.Name, request.Description, request.Type, request.Emoji, request.Currency)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, response)
@@ -147,8 +175,10 @@ func createMoneyPool(c *gin.Context) {
 // @Param loginUserID header string true "ログインユーザーID"
 // @Param moneypool_id path string true "マネープールID"
 // @Param body body struct{Name string `json:"name"; Description string `json:"description"; Type domain.PublicType `json:"type"`} true "更新するマネープール情報"
+// @Param If-Match header string false "GETで取得したETag"
 // @Success 200 {object} MoneyPoolResponse
 // @Failure 400 {object} map[string]string
+// @Failure 412 {object} map[string]interface{} "Precondition Failed: 他の更新と競合した。currentに現在のマネープール"
 // @Failure 500 {object} map[string]string
 // @Router /moneypools/{moneypool_id} [patch]
 func updateMoneyPool(c *gin.Context) {
@@ -159,6 +189,8 @@ func updateMoneyPool(c *gin.Context) {
 		Description string `json:"description"`
 		Type        string `json:"type"`
 		Emoji       string `json:"emoji"`
+		// 省略した場合は今の通貨のまま
+		Currency *string `json:"currency"`
 	}
 	if err := c.BindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -168,11 +200,20 @@ func updateMoneyPool(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "request type does not match any options"})
 		return
 	}
-	response, err := uc.UpdateMoneyPool(userID, moneyPoolID, request.Name, request.Description, request.Type, request.Emoji)
+	expectedVersion, err := parseIfMatch(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	response, err := uc.UpdateMoneyPool(userID, moneyPoolID, request.Name, request.Description, request.Type, request.Emoji, request.Currency, expectedVersion)
+	if err != nil {
+		if respondVersionConflict(c, err, expectedVersion) {
+			return
+		}
+		c.Error(err)
 		return
 	}
+	setETag(c, response.Version)
 	c.JSON(http.StatusOK, response)
 }
 
@@ -192,7 +233,7 @@ func deleteMoneyPool(c *gin.Context) {
 	moneyPoolID := c.Param("moneypool_id")
 	err := uc.DeleteMoneyPool(userID, moneyPoolID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.Status(http.StatusOK)
@@ -224,7 +265,7 @@ func changePublicationScope(c *gin.Context) {
 	}
 	err := uc.ChangePublicationScope(userID, moneyPoolID, request.UserGroupIDs)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.Status(http.StatusOK)
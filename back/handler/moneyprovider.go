@@ -2,17 +2,18 @@ package handler
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/walnuts1018/openchokin/back/domain"
+	"github.com/walnuts1018/openchokin/back/timeJST"
 )
 
-// MoneyProvidersHandler handles GET requests for a summary of money providers.
+// MoneyProvidersHandler handles GET requests for a summary or details of money providers.
 func getMoneyProviders(c *gin.Context) {
-	// クエリパラメータ 'type' を取得し、'summary' が指定されているかチェックします。
+	// クエリパラメータ 'type' を取得し、'summary' か 'detail' が指定されているかチェックします。
 	queryType := c.DefaultQuery("type", "summary")
-
-	// 今回は 'summary' のみを実装しているため、それ以外の値が来た場合はエラーを返します。
-	if queryType != "summary" {
+	if queryType != "summary" && queryType != "detail" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid type parameter"})
 		return
 	}
@@ -20,21 +21,45 @@ func getMoneyProviders(c *gin.Context) {
 	// 認証ミドルウェアでuserIDを指定する
 	userID := c.MustGet("loginUserID").(string)
 
-	response, err := uc.GetMoneyProvidersSummary(userID)
+	var response any
+	var err error
+	if queryType == "detail" {
+		// 'detail' では残高の推移と割り当てられたマネープールも返します。
+		response, err = uc.GetMoneyProvidersDetail(userID)
+	} else {
+		response, err = uc.GetMoneyProvidersSummary(userID)
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GET /moneyproviders/:moneyprovider_id
+// マネープロバイダーを1件返す。ETagにマネープロバイダーのバージョンが入る
+func getMoneyProviderHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+	moneyProviderID := c.Param("moneyprovider_id")
+
+	response, err := uc.GetMoneyProvider(userID, moneyProviderID)
 	if err != nil {
-		// Handle the error, e.g., by logging and returning an appropriate HTTP status code.
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		c.Error(err)
 		return
 	}
 
+	setETag(c, response.Version)
 	c.JSON(http.StatusOK, response)
 }
 
 // Handler function for creating a new MoneyProvider.
 func createMoneyProviderHandler(c *gin.Context) {
 	var req struct {
-		Name    string  `json:"name"`
-		Balance float64 `json:"balance"`
+		Name    string       `json:"name"`
+		Balance domain.Money `json:"balance"`
+		// 省略した場合はJPY
+		Currency string `json:"currency"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -43,9 +68,9 @@ func createMoneyProviderHandler(c *gin.Context) {
 	}
 
 	userID := c.MustGet("loginUserID").(string) // Assuming authentication middleware sets this.
-	response, err := uc.AddMoneyProvider(userID, req.Name, req.Balance)
+	response, err := uc.AddMoneyProvider(userID, req.Name, req.Balance, req.Currency)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -53,10 +78,13 @@ func createMoneyProviderHandler(c *gin.Context) {
 }
 
 // Handler function for updating an existing MoneyProvider.
+// If-Matchにマネープロバイダーのversionを指定すると、他の更新と競合した場合は412で現在の状態を返す
 func updateMoneyProviderHandler(c *gin.Context) {
 	var req struct {
-		Name    string  `json:"name"`
-		Balance float64 `json:"balance"`
+		Name    string       `json:"name"`
+		Balance domain.Money `json:"balance"`
+		// 省略した場合は今の通貨のまま
+		Currency *string `json:"currency"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -67,12 +95,22 @@ func updateMoneyProviderHandler(c *gin.Context) {
 	userID := c.MustGet("loginUserID").(string)
 	moneyProviderID := c.Param("moneyprovider_id")
 
-	response, err := uc.UpdateMoneyProvider(userID, moneyProviderID, req.Name, req.Balance)
+	expectedVersion, err := parseIfMatch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := uc.UpdateMoneyProvider(userID, moneyProviderID, req.Name, req.Balance, req.Currency, expectedVersion)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if respondVersionConflict(c, err, expectedVersion) {
+			return
+		}
+		c.Error(err)
 		return
 	}
 
+	setETag(c, response.Version)
 	c.JSON(http.StatusOK, response)
 }
 
@@ -82,9 +120,48 @@ func deleteMoneyProviderHandler(c *gin.Context) {
 	moneyProviderID := c.Param("moneyprovider_id")
 
 	if err := uc.DeleteMoneyProvider(userID, moneyProviderID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	c.Status(http.StatusNoContent)
 }
+
+// GET /moneyproviders/:moneyprovider_id/history
+// マネープロバイダーの残高の推移を返す。from, to (YYYY-MM-DD) を省略した場合は今日までの1年間
+func getMoneyProviderBalanceHistory(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+	moneyProviderID := c.Param("moneyprovider_id")
+
+	now := timeJST.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if toParam := c.Query("to"); toParam != "" {
+		var err error
+		to, err = time.Parse("2006-01-02", toParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to format, should be YYYY-MM-DD"})
+			return
+		}
+	}
+	from := to.AddDate(-1, 0, 0)
+	if fromParam := c.Query("from"); fromParam != "" {
+		var err error
+		from, err = time.Parse("2006-01-02", fromParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from format, should be YYYY-MM-DD"})
+			return
+		}
+	}
+	if from.After(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return
+	}
+
+	response, err := uc.GetMoneyProviderBalanceHistory(userID, moneyProviderID, from, to)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
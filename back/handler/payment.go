@@ -1,24 +1,55 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/walnuts1018/openchokin/back/domain"
+	"github.com/walnuts1018/openchokin/back/timeJST"
+	"github.com/walnuts1018/openchokin/back/usecase"
 )
 
+// GET /moneypools/:moneypool_id/payments/:payment_id
+// 支払いを1件返す。ETagに支払いのバージョンが入る
+func getPaymentHandler(c *gin.Context) {
+	loginUserID := c.GetString("loginUserID")
+	moneyPoolID := c.Param("moneypool_id")
+	paymentID := c.Param("payment_id")
+
+	paymentResponse, err := uc.GetPayment(loginUserID, moneyPoolID, paymentID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	setETag(c, paymentResponse.Version)
+	c.JSON(http.StatusOK, paymentResponse)
+}
+
 // updatePaymentHandler handles the PATCH request for updating a payment
+// If-Matchに支払いのETagを指定すると、他の更新と競合した場合は412で現在の支払いを返す
 func updatePaymentHandler(c *gin.Context) {
 	userID := c.MustGet("loginUserID").(string) // Assuming userID retrieval from middleware
 	moneyPoolID := c.Param("moneypool_id")
 	paymentID := c.Param("payment_id")
 
 	var req struct {
-		Date        time.Time `json:"date"`
-		Title       string    `json:"title"`
-		Amount      float64   `json:"amount"`
-		Description string    `json:"description"`
-		IsPlanned   bool      `json:"is_planned"`
+		Date        time.Time    `json:"date"`
+		Title       string       `json:"title"`
+		Amount      domain.Money `json:"amount"`
+		Description string       `json:"description"`
+		IsPlanned   bool         `json:"is_planned"`
+		// store_idを省略した場合は既存の店舗を維持し、nullの場合は店舗を外す
+		StoreID json.RawMessage `json:"store_id"`
+		// label_idsを省略した場合は既存のラベルを維持する
+		LabelIDs []string `json:"label_ids"`
+		// itemsを省略した場合は既存の明細を維持し、空配列の場合は明細を削除する
+		Items []usecase.PaymentItemInput `json:"items"`
 	}
 
 	if err := c.BindJSON(&req); err != nil {
@@ -26,12 +57,31 @@ func updatePaymentHandler(c *gin.Context) {
 		return
 	}
 
-	paymentResponse, err := uc.UpdatePayment(userID, moneyPoolID, paymentID, req.Date, req.Title, req.Amount, req.Description, req.IsPlanned)
+	keepStore := len(req.StoreID) == 0
+	var storeID *string
+	if !keepStore {
+		if err := json.Unmarshal(req.StoreID, &storeID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "store_id must be a string or null"})
+			return
+		}
+	}
+
+	expectedVersion, err := parseIfMatch(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	paymentResponse, err := uc.UpdatePayment(userID, moneyPoolID, paymentID, req.Date, req.Title, req.Amount, req.Description, req.IsPlanned, storeID, keepStore, req.LabelIDs, req.Items, expectedVersion)
+	if err != nil {
+		if respondVersionConflict(c, err, expectedVersion) {
+			return
+		}
+		c.Error(err)
+		return
+	}
+
+	setETag(c, paymentResponse.Version)
 	c.JSON(http.StatusOK, paymentResponse)
 }
 
@@ -42,13 +92,81 @@ func deletePaymentHandler(c *gin.Context) {
 
 	err := uc.DeletePayment(userID, paymentID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	c.Status(http.StatusNoContent)
 }
 
+// POST /moneypools/:moneypool_id/payments/:payment_id/realize
+// 予定の支払いを実績にする。元の予定日と予定金額は予実差異の確認用に残る
+// PATCHと同じようにIf-Matchを指定できる
+func realizePaymentHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+	moneyPoolID := c.Param("moneypool_id")
+	paymentID := c.Param("payment_id")
+
+	var req struct {
+		// 省略した場合は今日
+		Date string `json:"date"`
+		// 省略した場合は予定金額のまま
+		Amount *domain.Money `json:"amount"`
+		// 省略した場合は既存の明細を維持する
+		Items []usecase.PaymentItemInput `json:"items"`
+	}
+	// ボディは省略できる。空のボディをJSONとして読むとEOFになるので、ある場合だけ読む
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	now := timeJST.Now()
+	date := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if req.Date != "" {
+		var err error
+		date, err = time.Parse("2006-01-02", req.Date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date format, should be YYYY-MM-DD"})
+			return
+		}
+	}
+
+	expectedVersion, err := parseIfMatch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	paymentResponse, err := uc.RealizePayment(userID, moneyPoolID, paymentID, date, req.Amount, req.Items, expectedVersion)
+	if err != nil {
+		if respondVersionConflict(c, err, expectedVersion) {
+			return
+		}
+		c.Error(err)
+		return
+	}
+
+	setETag(c, paymentResponse.Version)
+	c.JSON(http.StatusOK, paymentResponse)
+}
+
+// GET /payments/overdue
+// 予定日を過ぎても実績になっていない予定の支払いを、古い順に返す
+func getOverduePayments(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	response, err := uc.GetOverduePayments(userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
 // POST /moneypools/:moneypool_id/payments
 // 指定されたマネープールに新しい支払いを追加する
 func postPayment(c *gin.Context) {
@@ -57,11 +175,15 @@ func postPayment(c *gin.Context) {
 
 	// リクエストボディの構造体
 	var paymentRequest struct {
-		Title       string  `json:"title"`
-		Amount      float64 `json:"amount"`
-		Description string  `json:"description"`
-		IsPlanned   bool    `json:"is_planned"`
-		Date        string  `json:"date"`
+		Title       string       `json:"title"`
+		Amount      domain.Money `json:"amount"`
+		Description string       `json:"description"`
+		IsPlanned   bool         `json:"is_planned"`
+		Date        string       `json:"date"`
+		StoreID     *string      `json:"store_id"`
+		LabelIDs    []string     `json:"label_ids"`
+		// 明細の合計は金額の絶対値と一致する必要がある
+		Items []usecase.PaymentItemInput `json:"items"`
 	}
 	if err := c.BindJSON(&paymentRequest); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
@@ -74,17 +196,71 @@ func postPayment(c *gin.Context) {
 		return
 	}
 
-	err = uc.AddNewPayment(userID, moneyPoolID, date, paymentRequest.Title, paymentRequest.Amount, paymentRequest.Description, paymentRequest.IsPlanned)
+	err = uc.AddNewPayment(userID, moneyPoolID, date, paymentRequest.Title, paymentRequest.Amount, paymentRequest.Description, paymentRequest.IsPlanned, paymentRequest.StoreID, paymentRequest.LabelIDs, paymentRequest.Items)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	c.Status(http.StatusCreated)
 }
 
+// parsePaymentQuery reads the filters, sort order and page of a payment listing from the query parameters.
+// from, to: YYYY-MM-DD (両端を含む), min_amount, max_amount, status: planned or actual, q: タイトルの部分一致,
+// store, label, sort: date_desc (default), date_asc, amount_desc, amount_asc, limit, cursor: 前のページのnext_cursor
+func parsePaymentQuery(c *gin.Context) (usecase.PaymentQuery, error) {
+	query := usecase.PaymentQuery{
+		Title:   c.Query("q"),
+		StoreID: c.Query("store"),
+		LabelID: c.Query("label"),
+		Sort:    c.Query("sort"),
+		Cursor:  c.Query("cursor"),
+	}
+
+	for name, dst := range map[string]**time.Time{"from": &query.From, "to": &query.To} {
+		if value := c.Query(name); value != "" {
+			date, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return usecase.PaymentQuery{}, fmt.Errorf("invalid %s format, should be YYYY-MM-DD", name)
+			}
+			*dst = &date
+		}
+	}
+	for name, dst := range map[string]**domain.Money{"min_amount": &query.MinAmount, "max_amount": &query.MaxAmount} {
+		if value := c.Query(name); value != "" {
+			amount, err := domain.ParseMoney(value)
+			if err != nil {
+				return usecase.PaymentQuery{}, fmt.Errorf("invalid %s: %v", name, err)
+			}
+			*dst = &amount
+		}
+	}
+
+	switch c.Query("status") {
+	case "":
+	case "planned":
+		planned := true
+		query.IsPlanned = &planned
+	case "actual":
+		planned := false
+		query.IsPlanned = &planned
+	default:
+		return usecase.PaymentQuery{}, errors.New("invalid status, should be planned or actual")
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return usecase.PaymentQuery{}, errors.New("invalid limit, should be a positive integer")
+		}
+		query.Limit = limit
+	}
+	return query, nil
+}
+
 // GET /payments
 // 指定された月の支払い情報を取得する
+// parsePaymentQueryのクエリパラメータで絞り込み・並び替え・ページングができる（from, toは使わず月で絞り込む）
 func getMonthlyPayments(c *gin.Context) {
 	userID := c.MustGet("loginUserID").(string) // 認証ユーザーのIDを取得
 	monthStr := c.Query("month")                // クエリパラメータから月を取得
@@ -96,9 +272,15 @@ func getMonthlyPayments(c *gin.Context) {
 		return
 	}
 
-	response, err := uc.GetMonthlyPayments(userID, month)
+	query, err := parsePaymentQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := uc.GetMonthlyPayments(userID, month, query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
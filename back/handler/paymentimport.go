@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/walnuts1018/openchokin/back/usecase"
+)
+
+// maxImportFileSize は取り込むCSVファイルの最大サイズです。
+const maxImportFileSize = 10 << 20
+
+// parsePaymentImportForm reads the uploaded CSV and the column mapping from the multipart form.
+// The caller must close the returned file.
+func parsePaymentImportForm(c *gin.Context) (multipart.File, usecase.PaymentImportMapping, error) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return nil, usecase.PaymentImportMapping{}, errors.New("file is required")
+	}
+	if fileHeader.Size > maxImportFileSize {
+		return nil, usecase.PaymentImportMapping{}, errors.New("file is too large")
+	}
+
+	mapping := usecase.PaymentImportMapping{
+		Encoding:          c.PostForm("encoding"),
+		HasHeader:         c.DefaultPostForm("has_header", "true") == "true",
+		DateColumn:        c.PostForm("date_column"),
+		TitleColumn:       c.PostForm("title_column"),
+		DescriptionColumn: c.PostForm("description_column"),
+		AmountColumn:      c.PostForm("amount_column"),
+		WithdrawalColumn:  c.PostForm("withdrawal_column"),
+		DepositColumn:     c.PostForm("deposit_column"),
+		AmountSign:        c.PostForm("amount_sign"),
+		IsPlanned:         c.PostForm("is_planned") == "true",
+	}
+	switch delimiter := c.PostForm("delimiter"); {
+	case delimiter == "":
+	case delimiter == "tab":
+		mapping.Delimiter = '\t'
+	case utf8.RuneCountInString(delimiter) == 1:
+		mapping.Delimiter, _ = utf8.DecodeRuneInString(delimiter)
+	default:
+		return nil, usecase.PaymentImportMapping{}, errors.New("delimiter should be a single character or tab")
+	}
+	if value := c.PostForm("skip_rows"); value != "" {
+		skipRows, err := strconv.Atoi(value)
+		if err != nil || skipRows < 0 {
+			return nil, usecase.PaymentImportMapping{}, errors.New("skip_rows should be a non-negative integer")
+		}
+		mapping.SkipRows = skipRows
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, usecase.PaymentImportMapping{}, err
+	}
+	return file, mapping, nil
+}
+
+// POST /moneypools/:moneypool_id/import/preview
+// CSVを読み取った結果を返す。保存はしない
+func previewPaymentImportHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	file, mapping, err := parsePaymentImportForm(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	response, err := uc.PreviewPaymentImport(userID, c.Param("moneypool_id"), file, mapping)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// POST /moneypools/:moneypool_id/import
+// プレビューと同じCSVと対応付けを送り、linesで指定した行（カンマ区切りの行番号）を1つのトランザクションで取り込む
+// linesを省略した場合は、エラーがなく重複でもない行をすべて取り込む
+func importPaymentsHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	file, mapping, err := parsePaymentImportForm(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	var lines []int
+	if value, ok := c.GetPostForm("lines"); ok {
+		lines = []int{}
+		for _, field := range strings.Split(value, ",") {
+			if strings.TrimSpace(field) == "" {
+				continue
+			}
+			line, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "lines should be comma separated line numbers"})
+				return
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	response, err := uc.ImportPayments(userID, c.Param("moneypool_id"), file, mapping, lines)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PUT /moneypools/:moneypool_id/moneyprovider
+// マネープールのお金を置いているマネープロバイダーを設定する。money_provider_idがnullの場合は割り当てを解除する
+func allocateMoneyPoolHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+	moneyPoolID := c.Param("moneypool_id")
+
+	var req struct {
+		MoneyProviderID *string `json:"money_provider_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := uc.AllocateMoneyPool(userID, moneyPoolID, req.MoneyProviderID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GET /reconciliation
+// マネープロバイダーごとに、残高・割り当てられたマネープールの残高の合計・その差を返す
+func getReconciliation(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	response, err := uc.GetReconciliation(userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GET /reconciliations
+// 保存した照合結果の履歴を新しい順に返す
+func getReconciliationHistory(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	response, err := uc.GetReconciliationHistory(userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// POST /reconciliations
+// 現時点の照合結果を履歴に保存する
+func createReconciliationHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := uc.SaveReconciliation(userID, req.Note)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
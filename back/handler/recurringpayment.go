@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/walnuts1018/openchokin/back/domain"
+	"github.com/walnuts1018/openchokin/back/usecase"
+)
+
+// recurringPaymentRequest is the request body for creating and updating a recurring payment rule.
+type recurringPaymentRequest struct {
+	Title       string       `json:"title"`
+	Amount      domain.Money `json:"amount"`
+	Description string       `json:"description"`
+	StoreID     *string      `json:"store_id"`
+	// daily, weekly, monthly, yearly
+	Frequency string `json:"frequency"`
+	// 省略した場合は1（毎日・毎週・毎月・毎年）
+	Interval int `json:"interval"`
+	// monthlyで第N何曜日を指定する場合。weekdayは0(日曜)〜6(土曜)、nth_weekは1〜5または-1(最終週)
+	Weekday   *int    `json:"weekday"`
+	NthWeek   *int    `json:"nth_week"`
+	StartDate string  `json:"start_date"`
+	EndDate   *string `json:"end_date"`
+	Count     *int    `json:"count"`
+}
+
+func (r recurringPaymentRequest) toInput() (usecase.RecurringPaymentInput, error) {
+	startDate, err := time.Parse("2006-01-02", r.StartDate)
+	if err != nil {
+		return usecase.RecurringPaymentInput{}, errors.New("invalid start_date format, should be YYYY-MM-DD")
+	}
+	var endDate *time.Time
+	if r.EndDate != nil {
+		parsed, err := time.Parse("2006-01-02", *r.EndDate)
+		if err != nil {
+			return usecase.RecurringPaymentInput{}, errors.New("invalid end_date format, should be YYYY-MM-DD")
+		}
+		endDate = &parsed
+	}
+	return usecase.RecurringPaymentInput{
+		Title:       r.Title,
+		Amount:      r.Amount,
+		Description: r.Description,
+		StoreID:     r.StoreID,
+		Frequency:   r.Frequency,
+		Interval:    r.Interval,
+		Weekday:     r.Weekday,
+		NthWeek:     r.NthWeek,
+		StartDate:   startDate,
+		EndDate:     endDate,
+		Count:       r.Count,
+	}, nil
+}
+
+// GET /recurringpayments
+// ログインユーザーの定期支払いのルール一覧を返す。クエリパラメータmoneypool_idで絞り込める
+func getRecurringPayments(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	response, err := uc.GetRecurringPayments(userID, c.Query("moneypool_id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// POST /moneypools/:moneypool_id/recurringpayments
+// 指定されたマネープールに定期支払いのルールを追加する
+func createRecurringPaymentHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+	moneyPoolID := c.Param("moneypool_id")
+
+	var req recurringPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input, err := req.toInput()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := uc.AddRecurringPayment(userID, moneyPoolID, input)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// PATCH /recurringpayments/:recurringpayment_id
+// ルールを更新し、今日以降の予定の支払いを作り直す
+func updateRecurringPaymentHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+	ruleID := c.Param("recurringpayment_id")
+
+	var req recurringPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input, err := req.toInput()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := uc.UpdateRecurringPayment(userID, ruleID, input)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// POST /recurringpayments/:recurringpayment_id/pause
+// ルールを一時停止し、今日以降の予定の支払いを削除する
+func pauseRecurringPaymentHandler(c *gin.Context) {
+	setRecurringPaymentPaused(c, true)
+}
+
+// POST /recurringpayments/:recurringpayment_id/resume
+// 一時停止したルールを再開する。停止中の分は作成されない
+func resumeRecurringPaymentHandler(c *gin.Context) {
+	setRecurringPaymentPaused(c, false)
+}
+
+func setRecurringPaymentPaused(c *gin.Context, paused bool) {
+	userID := c.MustGet("loginUserID").(string)
+	ruleID := c.Param("recurringpayment_id")
+
+	response, err := uc.SetRecurringPaymentPaused(userID, ruleID, paused)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DELETE /recurringpayments/:recurringpayment_id
+// ルールと今日以降の予定の支払いを削除する。過去の支払いは残る
+func deleteRecurringPaymentHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+	ruleID := c.Param("recurringpayment_id")
+
+	if err := uc.DeleteRecurringPayment(userID, ruleID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /search?q=Amazon 3月&from=2024-03-01&to=2024-03-31&limit=20
+// 支払いのタイトル・説明・マネープール名・店名、マネープール名、店名を検索する
+// ログインしていない場合は公開されているマネープールだけが対象になる
+func searchHandler(c *gin.Context) {
+	loginUserID := ""
+	if userID, exists := c.Get("loginUserID"); exists {
+		var ok bool
+		loginUserID, ok = userID.(string)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "User ID is not a string"})
+			return
+		}
+	}
+
+	var from, to *time.Time
+	for name, dst := range map[string]**time.Time{"from": &from, "to": &to} {
+		if value := c.Query(name); value != "" {
+			date, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name + " format, should be YYYY-MM-DD"})
+				return
+			}
+			*dst = &date
+		}
+	}
+
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit, should be a positive integer"})
+			return
+		}
+	}
+
+	response, err := uc.Search(loginUserID, c.Query("q"), from, to, limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/walnuts1018/openchokin/back/domain"
+	"github.com/walnuts1018/openchokin/back/usecase"
+)
+
+// transferRequest is the request body for creating and updating a transfer.
+type transferRequest struct {
+	FromMoneyPoolID string       `json:"from_money_pool_id"`
+	ToMoneyPoolID   string       `json:"to_money_pool_id"`
+	Date            string       `json:"date"`
+	Title           string       `json:"title"`
+	Description     string       `json:"description"`
+	IsPlanned       bool         `json:"is_planned"`
+	Amount          domain.Money `json:"amount"`
+	// 通貨が異なるマネープール間の場合のみ必要
+	ToAmount *domain.Money `json:"to_amount"`
+}
+
+func (r transferRequest) toInput() (usecase.TransferInput, error) {
+	date, err := time.Parse("2006-01-02", r.Date)
+	if err != nil {
+		return usecase.TransferInput{}, errors.New("invalid date format, should be YYYY-MM-DD")
+	}
+	return usecase.TransferInput{
+		FromMoneyPoolID: r.FromMoneyPoolID,
+		ToMoneyPoolID:   r.ToMoneyPoolID,
+		Date:            date,
+		Title:           r.Title,
+		Description:     r.Description,
+		IsPlanned:       r.IsPlanned,
+		Amount:          r.Amount,
+		ToAmount:        r.ToAmount,
+	}, nil
+}
+
+// GET /transfers
+// ログインユーザーの振替一覧を新しい順に返す
+func getTransfers(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	response, err := uc.GetTransfers(userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GET /transfers/:transfer_id
+func getTransfer(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	response, err := uc.GetTransfer(userID, c.Param("transfer_id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// POST /transfers
+// マネープール間でお金を移す。振替元と振替先の支払いが同時に作成される
+func createTransferHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	var req transferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input, err := req.toInput()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := uc.AddTransfer(userID, input)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// PATCH /transfers/:transfer_id
+// 振替と両方の支払いを同時に更新する
+func updateTransferHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	var req transferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input, err := req.toInput()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := uc.UpdateTransfer(userID, c.Param("transfer_id"), input)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DELETE /transfers/:transfer_id
+// 振替と両方の支払いを同時に削除する
+func deleteTransferHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	if err := uc.DeleteTransfer(userID, c.Param("transfer_id")); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/walnuts1018/openchokin/back/config"
+)
+
+// GET /moneypools/trash
+// ログインユーザーのゴミ箱にあるマネープールと、完全に削除される日を返す
+func getMoneyPoolTrash(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	response, err := uc.GetTrash(userID, config.Config.TrashRetentionDays)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// POST /moneypools/:moneypool_id/restore
+// ゴミ箱のマネープールを支払いと一緒に元に戻す
+func restoreMoneyPoolHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	err := uc.RestoreMoneyPool(userID, c.Param("moneypool_id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// DELETE /moneypools/:moneypool_id/permanent
+// ゴミ箱のマネープールを支払い・定期支払いと一緒に完全に削除する。元に戻すことはできない
+func purgeMoneyPoolHandler(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	err := uc.PurgeMoneyPool(userID, c.Param("moneypool_id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
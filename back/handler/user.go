@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/walnuts1018/openchokin/back/usecase"
+)
+
+// GET /me
+// ログインユーザーのプロフィールを取得する
+func getMe(c *gin.Context) {
+	userID := c.MustGet("loginUserID").(string)
+
+	response, err := uc.GetMe(userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// PATCH /me
+// ログインユーザーのプロフィールを変更する。指定しなかった項目はそのまま、空文字列を指定するとOIDCの値に戻る
+func updateMe(c *gin.Context) {
+	var req usecase.UserProfileInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("loginUserID").(string)
+	response, err := uc.UpdateMe(userID, req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GET /users/lookup
+// ユーザーグループに追加するユーザーを、メールアドレスかハンドルの完全一致で探す
+// /users/lookup?email=alice@example.com または /users/lookup?handle=alice
+func lookupUser(c *gin.Context) {
+	email := c.Query("email")
+	handle := c.Query("handle")
+	if (email == "") == (handle == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "either email or handle is required"})
+		return
+	}
+
+	response, err := uc.LookupUser(email, handle)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -11,7 +11,7 @@ func getUserGroups(c *gin.Context) {
 	userID := c.MustGet("loginUserID").(string)
 	response, err := uc.GetUserGroups(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, response)
@@ -30,7 +30,7 @@ func createUserGroup(c *gin.Context) {
 	}
 	response, err := uc.AddUserGroup(userID, requestBody.Name, requestBody.MemberIDs)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusCreated, response)
@@ -50,7 +50,7 @@ func updateUserGroup(c *gin.Context) {
 	}
 	response, err := uc.UpdateUserGroup(userID, userGroupID, requestBody.Name, requestBody.MemberIDs)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, response)
@@ -62,7 +62,7 @@ func deleteUserGroup(c *gin.Context) {
 	userGroupID := c.Param("usergroup_id")
 	err := uc.DeleteUserGroup(userID, userGroupID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.Status(http.StatusOK)
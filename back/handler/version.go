@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/walnuts1018/openchokin/back/usecase"
+)
+
+// setETag sets the version of the resource in the response as its ETag.
+func setETag(c *gin.Context, version int64) {
+	c.Header("ETag", fmt.Sprintf(`"%d"`, version))
+}
+
+// parseIfMatch returns the version in the If-Match header, or nil if the header is missing or "*".
+// Both "3" and W/"3" are accepted, since proxies may weaken the ETag.
+func parseIfMatch(c *gin.Context) (*int64, error) {
+	value := strings.TrimSpace(c.GetHeader("If-Match"))
+	if value == "" || value == "*" {
+		return nil, nil
+	}
+	value = strings.TrimPrefix(value, "W/")
+	if len(value) < 2 || !strings.HasPrefix(value, `"`) || !strings.HasSuffix(value, `"`) {
+		return nil, fmt.Errorf("invalid If-Match header, should be a single ETag such as \"3\"")
+	}
+	version, err := strconv.ParseInt(value[1:len(value)-1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid If-Match header, should be a single ETag such as \"3\"")
+	}
+	return &version, nil
+}
+
+// respondVersionConflict writes the current state of the resource if err is a version conflict, and reports whether it did.
+// A conflict without If-Match happens only when another update came in between reading and writing, which is a 409 rather than a 412.
+func respondVersionConflict(c *gin.Context, err error, expectedVersion *int64) bool {
+	var conflict *usecase.VersionConflictError
+	if !errors.As(err, &conflict) {
+		return false
+	}
+	status := http.StatusPreconditionFailed
+	if expectedVersion == nil {
+		status = http.StatusConflict
+	}
+	setETag(c, conflict.Version)
+	c.JSON(status, gin.H{"error": err.Error(), "current": conflict.Current})
+	return true
+}
@@ -0,0 +1,324 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID は複数のプロセスが同時にマイグレーションを実行しないための advisory lock のキーです。
+const migrationLockID = 4_710_233_801
+
+// Migration is a numbered schema change with its up and down SQL.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes whether a migration has been applied to the database.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// loadMigrations reads the embedded migration files.
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql.
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("unexpected migration file %s", fileName)
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration file %s must be named <version>_<name>.%s.sql", fileName, direction)
+		}
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version in migration file %s: %w", fileName, err)
+		}
+
+		body, err := migrationFiles.ReadFile(path.Join("migrations", fileName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration file %s: %w", fileName, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration version %d has conflicting names %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func ensureMigrationsTable(db *sqlx.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+type appliedMigration struct {
+	Version   int64     `db:"version"`
+	Name      string    `db:"name"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+func getAppliedMigrations(db *sqlx.DB) ([]appliedMigration, error) {
+	var applied []appliedMigration
+	err := db.Select(&applied, `SELECT version, name, applied_at FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// withMigrationLock runs f while holding a session level advisory lock.
+func withMigrationLock(db *sqlx.DB, f func() error) error {
+	conn, err := db.Connx(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(context.Background(), `SELECT pg_advisory_lock($1)`, migrationLockID)
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	return f()
+}
+
+func runMigration(db *sqlx.DB, m Migration, up bool) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	body := m.Down
+	if up {
+		body = m.Up
+	}
+	// 引数なしのExecは単純クエリプロトコルで送信されるため、複数のステートメントをまとめて実行できる
+	_, err = tx.Exec(body)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to run migration %d_%s: %w", m.Version, m.Name, err)
+	}
+
+	if up {
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+	}
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to record migration %d_%s: %w", m.Version, m.Name, err)
+	}
+
+	return tx.Commit()
+}
+
+// MigrateUp applies all pending migrations in order.
+func MigrateUp(db *sqlx.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if err := ensureMigrationsTable(db); err != nil {
+		return err
+	}
+
+	return withMigrationLock(db, func() error {
+		if err := checkAppliedMigrations(db, migrations); err != nil {
+			return err
+		}
+		applied, err := getAppliedMigrations(db)
+		if err != nil {
+			return err
+		}
+		appliedVersions := make(map[int64]bool)
+		for _, a := range applied {
+			appliedVersions[a.Version] = true
+		}
+
+		for _, m := range migrations {
+			if appliedVersions[m.Version] {
+				continue
+			}
+			log.Printf("マイグレーション %d_%s を適用します。", m.Version, m.Name)
+			if err := runMigration(db, m, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateDown rolls back the latest steps migrations.
+func MigrateDown(db *sqlx.DB, steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if err := ensureMigrationsTable(db); err != nil {
+		return err
+	}
+
+	byVersion := make(map[int64]Migration)
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	return withMigrationLock(db, func() error {
+		if err := checkAppliedMigrations(db, migrations); err != nil {
+			return err
+		}
+		applied, err := getAppliedMigrations(db)
+		if err != nil {
+			return err
+		}
+
+		for i := len(applied) - 1; i >= 0 && steps > 0; i, steps = i-1, steps-1 {
+			m := byVersion[applied[i].Version]
+			log.Printf("マイグレーション %d_%s を取り消します。", m.Version, m.Name)
+			if err := runMigration(db, m, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetMigrationStatus lists every known migration and whether it has been applied.
+func GetMigrationStatus(db *sqlx.DB) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	applied, err := getAppliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := make(map[int64]time.Time)
+	for _, a := range applied {
+		appliedAt[a.Version] = a.AppliedAt
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if t, ok := appliedAt[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &t
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// checkAppliedMigrations returns an error if the database has migrations applied that this binary does not know.
+func checkAppliedMigrations(db *sqlx.DB, migrations []Migration) error {
+	applied, err := getAppliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	known := make(map[int64]string)
+	for _, m := range migrations {
+		known[m.Version] = m.Name
+	}
+	for _, a := range applied {
+		name, ok := known[a.Version]
+		if !ok || name != a.Name {
+			return fmt.Errorf("unknown schema version %d_%s is applied to the database", a.Version, a.Name)
+		}
+	}
+	return nil
+}
+
+// CheckSchemaVersion returns an error unless the database schema is exactly at the latest embedded migration.
+func CheckSchemaVersion(db *sqlx.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	var exists bool
+	err = db.Get(&exists, `SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'schema_migrations')`)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to check schema_migrations table: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("schema_migrations table does not exist, run `migrate up` first")
+	}
+
+	if err := checkAppliedMigrations(db, migrations); err != nil {
+		return err
+	}
+	applied, err := getAppliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	if len(applied) != len(migrations) {
+		return fmt.Errorf("%d of %d migrations are applied, run `migrate up` first", len(applied), len(migrations))
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS restricted_publication_scope;
+DROP TABLE IF EXISTS user_group_membership;
+DROP TABLE IF EXISTS item_payment;
+DROP TABLE IF EXISTS payment;
+DROP TABLE IF EXISTS label;
+DROP TABLE IF EXISTS item;
+DROP TABLE IF EXISTS store;
+DROP TABLE IF EXISTS money_provider;
+DROP TABLE IF EXISTS money_pool;
+DROP TABLE IF EXISTS user_groups;
+DROP TABLE IF EXISTS users;
+DROP TYPE IF EXISTS public_type;
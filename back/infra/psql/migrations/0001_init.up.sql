@@ -1,3 +1,5 @@
+-- init.sqlで管理していたスキーマ。既存の環境にも適用できるよう冪等にしている
+
 -- 公開タイプの列挙型を定義
 DO $$
 BEGIN
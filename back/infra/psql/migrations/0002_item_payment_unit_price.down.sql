@@ -0,0 +1 @@
+ALTER TABLE item_payment DROP COLUMN IF EXISTS unit_price;
@@ -0,0 +1,2 @@
+-- 商品取引テーブルに単価を追加
+ALTER TABLE item_payment ADD COLUMN IF NOT EXISTS unit_price DECIMAL(19,4) NOT NULL DEFAULT 0 CHECK (unit_price >= 0);
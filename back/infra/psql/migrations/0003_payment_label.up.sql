@@ -0,0 +1,8 @@
+-- 取引ラベルテーブル
+CREATE TABLE IF NOT EXISTS payment_label (
+    payment_id BIGINT NOT NULL,
+    label_id BIGINT NOT NULL,
+    PRIMARY KEY (payment_id, label_id),
+    FOREIGN KEY (payment_id) REFERENCES payment(id) ON DELETE CASCADE,
+    FOREIGN KEY (label_id) REFERENCES label(id) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS exchange_rate;
+ALTER TABLE users DROP COLUMN IF EXISTS base_currency;
+ALTER TABLE money_provider DROP COLUMN IF EXISTS currency;
+ALTER TABLE money_pool DROP COLUMN IF EXISTS currency;
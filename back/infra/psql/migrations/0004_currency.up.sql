@@ -0,0 +1,18 @@
+-- マネープール・マネープロバイダーの通貨と、ユーザーの基準通貨
+ALTER TABLE money_pool ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'JPY';
+ALTER TABLE money_provider ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'JPY';
+ALTER TABLE users ADD COLUMN base_currency CHAR(3) NOT NULL DEFAULT 'JPY';
+
+-- 為替レートテーブル
+-- from_currency 1単位が to_currency で rate になる。valid_from 以降、次のレートまで有効
+CREATE TABLE exchange_rate (
+    id BIGSERIAL PRIMARY KEY,
+    creator_id BIGINT NOT NULL,
+    from_currency CHAR(3) NOT NULL,
+    to_currency CHAR(3) NOT NULL,
+    rate DECIMAL(24,10) NOT NULL CHECK (rate > 0),
+    valid_from DATE NOT NULL,
+    UNIQUE (creator_id, from_currency, to_currency, valid_from),
+    CHECK (from_currency <> to_currency),
+    FOREIGN KEY (creator_id) REFERENCES users(id)
+);
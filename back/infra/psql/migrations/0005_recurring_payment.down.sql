@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS payment_recurring_payment_id_idx;
+ALTER TABLE payment DROP COLUMN IF EXISTS recurring_payment_id;
+DROP TABLE IF EXISTS recurring_payment;
@@ -0,0 +1,29 @@
+-- 定期的な支払い（家賃・給料・サブスクリプションなど）のルール
+-- frequency: daily / weekly / monthly / yearly
+-- weekday, nth_week が設定されている場合、monthlyは「第N何曜日」になる（nth_week = -1 は最終週）
+CREATE TABLE IF NOT EXISTS recurring_payment (
+    id BIGSERIAL PRIMARY KEY,
+    money_pool_id BIGINT NOT NULL,
+    creator_id BIGINT NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    amount DECIMAL(19,4) NOT NULL,
+    description TEXT,
+    store_id BIGINT,
+    frequency VARCHAR(16) NOT NULL,
+    interval_count INT NOT NULL DEFAULT 1 CHECK (interval_count >= 1),
+    weekday SMALLINT CHECK (weekday BETWEEN 0 AND 6),
+    nth_week SMALLINT CHECK (nth_week BETWEEN -1 AND 5 AND nth_week <> 0),
+    start_date DATE NOT NULL,
+    end_date DATE,
+    occurrence_count INT CHECK (occurrence_count >= 1),
+    is_paused BOOLEAN NOT NULL DEFAULT FALSE,
+    -- この日までの発生分は支払いとして作成済み
+    generated_until DATE,
+    FOREIGN KEY (money_pool_id) REFERENCES money_pool(id),
+    FOREIGN KEY (creator_id) REFERENCES users(id),
+    FOREIGN KEY (store_id) REFERENCES store(id) ON DELETE SET NULL
+);
+
+-- ルールから作成された支払い。ルールを削除しても実績の支払いは残す
+ALTER TABLE payment ADD COLUMN IF NOT EXISTS recurring_payment_id BIGINT REFERENCES recurring_payment(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS payment_recurring_payment_id_idx ON payment (recurring_payment_id);
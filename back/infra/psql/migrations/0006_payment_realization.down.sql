@@ -0,0 +1,2 @@
+ALTER TABLE payment DROP COLUMN IF EXISTS planned_amount;
+ALTER TABLE payment DROP COLUMN IF EXISTS planned_date;
@@ -0,0 +1,3 @@
+-- 予定の支払いを実績にしたときの、元の予定日と予定金額（予実差異の確認用）
+ALTER TABLE payment ADD COLUMN IF NOT EXISTS planned_date DATE;
+ALTER TABLE payment ADD COLUMN IF NOT EXISTS planned_amount DECIMAL(19,4);
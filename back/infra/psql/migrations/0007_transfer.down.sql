@@ -0,0 +1,5 @@
+-- 振替のレッグは振替と一緒に消す
+DELETE FROM payment WHERE transfer_id IS NOT NULL;
+DROP INDEX IF EXISTS payment_transfer_id_idx;
+ALTER TABLE payment DROP COLUMN IF EXISTS transfer_id;
+DROP TABLE IF EXISTS transfer;
@@ -0,0 +1,14 @@
+-- マネープール間の振替。振替元と振替先の2つの支払い（レッグ）からなる
+CREATE TABLE IF NOT EXISTS transfer (
+    id BIGSERIAL PRIMARY KEY,
+    creator_id BIGINT NOT NULL,
+    date DATE NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    is_planned BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (creator_id) REFERENCES users(id)
+);
+
+-- 振替のレッグ。振替元は負、振替先は正の金額になる
+ALTER TABLE payment ADD COLUMN IF NOT EXISTS transfer_id BIGINT REFERENCES transfer(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS payment_transfer_id_idx ON payment (transfer_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS reconciliation_entry;
+DROP TABLE IF EXISTS reconciliation;
+ALTER TABLE money_pool DROP COLUMN IF EXISTS money_provider_id;
@@ -0,0 +1,24 @@
+-- マネープールのお金を実際に置いているマネープロバイダー（口座・財布など）
+ALTER TABLE money_pool ADD COLUMN IF NOT EXISTS money_provider_id BIGINT REFERENCES money_provider(id) ON DELETE SET NULL;
+
+-- マネープロバイダーの残高と、割り当てられたマネープールの残高の照合履歴
+CREATE TABLE IF NOT EXISTS reconciliation (
+    id BIGSERIAL PRIMARY KEY,
+    creator_id BIGINT NOT NULL,
+    reconciled_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    note TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (creator_id) REFERENCES users(id)
+);
+
+-- 照合時点のマネープロバイダーごとの結果。プロバイダーが削除されても名前と金額は残す
+CREATE TABLE IF NOT EXISTS reconciliation_entry (
+    reconciliation_id BIGINT NOT NULL,
+    money_provider_id BIGINT,
+    money_provider_name VARCHAR(255) NOT NULL,
+    currency CHAR(3) NOT NULL,
+    provider_balance DECIMAL(19,4) NOT NULL,
+    allocated_pool_sum DECIMAL(19,4) NOT NULL,
+    difference DECIMAL(19,4) NOT NULL,
+    FOREIGN KEY (reconciliation_id) REFERENCES reconciliation(id) ON DELETE CASCADE,
+    FOREIGN KEY (money_provider_id) REFERENCES money_provider(id) ON DELETE SET NULL
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS money_provider_balance_snapshot;
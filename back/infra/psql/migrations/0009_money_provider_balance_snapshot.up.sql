@@ -0,0 +1,13 @@
+-- マネープロバイダーの残高の変更履歴
+CREATE TABLE IF NOT EXISTS money_provider_balance_snapshot (
+    id BIGSERIAL PRIMARY KEY,
+    money_provider_id BIGINT NOT NULL,
+    balance DECIMAL(19,4) NOT NULL,
+    recorded_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    FOREIGN KEY (money_provider_id) REFERENCES money_provider(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS money_provider_balance_snapshot_provider_idx ON money_provider_balance_snapshot (money_provider_id, recorded_at);
+
+-- 既存のプロバイダーは現在の残高を最初の記録にする
+INSERT INTO money_provider_balance_snapshot (money_provider_id, balance)
+SELECT id, balance FROM money_provider;
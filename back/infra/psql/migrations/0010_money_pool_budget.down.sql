@@ -0,0 +1,4 @@
+ALTER TABLE money_pool DROP COLUMN IF EXISTS budget_start_date;
+ALTER TABLE money_pool DROP COLUMN IF EXISTS budget_rollover;
+ALTER TABLE money_pool DROP COLUMN IF EXISTS budget_period;
+ALTER TABLE money_pool DROP COLUMN IF EXISTS budget_amount;
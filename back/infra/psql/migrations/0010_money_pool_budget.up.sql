@@ -0,0 +1,7 @@
+-- マネープールの予算。budget_amountがNULLの場合は予算なし
+-- budget_period: weekly / monthly / yearly
+-- budget_rolloverがTRUEの場合、期間内に使い切らなかった分を次の期間に繰り越す（budget_start_dateの期間から計算する）
+ALTER TABLE money_pool ADD COLUMN IF NOT EXISTS budget_amount DECIMAL(19,4) CHECK (budget_amount >= 0);
+ALTER TABLE money_pool ADD COLUMN IF NOT EXISTS budget_period VARCHAR(16);
+ALTER TABLE money_pool ADD COLUMN IF NOT EXISTS budget_rollover BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE money_pool ADD COLUMN IF NOT EXISTS budget_start_date DATE;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS payment_money_pool_id_amount_idx;
+DROP INDEX IF EXISTS payment_money_pool_id_date_idx;
@@ -0,0 +1,3 @@
+-- 支払い一覧の絞り込み・並び替え・ページング用のインデックス
+CREATE INDEX IF NOT EXISTS payment_money_pool_id_date_idx ON payment (money_pool_id, date, id);
+CREATE INDEX IF NOT EXISTS payment_money_pool_id_amount_idx ON payment (money_pool_id, amount, id);
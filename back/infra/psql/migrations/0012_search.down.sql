@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS store_name_trgm_idx;
+DROP INDEX IF EXISTS money_pool_name_trgm_idx;
+DROP INDEX IF EXISTS payment_description_trgm_idx;
+DROP INDEX IF EXISTS payment_title_trgm_idx;
@@ -0,0 +1,7 @@
+-- 検索用のトライグラムインデックス
+-- 日本語は空白で単語に区切られないため、全文検索ではなくpg_trgmで部分一致(ILIKE)を高速化する
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS payment_title_trgm_idx ON payment USING gin (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS payment_description_trgm_idx ON payment USING gin (description gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS money_pool_name_trgm_idx ON money_pool USING gin (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS store_name_trgm_idx ON store USING gin (name gin_trgm_ops);
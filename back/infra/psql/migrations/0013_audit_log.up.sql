@@ -0,0 +1,17 @@
+-- 変更履歴。誰がいつ何をどう変えたかを、変更前後の値と一緒に記録する
+-- action: create / update / delete / restore
+-- entity_type: payment / money_pool / money_provider / user_group / publication_scope / transfer
+-- money_pool_idはマネープールごとの履歴を引くためのもの。マネープールが完全に削除されても履歴は残すため外部キーにしない
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id BIGINT NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    entity_type VARCHAR(32) NOT NULL,
+    entity_id BIGINT NOT NULL,
+    money_pool_id BIGINT,
+    before JSONB,
+    after JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity_type, entity_id, id);
+CREATE INDEX IF NOT EXISTS audit_log_money_pool_id_idx ON audit_log (money_pool_id, id);
@@ -0,0 +1,3 @@
+ALTER TABLE money_provider DROP COLUMN IF EXISTS version;
+ALTER TABLE payment DROP COLUMN IF EXISTS version;
+ALTER TABLE money_pool DROP COLUMN IF EXISTS version;
@@ -0,0 +1,4 @@
+-- 楽観的排他制御のためのバージョン。更新するたびに1つ増やし、If-Matchで指定されたバージョンと異なる場合は更新しない
+ALTER TABLE money_pool ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE payment ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE money_provider ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,16 @@
+-- 個人用アクセストークン。ブラウザでログインできないスクリプトなどからAPIを呼び出すためのもの
+-- トークン自体は作成時に一度だけ返し、SHA-256のハッシュだけを保存する。prefixは一覧で見分けるための先頭の数文字
+-- scopes: read / payments:write / admin
+CREATE TABLE IF NOT EXISTS api_token (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    name VARCHAR(255) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    prefix VARCHAR(16) NOT NULL,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS api_token_user_id_idx ON api_token (user_id);
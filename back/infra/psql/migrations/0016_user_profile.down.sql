@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS users_email_key;
+ALTER TABLE users DROP COLUMN IF EXISTS timezone;
+ALTER TABLE users DROP COLUMN IF EXISTS locale;
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_url;
+ALTER TABLE users DROP COLUMN IF EXISTS display_name;
+ALTER TABLE users DROP COLUMN IF EXISTS handle;
+ALTER TABLE users DROP COLUMN IF EXISTS oidc_zoneinfo;
+ALTER TABLE users DROP COLUMN IF EXISTS oidc_locale;
+ALTER TABLE users DROP COLUMN IF EXISTS oidc_picture;
+ALTER TABLE users DROP COLUMN IF EXISTS oidc_name;
+ALTER TABLE users DROP COLUMN IF EXISTS email;
@@ -0,0 +1,16 @@
+-- ユーザーのプロフィール
+-- email, oidc_* はログインのたびにOIDCのクレームから更新する。emailはemail_verifiedのものだけ保存する
+-- handle, display_name, avatar_url, locale, timezone はユーザーが編集する値で、NULLの場合はOIDCの値を使う
+ALTER TABLE users ADD COLUMN email VARCHAR(255);
+ALTER TABLE users ADD COLUMN oidc_name VARCHAR(255);
+ALTER TABLE users ADD COLUMN oidc_picture TEXT;
+ALTER TABLE users ADD COLUMN oidc_locale VARCHAR(35);
+ALTER TABLE users ADD COLUMN oidc_zoneinfo VARCHAR(64);
+ALTER TABLE users ADD COLUMN handle VARCHAR(32) UNIQUE;
+ALTER TABLE users ADD COLUMN display_name VARCHAR(100);
+ALTER TABLE users ADD COLUMN avatar_url TEXT;
+ALTER TABLE users ADD COLUMN locale VARCHAR(35);
+ALTER TABLE users ADD COLUMN timezone VARCHAR(64);
+
+-- メールアドレスは1人のユーザーだけが持てる。メールアドレスでユーザーを探すときにも使い、大文字と小文字は区別しない
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (lower(email));
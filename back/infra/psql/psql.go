@@ -1,12 +1,9 @@
 package psql
 
 import (
-	"bufio"
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
-	"strings"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
@@ -60,7 +57,8 @@ func dbInit() error {
 	return nil
 }
 
-func NewDB() (*sqlx.DB, error) {
+// Open creates the database and its user if necessary and connects to it without checking the schema.
+func Open() (*sqlx.DB, error) {
 	err := dbInit()
 	if err != nil {
 		log.Printf("DB初期化に失敗しました: %v", err)
@@ -74,65 +72,23 @@ func NewDB() (*sqlx.DB, error) {
 	}
 
 	log.Println("DB接続に成功しました。")
-
-	// SQLファイルからテーブルを作成
-	err = executeSQLFile(db, "/app/infra/psql/init.sql")
-	if err != nil {
-		log.Printf("SQLファイルの実行に失敗しました: %v", err)
-		return nil, err
-	}
-
-	log.Println("SQLファイルが正常に実行されました。")
 	return db, nil
 }
 
-func executeSQLFile(db *sqlx.DB, filepath string) error {
-	file, err := os.Open(filepath)
+// NewDB connects to the database and refuses to continue unless the schema is at the latest migration.
+func NewDB() (*sqlx.DB, error) {
+	db, err := Open()
 	if err != nil {
-		log.Printf("SQLファイルのオープンに失敗しました: %v", err)
-		return fmt.Errorf("failed to open SQL file: %w", err)
-	}
-	defer file.Close()
-	log.Printf("SQLファイル %s をオープンしました。", filepath)
-
-	scanner := bufio.NewScanner(file)
-	var sqlStatement string
-	var inDOBlock bool
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		trimmedLine := strings.TrimSpace(line)
-
-		if strings.HasPrefix(trimmedLine, "--") {
-			continue
-		}
-
-		if strings.HasPrefix(trimmedLine, "DO $$") {
-			inDOBlock = true
-		}
-
-		if inDOBlock && strings.HasPrefix(trimmedLine, "END$$;") {
-			inDOBlock = false
-		}
-
-		sqlStatement += line + "\n"
-
-		if (!inDOBlock && strings.HasSuffix(trimmedLine, ";")) || (inDOBlock && strings.HasPrefix(trimmedLine, "END$$;")) {
-			log.Printf("SQLステートメント %s を実行します", sqlStatement)
-			_, err = db.Exec(sqlStatement)
-			if err != nil {
-				log.Printf("SQLステートメントの実行に失敗しました: %v", err)
-				return fmt.Errorf("failed to exec SQL statement: %w", err)
-			}
-			sqlStatement = ""
-		}
+		return nil, err
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("SQLファイルの読み込み中にエラーが発生しました: %v", err)
-		return fmt.Errorf("error while reading SQL file: %w", err)
+	err = CheckSchemaVersion(db)
+	if err != nil {
+		db.Close()
+		log.Printf("スキーマのバージョンが一致しません: %v", err)
+		return nil, fmt.Errorf("schema version mismatch: %w", err)
 	}
 
-	log.Println("SQLファイルが正常に実行されました。")
-	return nil
+	log.Println("スキーマのバージョンを確認しました。")
+	return db, nil
 }
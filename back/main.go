@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/walnuts1018/openchokin/back/config"
 	"github.com/walnuts1018/openchokin/back/domain"
@@ -15,6 +20,25 @@ import (
 func main() {
 	config.LoadConfig()
 
+	// ./server migrate up|down [N]|status
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(args[1:]); err != nil {
+			slog.Error("failed to migrate", "message", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// ./server backup USER_ID [FILE]
+	// ./server restore USER_ID FILE [empty|merge]
+	if args := flag.Args(); len(args) > 0 && (args[0] == "backup" || args[0] == "restore") {
+		if err := runBackup(args); err != nil {
+			slog.Error("failed to "+args[0], "message", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	db, err := psql.NewDB()
 	if err != nil {
 		slog.Error("failed to create db", "message", err)
@@ -24,6 +48,11 @@ func main() {
 
 	u := usecase.NewUsecase(domain.NewDB(db))
 
+	// 定期支払いの予定を先の日付まで作成し続ける
+	go u.RunRecurringPaymentGenerator(context.Background(), time.Hour)
+	// 保存期間を過ぎたゴミ箱のマネープールを完全に削除する
+	go u.RunTrashPurger(context.Background(), time.Hour, config.Config.TrashRetentionDays)
+
 	h, err := handler.NewHandler(u)
 	if err != nil {
 		slog.Error("failed to create handler", "message", err)
@@ -36,3 +65,97 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [N]|status")
+	}
+
+	db, err := psql.Open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		return psql.MigrateUp(db)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+		return psql.MigrateDown(db, steps)
+	case "status":
+		statuses, err := psql.GetMigrationStatus(db)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %s, usage: migrate up|down [N]|status", args[0])
+	}
+}
+
+func runBackup(args []string) error {
+	usage := fmt.Errorf("usage: backup USER_ID [FILE] | restore USER_ID FILE [empty|merge]")
+	if len(args) < 2 || (args[0] == "restore" && len(args) < 3) {
+		return usage
+	}
+
+	db, err := psql.NewDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	u := usecase.NewUsecase(domain.NewDB(db))
+
+	userID := args[1]
+	if args[0] == "backup" {
+		backup, err := u.GetBackup(userID)
+		if err != nil {
+			return err
+		}
+		out := os.Stdout
+		if len(args) > 2 {
+			out, err = os.Create(args[2])
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(backup)
+	}
+
+	f, err := os.Open(args[2])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var backup domain.Backup
+	if err := json.NewDecoder(f).Decode(&backup); err != nil {
+		return fmt.Errorf("failed to read backup %s: %v", args[2], err)
+	}
+	mode := usecase.RestoreModeEmpty
+	if len(args) > 3 {
+		mode = args[3]
+	}
+	result, err := u.RestoreBackup(userID, backup, mode)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restored %d money pools and %d payments to user %s\n", result.MoneyPools, result.Payments, userID)
+	return nil
+}
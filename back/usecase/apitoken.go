@@ -0,0 +1,167 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+	"github.com/walnuts1018/openchokin/back/timeJST"
+)
+
+// APITokenPrefix は個人用アクセストークンの先頭につく文字列。Authorizationヘッダーのトークンが、OIDCのトークンか個人用アクセストークンかを見分けるのに使う
+const APITokenPrefix = "ocpat_"
+
+// ErrInvalidAPIToken は作成しようとしたトークンの名前・スコープ・期限が不正な場合に返されます。
+var ErrInvalidAPIToken = fmt.Errorf("%w: invalid api token", ErrValidation)
+
+type APITokenResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Prefix はトークンの先頭の数文字。どのトークンかを見分けるためのもの
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type CreatedAPITokenResponse struct {
+	APITokenResponse
+	// Token は作成したときにだけ返す。あとから取得することはできない
+	Token string `json:"token"`
+}
+
+func toAPITokenResponse(token domain.APIToken) APITokenResponse {
+	return APITokenResponse{
+		ID:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     token.Scopes,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		RevokedAt:  token.RevokedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
+
+// hashAPIToken returns the hash under which a token is stored.
+// The tokens are random enough that a plain SHA-256 cannot be reversed, and it lets a token be looked up by its hash.
+func hashAPIToken(rawToken string) string {
+	sum := sha256.Sum256([]byte(rawToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken creates a personal access token of the user with the given scopes.
+// If expiresAt is nil the token never expires. The token itself is returned only here.
+func (u *Usecase) CreateAPIToken(userID string, name string, scopes []string, expiresAt *time.Time) (CreatedAPITokenResponse, error) {
+	log.Printf("ユーザーID %s の個人用アクセストークン %s の作成を開始します。", userID, name)
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 255 {
+		return CreatedAPITokenResponse{}, fmt.Errorf("%w: name must be between 1 and 255 characters", ErrInvalidAPIToken)
+	}
+	if len(scopes) == 0 {
+		return CreatedAPITokenResponse{}, fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIToken)
+	}
+	validScopes := []string{domain.APITokenScopeRead, domain.APITokenScopePaymentsWrite, domain.APITokenScopeAdmin}
+	tokenScopes := []string{}
+	for _, scope := range scopes {
+		if !slices.Contains(validScopes, scope) {
+			return CreatedAPITokenResponse{}, fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIToken, scope)
+		}
+		if !slices.Contains(tokenScopes, scope) {
+			tokenScopes = append(tokenScopes, scope)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(timeJST.Now()) {
+		return CreatedAPITokenResponse{}, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidAPIToken)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Printf("トークンの生成に失敗しました。エラー: %v", err)
+		return CreatedAPITokenResponse{}, err
+	}
+	rawToken := APITokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	token, err := u.db.NewAPIToken(domain.APIToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hashAPIToken(rawToken),
+		Prefix:    rawToken[:len(APITokenPrefix)+6],
+		Scopes:    tokenScopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		log.Printf("個人用アクセストークンの保存に失敗しました。ユーザーID: %s, エラー: %v", userID, err)
+		return CreatedAPITokenResponse{}, err
+	}
+
+	log.Printf("個人用アクセストークンを作成しました。ID: %s, スコープ: %v", token.ID, token.Scopes)
+	return CreatedAPITokenResponse{APITokenResponse: toAPITokenResponse(token), Token: rawToken}, nil
+}
+
+// GetAPITokens returns the personal access tokens of the user, newest first, including revoked and expired ones.
+func (u *Usecase) GetAPITokens(userID string) ([]APITokenResponse, error) {
+	tokens, err := u.db.GetAPITokensByUserID(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s の個人用アクセストークンの取得に失敗しました。エラー: %v", userID, err)
+		return nil, err
+	}
+	response := make([]APITokenResponse, 0, len(tokens))
+	for _, token := range tokens {
+		response = append(response, toAPITokenResponse(token))
+	}
+	return response, nil
+}
+
+// RevokeAPIToken revokes a personal access token of the user. Revoked tokens stay in the list.
+func (u *Usecase) RevokeAPIToken(userID string, tokenID string) error {
+	log.Printf("ユーザーID %s が個人用アクセストークンID %s を失効させます。", userID, tokenID)
+	if err := u.db.RevokeAPIToken(tokenID, userID, timeJST.Now()); err != nil {
+		log.Printf("個人用アクセストークンID %s の失効に失敗しました。エラー: %v", tokenID, err)
+		return err
+	}
+	return nil
+}
+
+// apiTokenTouchInterval は最終利用日時を記録する間隔。リクエストのたびに書き込まないようにする
+const apiTokenTouchInterval = time.Minute
+
+// AuthenticateAPIToken returns the personal access token for rawToken if it is neither revoked nor expired.
+func (u *Usecase) AuthenticateAPIToken(rawToken string) (domain.APIToken, error) {
+	token, err := u.db.GetAPITokenByHash(hashAPIToken(rawToken))
+	if errors.Is(err, ErrNotFound) {
+		log.Printf("個人用アクセストークンが見つかりません。")
+		return domain.APIToken{}, fmt.Errorf("%w: unknown api token", ErrUnauthenticated)
+	}
+	if err != nil {
+		log.Printf("個人用アクセストークンの取得に失敗しました。エラー: %v", err)
+		return domain.APIToken{}, err
+	}
+
+	now := timeJST.Now()
+	if token.RevokedAt != nil {
+		return domain.APIToken{}, fmt.Errorf("%w: api token %s has been revoked", ErrUnauthenticated, token.Prefix)
+	}
+	if token.ExpiresAt != nil && !token.ExpiresAt.After(now) {
+		return domain.APIToken{}, fmt.Errorf("%w: api token %s has expired", ErrUnauthenticated, token.Prefix)
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > apiTokenTouchInterval {
+		if err := u.db.TouchAPIToken(token.ID, now); err != nil {
+			// 最終利用日時の記録に失敗しても認証はできたものとする
+			log.Printf("個人用アクセストークンID %s の最終利用日時の更新に失敗しました。エラー: %v", token.ID, err)
+		}
+	}
+	return token, nil
+}
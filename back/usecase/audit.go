@@ -0,0 +1,466 @@
+package usecase
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+)
+
+// ErrInvalidAuditQuery は変更履歴の取得条件が不正な場合に返されます。
+var ErrInvalidAuditQuery = fmt.Errorf("%w: invalid audit query", ErrValidation)
+
+const (
+	DefaultAuditLogLimit = 100
+	MaxAuditLogLimit     = 500
+)
+
+// 変更履歴に記録する値。domainの構造体をそのまま使わず、JSONの形をここで固定する
+
+type paymentAuditSnapshot struct {
+	ID                 string        `json:"id"`
+	MoneyPoolID        string        `json:"money_pool_id"`
+	Date               string        `json:"date"`
+	Title              string        `json:"title"`
+	Amount             domain.Money  `json:"amount"`
+	Description        string        `json:"description"`
+	IsPlanned          bool          `json:"is_planned"`
+	StoreID            *string       `json:"store_id"`
+	LabelIDs           []string      `json:"label_ids,omitempty"`
+	PlannedDate        *string       `json:"planned_date"`
+	PlannedAmount      *domain.Money `json:"planned_amount"`
+	RecurringPaymentID *string       `json:"recurring_payment_id"`
+	TransferID         *string       `json:"transfer_id"`
+}
+
+func paymentSnapshot(payment domain.Payment) paymentAuditSnapshot {
+	snapshot := paymentAuditSnapshot{
+		ID:                 payment.ID,
+		MoneyPoolID:        payment.MoneyPoolID,
+		Date:               payment.Date.Format("2006-01-02"),
+		Title:              payment.Title,
+		Amount:             payment.Amount,
+		Description:        payment.Description,
+		IsPlanned:          payment.IsPlanned,
+		StoreID:            payment.StoreID,
+		LabelIDs:           payment.LabelIDs,
+		PlannedAmount:      payment.PlannedAmount,
+		RecurringPaymentID: payment.RecurringPaymentID,
+		TransferID:         payment.TransferID,
+	}
+	if payment.PlannedDate != nil {
+		plannedDate := payment.PlannedDate.Format("2006-01-02")
+		snapshot.PlannedDate = &plannedDate
+	}
+	return snapshot
+}
+
+type moneyPoolAuditSnapshot struct {
+	ID              string        `json:"id"`
+	Name            string        `json:"name"`
+	Description     string        `json:"description"`
+	Type            string        `json:"type"`
+	Emoji           string        `json:"emoji"`
+	Currency        string        `json:"currency"`
+	IsDeleted       bool          `json:"is_deleted"`
+	MoneyProviderID *string       `json:"money_provider_id"`
+	BudgetAmount    *domain.Money `json:"budget_amount"`
+	BudgetPeriod    *string       `json:"budget_period"`
+	BudgetRollover  bool          `json:"budget_rollover"`
+}
+
+func moneyPoolSnapshot(pool domain.MoneyPool) moneyPoolAuditSnapshot {
+	return moneyPoolAuditSnapshot{
+		ID:              pool.ID,
+		Name:            pool.Name,
+		Description:     pool.Description,
+		Type:            pool.Type,
+		Emoji:           pool.Emoji,
+		Currency:        pool.Currency,
+		IsDeleted:       pool.IsDeleted,
+		MoneyProviderID: pool.MoneyProviderID,
+		BudgetAmount:    pool.BudgetAmount,
+		BudgetPeriod:    pool.BudgetPeriod,
+		BudgetRollover:  pool.BudgetRollover,
+	}
+}
+
+type moneyProviderAuditSnapshot struct {
+	ID       string       `json:"id"`
+	Name     string       `json:"name"`
+	Balance  domain.Money `json:"balance"`
+	Currency string       `json:"currency"`
+}
+
+func moneyProviderSnapshot(provider domain.MoneyProvider) moneyProviderAuditSnapshot {
+	return moneyProviderAuditSnapshot{
+		ID:       provider.ID,
+		Name:     provider.Name,
+		Balance:  provider.Balance,
+		Currency: provider.Currency,
+	}
+}
+
+type userGroupAuditSnapshot struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	MemberIDs []string `json:"member_ids"`
+}
+
+// userGroupSnapshot reads the current members of a user group for its audit log.
+func (u *Usecase) userGroupSnapshot(group domain.UserGroup) (userGroupAuditSnapshot, error) {
+	members, err := u.db.GetUserGroupMembers(group.ID)
+	if err != nil {
+		log.Printf("ユーザーグループID %s のメンバー取得中にエラー: %v", group.ID, err)
+		return userGroupAuditSnapshot{}, err
+	}
+	snapshot := userGroupAuditSnapshot{ID: group.ID, Name: group.Name, MemberIDs: make([]string, 0, len(members))}
+	for _, member := range members {
+		snapshot.MemberIDs = append(snapshot.MemberIDs, member.ID)
+	}
+	return snapshot, nil
+}
+
+type publicationScopeAuditSnapshot struct {
+	MoneyPoolID string   `json:"money_pool_id"`
+	GroupIDs    []string `json:"group_ids"`
+}
+
+type transferAuditSnapshot struct {
+	ID              string       `json:"id"`
+	Date            string       `json:"date"`
+	Title           string       `json:"title"`
+	Description     string       `json:"description"`
+	IsPlanned       bool         `json:"is_planned"`
+	FromMoneyPoolID string       `json:"from_money_pool_id"`
+	FromPaymentID   string       `json:"from_payment_id"`
+	FromAmount      domain.Money `json:"from_amount"`
+	ToMoneyPoolID   string       `json:"to_money_pool_id"`
+	ToPaymentID     string       `json:"to_payment_id"`
+	ToAmount        domain.Money `json:"to_amount"`
+}
+
+func transferSnapshot(transfer domain.Transfer) transferAuditSnapshot {
+	return transferAuditSnapshot{
+		ID:              transfer.ID,
+		Date:            transfer.Date.Format("2006-01-02"),
+		Title:           transfer.Title,
+		Description:     transfer.Description,
+		IsPlanned:       transfer.IsPlanned,
+		FromMoneyPoolID: transfer.FromMoneyPoolID,
+		FromPaymentID:   transfer.FromPaymentID,
+		FromAmount:      transfer.FromAmount,
+		ToMoneyPoolID:   transfer.ToMoneyPoolID,
+		ToPaymentID:     transfer.ToPaymentID,
+		ToAmount:        transfer.ToAmount,
+	}
+}
+
+type recurringPaymentAuditSnapshot struct {
+	ID          string       `json:"id"`
+	MoneyPoolID string       `json:"money_pool_id"`
+	Title       string       `json:"title"`
+	Amount      domain.Money `json:"amount"`
+	Description string       `json:"description"`
+	StoreID     *string      `json:"store_id"`
+	Frequency   string       `json:"frequency"`
+	Interval    int          `json:"interval"`
+	Weekday     *int         `json:"weekday"`
+	NthWeek     *int         `json:"nth_week"`
+	StartDate   string       `json:"start_date"`
+	EndDate     *string      `json:"end_date"`
+	Count       *int         `json:"count"`
+	IsPaused    bool         `json:"is_paused"`
+}
+
+func recurringPaymentSnapshot(rule domain.RecurringPayment) recurringPaymentAuditSnapshot {
+	snapshot := recurringPaymentAuditSnapshot{
+		ID:          rule.ID,
+		MoneyPoolID: rule.MoneyPoolID,
+		Title:       rule.Title,
+		Amount:      rule.Amount,
+		Description: rule.Description,
+		StoreID:     rule.StoreID,
+		Frequency:   rule.Frequency,
+		Interval:    rule.IntervalCount,
+		Weekday:     rule.Weekday,
+		NthWeek:     rule.NthWeek,
+		StartDate:   rule.StartDate.Format("2006-01-02"),
+		Count:       rule.OccurrenceCount,
+		IsPaused:    rule.IsPaused,
+	}
+	if rule.EndDate.Valid {
+		endDate := rule.EndDate.Time.Format("2006-01-02")
+		snapshot.EndDate = &endDate
+	}
+	return snapshot
+}
+
+// newAuditLog builds an audit log of a change. before is nil for a creation and after is nil for a deletion.
+func newAuditLog(actorID string, action string, entityType string, entityID string, moneyPoolID *string, before any, after any) (domain.AuditLog, error) {
+	auditLog := domain.AuditLog{
+		ActorID:     actorID,
+		Action:      action,
+		EntityType:  entityType,
+		EntityID:    entityID,
+		MoneyPoolID: moneyPoolID,
+	}
+	for _, v := range []struct {
+		value any
+		dst   **string
+	}{{before, &auditLog.Before}, {after, &auditLog.After}} {
+		if v.value == nil {
+			continue
+		}
+		data, err := json.Marshal(v.value)
+		if err != nil {
+			return domain.AuditLog{}, fmt.Errorf("failed to marshal audit log of %s %s: %v", entityType, entityID, err)
+		}
+		s := string(data)
+		*v.dst = &s
+	}
+	return auditLog, nil
+}
+
+// recurringPaymentAudit returns the builder of the audit logs of a change of a recurring payment rule,
+// which the domain calls so that the audit logs are written in the same transaction as the change.
+// action is the change of the rule itself, or empty if the change only generates planned payments.
+// before is the rule before the change, or nil for a creation.
+// If actorID is empty, the creator of the rule is recorded, e.g. for payments generated in the background.
+func recurringPaymentAudit(actorID string, action string, before *domain.RecurringPayment) domain.RecurringPaymentAudit {
+	return func(rule *domain.RecurringPayment, created []domain.Payment, deleted []domain.Payment) ([]domain.AuditLog, error) {
+		actor := actorID
+		var ruleID string
+		var beforeValue, afterValue any
+		var poolIDs []string
+		if before != nil {
+			if actor == "" {
+				actor = before.CreatorID
+			}
+			ruleID = before.ID
+			beforeValue = recurringPaymentSnapshot(*before)
+			poolIDs = append(poolIDs, before.MoneyPoolID)
+		}
+		if rule != nil {
+			if actor == "" {
+				actor = rule.CreatorID
+			}
+			ruleID = rule.ID
+			afterValue = recurringPaymentSnapshot(*rule)
+			poolIDs = append(poolIDs, rule.MoneyPoolID)
+		}
+
+		var auditLogs []domain.AuditLog
+		add := func(action string, entityType string, entityID string, moneyPoolID string, before any, after any) error {
+			auditLog, err := newAuditLog(actor, action, entityType, entityID, &moneyPoolID, before, after)
+			if err != nil {
+				return err
+			}
+			auditLogs = append(auditLogs, auditLog)
+			return nil
+		}
+
+		if action != "" {
+			// 別のマネープールに移した場合は、両方のマネープールの履歴に残す
+			seen := make(map[string]bool, len(poolIDs))
+			for _, poolID := range poolIDs {
+				if seen[poolID] {
+					continue
+				}
+				seen[poolID] = true
+				if err := add(action, domain.AuditEntityRecurringPayment, ruleID, poolID, beforeValue, afterValue); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for _, payment := range deleted {
+			if err := add(domain.AuditActionDelete, domain.AuditEntityPayment, payment.ID, payment.MoneyPoolID, paymentSnapshot(payment), nil); err != nil {
+				return nil, err
+			}
+		}
+		for _, payment := range created {
+			if err := add(domain.AuditActionCreate, domain.AuditEntityPayment, payment.ID, payment.MoneyPoolID, nil, paymentSnapshot(payment)); err != nil {
+				return nil, err
+			}
+		}
+		return auditLogs, nil
+	}
+}
+
+// auditChange returns the builder of the audit log of a change whose values are known before it is written,
+// which the domain calls in the transaction of the change. before is nil for a creation and after is nil for a deletion.
+func auditChange[T any](actorID string, action string, entityType string, entityID string, moneyPoolID *string, before any, after any) domain.Audit[T] {
+	return func(T) ([]domain.AuditLog, error) {
+		auditLog, err := newAuditLog(actorID, action, entityType, entityID, moneyPoolID, before, after)
+		if err != nil {
+			return nil, err
+		}
+		return []domain.AuditLog{auditLog}, nil
+	}
+}
+
+// auditCreate returns the builder of the audit log of a creation. snapshot returns the ID, the money pool and the value
+// of the created entity, which are known only after it has been inserted.
+func auditCreate[T any](actorID string, entityType string, snapshot func(created T) (entityID string, moneyPoolID *string, after any)) domain.Audit[T] {
+	return func(created T) ([]domain.AuditLog, error) {
+		entityID, moneyPoolID, after := snapshot(created)
+		return auditChange[T](actorID, domain.AuditActionCreate, entityType, entityID, moneyPoolID, nil, after)(created)
+	}
+}
+
+// transferAuditLogs builds the audit logs of a change of a transfer, one in the history of every money pool it touches.
+func transferAuditLogs(actorID string, action string, before *domain.Transfer, after *domain.Transfer) ([]domain.AuditLog, error) {
+	var beforeValue, afterValue any
+	var transferID string
+	var poolIDs []string
+	if before != nil {
+		beforeValue = transferSnapshot(*before)
+		transferID = before.ID
+		poolIDs = append(poolIDs, before.FromMoneyPoolID, before.ToMoneyPoolID)
+	}
+	if after != nil {
+		afterValue = transferSnapshot(*after)
+		transferID = after.ID
+		poolIDs = append(poolIDs, after.FromMoneyPoolID, after.ToMoneyPoolID)
+	}
+	var auditLogs []domain.AuditLog
+	seen := make(map[string]bool, len(poolIDs))
+	for _, poolID := range poolIDs {
+		if seen[poolID] {
+			continue
+		}
+		seen[poolID] = true
+		poolID := poolID
+		auditLog, err := newAuditLog(actorID, action, domain.AuditEntityTransfer, transferID, &poolID, beforeValue, afterValue)
+		if err != nil {
+			return nil, err
+		}
+		auditLogs = append(auditLogs, auditLog)
+	}
+	return auditLogs, nil
+}
+
+type AuditLogResponse struct {
+	ID          string          `json:"id"`
+	ActorID     string          `json:"actor_id"`
+	Actor       UserSummary     `json:"actor"`
+	Action      string          `json:"action"`
+	EntityType  string          `json:"entity_type"`
+	EntityID    string          `json:"entity_id"`
+	MoneyPoolID *string         `json:"money_pool_id"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+type AuditLogsResponse struct {
+	Logs []AuditLogResponse `json:"logs"`
+	// NextBefore をbeforeに渡すと、続きの古い履歴を取得できる。続きがない場合はnil
+	NextBefore *string `json:"next_before"`
+}
+
+// getOwnMoneyPoolForAudit retrieves a money pool of the user, including one in the trash.
+func (u *Usecase) getOwnMoneyPoolForAudit(userID string, moneyPoolID string) error {
+	moneyPool, err := u.db.GetMoneyPool(moneyPoolID)
+	if err != nil {
+		moneyPool, err = u.db.GetDeletedMoneyPool(moneyPoolID)
+		if err != nil {
+			log.Printf("マネープールID: %sの取得に失敗しました。エラー: %v", moneyPoolID, err)
+			return err
+		}
+	}
+	if moneyPool.OwnerID != userID {
+		log.Printf("ユーザーID: %sはマネープールID: %sの所有者ではありません。", userID, moneyPoolID)
+		return fmt.Errorf("%w: user %s is not the owner of the MoneyPool %s", ErrForbidden, userID, moneyPoolID)
+	}
+	return nil
+}
+
+func (u *Usecase) getAuditLogs(filter domain.AuditLogFilter, before string, limit int) (AuditLogsResponse, error) {
+	if limit == 0 {
+		limit = DefaultAuditLogLimit
+	}
+	if limit < 0 || limit > MaxAuditLogLimit {
+		return AuditLogsResponse{}, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidAuditQuery, MaxAuditLogLimit)
+	}
+	if before != "" {
+		if _, err := strconv.ParseInt(before, 10, 64); err != nil {
+			return AuditLogsResponse{}, fmt.Errorf("%w: before must be an audit log id", ErrInvalidAuditQuery)
+		}
+		filter.BeforeID = &before
+	}
+	// 1件多く取得して、続きがあるかを調べる
+	filter.Limit = limit + 1
+
+	auditLogs, err := u.db.GetAuditLogs(filter)
+	if err != nil {
+		log.Printf("変更履歴の取得に失敗しました。エラー: %v", err)
+		return AuditLogsResponse{}, err
+	}
+
+	response := AuditLogsResponse{Logs: make([]AuditLogResponse, 0, len(auditLogs))}
+	if len(auditLogs) > limit {
+		auditLogs = auditLogs[:limit]
+		nextBefore := auditLogs[limit-1].ID
+		response.NextBefore = &nextBefore
+	}
+	actorIDs := make([]string, 0, len(auditLogs))
+	for _, auditLog := range auditLogs {
+		actorIDs = append(actorIDs, auditLog.ActorID)
+	}
+	actors, err := u.userSummaries(actorIDs)
+	if err != nil {
+		return AuditLogsResponse{}, err
+	}
+	for _, auditLog := range auditLogs {
+		entry := AuditLogResponse{
+			ID:          auditLog.ID,
+			ActorID:     auditLog.ActorID,
+			Actor:       actors[auditLog.ActorID],
+			Action:      auditLog.Action,
+			EntityType:  auditLog.EntityType,
+			EntityID:    auditLog.EntityID,
+			MoneyPoolID: auditLog.MoneyPoolID,
+			CreatedAt:   auditLog.CreatedAt,
+		}
+		if auditLog.Before != nil {
+			entry.Before = json.RawMessage(*auditLog.Before)
+		}
+		if auditLog.After != nil {
+			entry.After = json.RawMessage(*auditLog.After)
+		}
+		response.Logs = append(response.Logs, entry)
+	}
+	return response, nil
+}
+
+// GetMoneyPoolAuditLogs returns the changes of a money pool of the user and of everything in it, newest first.
+// The history of a pool in the trash can be seen too. Only the owner may see it.
+func (u *Usecase) GetMoneyPoolAuditLogs(userID string, moneyPoolID string, before string, limit int) (AuditLogsResponse, error) {
+	log.Printf("マネープールID: %sの変更履歴を取得します。ユーザーID: %s", moneyPoolID, userID)
+	if err := u.getOwnMoneyPoolForAudit(userID, moneyPoolID); err != nil {
+		return AuditLogsResponse{}, err
+	}
+	return u.getAuditLogs(domain.AuditLogFilter{MoneyPoolID: &moneyPoolID}, before, limit)
+}
+
+// GetPaymentAuditLogs returns the changes of a payment in a money pool of the user, newest first.
+// The history of a deleted payment can be seen too. Only the owner of the pool may see it.
+func (u *Usecase) GetPaymentAuditLogs(userID string, moneyPoolID string, paymentID string, before string, limit int) (AuditLogsResponse, error) {
+	log.Printf("支払いID: %sの変更履歴を取得します。ユーザーID: %s", paymentID, userID)
+	if _, err := strconv.ParseInt(paymentID, 10, 64); err != nil {
+		return AuditLogsResponse{}, fmt.Errorf("%w: invalid payment id %q", ErrInvalidAuditQuery, paymentID)
+	}
+	if err := u.getOwnMoneyPoolForAudit(userID, moneyPoolID); err != nil {
+		return AuditLogsResponse{}, err
+	}
+	filter := domain.AuditLogFilter{
+		MoneyPoolID: &moneyPoolID,
+		EntityType:  domain.AuditEntityPayment,
+		EntityID:    paymentID,
+	}
+	return u.getAuditLogs(filter, before, limit)
+}
@@ -0,0 +1,215 @@
+package usecase
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+)
+
+var (
+	// ErrInvalidBackup はバックアップの形式が不正な場合や、含まれていないデータを参照している場合に返されます。
+	ErrInvalidBackup = fmt.Errorf("%w: invalid backup", ErrValidation)
+	// ErrBackupTargetNotEmpty は空のアカウントへの復元で、復元先にすでにデータがある場合に返されます。
+	ErrBackupTargetNotEmpty = fmt.Errorf("%w: backup target is not empty", ErrConflict)
+)
+
+// 復元の方法。emptyはデータのないアカウントにだけ復元でき、基準通貨も復元する。mergeは既存のデータに追加する
+const (
+	RestoreModeEmpty = "empty"
+	RestoreModeMerge = "merge"
+)
+
+type RestoreBackupResponse struct {
+	Mode              string `json:"mode"`
+	Stores            int    `json:"stores"`
+	Items             int    `json:"items"`
+	Labels            int    `json:"labels"`
+	MoneyProviders    int    `json:"money_providers"`
+	UserGroups        int    `json:"user_groups"`
+	MoneyPools        int    `json:"money_pools"`
+	RecurringPayments int    `json:"recurring_payments"`
+	Transfers         int    `json:"transfers"`
+	Payments          int    `json:"payments"`
+	ExchangeRates     int    `json:"exchange_rates"`
+}
+
+// GetBackup returns everything the user owns as a single archive, including deleted money pools.
+// Reconciliations and the balance history of money providers are not included.
+func (u *Usecase) GetBackup(userID string) (domain.Backup, error) {
+	log.Printf("バックアップを作成します。ユーザーID: %s", userID)
+	backup, err := u.db.GetBackup(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s のバックアップの作成に失敗しました。エラー: %v", userID, err)
+		return domain.Backup{}, err
+	}
+	log.Printf("バックアップを作成しました。マネープール: %d件, 支払い: %d件", len(backup.MoneyPools), len(backup.Payments))
+	return backup, nil
+}
+
+// RestoreBackup re-creates the data of the backup under userID, which may differ from the user the backup was made of.
+// All rows get new IDs, and the references between them are remapped.
+// With RestoreModeEmpty the user must not own any data yet; with RestoreModeMerge the backup is added to the existing data.
+func (u *Usecase) RestoreBackup(userID string, backup domain.Backup, mode string) (RestoreBackupResponse, error) {
+	log.Printf("バックアップを復元します。ユーザーID: %s, バックアップ元のユーザーID: %s, モード: %s", userID, backup.UserID, mode)
+	if mode == "" {
+		mode = RestoreModeEmpty
+	}
+	if mode != RestoreModeEmpty && mode != RestoreModeMerge {
+		return RestoreBackupResponse{}, fmt.Errorf("%w: unknown restore mode %q", ErrInvalidBackup, mode)
+	}
+	if err := validateBackup(backup); err != nil {
+		return RestoreBackupResponse{}, err
+	}
+
+	if mode == RestoreModeEmpty {
+		hasData, err := u.db.HasUserData(userID)
+		if err != nil {
+			log.Printf("ユーザーID %s のデータの確認に失敗しました。エラー: %v", userID, err)
+			return RestoreBackupResponse{}, err
+		}
+		if hasData {
+			return RestoreBackupResponse{}, fmt.Errorf("%w: user %s already has data, use merge mode", ErrBackupTargetNotEmpty, userID)
+		}
+	}
+
+	err := u.db.RestoreBackup(userID, backup, mode == RestoreModeMerge)
+	if err != nil {
+		log.Printf("ユーザーID %s へのバックアップの復元に失敗しました。エラー: %v", userID, err)
+		return RestoreBackupResponse{}, err
+	}
+
+	log.Printf("バックアップを復元しました。マネープール: %d件, 支払い: %d件", len(backup.MoneyPools), len(backup.Payments))
+	return RestoreBackupResponse{
+		Mode:              mode,
+		Stores:            len(backup.Stores),
+		Items:             len(backup.Items),
+		Labels:            len(backup.Labels),
+		MoneyProviders:    len(backup.MoneyProviders),
+		UserGroups:        len(backup.UserGroups),
+		MoneyPools:        len(backup.MoneyPools),
+		RecurringPayments: len(backup.RecurringPayments),
+		Transfers:         len(backup.Transfers),
+		Payments:          len(backup.Payments),
+		ExchangeRates:     len(backup.ExchangeRates),
+	}, nil
+}
+
+// validateBackup checks the version of the backup and that every reference points to a row in the backup,
+// so that a broken archive is rejected before anything is written.
+func validateBackup(backup domain.Backup) error {
+	if backup.Version != domain.BackupVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidBackup, backup.Version)
+	}
+
+	ids := func(kind string, n int, id func(i int) string) (map[string]bool, error) {
+		set := make(map[string]bool, n)
+		for i := 0; i < n; i++ {
+			if id(i) == "" || set[id(i)] {
+				return nil, fmt.Errorf("%w: missing or duplicate %s id %q", ErrInvalidBackup, kind, id(i))
+			}
+			set[id(i)] = true
+		}
+		return set, nil
+	}
+	stores, err := ids("store", len(backup.Stores), func(i int) string { return backup.Stores[i].ID })
+	if err != nil {
+		return err
+	}
+	items, err := ids("item", len(backup.Items), func(i int) string { return backup.Items[i].ID })
+	if err != nil {
+		return err
+	}
+	labels, err := ids("label", len(backup.Labels), func(i int) string { return backup.Labels[i].ID })
+	if err != nil {
+		return err
+	}
+	providers, err := ids("money provider", len(backup.MoneyProviders), func(i int) string { return backup.MoneyProviders[i].ID })
+	if err != nil {
+		return err
+	}
+	groups, err := ids("user group", len(backup.UserGroups), func(i int) string { return backup.UserGroups[i].ID })
+	if err != nil {
+		return err
+	}
+	pools, err := ids("money pool", len(backup.MoneyPools), func(i int) string { return backup.MoneyPools[i].ID })
+	if err != nil {
+		return err
+	}
+	rules, err := ids("recurring payment", len(backup.RecurringPayments), func(i int) string { return backup.RecurringPayments[i].ID })
+	if err != nil {
+		return err
+	}
+	transfers, err := ids("transfer", len(backup.Transfers), func(i int) string { return backup.Transfers[i].ID })
+	if err != nil {
+		return err
+	}
+	payments, err := ids("payment", len(backup.Payments), func(i int) string { return backup.Payments[i].ID })
+	if err != nil {
+		return err
+	}
+
+	check := func(set map[string]bool, kind string, id *string) error {
+		if id != nil && !set[*id] {
+			return fmt.Errorf("%w: reference to unknown %s %q", ErrInvalidBackup, kind, *id)
+		}
+		return nil
+	}
+	for _, member := range backup.UserGroupMembers {
+		if err := check(groups, "user group", &member.GroupID); err != nil {
+			return err
+		}
+	}
+	for _, pool := range backup.MoneyPools {
+		if err := check(providers, "money provider", pool.MoneyProviderID); err != nil {
+			return err
+		}
+	}
+	for _, scope := range backup.PublicationScopes {
+		if err := check(pools, "money pool", &scope.MoneyPoolID); err != nil {
+			return err
+		}
+		if err := check(groups, "user group", &scope.GroupID); err != nil {
+			return err
+		}
+	}
+	for _, rule := range backup.RecurringPayments {
+		if err := check(pools, "money pool", &rule.MoneyPoolID); err != nil {
+			return err
+		}
+		if err := check(stores, "store", rule.StoreID); err != nil {
+			return err
+		}
+	}
+	for _, payment := range backup.Payments {
+		if err := check(pools, "money pool", &payment.MoneyPoolID); err != nil {
+			return err
+		}
+		if err := check(stores, "store", payment.StoreID); err != nil {
+			return err
+		}
+		if err := check(rules, "recurring payment", payment.RecurringPaymentID); err != nil {
+			return err
+		}
+		if err := check(transfers, "transfer", payment.TransferID); err != nil {
+			return err
+		}
+	}
+	for _, item := range backup.PaymentItems {
+		if err := check(payments, "payment", &item.PaymentID); err != nil {
+			return err
+		}
+		if err := check(items, "item", &item.ItemID); err != nil {
+			return err
+		}
+	}
+	for _, label := range backup.PaymentLabels {
+		if err := check(payments, "payment", &label.PaymentID); err != nil {
+			return err
+		}
+		if err := check(labels, "label", &label.LabelID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
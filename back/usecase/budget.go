@@ -0,0 +1,205 @@
+package usecase
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+)
+
+// ErrInvalidBudget は予算の入力が不正な場合に返されます。
+var ErrInvalidBudget = fmt.Errorf("%w: invalid budget", ErrValidation)
+
+// BudgetStatus は現在の予算期間の予算と支出の状況です。金額はマネープールの通貨です。
+type BudgetStatus struct {
+	Amount      domain.Money `json:"amount"`
+	Period      string       `json:"period"`
+	Rollover    bool         `json:"rollover"`
+	PeriodStart time.Time    `json:"period_start"`
+	PeriodEnd   time.Time    `json:"period_end"`
+	// CarriedOver は前の期間から繰り越された使い残し
+	CarriedOver domain.Money `json:"carried_over"`
+	// Budgeted = Amount + CarriedOver
+	Budgeted domain.Money `json:"budgeted"`
+	// Spent は期間内の実際の支出、Planned は期間内の予定の支出（振替を除く）
+	Spent   domain.Money `json:"spent"`
+	Planned domain.Money `json:"planned"`
+	// Remaining = Budgeted - Spent, ProjectedRemaining = Remaining - Planned
+	Remaining          domain.Money `json:"remaining"`
+	ProjectedRemaining domain.Money `json:"projected_remaining"`
+	IsOverBudget       bool         `json:"is_over_budget"`
+	// IsProjectedOverBudget は予定の支出まで含めると予算を超える場合にtrue
+	IsProjectedOverBudget bool `json:"is_projected_over_budget"`
+}
+
+func sumDailyTotals(totals []domain.DailyTotal) (domain.Money, error) {
+	var sum domain.Money
+	for _, total := range totals {
+		var err error
+		if sum, err = sum.Add(total.Amount); err != nil {
+			return domain.Money{}, err
+		}
+	}
+	return sum, nil
+}
+
+// getBudgetStatus calculates the budget of the period containing date. It returns nil if the pool has no budget.
+func (u *Usecase) getBudgetStatus(pool domain.MoneyPool, date time.Time) (*BudgetStatus, error) {
+	if pool.BudgetAmount == nil || pool.BudgetPeriod == nil {
+		return nil, nil
+	}
+	period := *pool.BudgetPeriod
+	start, end := domain.BudgetPeriodRange(period, date)
+	status := &BudgetStatus{
+		Amount:      *pool.BudgetAmount,
+		Period:      period,
+		Rollover:    pool.BudgetRollover,
+		PeriodStart: start,
+		PeriodEnd:   end,
+	}
+
+	// 予算を設定した期間から前の期間までの使い残しを順に繰り越す
+	if pool.BudgetRollover && pool.BudgetStartDate != nil {
+		firstStart, _ := domain.BudgetPeriodRange(period, *pool.BudgetStartDate)
+		if firstStart.Before(start) {
+			spending, err := u.db.GetMoneyPoolDailySpending(pool.ID, firstStart, start.AddDate(0, 0, -1), false)
+			if err != nil {
+				log.Printf("マネープールID %s の過去の支出の取得に失敗しました。エラー: %v", pool.ID, err)
+				return nil, err
+			}
+			i := 0
+			for periodStart := firstStart; periodStart.Before(start); {
+				_, periodEnd := domain.BudgetPeriodRange(period, periodStart)
+				var spent domain.Money
+				for ; i < len(spending) && !spending[i].Date.After(periodEnd); i++ {
+					if spent, err = spent.Add(spending[i].Amount); err != nil {
+						return nil, err
+					}
+				}
+				// 使い残しだけを繰り越し、使いすぎた分は次の期間に持ち越さない
+				available, err := status.CarriedOver.Add(status.Amount)
+				if err != nil {
+					return nil, err
+				}
+				if status.CarriedOver, err = available.Sub(spent); err != nil {
+					return nil, err
+				}
+				if status.CarriedOver.IsNegative() {
+					status.CarriedOver = domain.Money{}
+				}
+				periodStart = periodEnd.AddDate(0, 0, 1)
+			}
+		}
+	}
+
+	spending, err := u.db.GetMoneyPoolDailySpending(pool.ID, start, end, false)
+	if err != nil {
+		log.Printf("マネープールID %s の支出の取得に失敗しました。エラー: %v", pool.ID, err)
+		return nil, err
+	}
+	plannedSpending, err := u.db.GetMoneyPoolDailySpending(pool.ID, start, end, true)
+	if err != nil {
+		log.Printf("マネープールID %s の予定の支出の取得に失敗しました。エラー: %v", pool.ID, err)
+		return nil, err
+	}
+
+	if status.Budgeted, err = status.Amount.Add(status.CarriedOver); err != nil {
+		return nil, err
+	}
+	if status.Spent, err = sumDailyTotals(spending); err != nil {
+		return nil, err
+	}
+	if status.Planned, err = sumDailyTotals(plannedSpending); err != nil {
+		return nil, err
+	}
+	if status.Remaining, err = status.Budgeted.Sub(status.Spent); err != nil {
+		return nil, err
+	}
+	if status.ProjectedRemaining, err = status.Remaining.Sub(status.Planned); err != nil {
+		return nil, err
+	}
+	status.IsOverBudget = status.Remaining.IsNegative()
+	status.IsProjectedOverBudget = status.ProjectedRemaining.IsNegative()
+	return status, nil
+}
+
+// GetMoneyPoolBudget returns the budget status of the current period of a pool owned by the user.
+func (u *Usecase) GetMoneyPoolBudget(userID string, moneyPoolID string) (*BudgetStatus, error) {
+	pool, err := u.getOwnMoneyPoolForBudget(userID, moneyPoolID)
+	if err != nil {
+		return nil, err
+	}
+	return u.getBudgetStatus(pool, today())
+}
+
+// SetMoneyPoolBudget defines the budget of a money pool. Rollover is counted from the period the budget was first set in,
+// and starts over when the period is changed.
+func (u *Usecase) SetMoneyPoolBudget(userID string, moneyPoolID string, amount domain.Money, period string, rollover bool) (*BudgetStatus, error) {
+	log.Printf("マネープールID %s の予算の設定を開始します。ユーザーID: %s", moneyPoolID, userID)
+
+	switch period {
+	case domain.BudgetPeriodWeekly, domain.BudgetPeriodMonthly, domain.BudgetPeriodYearly:
+	default:
+		return nil, fmt.Errorf("%w: period must be one of weekly, monthly or yearly", ErrInvalidBudget)
+	}
+	if amount.IsNegative() {
+		return nil, fmt.Errorf("%w: amount must not be negative", ErrInvalidBudget)
+	}
+
+	pool, err := u.getOwnMoneyPoolForBudget(userID, moneyPoolID)
+	if err != nil {
+		return nil, err
+	}
+
+	before := moneyPoolSnapshot(pool)
+	if pool.BudgetPeriod == nil || *pool.BudgetPeriod != period || pool.BudgetStartDate == nil {
+		startDate := today()
+		pool.BudgetStartDate = &startDate
+	}
+	pool.BudgetAmount = &amount
+	pool.BudgetPeriod = &period
+	pool.BudgetRollover = rollover
+
+	if err := u.db.SetMoneyPoolBudget(pool, auditChange[domain.MoneyPool](userID, domain.AuditActionUpdate, domain.AuditEntityMoneyPool, moneyPoolID, &moneyPoolID, before, moneyPoolSnapshot(pool))); err != nil {
+		log.Printf("マネープールID %s の予算の保存に失敗しました。エラー: %v", moneyPoolID, err)
+		return nil, err
+	}
+
+	log.Printf("マネープールID %s の予算を設定しました。", moneyPoolID)
+	return u.getBudgetStatus(pool, today())
+}
+
+// DeleteMoneyPoolBudget removes the budget of a money pool.
+func (u *Usecase) DeleteMoneyPoolBudget(userID string, moneyPoolID string) error {
+	log.Printf("マネープールID %s の予算の削除を開始します。ユーザーID: %s", moneyPoolID, userID)
+
+	pool, err := u.getOwnMoneyPoolForBudget(userID, moneyPoolID)
+	if err != nil {
+		return err
+	}
+	before := moneyPoolSnapshot(pool)
+	pool.BudgetAmount = nil
+	pool.BudgetPeriod = nil
+	pool.BudgetRollover = false
+	pool.BudgetStartDate = nil
+
+	if err := u.db.SetMoneyPoolBudget(pool, auditChange[domain.MoneyPool](userID, domain.AuditActionUpdate, domain.AuditEntityMoneyPool, moneyPoolID, &moneyPoolID, before, moneyPoolSnapshot(pool))); err != nil {
+		log.Printf("マネープールID %s の予算の削除に失敗しました。エラー: %v", moneyPoolID, err)
+		return err
+	}
+	return nil
+}
+
+func (u *Usecase) getOwnMoneyPoolForBudget(userID string, moneyPoolID string) (domain.MoneyPool, error) {
+	pool, err := u.db.GetMoneyPool(moneyPoolID)
+	if err != nil {
+		log.Printf("マネープールID %s の取得に失敗しました。エラー: %v", moneyPoolID, err)
+		return domain.MoneyPool{}, err
+	}
+	if pool.OwnerID != userID {
+		log.Printf("ユーザーID %s はマネープールID %s の予算を操作する権限がありません。", userID, moneyPoolID)
+		return domain.MoneyPool{}, fmt.Errorf("%w: user %s is not the owner of the MoneyPool %s", ErrForbidden, userID, moneyPoolID)
+	}
+	return pool, nil
+}
@@ -0,0 +1,291 @@
+package usecase
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+)
+
+var (
+	// ErrInvalidCurrency は通貨コードが不正な場合に返されます。
+	ErrInvalidCurrency = fmt.Errorf("%w: invalid currency", ErrValidation)
+	// ErrInvalidExchangeRate は為替レートの入力が不正な場合に返されます。
+	ErrInvalidExchangeRate = fmt.Errorf("%w: invalid exchange rate", ErrValidation)
+	// ErrNoExchangeRate は換算に必要な為替レートが登録されていない場合に返されます。
+	ErrNoExchangeRate = fmt.Errorf("%w: no exchange rate", ErrValidation)
+)
+
+// normalizeCurrency validates a currency code given by the user. An empty code means the default currency.
+func normalizeCurrency(code string) (string, error) {
+	normalized := domain.NormalizeCurrencyCode(code)
+	if !domain.IsValidCurrencyCode(normalized) {
+		return "", fmt.Errorf("%w: %q is not a currency code", ErrInvalidCurrency, code)
+	}
+	return normalized, nil
+}
+
+type ExchangeRateResponse struct {
+	ID           string      `json:"id"`
+	FromCurrency string      `json:"from_currency"`
+	ToCurrency   string      `json:"to_currency"`
+	Rate         domain.Rate `json:"rate"`
+	ValidFrom    time.Time   `json:"valid_from"`
+}
+
+func toExchangeRateResponses(rates []domain.ExchangeRate) []ExchangeRateResponse {
+	responses := make([]ExchangeRateResponse, 0, len(rates))
+	for _, rate := range rates {
+		responses = append(responses, ExchangeRateResponse{
+			ID:           rate.ID,
+			FromCurrency: rate.FromCurrency,
+			ToCurrency:   rate.ToCurrency,
+			Rate:         rate.Rate,
+			ValidFrom:    rate.ValidFrom,
+		})
+	}
+	return responses
+}
+
+// GetExchangeRates retrieves all exchange rates registered by the user.
+func (u Usecase) GetExchangeRates(userID string) ([]ExchangeRateResponse, error) {
+	log.Printf("ユーザーID %s の為替レート一覧の取得を開始します。", userID)
+	rates, err := u.db.GetExchangeRatesByUserID(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s の為替レート取得中にエラーが発生しました: %v", userID, err)
+		return nil, err
+	}
+	return toExchangeRateResponses(rates), nil
+}
+
+// AddExchangeRate registers a manually entered exchange rate valid from validFrom.
+func (u Usecase) AddExchangeRate(userID string, fromCurrency string, toCurrency string, rate domain.Rate, validFrom time.Time) (ExchangeRateResponse, error) {
+	log.Printf("為替レートの追加を開始します。ユーザーID: %s, %s/%s", userID, fromCurrency, toCurrency)
+
+	exchangeRate, err := newExchangeRate(userID, fromCurrency, toCurrency, rate, validFrom)
+	if err != nil {
+		return ExchangeRateResponse{}, err
+	}
+
+	created, err := u.db.NewExchangeRates([]domain.ExchangeRate{exchangeRate})
+	if err != nil {
+		log.Printf("為替レートの保存中にエラーが発生しました。エラー: %v", err)
+		return ExchangeRateResponse{}, err
+	}
+
+	log.Printf("為替レートを追加しました。ID: %s", created[0].ID)
+	return toExchangeRateResponses(created)[0], nil
+}
+
+// ImportExchangeRatesCSV registers exchange rates from a CSV with the header
+// from_currency,to_currency,rate,valid_from. Either all rows are stored or none.
+func (u Usecase) ImportExchangeRatesCSV(userID string, r io.Reader) ([]ExchangeRateResponse, error) {
+	log.Printf("為替レートのCSV取り込みを開始します。ユーザーID: %s", userID)
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read csv: %v", ErrInvalidExchangeRate, err)
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("%w: csv has no rows", ErrInvalidExchangeRate)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		// Excelが付けるBOMを取り除く
+		columns[strings.TrimPrefix(strings.TrimSpace(name), "\ufeff")] = i
+	}
+	for _, name := range []string{"from_currency", "to_currency", "rate", "valid_from"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: csv header must contain %s", ErrInvalidExchangeRate, name)
+		}
+	}
+
+	rates := make([]domain.ExchangeRate, 0, len(records)-1)
+	for i, record := range records[1:] {
+		line := i + 2
+		rate, err := domain.ParseRate(record[columns["rate"]])
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidExchangeRate, line, err)
+		}
+		validFrom, err := time.Parse("2006-01-02", strings.TrimSpace(record[columns["valid_from"]]))
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: valid_from should be YYYY-MM-DD", ErrInvalidExchangeRate, line)
+		}
+		exchangeRate, err := newExchangeRate(userID, record[columns["from_currency"]], record[columns["to_currency"]], rate, validFrom)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rates = append(rates, exchangeRate)
+	}
+
+	created, err := u.db.NewExchangeRates(rates)
+	if err != nil {
+		log.Printf("為替レートのCSV取り込み中にエラーが発生しました。エラー: %v", err)
+		return nil, err
+	}
+
+	log.Printf("為替レートを %d 件取り込みました。ユーザーID: %s", len(created), userID)
+	return toExchangeRateResponses(created), nil
+}
+
+func newExchangeRate(userID string, fromCurrency string, toCurrency string, rate domain.Rate, validFrom time.Time) (domain.ExchangeRate, error) {
+	from, err := normalizeCurrency(fromCurrency)
+	if err != nil {
+		return domain.ExchangeRate{}, err
+	}
+	to, err := normalizeCurrency(toCurrency)
+	if err != nil {
+		return domain.ExchangeRate{}, err
+	}
+	if from == to {
+		return domain.ExchangeRate{}, fmt.Errorf("%w: from_currency and to_currency must differ", ErrInvalidExchangeRate)
+	}
+	if rate.IsZero() {
+		return domain.ExchangeRate{}, fmt.Errorf("%w: rate is required", ErrInvalidExchangeRate)
+	}
+	return domain.ExchangeRate{
+		CreatorID:    userID,
+		FromCurrency: from,
+		ToCurrency:   to,
+		Rate:         rate,
+		ValidFrom:    validFrom,
+	}, nil
+}
+
+func (u Usecase) DeleteExchangeRate(userID string, exchangeRateID string) error {
+	log.Printf("為替レートID %s の削除を試みます。ユーザーID: %s", exchangeRateID, userID)
+
+	rate, err := u.db.GetExchangeRate(exchangeRateID)
+	if err != nil {
+		log.Printf("為替レートID %s のデータ取得中にエラーが発生しました。エラー: %v", exchangeRateID, err)
+		return err
+	}
+	if rate.CreatorID != userID {
+		log.Printf("ユーザーID %s は為替レートID %s の削除が許可されていません。", userID, exchangeRateID)
+		return fmt.Errorf("%w: cannot delete exchange rate %s", ErrForbidden, exchangeRateID)
+	}
+
+	err = u.db.DeleteExchangeRate(exchangeRateID)
+	if err != nil {
+		log.Printf("為替レートID %s の削除中にエラーが発生しました。エラー: %v", exchangeRateID, err)
+		return err
+	}
+
+	log.Printf("為替レートID %s の削除が完了しました。", exchangeRateID)
+	return nil
+}
+
+// SetBaseCurrency changes the currency the user's totals are reported in.
+func (u Usecase) SetBaseCurrency(userID string, currency string) (domain.User, error) {
+	log.Printf("ユーザーID %s の基準通貨を %s に変更します。", userID, currency)
+
+	normalized, err := normalizeCurrency(currency)
+	if err != nil {
+		return domain.User{}, err
+	}
+	user, err := u.db.GetUser(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s の取得に失敗しました。エラー: %v", userID, err)
+		return domain.User{}, err
+	}
+	user.BaseCurrency = normalized
+
+	err = u.db.UpdateUser(user)
+	if err != nil {
+		log.Printf("ユーザーID %s の基準通貨の更新に失敗しました。エラー: %v", userID, err)
+		return domain.User{}, err
+	}
+	return user, nil
+}
+
+// resolveBaseCurrency returns the requested currency, or the base currency of the user if none was requested.
+func (u *Usecase) resolveBaseCurrency(userID string, requested string) (string, error) {
+	if requested != "" {
+		return normalizeCurrency(requested)
+	}
+	user, err := u.db.GetUser(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s の取得に失敗しました。エラー: %v", userID, err)
+		return "", err
+	}
+	return domain.NormalizeCurrencyCode(user.BaseCurrency), nil
+}
+
+// currencyConverter converts amounts with the exchange rates registered by one user.
+// The rates are loaded once so that converting many daily totals does not hit the database each time.
+type currencyConverter struct {
+	rates []domain.ExchangeRate
+}
+
+func (u *Usecase) newCurrencyConverter(userID string) (*currencyConverter, error) {
+	rates, err := u.db.GetExchangeRatesByUserID(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s の為替レート取得に失敗しました。エラー: %v", userID, err)
+		return nil, err
+	}
+	return &currencyConverter{rates: rates}, nil
+}
+
+// Convert converts amount from one currency into another with the rate valid on date.
+// A rate registered for the opposite direction is used inversely if it is more recent.
+func (c *currencyConverter) Convert(amount domain.Money, from string, to string, date time.Time) (domain.Money, error) {
+	if from == to || amount.IsZero() {
+		return amount, nil
+	}
+
+	var best *domain.ExchangeRate
+	for i, rate := range c.rates {
+		isDirect := rate.FromCurrency == from && rate.ToCurrency == to
+		isInverse := rate.FromCurrency == to && rate.ToCurrency == from
+		if !isDirect && !isInverse || rate.ValidFrom.After(date) {
+			continue
+		}
+		if best == nil || rate.ValidFrom.After(best.ValidFrom) || (rate.ValidFrom.Equal(best.ValidFrom) && isDirect) {
+			best = &c.rates[i]
+		}
+	}
+	if best == nil {
+		return domain.Money{}, fmt.Errorf("%w: %s/%s on %s", ErrNoExchangeRate, from, to, date.Format("2006-01-02"))
+	}
+
+	if best.FromCurrency == from {
+		return amount.Convert(best.Rate)
+	}
+	return amount.ConvertInverse(best.Rate)
+}
+
+// convertMoneyPoolBalance calculates the balance of a pool up to date (or all of it if date is nil)
+// in the given currency, converting each day's payments with the rate valid on that day.
+// If excludeTransfers is true, money moved from or to other pools is not counted.
+func (u *Usecase) convertMoneyPoolBalance(pool domain.MoneyPool, date *time.Time, includePlanned bool, excludeTransfers bool, currency string, converter *currencyConverter) (domain.Money, error) {
+	poolCurrency := domain.NormalizeCurrencyCode(pool.Currency)
+	if poolCurrency == currency && !excludeTransfers {
+		if date != nil {
+			return u.db.GetMoneyPoolBalanceOfDate(pool.ID, *date, includePlanned)
+		}
+		return u.db.GetMoneyPoolBalance(pool.ID, includePlanned)
+	}
+
+	totals, err := u.db.GetMoneyPoolDailyTotals(pool.ID, date, includePlanned, excludeTransfers)
+	if err != nil {
+		return domain.Money{}, err
+	}
+	var balance domain.Money
+	for _, total := range totals {
+		converted, err := converter.Convert(total.Amount, poolCurrency, currency, total.Date)
+		if err != nil {
+			return domain.Money{}, err
+		}
+		if balance, err = balance.Add(converted); err != nil {
+			return domain.Money{}, err
+		}
+	}
+	return balance, nil
+}
@@ -0,0 +1,22 @@
+package usecase
+
+import (
+	"errors"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+)
+
+// エラーの種類。個別のエラーはこれらを%wで包み、ハンドラーはerrors.Isで種類を見てHTTPのステータスにする
+// ErrInvalidCurrencyやErrInvalidTransferなど、内容が不正な入力のエラーはすべてErrValidationを包み、どのエンドポイントでも422になる
+var (
+	// ErrUnauthenticated はログインが必要な操作を未ログインで行おうとした場合に返されます。
+	ErrUnauthenticated = errors.New("authentication required")
+	// ErrForbidden はログインユーザーに権限のないデータを操作しようとした場合に返されます。
+	ErrForbidden = errors.New("forbidden")
+	// ErrNotFound は指定されたデータがない場合に返されます。
+	ErrNotFound = domain.ErrNotFound
+	// ErrConflict はデータの今の状態ではその操作ができない場合に返されます。
+	ErrConflict = errors.New("conflict")
+	// ErrValidation はリクエストの形式は正しいが、内容を処理できない場合に返されます。
+	ErrValidation = errors.New("validation failed")
+)
@@ -0,0 +1,161 @@
+package usecase
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+)
+
+// ErrInvalidExport はエクスポートの条件が不正な場合に返されます。
+var ErrInvalidExport = fmt.Errorf("%w: invalid export", ErrValidation)
+
+// exportBatchSize は1回のクエリで読み込む支払いの件数です。全件をメモリに載せずに書き出すため、この件数ずつ読み込みます。
+const exportBatchSize = 500
+
+type ExportMoneyPool struct {
+	ID       string
+	Name     string
+	Currency string
+	OwnerID  string
+	// Balance は予定を含まない現在の残高
+	Balance domain.Money
+}
+
+type ExportPayment struct {
+	ID          string
+	Date        time.Time
+	Title       string
+	Amount      domain.Money
+	Description string
+	IsPlanned   bool
+	StoreName   string
+	Labels      []string
+	TransferID  *string
+}
+
+// PaymentExportWriter receives the exported payments money pool by money pool.
+// WritePayment is called for each payment of the pool between BeginMoneyPool and EndMoneyPool, oldest first.
+type PaymentExportWriter interface {
+	BeginMoneyPool(pool ExportMoneyPool) error
+	WritePayment(pool ExportMoneyPool, payment ExportPayment) error
+	EndMoneyPool(pool ExportMoneyPool) error
+}
+
+// ExportPayments writes the payments between from and to (inclusive, nil for no limit) to w.
+// If moneyPoolID is empty, the money pools of the user and the ones shared with the user are exported.
+// Otherwise only that pool is exported, which the user must be allowed to see just like in GetMoneyPool.
+// All access checks are done before anything is written to w.
+func (u *Usecase) ExportPayments(loginUserID string, moneyPoolID string, from *time.Time, to *time.Time, w PaymentExportWriter) error {
+	log.Printf("支払いのエクスポートを開始します。ログインユーザーID: %s, マネープールID: %s", loginUserID, moneyPoolID)
+	if from != nil && to != nil && from.After(*to) {
+		return fmt.Errorf("%w: from must not be after to", ErrInvalidExport)
+	}
+
+	var moneyPools []domain.MoneyPool
+	if moneyPoolID != "" {
+		pool, err := u.getViewableMoneyPool(moneyPoolID, loginUserID)
+		if err != nil {
+			return err
+		}
+		moneyPools = []domain.MoneyPool{pool}
+	} else {
+		if loginUserID == "" {
+			return fmt.Errorf("%w: login is required to export all money pools", ErrInvalidExport)
+		}
+		owned, err := u.db.GetMoneyPoolsByUserID(loginUserID)
+		if err != nil {
+			log.Printf("ユーザーID %s のマネープール取得に失敗しました。エラー: %v", loginUserID, err)
+			return err
+		}
+		shared, err := u.db.GetMoneyPoolsSharedWithUser(loginUserID)
+		if err != nil {
+			log.Printf("ユーザーID %s に共有されたマネープールの取得に失敗しました。エラー: %v", loginUserID, err)
+			return err
+		}
+		moneyPools = append(owned, shared...)
+	}
+
+	count := 0
+	for _, moneyPool := range moneyPools {
+		balance, err := u.db.GetMoneyPoolBalance(moneyPool.ID, false)
+		if err != nil {
+			log.Printf("MoneyPoolのバランス取得に失敗: Pool ID: %s, エラー: %v", moneyPool.ID, err)
+			return err
+		}
+		pool := ExportMoneyPool{
+			ID:       moneyPool.ID,
+			Name:     moneyPool.Name,
+			Currency: domain.NormalizeCurrencyCode(moneyPool.Currency),
+			OwnerID:  moneyPool.OwnerID,
+			Balance:  balance,
+		}
+		if err := w.BeginMoneyPool(pool); err != nil {
+			return err
+		}
+
+		filter := domain.PaymentFilter{
+			MoneyPoolIDs: []string{moneyPool.ID},
+			From:         from,
+			To:           to,
+			Sort:         domain.PaymentSortDateAsc,
+			Limit:        exportBatchSize,
+		}
+		for {
+			payments, err := u.db.GetPayments(filter)
+			if err != nil {
+				log.Printf("MoneyPoolID: %sの支払いの取得に失敗しました。エラー: %v", moneyPool.ID, err)
+				return err
+			}
+			if len(payments) == 0 {
+				break
+			}
+			paymentIDs := make([]string, 0, len(payments))
+			for _, payment := range payments {
+				paymentIDs = append(paymentIDs, payment.ID)
+			}
+			labels, err := u.db.GetPaymentLabelsByPaymentIDs(paymentIDs)
+			if err != nil {
+				log.Printf("MoneyPoolID: %sの支払いラベルの取得に失敗しました。エラー: %v", moneyPool.ID, err)
+				return err
+			}
+			labelsByPayment := groupPaymentLabels(labels)
+
+			for _, payment := range payments {
+				exported := ExportPayment{
+					ID:          payment.ID,
+					Date:        payment.Date,
+					Title:       payment.Title,
+					Amount:      payment.Amount,
+					Description: payment.Description,
+					IsPlanned:   payment.IsPlanned,
+					TransferID:  payment.TransferID,
+				}
+				if payment.StoreName != nil {
+					exported.StoreName = *payment.StoreName
+				}
+				for _, label := range labelsByPayment[payment.ID] {
+					exported.Labels = append(exported.Labels, label.LabelName)
+				}
+				if err := w.WritePayment(pool, exported); err != nil {
+					return err
+				}
+			}
+			count += len(payments)
+
+			if len(payments) < exportBatchSize {
+				break
+			}
+			last := payments[len(payments)-1]
+			filter.After = &domain.PaymentCursor{Date: last.Date, Amount: last.Amount, ID: last.ID}
+		}
+
+		if err := w.EndMoneyPool(pool); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("支払いのエクスポートが完了しました。マネープール: %d件, 支払い: %d件", len(moneyPools), count)
+	return nil
+}
@@ -0,0 +1,134 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+)
+
+// ErrInvalidPaymentItems は支払いの明細が不正な場合に返されます。
+var ErrInvalidPaymentItems = fmt.Errorf("%w: invalid payment items", ErrValidation)
+
+// PaymentItemInput は支払いに添付する明細の入力です。ItemIDかItemNameのどちらかを指定します。
+type PaymentItemInput struct {
+	ItemID    string       `json:"item_id"`
+	ItemName  string       `json:"item_name"`
+	Quantity  int64        `json:"quantity"`
+	UnitPrice domain.Money `json:"unit_price"`
+}
+
+type PaymentItemSummary struct {
+	ItemID    string       `json:"item_id"`
+	Name      string       `json:"name"`
+	Quantity  int64        `json:"quantity"`
+	UnitPrice domain.Money `json:"unit_price"`
+}
+
+// resolvePaymentItems validates the line items against the payment amount and resolves them to stored items.
+// Items given by name are looked up among the user's items. Names that do not exist yet are returned without an ItemID,
+// and the items are created together with the payment, so a rejected payment leaves no items behind.
+func (u *Usecase) resolvePaymentItems(userID string, inputs []PaymentItemInput, amount domain.Money) ([]domain.ItemPayment, error) {
+	if inputs == nil {
+		return nil, nil
+	}
+
+	items := make([]domain.ItemPayment, 0, len(inputs))
+	seen := make(map[string]bool)
+	for _, input := range inputs {
+		if input.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidPaymentItems)
+		}
+		if input.UnitPrice.IsNegative() {
+			return nil, fmt.Errorf("%w: unit_price must not be negative", ErrInvalidPaymentItems)
+		}
+
+		var item domain.Item
+		var err error
+		switch {
+		case input.ItemID != "":
+			item, err = u.db.GetItem(input.ItemID)
+			if errors.Is(err, domain.ErrNotFound) {
+				return nil, fmt.Errorf("%w: item %s not found", ErrInvalidPaymentItems, input.ItemID)
+			}
+			if err != nil {
+				log.Printf("商品ID %s の取得に失敗しました。エラー: %v", input.ItemID, err)
+				return nil, err
+			}
+			if item.CreatorID != userID {
+				log.Printf("ユーザーID %s は商品ID %s を使用する権限がありません。", userID, input.ItemID)
+				return nil, fmt.Errorf("%w: item %s not found", ErrInvalidPaymentItems, input.ItemID)
+			}
+		case input.ItemName != "":
+			item, err = u.db.GetItemByName(userID, input.ItemName)
+			if errors.Is(err, domain.ErrNotFound) {
+				// まだない商品は、支払いと同じトランザクションで作成する
+				item = domain.Item{Name: input.ItemName}
+			} else if err != nil {
+				log.Printf("商品 %s の取得に失敗しました。エラー: %v", input.ItemName, err)
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: item_id or item_name is required", ErrInvalidPaymentItems)
+		}
+
+		// item_paymentの主キーは(payment_id, item_id)なので同じ商品は1行にまとめる必要があります。
+		// まだない商品はIDがないので名前で比べます。
+		key := "id:" + item.ID
+		if item.ID == "" {
+			key = "name:" + item.Name
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("%w: item %s is listed more than once", ErrInvalidPaymentItems, item.Name)
+		}
+		seen[key] = true
+
+		items = append(items, domain.ItemPayment{
+			ItemID:    item.ID,
+			ItemName:  item.Name,
+			Quantity:  input.Quantity,
+			UnitPrice: input.UnitPrice,
+		})
+	}
+
+	if err := checkPaymentItemsTotal(items, amount); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// checkPaymentItemsTotal checks that the line items add up to the payment amount.
+func checkPaymentItemsTotal(items []domain.ItemPayment, amount domain.Money) error {
+	if len(items) == 0 {
+		return nil
+	}
+	var total domain.Money
+	for _, item := range items {
+		subtotal, err := item.UnitPrice.Mul(item.Quantity)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPaymentItems, err)
+		}
+		if total, err = total.Add(subtotal); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPaymentItems, err)
+		}
+	}
+	// 支払いは出金を負の値で表すため、明細の合計は金額の絶対値と比較します。
+	if !total.Equal(amount.Abs()) {
+		return fmt.Errorf("%w: items total %v does not match payment amount %v", ErrInvalidPaymentItems, total, amount)
+	}
+	return nil
+}
+
+func toPaymentItemSummaries(items []domain.ItemPayment) []PaymentItemSummary {
+	summaries := make([]PaymentItemSummary, 0, len(items))
+	for _, item := range items {
+		summaries = append(summaries, PaymentItemSummary{
+			ItemID:    item.ItemID,
+			Name:      item.ItemName,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+		})
+	}
+	return summaries
+}
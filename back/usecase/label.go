@@ -0,0 +1,199 @@
+package usecase
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+)
+
+// ErrInvalidLabel は支払いに指定されたラベルが存在しない、または使用できない場合に返されます。
+var ErrInvalidLabel = fmt.Errorf("%w: invalid label", ErrValidation)
+
+type LabelResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// GetLabels retrieves all labels of the user.
+func (u Usecase) GetLabels(userID string) ([]LabelResponse, error) {
+	log.Printf("ユーザーID %s のラベル一覧の取得を開始します。", userID)
+	labels, err := u.db.GetLabelsByUserID(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s のラベル取得中にエラーが発生しました: %v", userID, err)
+		return nil, err
+	}
+
+	response := make([]LabelResponse, 0, len(labels))
+	for _, label := range labels {
+		response = append(response, LabelResponse{
+			ID:   label.ID,
+			Name: label.Name,
+		})
+	}
+
+	log.Printf("ユーザーID %s のラベル一覧の取得が完了しました。", userID)
+	return response, nil
+}
+
+func (u Usecase) AddLabel(userID string, name string) (LabelResponse, error) {
+	log.Printf("新しいラベルの追加を開始します。ユーザーID: %s, 名前: %s", userID, name)
+
+	createdLabel, err := u.db.NewLabel(domain.Label{
+		Name:      name,
+		CreatorID: userID,
+	})
+	if err != nil {
+		log.Printf("新しいラベルの作成中にエラーが発生しました。エラー: %v", err)
+		return LabelResponse{}, err
+	}
+
+	log.Printf("新しいラベルが作成されました。ID: %s", createdLabel.ID)
+	return LabelResponse{
+		ID:   createdLabel.ID,
+		Name: createdLabel.Name,
+	}, nil
+}
+
+func (u Usecase) UpdateLabel(userID string, labelID string, name string) (LabelResponse, error) {
+	log.Printf("ラベルID %s の更新を開始します。ユーザーID: %s", labelID, userID)
+
+	existingLabel, err := u.db.GetLabel(labelID)
+	if err != nil {
+		log.Printf("ラベルID %s のデータ取得中にエラーが発生しました。エラー: %v", labelID, err)
+		return LabelResponse{}, err
+	}
+
+	if existingLabel.CreatorID != userID {
+		log.Printf("ユーザーID %s はラベルID %s の更新が許可されていません。", userID, labelID)
+		return LabelResponse{}, fmt.Errorf("%w: cannot update label %s", ErrForbidden, labelID)
+	}
+
+	updatedLabel := domain.Label{
+		ID:        labelID,
+		Name:      name,
+		CreatorID: userID,
+	}
+	err = u.db.UpdateLabel(updatedLabel)
+	if err != nil {
+		log.Printf("ラベルID %s の更新中にエラーが発生しました。エラー: %v", labelID, err)
+		return LabelResponse{}, err
+	}
+
+	log.Printf("ラベルID %s の更新が完了しました。", labelID)
+	return LabelResponse{
+		ID:   updatedLabel.ID,
+		Name: updatedLabel.Name,
+	}, nil
+}
+
+// DeleteLabel deletes a label and removes it from every payment.
+func (u Usecase) DeleteLabel(userID string, labelID string) error {
+	log.Printf("ラベルID %s の削除を試みます。ユーザーID: %s", labelID, userID)
+
+	label, err := u.db.GetLabel(labelID)
+	if err != nil {
+		log.Printf("ラベルID %s のデータ取得中にエラーが発生しました。エラー: %v", labelID, err)
+		return err
+	}
+
+	if label.CreatorID != userID {
+		log.Printf("ユーザーID %s はラベルID %s の削除が許可されていません。", userID, labelID)
+		return fmt.Errorf("%w: cannot delete label %s", ErrForbidden, labelID)
+	}
+
+	err = u.db.DeleteLabel(labelID)
+	if err != nil {
+		log.Printf("ラベルID %s の削除中にエラーが発生しました。エラー: %v", labelID, err)
+		return err
+	}
+
+	log.Printf("ラベルID %s の削除が完了しました。", labelID)
+	return nil
+}
+
+type LabelTotalSummary struct {
+	ID           string       `json:"id"`
+	Name         string       `json:"name"`
+	Total        domain.Money `json:"total"`
+	PaymentCount int64        `json:"payment_count"`
+}
+
+type LabelTotalsResponse struct {
+	From   time.Time           `json:"from"`
+	To     time.Time           `json:"to"`
+	Labels []LabelTotalSummary `json:"labels"`
+}
+
+// GetLabelTotals sums up the payments of each label of the user between from and to (inclusive).
+func (u Usecase) GetLabelTotals(userID string, from time.Time, to time.Time, includePlanned bool) (LabelTotalsResponse, error) {
+	log.Printf("ユーザーID %s のラベル別合計の計算を開始します。期間: %s - %s", userID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+
+	totals, err := u.db.GetLabelTotals(userID, from, to, includePlanned)
+	if err != nil {
+		log.Printf("ユーザーID %s のラベル別合計の計算中にエラーが発生しました: %v", userID, err)
+		return LabelTotalsResponse{}, err
+	}
+
+	response := LabelTotalsResponse{
+		From:   from,
+		To:     to,
+		Labels: make([]LabelTotalSummary, 0, len(totals)),
+	}
+	for _, total := range totals {
+		response.Labels = append(response.Labels, LabelTotalSummary{
+			ID:           total.LabelID,
+			Name:         total.LabelName,
+			Total:        total.Total,
+			PaymentCount: total.PaymentCount,
+		})
+	}
+
+	log.Printf("ユーザーID %s のラベル別合計の計算が完了しました。", userID)
+	return response, nil
+}
+
+// resolvePaymentLabels checks that the labels set on a payment belong to the user.
+func (u *Usecase) resolvePaymentLabels(userID string, labelIDs []string) ([]LabelResponse, error) {
+	if labelIDs == nil {
+		return nil, nil
+	}
+	labels := make([]LabelResponse, 0, len(labelIDs))
+	for _, labelID := range labelIDs {
+		label, err := u.db.GetLabel(labelID)
+		if err != nil {
+			log.Printf("ラベルID %s の取得に失敗しました。エラー: %v", labelID, err)
+			return nil, fmt.Errorf("%w: label %s not found", ErrInvalidLabel, labelID)
+		}
+		if label.CreatorID != userID {
+			log.Printf("ユーザーID %s はラベルID %s を使用する権限がありません。", userID, labelID)
+			return nil, fmt.Errorf("%w: label %s not found", ErrInvalidLabel, labelID)
+		}
+		labels = append(labels, LabelResponse{
+			ID:   label.ID,
+			Name: label.Name,
+		})
+	}
+	return labels, nil
+}
+
+func toLabelResponses(labels []domain.PaymentLabel) []LabelResponse {
+	responses := make([]LabelResponse, 0, len(labels))
+	for _, label := range labels {
+		responses = append(responses, LabelResponse{
+			ID:   label.LabelID,
+			Name: label.LabelName,
+		})
+	}
+	return responses
+}
+
+// groupPaymentLabels groups labels by the payment they are attached to.
+func groupPaymentLabels(labels []domain.PaymentLabel) map[string][]domain.PaymentLabel {
+	grouped := make(map[string][]domain.PaymentLabel)
+	for _, label := range labels {
+		grouped[label.PaymentID] = append(grouped[label.PaymentID], label)
+	}
+	return grouped
+}
@@ -5,19 +5,34 @@ import (
 	"time"
 
 	"github.com/walnuts1018/openchokin/back/domain"
+	"github.com/walnuts1018/openchokin/back/timeJST"
 )
 
+// MoneySumResponse の金額はすべて BaseCurrency に換算されている
 type MoneySumResponse struct {
-	MoneyProviderSum       float64
-	ActualMoneyPoolSum     float64
-	ForecastedMoneyPoolSum float64
+	BaseCurrency           string
+	MoneyProviderSum       domain.Money
+	ActualMoneyPoolSum     domain.Money
+	ForecastedMoneyPoolSum domain.Money
 }
 
 // GetMoneyInformation retrieves the sum of money information for a user.
-func (u Usecase) GetMoneyInformation(userID string, loginUserID string) (MoneySumResponse, error) {
+// Transfers between money pools only move money around and are not counted in the pool sums.
+// The sums are converted into currency, or into the base currency of the user if currency is empty.
+func (u Usecase) GetMoneyInformation(userID string, loginUserID string, currency string) (MoneySumResponse, error) {
 	var response MoneySumResponse
 	log.Printf("ユーザーID %s のマネー情報取得を開始します。ログインユーザーID: %s", userID, loginUserID)
 
+	baseCurrency, err := u.resolveBaseCurrency(userID, currency)
+	if err != nil {
+		return response, err
+	}
+	response.BaseCurrency = baseCurrency
+	converter, err := u.newCurrencyConverter(userID)
+	if err != nil {
+		return response, err
+	}
+
 	// Retrieve all MoneyPools associated with the user.
 	moneyPools, err := u.db.GetMoneyPoolsByUserID(userID)
 	if err != nil {
@@ -53,20 +68,24 @@ func (u Usecase) GetMoneyInformation(userID string, loginUserID string) (MoneySu
 
 		// If the user has access, sum up the actual and forecasted balances.
 		if hasAccess {
-			balance, err := u.db.GetMoneyPoolBalance(pool.ID, false)
+			balance, err := u.convertMoneyPoolBalance(pool, nil, false, true, baseCurrency, converter)
 			if err != nil {
 				log.Printf("マネープールID %s の実際の残高取得エラー: %v", pool.ID, err)
 				return response, err
 			}
-			response.ActualMoneyPoolSum += balance
+			if response.ActualMoneyPoolSum, err = response.ActualMoneyPoolSum.Add(balance); err != nil {
+				return response, err
+			}
 
-			forecastedBalance, err := u.db.GetMoneyPoolBalance(pool.ID, true)
+			forecastedBalance, err := u.convertMoneyPoolBalance(pool, nil, true, true, baseCurrency, converter)
 			if err != nil {
 				log.Printf("マネープールID %s の予測残高取得エラー: %v", pool.ID, err)
 				return response, err
 			}
-			response.ForecastedMoneyPoolSum += forecastedBalance
-			log.Printf("マネープールID %s の残高を追加: 実際の残高 %f, 予測残高 %f", pool.ID, balance, forecastedBalance)
+			if response.ForecastedMoneyPoolSum, err = response.ForecastedMoneyPoolSum.Add(forecastedBalance); err != nil {
+				return response, err
+			}
+			log.Printf("マネープールID %s の残高を追加: 実際の残高 %s, 予測残高 %s", pool.ID, balance, forecastedBalance)
 		}
 	}
 
@@ -77,18 +96,37 @@ func (u Usecase) GetMoneyInformation(userID string, loginUserID string) (MoneySu
 		return response, err
 	}
 	for _, provider := range moneyProviders {
-		response.MoneyProviderSum += provider.Balance
+		balance, err := converter.Convert(provider.Balance, domain.NormalizeCurrencyCode(provider.Currency), baseCurrency, timeJST.Now())
+		if err != nil {
+			log.Printf("マネープロバイダーID %s の残高換算エラー: %v", provider.ID, err)
+			return response, err
+		}
+		if response.MoneyProviderSum, err = response.MoneyProviderSum.Add(balance); err != nil {
+			return response, err
+		}
 	}
-	log.Printf("ユーザーID %s のマネープロバイダー合計を計算: %f", userID, response.MoneyProviderSum)
+	log.Printf("ユーザーID %s のマネープロバイダー合計を計算: %s", userID, response.MoneyProviderSum)
 
 	log.Printf("ユーザーID %s のマネー情報取得が完了しました。", userID)
 	return response, nil
 }
 
-func (u Usecase) GetMoneyInformationOfDate(userID string, loginUserID string, date time.Time) (MoneySumResponse, error) {
+// GetMoneyInformationOfDate is like GetMoneyInformation but only counts payments up to date,
+// and uses the balances the money providers had at the end of that day.
+func (u Usecase) GetMoneyInformationOfDate(userID string, loginUserID string, date time.Time, currency string) (MoneySumResponse, error) {
 	var response MoneySumResponse
 	log.Printf("特定日の金銭情報取得を開始: ユーザーID: %s, ログインユーザーID: %s, 日付: %v", userID, loginUserID, date)
 
+	baseCurrency, err := u.resolveBaseCurrency(userID, currency)
+	if err != nil {
+		return response, err
+	}
+	response.BaseCurrency = baseCurrency
+	converter, err := u.newCurrencyConverter(userID)
+	if err != nil {
+		return response, err
+	}
+
 	// ユーザーに関連する全てのMoneyProvidersを取得し、そのバランスの合計を計算する。
 	moneyProviders, err := u.db.GetMoneyProvidersByUserID(userID)
 	if err != nil {
@@ -96,7 +134,20 @@ func (u Usecase) GetMoneyInformationOfDate(userID string, loginUserID string, da
 		return response, err
 	}
 	for _, provider := range moneyProviders {
-		response.MoneyProviderSum += provider.Balance
+		// その日の終わりの時点の残高を使う
+		providerBalance, err := u.db.GetMoneyProviderBalanceAt(provider.ID, endOfDayJST(date))
+		if err != nil {
+			log.Printf("MoneyProvider残高履歴取得エラー: プロバイダーID: %s, エラー: %v", provider.ID, err)
+			return response, err
+		}
+		balance, err := converter.Convert(providerBalance, domain.NormalizeCurrencyCode(provider.Currency), baseCurrency, date)
+		if err != nil {
+			log.Printf("MoneyProvider残高換算エラー: プロバイダーID: %s, エラー: %v", provider.ID, err)
+			return response, err
+		}
+		if response.MoneyProviderSum, err = response.MoneyProviderSum.Add(balance); err != nil {
+			return response, err
+		}
 	}
 
 	// アクセス権に基づいてMoneyPoolsを取得
@@ -124,23 +175,27 @@ func (u Usecase) GetMoneyInformationOfDate(userID string, loginUserID string, da
 
 		if hasAccess {
 			// 指定された日付までの実際のバランスを計算
-			balance, err := u.db.GetMoneyPoolBalanceOfDate(pool.ID, date, false)
+			balance, err := u.convertMoneyPoolBalance(pool, &date, false, true, baseCurrency, converter)
 			if err != nil {
 				log.Printf("実際のバランス計算エラー: プールID: %s, 日付: %v, エラー: %v", pool.ID, date, err)
 				return response, err
 			}
-			response.ActualMoneyPoolSum += balance
+			if response.ActualMoneyPoolSum, err = response.ActualMoneyPoolSum.Add(balance); err != nil {
+				return response, err
+			}
 
 			// 指定された日付までの予測バランスを計算
-			balance, err = u.db.GetMoneyPoolBalanceOfDate(pool.ID, date, true)
+			balance, err = u.convertMoneyPoolBalance(pool, &date, true, true, baseCurrency, converter)
 			if err != nil {
 				log.Printf("予測バランス計算エラー: プールID: %s, 日付: %v, エラー: %v", pool.ID, date, err)
 				return response, err
 			}
-			response.ForecastedMoneyPoolSum += balance
+			if response.ForecastedMoneyPoolSum, err = response.ForecastedMoneyPoolSum.Add(balance); err != nil {
+				return response, err
+			}
 		}
 	}
 
-	log.Printf("特定日の金銭情報取得完了: ユーザーID: %s, 実際の合計: %f, 予測合計: %f", userID, response.ActualMoneyPoolSum, response.ForecastedMoneyPoolSum)
+	log.Printf("特定日の金銭情報取得完了: ユーザーID: %s, 実際の合計: %s, 予測合計: %s", userID, response.ActualMoneyPoolSum, response.ForecastedMoneyPoolSum)
 	return response, nil
 }
@@ -12,19 +12,30 @@ import (
 type MoneyPoolSummary struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
-	// このIDのMoneyPoolに紐づくPlanではない実際の支払いの総額
-	Sum   float64 `json:"sum"`
-	Type  string  `json:"type"`
-	Emoji string  `json:"emoji"`
+	// このIDのMoneyPoolに紐づくPlanではない実際の支払いの総額（マネープールの通貨）
+	Sum      domain.Money `json:"sum"`
+	Currency string       `json:"currency"`
+	// Sum を基準通貨に換算した額
+	ConvertedSum domain.Money `json:"converted_sum"`
+	Type         string       `json:"type"`
+	Emoji        string       `json:"emoji"`
+	// Budget は現在の予算期間の状況。予算が設定されていない場合はnull
+	Budget *BudgetStatus `json:"budget"`
 }
 
 // MoneyPoolsSummaryResponse
 type MoneyPoolsSummaryResponse struct {
-	Pools []MoneyPoolSummary `json:"pools"`
+	BaseCurrency string             `json:"base_currency"`
+	Total        domain.Money       `json:"total"`
+	Pools        []MoneyPoolSummary `json:"pools"`
+	// 予算を超えている、または予定の支出を含めると超えるマネープールの数
+	OverBudgetCount          int `json:"over_budget_count"`
+	ProjectedOverBudgetCount int `json:"projected_over_budget_count"`
 }
 
 // GetMoneyPoolsSummary メソッドは、指定されたuserIDのMoneyPoolsの要約を返します。
-func (u *Usecase) GetMoneyPoolsSummary(userID string, loginUserID string) (MoneyPoolsSummaryResponse, error) {
+// 各マネープールの残高は currency（空の場合はユーザーの基準通貨）に支払い日のレートで換算されます。
+func (u *Usecase) GetMoneyPoolsSummary(userID string, loginUserID string, currency string) (MoneyPoolsSummaryResponse, error) {
 	log.Printf("ユーザーのMoneyPoolsの概要取得開始: ユーザーID: %s, ログインユーザーID: %s", userID, loginUserID)
 	moneyPools, err := u.db.GetMoneyPoolsByUserID(userID)
 	if err != nil {
@@ -32,55 +43,256 @@ func (u *Usecase) GetMoneyPoolsSummary(userID string, loginUserID string) (Money
 		return MoneyPoolsSummaryResponse{}, err
 	}
 
-	var pools []MoneyPoolSummary
+	baseCurrency, err := u.resolveBaseCurrency(userID, currency)
+	if err != nil {
+		return MoneyPoolsSummaryResponse{}, err
+	}
+	converter, err := u.newCurrencyConverter(userID)
+	if err != nil {
+		return MoneyPoolsSummaryResponse{}, err
+	}
+
+	response := MoneyPoolsSummaryResponse{BaseCurrency: baseCurrency}
 	for _, pool := range moneyPools {
-		if userID == loginUserID || pool.Type == "public" {
-			sum, balanceErr := u.db.GetMoneyPoolBalance(pool.ID, false)
-			if balanceErr != nil {
-				log.Printf("MoneyPoolのバランス取得に失敗: Pool ID: %s, エラー: %v", pool.ID, balanceErr)
-				return MoneyPoolsSummaryResponse{}, balanceErr
-			}
-			pools = append(pools, MoneyPoolSummary{
-				ID:    pool.ID,
-				Name:  pool.Name,
-				Sum:   sum,
-				Type:  pool.Type,
-				Emoji: pool.Emoji,
-			})
-		} else if loginUserID != "" {
-			shared, shareErr := u.db.IsMoneyPoolSharedWithUser(pool.ID, loginUserID)
-			if shareErr != nil {
-				log.Printf("MoneyPoolの共有状態確認に失敗: Pool ID: %s, ログインユーザーID: %s, エラー: %v", pool.ID, loginUserID, shareErr)
-				return MoneyPoolsSummaryResponse{}, shareErr
+		hasAccess, accessErr := u.canViewMoneyPool(pool, loginUserID)
+		if accessErr != nil {
+			return MoneyPoolsSummaryResponse{}, accessErr
+		}
+		if !hasAccess {
+			continue
+		}
+
+		sum, balanceErr := u.db.GetMoneyPoolBalance(pool.ID, false)
+		if balanceErr != nil {
+			log.Printf("MoneyPoolのバランス取得に失敗: Pool ID: %s, エラー: %v", pool.ID, balanceErr)
+			return MoneyPoolsSummaryResponse{}, balanceErr
+		}
+		convertedSum, convertErr := u.convertMoneyPoolBalance(pool, nil, false, false, baseCurrency, converter)
+		if convertErr != nil {
+			log.Printf("MoneyPoolのバランス換算に失敗: Pool ID: %s, エラー: %v", pool.ID, convertErr)
+			return MoneyPoolsSummaryResponse{}, convertErr
+		}
+		budget, budgetErr := u.getBudgetStatus(pool, today())
+		if budgetErr != nil {
+			log.Printf("MoneyPoolの予算の計算に失敗: Pool ID: %s, エラー: %v", pool.ID, budgetErr)
+			return MoneyPoolsSummaryResponse{}, budgetErr
+		}
+		if response.Total, err = response.Total.Add(convertedSum); err != nil {
+			return MoneyPoolsSummaryResponse{}, err
+		}
+		if budget != nil && budget.IsOverBudget {
+			response.OverBudgetCount++
+		}
+		if budget != nil && budget.IsProjectedOverBudget {
+			response.ProjectedOverBudgetCount++
+		}
+		response.Pools = append(response.Pools, MoneyPoolSummary{
+			ID:           pool.ID,
+			Name:         pool.Name,
+			Sum:          sum,
+			Currency:     domain.NormalizeCurrencyCode(pool.Currency),
+			ConvertedSum: convertedSum,
+			Type:         pool.Type,
+			Emoji:        pool.Emoji,
+			Budget:       budget,
+		})
+	}
+
+	log.Printf("ユーザーのMoneyPoolsの概要取得完了: ユーザーID: %s", userID)
+	return response, nil
+}
+
+// canViewMoneyPool reports whether loginUserID (empty if not logged in) may see the pool:
+// the owner always can, others only if the pool is public or shared with one of their groups.
+func (u *Usecase) canViewMoneyPool(pool domain.MoneyPool, loginUserID string) (bool, error) {
+	if pool.OwnerID == loginUserID || pool.Type == domain.PublicTypePublic {
+		return true, nil
+	}
+	if loginUserID == "" {
+		return false, nil
+	}
+	shared, err := u.db.IsMoneyPoolSharedWithUser(pool.ID, loginUserID)
+	if err != nil {
+		log.Printf("MoneyPoolの共有状態確認に失敗: Pool ID: %s, ログインユーザーID: %s, エラー: %v", pool.ID, loginUserID, err)
+		return false, err
+	}
+	return shared, nil
+}
+
+// getViewableMoneyPool retrieves a money pool that has not been deleted and that loginUserID may see.
+func (u *Usecase) getViewableMoneyPool(moneyPoolID string, loginUserID string) (domain.MoneyPool, error) {
+	moneyPool, err := u.db.GetMoneyPool(moneyPoolID)
+	if err != nil {
+		log.Printf("MoneyPoolID: %sの取得に失敗しました。エラー: %v", moneyPoolID, err)
+		return domain.MoneyPool{}, err
+	}
+
+	hasAccess, err := u.canViewMoneyPool(moneyPool, loginUserID)
+	if err != nil {
+		return domain.MoneyPool{}, err
+	}
+	if moneyPool.IsDeleted || !hasAccess {
+		log.Printf("ユーザーID: %sはMoneyPoolID: %sへのアクセス権がありません。", loginUserID, moneyPoolID)
+		return domain.MoneyPool{}, fmt.Errorf("%w: user %s does not have access to the money pool %s", ErrForbidden, loginUserID, moneyPoolID)
+	}
+	return moneyPool, nil
+}
+
+type UserGroupSummary struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type MoneyPoolDetail struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	Emoji       string `json:"emoji"`
+	Currency    string `json:"currency"`
+	OwnerID     string `json:"owner_id"`
+	// Owner は所有者の名前とアバター
+	Owner UserSummary `json:"owner"`
+	// PublicationScope は公開先のユーザーグループ。所有者にだけ返す
+	PublicationScope []UserGroupSummary `json:"publication_scope"`
+	MoneyProviderID  *string            `json:"money_provider_id"`
+	// 残高はマネープールの通貨、Converted〜は基準通貨に換算した額
+	ActualBalance            domain.Money  `json:"actual_balance"`
+	ForecastBalance          domain.Money  `json:"forecast_balance"`
+	ConvertedActualBalance   domain.Money  `json:"converted_actual_balance"`
+	ConvertedForecastBalance domain.Money  `json:"converted_forecast_balance"`
+	PaymentCount             int64         `json:"payment_count"`
+	PlannedPaymentCount      int64         `json:"planned_payment_count"`
+	LastPaymentDate          *time.Time    `json:"last_payment_date"`
+	Budget                   *BudgetStatus `json:"budget"`
+}
+
+type MoneyPoolsDetailResponse struct {
+	BaseCurrency string            `json:"base_currency"`
+	Total        domain.Money      `json:"total"`
+	Pools        []MoneyPoolDetail `json:"pools"`
+}
+
+// GetMoneyPoolsDetail is like GetMoneyPoolsSummary but returns everything the dashboard shows for each pool,
+// so that it does not have to request every pool one by one.
+func (u *Usecase) GetMoneyPoolsDetail(userID string, loginUserID string, currency string) (MoneyPoolsDetailResponse, error) {
+	log.Printf("ユーザーのMoneyPoolsの詳細取得開始: ユーザーID: %s, ログインユーザーID: %s", userID, loginUserID)
+	moneyPools, err := u.db.GetMoneyPoolsByUserID(userID)
+	if err != nil {
+		log.Printf("ユーザーのMoneyPoolsの取得に失敗: ユーザーID: %s, エラー: %v", userID, err)
+		return MoneyPoolsDetailResponse{}, err
+	}
+
+	baseCurrency, err := u.resolveBaseCurrency(userID, currency)
+	if err != nil {
+		return MoneyPoolsDetailResponse{}, err
+	}
+	converter, err := u.newCurrencyConverter(userID)
+	if err != nil {
+		return MoneyPoolsDetailResponse{}, err
+	}
+
+	// マネープールはすべてuserIDのものなので、所有者の情報は一度だけ取得する
+	owners, err := u.userSummaries([]string{userID})
+	if err != nil {
+		return MoneyPoolsDetailResponse{}, err
+	}
+
+	response := MoneyPoolsDetailResponse{BaseCurrency: baseCurrency, Pools: []MoneyPoolDetail{}}
+	for _, pool := range moneyPools {
+		hasAccess, err := u.canViewMoneyPool(pool, loginUserID)
+		if err != nil {
+			return MoneyPoolsDetailResponse{}, err
+		}
+		if !hasAccess {
+			continue
+		}
+
+		detail := MoneyPoolDetail{
+			ID:              pool.ID,
+			Name:            pool.Name,
+			Description:     pool.Description,
+			Type:            pool.Type,
+			Emoji:           pool.Emoji,
+			Currency:        domain.NormalizeCurrencyCode(pool.Currency),
+			OwnerID:         pool.OwnerID,
+			Owner:           owners[pool.OwnerID],
+			MoneyProviderID: pool.MoneyProviderID,
+		}
+
+		if pool.OwnerID == loginUserID {
+			groups, err := u.db.GetMoneyPoolPublicationScope(pool.ID)
+			if err != nil {
+				log.Printf("MoneyPoolの公開範囲の取得に失敗: Pool ID: %s, エラー: %v", pool.ID, err)
+				return MoneyPoolsDetailResponse{}, err
 			}
-			if shared {
-				sum, balanceErr := u.db.GetMoneyPoolBalance(pool.ID, false)
-				if balanceErr != nil {
-					log.Printf("MoneyPoolのバランス取得に失敗: Pool ID: %s, エラー: %v", pool.ID, balanceErr)
-					return MoneyPoolsSummaryResponse{}, balanceErr
-				}
-				pools = append(pools, MoneyPoolSummary{
-					ID:    pool.ID,
-					Name:  pool.Name,
-					Sum:   sum,
-					Type:  pool.Type,
-					Emoji: pool.Emoji,
-				})
+			detail.PublicationScope = make([]UserGroupSummary, 0, len(groups))
+			for _, group := range groups {
+				detail.PublicationScope = append(detail.PublicationScope, UserGroupSummary{ID: group.ID, Name: group.Name})
 			}
 		}
+
+		if detail.ActualBalance, err = u.db.GetMoneyPoolBalance(pool.ID, false); err != nil {
+			log.Printf("MoneyPoolのバランス取得に失敗: Pool ID: %s, エラー: %v", pool.ID, err)
+			return MoneyPoolsDetailResponse{}, err
+		}
+		if detail.ForecastBalance, err = u.db.GetMoneyPoolBalance(pool.ID, true); err != nil {
+			log.Printf("MoneyPoolの予測バランス取得に失敗: Pool ID: %s, エラー: %v", pool.ID, err)
+			return MoneyPoolsDetailResponse{}, err
+		}
+		if detail.ConvertedActualBalance, err = u.convertMoneyPoolBalance(pool, nil, false, false, baseCurrency, converter); err != nil {
+			log.Printf("MoneyPoolのバランス換算に失敗: Pool ID: %s, エラー: %v", pool.ID, err)
+			return MoneyPoolsDetailResponse{}, err
+		}
+		if detail.ConvertedForecastBalance, err = u.convertMoneyPoolBalance(pool, nil, true, false, baseCurrency, converter); err != nil {
+			log.Printf("MoneyPoolの予測バランス換算に失敗: Pool ID: %s, エラー: %v", pool.ID, err)
+			return MoneyPoolsDetailResponse{}, err
+		}
+
+		stats, err := u.db.GetMoneyPoolPaymentStats(pool.ID)
+		if err != nil {
+			log.Printf("MoneyPoolの支払い件数の取得に失敗: Pool ID: %s, エラー: %v", pool.ID, err)
+			return MoneyPoolsDetailResponse{}, err
+		}
+		detail.PaymentCount = stats.PaymentCount
+		detail.PlannedPaymentCount = stats.PlannedCount
+		detail.LastPaymentDate = stats.LastPaymentDate
+
+		if detail.Budget, err = u.getBudgetStatus(pool, today()); err != nil {
+			log.Printf("MoneyPoolの予算の計算に失敗: Pool ID: %s, エラー: %v", pool.ID, err)
+			return MoneyPoolsDetailResponse{}, err
+		}
+
+		if response.Total, err = response.Total.Add(detail.ConvertedActualBalance); err != nil {
+			return MoneyPoolsDetailResponse{}, err
+		}
+		response.Pools = append(response.Pools, detail)
 	}
 
-	log.Printf("ユーザーのMoneyPoolsの概要取得完了: ユーザーID: %s", userID)
-	return MoneyPoolsSummaryResponse{Pools: pools}, nil
+	log.Printf("ユーザーのMoneyPoolsの詳細取得完了: ユーザーID: %s", userID)
+	return response, nil
 }
 
 type PaymentSummary struct {
-	ID          string    `json:"id"`
-	Date        time.Time `json:"date"`
-	Title       string    `json:"title"`
-	Amount      float64   `json:"amount"`
-	Description string    `json:"description"`
-	IsPlanned   bool      `json:"is_planned"`
+	ID          string               `json:"id"`
+	Date        time.Time            `json:"date"`
+	Title       string               `json:"title"`
+	Amount      domain.Money         `json:"amount"`
+	Description string               `json:"description"`
+	IsPlanned   bool                 `json:"is_planned"`
+	StoreID     *string              `json:"store_id"`
+	StoreName   *string              `json:"store_name"`
+	Labels      []LabelResponse      `json:"labels"`
+	Items       []PaymentItemSummary `json:"items"`
+	// RecurringPaymentID は定期支払いから作成された支払いの場合のルールID
+	RecurringPaymentID *string `json:"recurring_payment_id"`
+	// 実績にした予定の支払いの場合、元の予定日・予定金額と、予定金額との差
+	PlannedDate   *time.Time    `json:"planned_date"`
+	PlannedAmount *domain.Money `json:"planned_amount"`
+	Variance      *domain.Money `json:"variance"`
+	// TransferID はマネープール間の振替のレッグの場合の振替ID
+	TransferID *string `json:"transfer_id"`
+	Version    int64   `json:"version"`
 }
 type MoneyPoolResponse struct {
 	ID          string           `json:"id"`
@@ -88,43 +300,41 @@ type MoneyPoolResponse struct {
 	Description string           `json:"description"`
 	Type        string           `json:"type"`
 	Emoji       string           `json:"emoji"`
+	Currency    string           `json:"currency"`
 	Payments    []PaymentSummary `json:"payments"`
+	// NextCursor は次のページを取得するためのカーソル。次のページがない場合はnull
+	NextCursor *string `json:"next_cursor"`
+	// MoneyProviderID はこのマネープールのお金を置いているマネープロバイダー
+	MoneyProviderID *string `json:"money_provider_id"`
+	// Version はマネープール自体を更新するたびに増える。支払いの変更では変わらない
+	Version int64 `json:"version"`
 }
 
-func (u Usecase) GetMoneyPool(userID string, loginUserID string, moneyPoolID string) (MoneyPoolResponse, error) {
+// GetMoneyPool returns a money pool with the page of its payments that matches the query.
+func (u Usecase) GetMoneyPool(userID string, loginUserID string, moneyPoolID string, query PaymentQuery) (MoneyPoolResponse, error) {
 	log.Printf("ユーザーID: %sのためのMoneyPoolID: %sの取得を試みます。", userID, moneyPoolID)
 
-	// Fetch the money pool by ID
-	moneyPool, err := u.db.GetMoneyPool(moneyPoolID)
+	moneyPool, err := u.getViewableMoneyPool(moneyPoolID, loginUserID)
 	if err != nil {
-		log.Printf("MoneyPoolID: %sの取得に失敗しました。エラー: %v", moneyPoolID, err)
 		return MoneyPoolResponse{}, err
 	}
 
-	// Check access rights
-	hasAccess := false
-	if userID == loginUserID {
-		hasAccess = true
-	} else if loginUserID != "" {
-		shared, err := u.db.IsMoneyPoolSharedWithUser(moneyPoolID, loginUserID)
-		if err != nil {
-			log.Printf("MoneyPoolID: %sの共有状態の確認に失敗しました。エラー: %v", moneyPoolID, err)
-			return MoneyPoolResponse{}, err
-		}
-		hasAccess = shared || moneyPool.Type == domain.PublicTypePublic
-	} else {
-		hasAccess = moneyPool.Type == domain.PublicTypePublic
+	filter, err := query.toFilter([]string{moneyPoolID})
+	if err != nil {
+		return MoneyPoolResponse{}, err
 	}
 
-	if !hasAccess {
-		log.Printf("ユーザーID: %sはMoneyPoolID: %sへのアクセス権がありません。", userID, moneyPoolID)
-		return MoneyPoolResponse{}, fmt.Errorf("unauthorized access: user %s does not have access to the money pool %s", userID, moneyPoolID)
+	// Fetch the page of payments associated with the money pool
+	payments, nextCursor, err := u.getPaymentPage(filter)
+	if err != nil {
+		log.Printf("MoneyPoolID: %sに関連する支払いの取得に失敗しました。エラー: %v", moneyPoolID, err)
+		return MoneyPoolResponse{}, err
 	}
 
-	// Fetch payments associated with the money pool
-	payments, err := u.db.GetPaymentsByMoneyPoolID(moneyPoolID)
+	// Fetch the line items and labels of the payments at once
+	itemsByPayment, labelsByPayment, err := u.getPaymentDetails(payments)
 	if err != nil {
-		log.Printf("MoneyPoolID: %sに関連する支払いの取得に失敗しました。エラー: %v", moneyPoolID, err)
+		log.Printf("MoneyPoolID: %sに関連する支払いの明細とラベルの取得に失敗しました。エラー: %v", moneyPoolID, err)
 		return MoneyPoolResponse{}, err
 	}
 
@@ -138,6 +348,17 @@ func (u Usecase) GetMoneyPool(userID string, loginUserID string, moneyPoolID str
 			Amount:      payment.Amount,
 			Description: payment.Description,
 			IsPlanned:   payment.IsPlanned,
+			StoreID:     payment.StoreID,
+			StoreName:   payment.StoreName,
+			Labels:      toLabelResponses(labelsByPayment[payment.ID]),
+			Items:       toPaymentItemSummaries(itemsByPayment[payment.ID]),
+
+			RecurringPaymentID: payment.RecurringPaymentID,
+			PlannedDate:        payment.PlannedDate,
+			PlannedAmount:      payment.PlannedAmount,
+			Variance:           paymentVariance(payment),
+			TransferID:         payment.TransferID,
+			Version:            payment.Version,
 		})
 	}
 
@@ -148,23 +369,36 @@ func (u Usecase) GetMoneyPool(userID string, loginUserID string, moneyPoolID str
 		Description: moneyPool.Description,
 		Type:        string(moneyPool.Type),
 		Payments:    paymentSummaries,
+		NextCursor:  nextCursor,
 		Emoji:       moneyPool.Emoji,
+		Currency:    domain.NormalizeCurrencyCode(moneyPool.Currency),
+
+		MoneyProviderID: moneyPool.MoneyProviderID,
+		Version:         moneyPool.Version,
 	}, nil
 }
 
 // AddMoneyPool adds a new money pool to the database and logs the process in Japanese.
-func (u Usecase) AddMoneyPool(userID string, name string, description string, publicType string, emoji string) (MoneyPoolResponse, error) {
+func (u Usecase) AddMoneyPool(userID string, name string, description string, publicType string, emoji string, currency string) (MoneyPoolResponse, error) {
 	log.Printf("ユーザーID: %sによる新しいマネープールの作成を開始します。名前: %s", userID, name)
 
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return MoneyPoolResponse{}, err
+	}
+
 	newMoneyPool := domain.MoneyPool{
 		Name:        name,
 		Description: description,
 		Type:        publicType,
 		OwnerID:     userID,
 		Emoji:       emoji,
+		Currency:    currency,
 	}
 
-	createdMoneyPool, err := u.db.NewMoneyPool(newMoneyPool)
+	createdMoneyPool, err := u.db.NewMoneyPool(newMoneyPool, auditCreate(userID, domain.AuditEntityMoneyPool, func(created domain.MoneyPool) (string, *string, any) {
+		return created.ID, &created.ID, moneyPoolSnapshot(created)
+	}))
 	if err != nil {
 		log.Printf("マネープールの作成中にエラーが発生しました: %v", err)
 		return MoneyPoolResponse{}, err
@@ -178,11 +412,15 @@ func (u Usecase) AddMoneyPool(userID string, name string, description string, pu
 		Type:        string(createdMoneyPool.Type),
 		Payments:    []PaymentSummary{}, // No payments right after creation
 		Emoji:       createdMoneyPool.Emoji,
+		Currency:    createdMoneyPool.Currency,
+		Version:     createdMoneyPool.Version,
 	}, nil
 }
 
 // UpdateMoneyPool updates an existing money pool and logs the process in Japanese.
-func (u Usecase) UpdateMoneyPool(userID string, moneyPoolID string, name string, description string, publicationType string, emoji string) (MoneyPoolResponse, error) {
+// If expectedVersion is not nil, the money pool is updated only if it is still at that version.
+// If currency is nil, the currency of the money pool is kept.
+func (u Usecase) UpdateMoneyPool(userID string, moneyPoolID string, name string, description string, publicationType string, emoji string, currency *string, expectedVersion *int64) (MoneyPoolResponse, error) {
 	log.Printf("ユーザーID: %sがマネープールID: %sを更新しようとしています。", userID, moneyPoolID)
 
 	existingMoneyPool, err := u.db.GetMoneyPool(moneyPoolID)
@@ -193,7 +431,18 @@ func (u Usecase) UpdateMoneyPool(userID string, moneyPoolID string, name string,
 
 	if existingMoneyPool.OwnerID != userID {
 		log.Printf("ユーザーID: %sはマネープールID: %sを更新する権限がありません。", userID, moneyPoolID)
-		return MoneyPoolResponse{}, errors.New("更新権限がありません")
+		return MoneyPoolResponse{}, fmt.Errorf("%w: 更新権限がありません", ErrForbidden)
+	}
+
+	if !versionMatches(expectedVersion, existingMoneyPool.Version) {
+		return MoneyPoolResponse{}, u.moneyPoolVersionConflict(userID, moneyPoolID)
+	}
+
+	newCurrency := existingMoneyPool.Currency
+	if currency != nil {
+		if newCurrency, err = normalizeCurrency(*currency); err != nil {
+			return MoneyPoolResponse{}, err
+		}
 	}
 
 	updatedMoneyPool := domain.MoneyPool{
@@ -203,9 +452,20 @@ func (u Usecase) UpdateMoneyPool(userID string, moneyPoolID string, name string,
 		Type:        publicationType,
 		OwnerID:     userID,
 		Emoji:       emoji,
+		Currency:    newCurrency,
+		Version:     existingMoneyPool.Version,
 	}
 
-	err = u.db.UpdateMoneyPool(updatedMoneyPool)
+	after := existingMoneyPool
+	after.Name = name
+	after.Description = description
+	after.Type = publicationType
+	after.Emoji = emoji
+	after.Currency = newCurrency
+	err = u.db.UpdateMoneyPool(updatedMoneyPool, auditChange[domain.MoneyPool](userID, domain.AuditActionUpdate, domain.AuditEntityMoneyPool, moneyPoolID, &moneyPoolID, moneyPoolSnapshot(existingMoneyPool), moneyPoolSnapshot(after)))
+	if errors.Is(err, domain.ErrVersionConflict) {
+		return MoneyPoolResponse{}, u.moneyPoolVersionConflict(userID, moneyPoolID)
+	}
 	if err != nil {
 		log.Printf("マネープールID: %sの更新中にエラーが発生しました: %v", moneyPoolID, err)
 		return MoneyPoolResponse{}, err
@@ -218,9 +478,23 @@ func (u Usecase) UpdateMoneyPool(userID string, moneyPoolID string, name string,
 		Description: updatedMoneyPool.Description,
 		Type:        string(updatedMoneyPool.Type),
 		Emoji:       updatedMoneyPool.Emoji,
+		Currency:    updatedMoneyPool.Currency,
+
+		MoneyProviderID: existingMoneyPool.MoneyProviderID,
+		Version:         updatedMoneyPool.Version + 1,
 	}, nil
 }
 
+// moneyPoolVersionConflict returns a VersionConflictError with the current state of the money pool and the first page of its payments.
+func (u Usecase) moneyPoolVersionConflict(userID string, moneyPoolID string) error {
+	current, err := u.GetMoneyPool(userID, userID, moneyPoolID, PaymentQuery{})
+	if err != nil {
+		return err
+	}
+	log.Printf("マネープールID: %sは他の更新と競合しました。現在のバージョン: %d", moneyPoolID, current.Version)
+	return &VersionConflictError{Version: current.Version, Current: current}
+}
+
 // DeleteMoneyPool deletes an existing money pool and logs the process in Japanese.
 func (u Usecase) DeleteMoneyPool(userID string, moneyPoolID string) error {
 	log.Printf("ユーザーID: %sがマネープールID: %sの削除を試みます。", userID, moneyPoolID)
@@ -233,10 +507,12 @@ func (u Usecase) DeleteMoneyPool(userID string, moneyPoolID string) error {
 
 	if moneyPool.OwnerID != userID {
 		log.Printf("ユーザーID: %sにはマネープールID: %sを削除する権限がありません。", userID, moneyPoolID)
-		return errors.New("削除権限がありません")
+		return fmt.Errorf("%w: 削除権限がありません", ErrForbidden)
 	}
 
-	err = u.db.DeleteMoneyPool(moneyPoolID)
+	after := moneyPool
+	after.IsDeleted = true
+	err = u.db.DeleteMoneyPool(moneyPoolID, auditChange[string](userID, domain.AuditActionDelete, domain.AuditEntityMoneyPool, moneyPoolID, &moneyPoolID, moneyPoolSnapshot(moneyPool), moneyPoolSnapshot(after)))
 	if err != nil {
 		log.Printf("マネープールID: %sの削除中にエラーが発生しました: %v", moneyPoolID, err)
 		return err
@@ -260,22 +536,32 @@ func (u *Usecase) ChangePublicationScope(userID string, moneyPoolID string, user
 
 	// Check if the owner of the MoneyPool is the user making the request.
 	if moneyPool.OwnerID != userID {
-		errMsg := fmt.Sprintf("ユーザーID: %sはマネープールID: %sの所有者ではありません。", userID, moneyPoolID)
-		log.Println(errMsg)
+		log.Printf("ユーザーID: %sはマネープールID: %sの所有者ではありません。", userID, moneyPoolID)
 		// Return an error if the user is not the owner.
-		return errors.New(errMsg)
+		return fmt.Errorf("%w: user %s is not the owner of the MoneyPool %s", ErrForbidden, userID, moneyPoolID)
 	}
 
 	// Check if the MoneyPool's publication type is restricted.
 	if moneyPool.Type != domain.PublicTypeRestricted {
-		errMsg := fmt.Sprintf("マネープールID: %sの公開タイプは制限されていません。", moneyPoolID)
-		log.Println(errMsg)
-		// Return an error if the publication type is not restricted.
-		return errors.New(errMsg)
+		log.Printf("マネープールID: %sの公開タイプは制限されていません。", moneyPoolID)
+		// Only a restricted MoneyPool has a publication scope, so change its type first.
+		return fmt.Errorf("%w: the MoneyPool %s is not restricted", ErrConflict, moneyPoolID)
+	}
+
+	currentScope, err := u.db.GetMoneyPoolPublicationScope(moneyPoolID)
+	if err != nil {
+		log.Printf("マネープールID: %sの公開範囲の取得に失敗しました: %v", moneyPoolID, err)
+		return err
+	}
+	before := publicationScopeAuditSnapshot{MoneyPoolID: moneyPoolID, GroupIDs: []string{}}
+	for _, group := range currentScope {
+		before.GroupIDs = append(before.GroupIDs, group.ID)
 	}
 
 	// If the publication type is restricted, share the MoneyPool with user groups.
-	err = u.db.ShareMoneyPoolWithUserGroups(moneyPoolID, userGroupIDs)
+	after := publicationScopeAuditSnapshot{MoneyPoolID: moneyPoolID, GroupIDs: append([]string{}, userGroupIDs...)}
+	err = u.db.ShareMoneyPoolWithUserGroups(moneyPoolID, userGroupIDs,
+		auditChange[string](userID, domain.AuditActionUpdate, domain.AuditEntityPublicationScope, moneyPoolID, &moneyPoolID, before, after))
 	if err != nil {
 		log.Printf("ユーザーグループにマネープールID: %sの共有に失敗しました: %v", moneyPoolID, err)
 		// Return error if sharing fails.
@@ -1,16 +1,22 @@
 package usecase
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/walnuts1018/openchokin/back/domain"
+	"github.com/walnuts1018/openchokin/back/timeJST"
 )
 
 type MoneyProviderSummary struct {
-	ID      string  `json:"id"`
-	Name    string  `json:"name"`
-	Balance float64 `json:"balance"`
+	ID       string       `json:"id"`
+	Name     string       `json:"name"`
+	Balance  domain.Money `json:"balance"`
+	Currency string       `json:"currency"`
+	// Version は PATCH /moneyproviders/:moneyprovider_id のIf-Matchに使う
+	Version int64 `json:"version"`
 }
 type MoneyProvidersSummaryResponse struct {
 	Providers []MoneyProviderSummary `json:"provider"`
@@ -27,11 +33,13 @@ func (u Usecase) GetMoneyProvidersSummary(userID string) (MoneyProvidersSummaryR
 	var providersSummary []MoneyProviderSummary
 	for _, provider := range moneyProviders {
 		providersSummary = append(providersSummary, MoneyProviderSummary{
-			ID:      provider.ID,
-			Name:    provider.Name,
-			Balance: provider.Balance,
+			ID:       provider.ID,
+			Name:     provider.Name,
+			Balance:  provider.Balance,
+			Currency: domain.NormalizeCurrencyCode(provider.Currency),
+			Version:  provider.Version,
 		})
-		log.Printf("MoneyProvider ID %s: 名前：%s, 残高：%f", provider.ID, provider.Name, provider.Balance)
+		log.Printf("MoneyProvider ID %s: 名前：%s, 残高：%s", provider.ID, provider.Name, provider.Balance)
 	}
 
 	log.Printf("ユーザーID %s のMoneyProvidersの概要取得が完了しました。", userID)
@@ -39,13 +47,18 @@ func (u Usecase) GetMoneyProvidersSummary(userID string) (MoneyProvidersSummaryR
 }
 
 type MoneyProviderResponse struct {
-	ID        string  `json:"id"`
-	Name      string  `json:"name"`
-	CreatorID string  `json:"creator_id"`
-	Balance   float64 `json:"balance"`
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	CreatorID string       `json:"creator_id"`
+	Balance   domain.Money `json:"balance"`
+	Currency  string       `json:"currency"`
+	Version   int64        `json:"version"`
 }
 
-func (u Usecase) UpdateMoneyProvider(userID string, moneyProviderID string, name string, balance float64) (MoneyProviderResponse, error) {
+// UpdateMoneyProvider updates a money provider of the user.
+// If expectedVersion is not nil, the money provider is updated only if it is still at that version.
+// If currency is nil, the currency of the money provider is kept.
+func (u Usecase) UpdateMoneyProvider(userID string, moneyProviderID string, name string, balance domain.Money, currency *string, expectedVersion *int64) (MoneyProviderResponse, error) {
 	log.Printf("MoneyProvider ID %s の更新を開始します。ユーザーID: %s", moneyProviderID, userID)
 
 	existingProvider, err := u.db.GetMoneyProvider(moneyProviderID)
@@ -56,7 +69,18 @@ func (u Usecase) UpdateMoneyProvider(userID string, moneyProviderID string, name
 
 	if existingProvider.CreatorID != userID {
 		log.Printf("ユーザーID %s はMoneyProvider ID %s の更新が許可されていません。", userID, moneyProviderID)
-		return MoneyProviderResponse{}, fmt.Errorf("unauthorized to update money provider: %s", moneyProviderID)
+		return MoneyProviderResponse{}, fmt.Errorf("%w: cannot update money provider %s", ErrForbidden, moneyProviderID)
+	}
+
+	if !versionMatches(expectedVersion, existingProvider.Version) {
+		return MoneyProviderResponse{}, u.moneyProviderVersionConflict(moneyProviderID)
+	}
+
+	newCurrency := existingProvider.Currency
+	if currency != nil {
+		if newCurrency, err = normalizeCurrency(*currency); err != nil {
+			return MoneyProviderResponse{}, err
+		}
 	}
 
 	updatedProvider := domain.MoneyProvider{
@@ -64,9 +88,15 @@ func (u Usecase) UpdateMoneyProvider(userID string, moneyProviderID string, name
 		Name:      name,
 		CreatorID: userID,
 		Balance:   balance,
+		Currency:  newCurrency,
+		Version:   existingProvider.Version,
 	}
 
-	err = u.db.UpdateMoneyProvider(updatedProvider)
+	err = u.db.UpdateMoneyProvider(updatedProvider, auditChange[domain.MoneyProvider](userID, domain.AuditActionUpdate, domain.AuditEntityMoneyProvider, moneyProviderID, nil,
+		moneyProviderSnapshot(existingProvider), moneyProviderSnapshot(updatedProvider)))
+	if errors.Is(err, domain.ErrVersionConflict) {
+		return MoneyProviderResponse{}, u.moneyProviderVersionConflict(moneyProviderID)
+	}
 	if err != nil {
 		log.Printf("MoneyProvider ID %s の更新中にエラーが発生しました。エラー: %v", moneyProviderID, err)
 		return MoneyProviderResponse{}, err
@@ -78,19 +108,65 @@ func (u Usecase) UpdateMoneyProvider(userID string, moneyProviderID string, name
 		Name:      updatedProvider.Name,
 		CreatorID: updatedProvider.CreatorID,
 		Balance:   updatedProvider.Balance,
+		Currency:  updatedProvider.Currency,
+		Version:   updatedProvider.Version + 1,
 	}, nil
 }
 
-func (u Usecase) AddMoneyProvider(userID string, name string, balance float64) (MoneyProviderResponse, error) {
+// moneyProviderVersionConflict returns a VersionConflictError with the current state of the money provider.
+func (u Usecase) moneyProviderVersionConflict(moneyProviderID string) error {
+	provider, err := u.db.GetMoneyProvider(moneyProviderID)
+	if err != nil {
+		log.Printf("MoneyProvider ID %s のデータ取得中にエラーが発生しました。エラー: %v", moneyProviderID, err)
+		return err
+	}
+	log.Printf("MoneyProvider ID %s は他の更新と競合しました。現在のバージョン: %d", moneyProviderID, provider.Version)
+	return &VersionConflictError{Version: provider.Version, Current: toMoneyProviderResponse(provider)}
+}
+
+func toMoneyProviderResponse(provider domain.MoneyProvider) MoneyProviderResponse {
+	return MoneyProviderResponse{
+		ID:        provider.ID,
+		Name:      provider.Name,
+		CreatorID: provider.CreatorID,
+		Balance:   provider.Balance,
+		Currency:  domain.NormalizeCurrencyCode(provider.Currency),
+		Version:   provider.Version,
+	}
+}
+
+// GetMoneyProvider returns a money provider of the user, with the version to send back in If-Match.
+func (u Usecase) GetMoneyProvider(userID string, moneyProviderID string) (MoneyProviderResponse, error) {
+	provider, err := u.db.GetMoneyProvider(moneyProviderID)
+	if err != nil {
+		log.Printf("MoneyProvider ID %s のデータ取得中にエラーが発生しました。エラー: %v", moneyProviderID, err)
+		return MoneyProviderResponse{}, err
+	}
+	if provider.CreatorID != userID {
+		log.Printf("ユーザーID %s はMoneyProvider ID %s の取得が許可されていません。", userID, moneyProviderID)
+		return MoneyProviderResponse{}, fmt.Errorf("%w: cannot get money provider %s", ErrForbidden, moneyProviderID)
+	}
+	return toMoneyProviderResponse(provider), nil
+}
+
+func (u Usecase) AddMoneyProvider(userID string, name string, balance domain.Money, currency string) (MoneyProviderResponse, error) {
 	log.Printf("新しいMoneyProviderの追加を開始します。ユーザーID: %s", userID)
 
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return MoneyProviderResponse{}, err
+	}
+
 	newProvider := domain.MoneyProvider{
 		Name:      name,
 		CreatorID: userID,
 		Balance:   balance,
+		Currency:  currency,
 	}
 
-	createdProvider, err := u.db.NewMoneyProvider(newProvider)
+	createdProvider, err := u.db.NewMoneyProvider(newProvider, auditCreate(userID, domain.AuditEntityMoneyProvider, func(created domain.MoneyProvider) (string, *string, any) {
+		return created.ID, nil, moneyProviderSnapshot(created)
+	}))
 	if err != nil {
 		log.Printf("新しいMoneyProviderの作成中にエラーが発生しました。エラー: %v", err)
 		return MoneyProviderResponse{}, err
@@ -102,6 +178,8 @@ func (u Usecase) AddMoneyProvider(userID string, name string, balance float64) (
 		Name:      createdProvider.Name,
 		CreatorID: createdProvider.CreatorID,
 		Balance:   createdProvider.Balance,
+		Currency:  createdProvider.Currency,
+		Version:   createdProvider.Version,
 	}, nil
 }
 
@@ -116,10 +194,10 @@ func (u Usecase) DeleteMoneyProvider(userID string, moneyProviderID string) erro
 
 	if provider.CreatorID != userID {
 		log.Printf("ユーザーID %s はMoneyProvider ID %s の削除が許可されていません。", userID, moneyProviderID)
-		return fmt.Errorf("unauthorized to delete money provider: %s", moneyProviderID)
+		return fmt.Errorf("%w: cannot delete money provider %s", ErrForbidden, moneyProviderID)
 	}
 
-	err = u.db.DeleteMoneyProvider(moneyProviderID)
+	err = u.db.DeleteMoneyProvider(moneyProviderID, auditChange[string](userID, domain.AuditActionDelete, domain.AuditEntityMoneyProvider, moneyProviderID, nil, moneyProviderSnapshot(provider), nil))
 	if err != nil {
 		log.Printf("MoneyProvider ID %s の削除中にエラーが発生しました。エラー: %v", moneyProviderID, err)
 		return err
@@ -128,3 +206,139 @@ func (u Usecase) DeleteMoneyProvider(userID string, moneyProviderID string) erro
 	log.Printf("MoneyProvider ID %s の削除が完了しました。", moneyProviderID)
 	return nil
 }
+
+type BalanceSnapshot struct {
+	Balance    domain.Money `json:"balance"`
+	RecordedAt time.Time    `json:"recorded_at"`
+}
+
+type MoneyProviderBalanceHistoryResponse struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
+	// OpeningBalance は期間の最初の時点の残高
+	OpeningBalance domain.Money      `json:"opening_balance"`
+	Snapshots      []BalanceSnapshot `json:"snapshots"`
+}
+
+// endOfDayJST returns the start of the day after date in JST, i.e. the moment up to which a date is counted.
+func endOfDayJST(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day()+1, 0, 0, 0, 0, timeJST.JST)
+}
+
+// GetMoneyProviderBalanceHistory retrieves how the balance of a money provider changed between the dates from and to (inclusive).
+func (u Usecase) GetMoneyProviderBalanceHistory(userID string, moneyProviderID string, from time.Time, to time.Time) (MoneyProviderBalanceHistoryResponse, error) {
+	log.Printf("MoneyProvider ID %s の残高履歴の取得を開始します。ユーザーID: %s", moneyProviderID, userID)
+
+	provider, err := u.db.GetMoneyProvider(moneyProviderID)
+	if err != nil {
+		log.Printf("MoneyProvider ID %s のデータ取得中にエラーが発生しました。エラー: %v", moneyProviderID, err)
+		return MoneyProviderBalanceHistoryResponse{}, err
+	}
+	if provider.CreatorID != userID {
+		log.Printf("ユーザーID %s はMoneyProvider ID %s の残高履歴の取得が許可されていません。", userID, moneyProviderID)
+		return MoneyProviderBalanceHistoryResponse{}, fmt.Errorf("%w: cannot get money provider %s", ErrForbidden, moneyProviderID)
+	}
+
+	start := endOfDayJST(from).AddDate(0, 0, -1)
+	openingBalance, err := u.db.GetMoneyProviderBalanceAt(moneyProviderID, start)
+	if err != nil {
+		log.Printf("MoneyProvider ID %s の期首残高の取得中にエラーが発生しました。エラー: %v", moneyProviderID, err)
+		return MoneyProviderBalanceHistoryResponse{}, err
+	}
+	snapshots, err := u.db.GetMoneyProviderBalanceHistory(moneyProviderID, start, endOfDayJST(to))
+	if err != nil {
+		log.Printf("MoneyProvider ID %s の残高履歴の取得中にエラーが発生しました。エラー: %v", moneyProviderID, err)
+		return MoneyProviderBalanceHistoryResponse{}, err
+	}
+
+	response := MoneyProviderBalanceHistoryResponse{
+		ID:             provider.ID,
+		Name:           provider.Name,
+		Currency:       domain.NormalizeCurrencyCode(provider.Currency),
+		OpeningBalance: openingBalance,
+		Snapshots:      make([]BalanceSnapshot, 0, len(snapshots)),
+	}
+	for _, snapshot := range snapshots {
+		response.Snapshots = append(response.Snapshots, BalanceSnapshot{
+			Balance:    snapshot.Balance,
+			RecordedAt: snapshot.RecordedAt.In(timeJST.JST),
+		})
+	}
+	return response, nil
+}
+
+type LinkedMoneyPool struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Emoji    string `json:"emoji"`
+	Currency string `json:"currency"`
+}
+
+type MoneyProviderDetail struct {
+	ID       string       `json:"id"`
+	Name     string       `json:"name"`
+	Balance  domain.Money `json:"balance"`
+	Currency string       `json:"currency"`
+	Version  int64        `json:"version"`
+	// History は直近1年間の残高の推移
+	History MoneyProviderBalanceHistoryResponse `json:"history"`
+	// LinkedPools はこのMoneyProviderに割り当てられたマネープール
+	LinkedPools []LinkedMoneyPool `json:"linked_pools"`
+}
+
+type MoneyProvidersDetailResponse struct {
+	Providers []MoneyProviderDetail `json:"provider"`
+}
+
+// GetMoneyProvidersDetail retrieves the money providers of the user with their balance history of the last year
+// and the money pools allocated to them.
+func (u Usecase) GetMoneyProvidersDetail(userID string) (MoneyProvidersDetailResponse, error) {
+	log.Printf("ユーザーID %s のMoneyProvidersの詳細を取得を開始します。", userID)
+	moneyProviders, err := u.db.GetMoneyProvidersByUserID(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s のMoneyProvidersの取得中にエラーが発生しました: %v", userID, err)
+		return MoneyProvidersDetailResponse{}, err
+	}
+	moneyPools, err := u.db.GetMoneyPoolsByUserID(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s のMoneyPoolsの取得中にエラーが発生しました: %v", userID, err)
+		return MoneyProvidersDetailResponse{}, err
+	}
+
+	to := today()
+	from := to.AddDate(-1, 0, 0)
+	response := MoneyProvidersDetailResponse{Providers: make([]MoneyProviderDetail, 0, len(moneyProviders))}
+	for _, provider := range moneyProviders {
+		history, err := u.GetMoneyProviderBalanceHistory(userID, provider.ID, from, to)
+		if err != nil {
+			return MoneyProvidersDetailResponse{}, err
+		}
+
+		linkedPools := []LinkedMoneyPool{}
+		for _, pool := range moneyPools {
+			if pool.MoneyProviderID == nil || *pool.MoneyProviderID != provider.ID {
+				continue
+			}
+			linkedPools = append(linkedPools, LinkedMoneyPool{
+				ID:       pool.ID,
+				Name:     pool.Name,
+				Emoji:    pool.Emoji,
+				Currency: domain.NormalizeCurrencyCode(pool.Currency),
+			})
+		}
+
+		response.Providers = append(response.Providers, MoneyProviderDetail{
+			ID:          provider.ID,
+			Name:        provider.Name,
+			Balance:     provider.Balance,
+			Currency:    domain.NormalizeCurrencyCode(provider.Currency),
+			Version:     provider.Version,
+			History:     history,
+			LinkedPools: linkedPools,
+		})
+	}
+
+	log.Printf("ユーザーID %s のMoneyProvidersの詳細取得が完了しました。", userID)
+	return response, nil
+}
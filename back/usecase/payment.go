@@ -1,6 +1,7 @@
 package usecase
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -8,8 +9,15 @@ import (
 	"github.com/walnuts1018/openchokin/back/domain"
 )
 
+var (
+	// ErrPaymentNotPlanned は予定ではない支払いを実績にしようとした場合に返されます。
+	ErrPaymentNotPlanned = fmt.Errorf("%w: payment is not planned", ErrConflict)
+	// ErrTransferPayment は振替のレッグを支払いとして個別に変更しようとした場合に返されます。
+	ErrTransferPayment = fmt.Errorf("%w: payment is a leg of a transfer", ErrConflict)
+)
+
 // AddNewPayment adds a new payment to the specified MoneyPool for a given user.
-func (u *Usecase) AddNewPayment(userID string, moneyPoolID string, Date time.Time, title string, amount float64, description string, isPlanned bool) error {
+func (u *Usecase) AddNewPayment(userID string, moneyPoolID string, Date time.Time, title string, amount domain.Money, description string, isPlanned bool, storeID *string, labelIDs []string, items []PaymentItemInput) error {
 	log.Printf("ユーザーID %s のための新規支払い追加を開始します。マネープールID: %s, タイトル: %s", userID, moneyPoolID, title)
 	// Retrieve the MoneyPool to ensure it exists and belongs to the user
 	moneyPool, err := u.db.GetMoneyPool(moneyPoolID)
@@ -19,7 +27,26 @@ func (u *Usecase) AddNewPayment(userID string, moneyPoolID string, Date time.Tim
 	}
 	if moneyPool.OwnerID != userID {
 		log.Printf("エラー: ユーザーID %s はマネープールID %s の支払い追加に対して権限がありません。", userID, moneyPoolID)
-		return fmt.Errorf("error: user unauthorized")
+		return fmt.Errorf("%w: user %s is not the owner of the MoneyPool %s", ErrForbidden, userID, moneyPoolID)
+	}
+
+	// Check that the store can be used by the user
+	_, err = u.resolvePaymentStore(userID, storeID)
+	if err != nil {
+		return err
+	}
+
+	// Check that the labels can be used by the user
+	_, err = u.resolvePaymentLabels(userID, labelIDs)
+	if err != nil {
+		return err
+	}
+
+	// Resolve the line items and check that they add up to the amount
+	paymentItems, err := u.resolvePaymentItems(userID, items, amount)
+	if err != nil {
+		log.Printf("支払いの明細が不正です。マネープールID: %s, タイトル: %s, エラー: %v", moneyPoolID, title, err)
+		return err
 	}
 
 	// Create the Payment entity
@@ -31,11 +58,15 @@ func (u *Usecase) AddNewPayment(userID string, moneyPoolID string, Date time.Tim
 		Amount:      amount,
 		Description: description,
 		IsPlanned:   isPlanned,
-		// StoreID can be nil or set based on additional logic if required
+		StoreID:     storeID,
+		Items:       paymentItems,
+		LabelIDs:    labelIDs,
 	}
 
 	// Persist the new payment
-	_, err = u.db.NewPayment(payment)
+	_, err = u.db.NewPayment(payment, auditCreate(userID, domain.AuditEntityPayment, func(created domain.Payment) (string, *string, any) {
+		return created.ID, &created.MoneyPoolID, paymentSnapshot(created)
+	}))
 	if err != nil {
 		log.Printf("新規支払いの保存に失敗しました。マネープールID: %s, タイトル: %s, エラー: %v", moneyPoolID, title, err)
 		return err
@@ -48,25 +79,43 @@ type DailyPaymentItem struct {
 	ID          string
 	MoneyPoolID string
 	Title       string
-	Amount      float64
+	Amount      domain.Money
 	IsPlanned   bool
+	StoreID     *string
+	StoreName   *string
+	Labels      []LabelResponse
+
+	RecurringPaymentID *string
+	// TransferID はマネープール間の振替のレッグの場合の振替ID
+	TransferID *string
 }
 type DailyPayments struct {
 	Payments []DailyPaymentItem
+	// Total はその日の支払いを基準通貨に換算した合計。振替は含まない
+	Total domain.Money
 }
 type MonthlyPaymentsResponse struct {
 	DailyPayments map[int]DailyPayments
+	// BaseCurrency は合計の通貨。支払いはそれぞれの日付のレートで換算する
+	BaseCurrency string
+	// Total はその月の支払いを基準通貨に換算した合計。振替は含まない
+	// ページングしても、絞り込みに一致するその月のすべての支払いの合計になる。日ごとの合計も同じ
+	Total domain.Money
+	// NextCursor は次のページを取得するためのカーソル。次のページがない場合はnil
+	NextCursor *string
 }
 
-// GetMonthlyPayments retrieves payments for a given user and month.
-func (u *Usecase) GetMonthlyPayments(userID string, month time.Time) (MonthlyPaymentsResponse, error) {
+// GetMonthlyPayments retrieves the payments of the user's money pools in the given month that match the query.
+// The month is applied as the date range of the query, so query.From and query.To are ignored.
+func (u *Usecase) GetMonthlyPayments(userID string, month time.Time, query PaymentQuery) (MonthlyPaymentsResponse, error) {
 	log.Printf("ユーザーID %s の月間支払い情報取得を開始します。対象月: %s", userID, month.Format("2006-01"))
 	response := MonthlyPaymentsResponse{
 		DailyPayments: make(map[int]DailyPayments),
 	}
 
-	daysInMonth := time.Date(month.Year(), month.Month()+1, 0, 0, 0, 0, 0, month.Location()).Day()
-	for day := 1; day <= daysInMonth; day++ {
+	firstDay := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	lastDay := firstDay.AddDate(0, 1, -1)
+	for day := 1; day <= lastDay.Day(); day++ {
 		response.DailyPayments[day] = DailyPayments{Payments: []DailyPaymentItem{}}
 	}
 
@@ -75,30 +124,88 @@ func (u *Usecase) GetMonthlyPayments(userID string, month time.Time) (MonthlyPay
 		log.Printf("ユーザーID %s のマネープール取得に失敗しました。エラー: %v", userID, err)
 		return MonthlyPaymentsResponse{}, err
 	}
-
+	moneyPoolIDs := make([]string, 0, len(moneyPools))
+	poolCurrencies := map[string]string{}
 	for _, pool := range moneyPools {
-		payments, err := u.db.GetPaymentsByMoneyPoolID(pool.ID)
+		moneyPoolIDs = append(moneyPoolIDs, pool.ID)
+		poolCurrencies[pool.ID] = domain.NormalizeCurrencyCode(pool.Currency)
+	}
+
+	// マネープールごとに通貨が違うので、合計は基準通貨に換算する
+	response.BaseCurrency, err = u.resolveBaseCurrency(userID, "")
+	if err != nil {
+		return MonthlyPaymentsResponse{}, err
+	}
+	converter, err := u.newCurrencyConverter(userID)
+	if err != nil {
+		return MonthlyPaymentsResponse{}, err
+	}
+
+	query.From = &firstDay
+	query.To = &lastDay
+	filter, err := query.toFilter(moneyPoolIDs)
+	if err != nil {
+		return MonthlyPaymentsResponse{}, err
+	}
+
+	payments, nextCursor, err := u.getPaymentPage(filter)
+	if err != nil {
+		log.Printf("ユーザーID %s の支払い情報取得に失敗しました。エラー: %v", userID, err)
+		return MonthlyPaymentsResponse{}, err
+	}
+	paymentIDs := make([]string, 0, len(payments))
+	for _, payment := range payments {
+		paymentIDs = append(paymentIDs, payment.ID)
+	}
+	labels, err := u.db.GetPaymentLabelsByPaymentIDs(paymentIDs)
+	if err != nil {
+		log.Printf("ユーザーID %s のラベル情報取得に失敗しました。エラー: %v", userID, err)
+		return MonthlyPaymentsResponse{}, err
+	}
+	labelsByPayment := groupPaymentLabels(labels)
+
+	for _, payment := range payments {
+		day := payment.Date.Day()
+
+		item := DailyPaymentItem{
+			ID:          payment.ID,
+			MoneyPoolID: payment.MoneyPoolID,
+			Title:       payment.Title,
+			Amount:      payment.Amount,
+			IsPlanned:   payment.IsPlanned,
+			StoreID:     payment.StoreID,
+			StoreName:   payment.StoreName,
+			Labels:      toLabelResponses(labelsByPayment[payment.ID]),
+
+			RecurringPaymentID: payment.RecurringPaymentID,
+			TransferID:         payment.TransferID,
+		}
+
+		dailyPayments := response.DailyPayments[day]
+		dailyPayments.Payments = append(dailyPayments.Payments, item)
+		response.DailyPayments[day] = dailyPayments
+	}
+	response.NextCursor = nextCursor
+
+	// 合計はページではなく、絞り込みに一致する月のすべての支払いから計算する。振替はお金を移しただけなので含めない
+	totals, err := u.db.GetPaymentDailyTotals(filter)
+	if err != nil {
+		log.Printf("ユーザーID %s の支払いの合計の取得に失敗しました。エラー: %v", userID, err)
+		return MonthlyPaymentsResponse{}, err
+	}
+	for _, total := range totals {
+		converted, err := converter.Convert(total.Amount, poolCurrencies[total.MoneyPoolID], response.BaseCurrency, total.Date)
 		if err != nil {
-			log.Printf("マネープールID %s の支払い情報取得に失敗しました。エラー: %v", pool.ID, err)
+			log.Printf("マネープールID %s の %s の合計の換算に失敗しました。エラー: %v", total.MoneyPoolID, total.Date.Format("2006-01-02"), err)
 			return MonthlyPaymentsResponse{}, err
 		}
-
-		for _, payment := range payments {
-			if payment.Date.Month() == month.Month() && payment.Date.Year() == month.Year() {
-				day := payment.Date.Day()
-
-				item := DailyPaymentItem{
-					ID:          payment.ID,
-					MoneyPoolID: payment.MoneyPoolID,
-					Title:       payment.Title,
-					Amount:      payment.Amount,
-					IsPlanned:   payment.IsPlanned,
-				}
-
-				dailyPayments := response.DailyPayments[day]
-				dailyPayments.Payments = append(dailyPayments.Payments, item)
-				response.DailyPayments[day] = dailyPayments
-			}
+		dailyPayments := response.DailyPayments[total.Date.Day()]
+		if dailyPayments.Total, err = dailyPayments.Total.Add(converted); err != nil {
+			return MonthlyPaymentsResponse{}, err
+		}
+		response.DailyPayments[total.Date.Day()] = dailyPayments
+		if response.Total, err = response.Total.Add(converted); err != nil {
+			return MonthlyPaymentsResponse{}, err
 		}
 	}
 
@@ -111,13 +218,91 @@ type PaymentResponse struct {
 	MoneyPoolID string
 	Date        time.Time
 	Title       string
-	Amount      float64
+	Amount      domain.Money
 	Description string
 	IsPlanned   bool
+	StoreID     *string
+	StoreName   *string
+	Labels      []LabelResponse
+	Items       []PaymentItemSummary
+
+	RecurringPaymentID *string
+	// 実績にした予定の支払いの場合、元の予定日・予定金額と、予定金額との差 (Amount - PlannedAmount)
+	PlannedDate   *time.Time
+	PlannedAmount *domain.Money
+	Variance      *domain.Money
+	TransferID    *string
+	// Version は更新のたびに増える。ETag / If-Match に使う
+	Version int64
+}
+
+// GetPayment returns a payment of a money pool the login user can view.
+func (u *Usecase) GetPayment(loginUserID string, moneyPoolID string, paymentID string) (PaymentResponse, error) {
+	log.Printf("支払いID %s の取得を開始します。ユーザーID: %s", paymentID, loginUserID)
+
+	if _, err := u.getViewableMoneyPool(moneyPoolID, loginUserID); err != nil {
+		return PaymentResponse{}, err
+	}
+
+	payment, err := u.db.GetPayment(paymentID)
+	if err != nil {
+		log.Printf("支払いの詳細取得に失敗しました。支払いID: %s, エラー: %v", paymentID, err)
+		return PaymentResponse{}, err
+	}
+	if payment.MoneyPoolID != moneyPoolID {
+		log.Printf("支払いID %s はマネープールID %s の支払いではありません。", paymentID, moneyPoolID)
+		return PaymentResponse{}, fmt.Errorf("%w: payment %s in the money pool %s", ErrNotFound, paymentID, moneyPoolID)
+	}
+
+	labels, err := u.db.GetPaymentLabels(paymentID)
+	if err != nil {
+		log.Printf("支払いのラベル取得に失敗しました。支払いID: %s, エラー: %v", paymentID, err)
+		return PaymentResponse{}, err
+	}
+	items, err := u.db.GetPaymentItems(paymentID)
+	if err != nil {
+		log.Printf("支払いの明細取得に失敗しました。支払いID: %s, エラー: %v", paymentID, err)
+		return PaymentResponse{}, err
+	}
+
+	return PaymentResponse{
+		ID:          payment.ID,
+		MoneyPoolID: payment.MoneyPoolID,
+		Date:        payment.Date,
+		Title:       payment.Title,
+		Amount:      payment.Amount,
+		Description: payment.Description,
+		IsPlanned:   payment.IsPlanned,
+		StoreID:     payment.StoreID,
+		StoreName:   payment.StoreName,
+		Labels:      toLabelResponses(labels),
+		Items:       toPaymentItemSummaries(items),
+
+		RecurringPaymentID: payment.RecurringPaymentID,
+		PlannedDate:        payment.PlannedDate,
+		PlannedAmount:      payment.PlannedAmount,
+		Variance:           paymentVariance(payment),
+		TransferID:         payment.TransferID,
+		Version:            payment.Version,
+	}, nil
+}
+
+// paymentVersionConflict returns a VersionConflictError with the current state of the payment.
+func (u *Usecase) paymentVersionConflict(userID string, moneyPoolID string, paymentID string) error {
+	current, err := u.GetPayment(userID, moneyPoolID, paymentID)
+	if err != nil {
+		return err
+	}
+	log.Printf("支払いID %s は他の更新と競合しました。現在のバージョン: %d", paymentID, current.Version)
+	return &VersionConflictError{Version: current.Version, Current: current}
 }
 
 // UpdatePayment updates a payment's details.
-func (u *Usecase) UpdatePayment(userID string, moneyPoolID string, paymentID string, date time.Time, title string, amount float64, description string, isPlanned bool) (PaymentResponse, error) {
+// If items is nil, the existing line items are kept and checked against the new amount.
+// If labelIDs is nil, the existing labels are kept.
+// If keepStore is true, the existing store is kept and storeID is ignored; otherwise a nil storeID removes the store.
+// If expectedVersion is not nil, the payment is updated only if it is still at that version.
+func (u *Usecase) UpdatePayment(userID string, moneyPoolID string, paymentID string, date time.Time, title string, amount domain.Money, description string, isPlanned bool, storeID *string, keepStore bool, labelIDs []string, items []PaymentItemInput, expectedVersion *int64) (PaymentResponse, error) {
 	log.Printf("支払いID %s の更新処理を開始します。ユーザーID: %s", paymentID, userID)
 
 	// Get the payment details from the DB.
@@ -137,22 +322,90 @@ func (u *Usecase) UpdatePayment(userID string, moneyPoolID string, paymentID str
 	// Check if the user is the owner of the MoneyPool.
 	if moneyPool.OwnerID != userID || moneyPool.ID != moneyPoolID {
 		log.Printf("不正アクセス：ユーザーID %s はマネープールID %s の所有者ではありません。", userID, moneyPoolID)
-		return PaymentResponse{}, fmt.Errorf("unauthorized: user %s is not the owner of the MoneyPool %s", userID, moneyPoolID)
+		return PaymentResponse{}, fmt.Errorf("%w: user %s is not the owner of the MoneyPool %s", ErrForbidden, userID, moneyPoolID)
+	}
+
+	// Legs of a transfer are changed through the transfer so that both sides stay balanced.
+	if payment.TransferID != nil {
+		log.Printf("支払いID %s は振替ID %s のレッグのため、個別に変更できません。", paymentID, *payment.TransferID)
+		return PaymentResponse{}, fmt.Errorf("%w: use the transfer %s instead", ErrTransferPayment, *payment.TransferID)
+	}
+
+	if !versionMatches(expectedVersion, payment.Version) {
+		return PaymentResponse{}, u.paymentVersionConflict(userID, moneyPoolID, paymentID)
+	}
+
+	// Check that the store can be used by the user, or keep the existing one if none was given.
+	storeName := payment.StoreName
+	if keepStore {
+		storeID = payment.StoreID
+	} else {
+		storeName, err = u.resolvePaymentStore(userID, storeID)
+		if err != nil {
+			return PaymentResponse{}, err
+		}
+	}
+
+	// Check the labels, or keep the existing ones if none were given.
+	labels, err := u.resolvePaymentLabels(userID, labelIDs)
+	if err != nil {
+		return PaymentResponse{}, err
+	}
+	if labelIDs == nil {
+		currentLabels, err := u.db.GetPaymentLabels(paymentID)
+		if err != nil {
+			log.Printf("支払いのラベル取得に失敗しました。支払いID: %s, エラー: %v", paymentID, err)
+			return PaymentResponse{}, err
+		}
+		labels = toLabelResponses(currentLabels)
+	}
+
+	// Resolve the line items, or keep the existing ones if none were given.
+	paymentItems, err := u.resolvePaymentItems(userID, items, amount)
+	if err != nil {
+		log.Printf("支払いの明細が不正です。支払いID: %s, エラー: %v", paymentID, err)
+		return PaymentResponse{}, err
+	}
+	currentItems := paymentItems
+	if items == nil {
+		currentItems, err = u.db.GetPaymentItems(paymentID)
+		if err != nil {
+			log.Printf("支払いの明細取得に失敗しました。支払いID: %s, エラー: %v", paymentID, err)
+			return PaymentResponse{}, err
+		}
+		if err := checkPaymentItemsTotal(currentItems, amount); err != nil {
+			log.Printf("既存の明細と金額が一致しません。支払いID: %s, エラー: %v", paymentID, err)
+			return PaymentResponse{}, err
+		}
 	}
 
 	// Update the payment details.
+	before := paymentSnapshot(payment)
 	payment.Date = date
 	payment.Title = title
 	payment.Amount = amount
 	payment.Description = description
 	payment.IsPlanned = isPlanned
+	payment.StoreID = storeID
+	payment.StoreName = storeName
+	payment.Items = paymentItems
+	payment.LabelIDs = labelIDs
+	if isPlanned {
+		// 予定に戻した場合は実績としての記録を消す
+		payment.PlannedDate = nil
+		payment.PlannedAmount = nil
+	}
 
 	// Persist the updated payment in the DB.
-	err = u.db.UpdatePayment(payment)
+	err = u.db.UpdatePayment(payment, auditChange[domain.Payment](userID, domain.AuditActionUpdate, domain.AuditEntityPayment, paymentID, &payment.MoneyPoolID, before, paymentSnapshot(payment)))
+	if errors.Is(err, domain.ErrVersionConflict) {
+		return PaymentResponse{}, u.paymentVersionConflict(userID, moneyPoolID, paymentID)
+	}
 	if err != nil {
 		log.Printf("支払いの更新に失敗しました。支払いID: %s, エラー: %v", paymentID, err)
 		return PaymentResponse{}, err
 	}
+	payment.Version++
 
 	log.Printf("支払いID %s の更新が完了しました。ユーザーID: %s", paymentID, userID)
 	// Return the updated payment as a response.
@@ -164,6 +417,17 @@ func (u *Usecase) UpdatePayment(userID string, moneyPoolID string, paymentID str
 		Amount:      payment.Amount,
 		Description: payment.Description,
 		IsPlanned:   payment.IsPlanned,
+		StoreID:     payment.StoreID,
+		StoreName:   payment.StoreName,
+		Labels:      labels,
+		Items:       toPaymentItemSummaries(currentItems),
+
+		RecurringPaymentID: payment.RecurringPaymentID,
+		PlannedDate:        payment.PlannedDate,
+		PlannedAmount:      payment.PlannedAmount,
+		Variance:           paymentVariance(payment),
+		TransferID:         payment.TransferID,
+		Version:            payment.Version,
 	}, nil
 }
 
@@ -188,11 +452,17 @@ func (u *Usecase) DeletePayment(userID string, paymentID string) error {
 	// Check if the user is the owner of the MoneyPool.
 	if moneyPool.OwnerID != userID {
 		log.Printf("不正アクセス：ユーザーID %s はマネープールID %s の所有者ではありません。", userID, payment.MoneyPoolID)
-		return fmt.Errorf("unauthorized: user %s is not the owner of the MoneyPool %s", userID, payment.MoneyPoolID)
+		return fmt.Errorf("%w: user %s is not the owner of the MoneyPool %s", ErrForbidden, userID, payment.MoneyPoolID)
+	}
+
+	// Legs of a transfer are deleted through the transfer so that both sides stay balanced.
+	if payment.TransferID != nil {
+		log.Printf("支払いID %s は振替ID %s のレッグのため、個別に削除できません。", paymentID, *payment.TransferID)
+		return fmt.Errorf("%w: use the transfer %s instead", ErrTransferPayment, *payment.TransferID)
 	}
 
 	// Use the DB interface method to delete the payment.
-	err = u.db.DeletePayment(paymentID)
+	err = u.db.DeletePayment(paymentID, auditChange[string](userID, domain.AuditActionDelete, domain.AuditEntityPayment, paymentID, &payment.MoneyPoolID, paymentSnapshot(payment), nil))
 	if err != nil {
 		log.Printf("支払いの削除に失敗しました。支払いID: %s, エラー: %v", paymentID, err)
 		return err
@@ -201,3 +471,189 @@ func (u *Usecase) DeletePayment(userID string, paymentID string) error {
 	log.Printf("支払いID %s の削除が完了しました。ユーザーID: %s", paymentID, userID)
 	return nil
 }
+
+// paymentVariance returns how much the actual amount differs from the planned amount of a realized payment.
+// It returns nil if the payment was not planned, or if the difference is too large to be represented.
+func paymentVariance(payment domain.Payment) *domain.Money {
+	if payment.PlannedAmount == nil {
+		return nil
+	}
+	variance, err := payment.Amount.Sub(*payment.PlannedAmount)
+	if err != nil {
+		log.Printf("支払いID %s の予定との差額を計算できません。エラー: %v", payment.ID, err)
+		return nil
+	}
+	return &variance
+}
+
+// RealizePayment turns a planned payment into an actual one that happened on date with amount.
+// The planned date and amount are kept for comparing the forecast with the result.
+// If amount is nil the planned amount is used. If items is nil the existing line items are kept.
+// If expectedVersion is not nil, the payment is realized only if it is still at that version.
+func (u *Usecase) RealizePayment(userID string, moneyPoolID string, paymentID string, date time.Time, amount *domain.Money, items []PaymentItemInput, expectedVersion *int64) (PaymentResponse, error) {
+	log.Printf("支払いID %s の実績化を開始します。ユーザーID: %s", paymentID, userID)
+
+	payment, err := u.db.GetPayment(paymentID)
+	if err != nil {
+		log.Printf("支払いの詳細取得に失敗しました。支払いID: %s, エラー: %v", paymentID, err)
+		return PaymentResponse{}, err
+	}
+
+	moneyPool, err := u.db.GetMoneyPool(payment.MoneyPoolID)
+	if err != nil {
+		log.Printf("マネープールの詳細取得に失敗しました。支払いID: %s, エラー: %v", paymentID, err)
+		return PaymentResponse{}, err
+	}
+	if moneyPool.OwnerID != userID || moneyPool.ID != moneyPoolID {
+		log.Printf("不正アクセス：ユーザーID %s はマネープールID %s の所有者ではありません。", userID, moneyPoolID)
+		return PaymentResponse{}, fmt.Errorf("%w: user %s is not the owner of the MoneyPool %s", ErrForbidden, userID, moneyPoolID)
+	}
+
+	// Legs of a transfer are changed through the transfer so that both sides stay balanced.
+	if payment.TransferID != nil {
+		log.Printf("支払いID %s は振替ID %s のレッグのため、個別に変更できません。", paymentID, *payment.TransferID)
+		return PaymentResponse{}, fmt.Errorf("%w: use the transfer %s instead", ErrTransferPayment, *payment.TransferID)
+	}
+
+	if !versionMatches(expectedVersion, payment.Version) {
+		return PaymentResponse{}, u.paymentVersionConflict(userID, moneyPoolID, paymentID)
+	}
+
+	if !payment.IsPlanned {
+		log.Printf("支払いID %s は予定の支払いではありません。", paymentID)
+		return PaymentResponse{}, fmt.Errorf("%w: %s", ErrPaymentNotPlanned, paymentID)
+	}
+
+	actualAmount := payment.Amount
+	if amount != nil {
+		actualAmount = *amount
+	}
+
+	// Resolve the line items, or keep the existing ones if they still add up to the actual amount.
+	paymentItems, err := u.resolvePaymentItems(userID, items, actualAmount)
+	if err != nil {
+		log.Printf("支払いの明細が不正です。支払いID: %s, エラー: %v", paymentID, err)
+		return PaymentResponse{}, err
+	}
+	currentItems := paymentItems
+	if items == nil {
+		currentItems, err = u.db.GetPaymentItems(paymentID)
+		if err != nil {
+			log.Printf("支払いの明細取得に失敗しました。支払いID: %s, エラー: %v", paymentID, err)
+			return PaymentResponse{}, err
+		}
+		if err := checkPaymentItemsTotal(currentItems, actualAmount); err != nil {
+			log.Printf("既存の明細と実績の金額が一致しません。支払いID: %s, エラー: %v", paymentID, err)
+			return PaymentResponse{}, err
+		}
+	}
+
+	before := paymentSnapshot(payment)
+	plannedDate := payment.Date
+	plannedAmount := payment.Amount
+	payment.PlannedDate = &plannedDate
+	payment.PlannedAmount = &plannedAmount
+	payment.Date = date
+	payment.Amount = actualAmount
+	payment.IsPlanned = false
+	payment.Items = paymentItems
+
+	err = u.db.UpdatePayment(payment, auditChange[domain.Payment](userID, domain.AuditActionUpdate, domain.AuditEntityPayment, paymentID, &payment.MoneyPoolID, before, paymentSnapshot(payment)))
+	if errors.Is(err, domain.ErrVersionConflict) {
+		return PaymentResponse{}, u.paymentVersionConflict(userID, moneyPoolID, paymentID)
+	}
+	if err != nil {
+		log.Printf("支払いの実績化に失敗しました。支払いID: %s, エラー: %v", paymentID, err)
+		return PaymentResponse{}, err
+	}
+	payment.Version++
+
+	labels, err := u.db.GetPaymentLabels(paymentID)
+	if err != nil {
+		log.Printf("支払いのラベル取得に失敗しました。支払いID: %s, エラー: %v", paymentID, err)
+		return PaymentResponse{}, err
+	}
+
+	log.Printf("支払いID %s を実績にしました。予定金額: %s, 実績金額: %s", paymentID, plannedAmount, actualAmount)
+	return PaymentResponse{
+		ID:          payment.ID,
+		MoneyPoolID: payment.MoneyPoolID,
+		Date:        payment.Date,
+		Title:       payment.Title,
+		Amount:      payment.Amount,
+		Description: payment.Description,
+		IsPlanned:   payment.IsPlanned,
+		StoreID:     payment.StoreID,
+		StoreName:   payment.StoreName,
+		Labels:      toLabelResponses(labels),
+		Items:       toPaymentItemSummaries(currentItems),
+
+		RecurringPaymentID: payment.RecurringPaymentID,
+		PlannedDate:        payment.PlannedDate,
+		PlannedAmount:      payment.PlannedAmount,
+		Variance:           paymentVariance(payment),
+		TransferID:         payment.TransferID,
+		Version:            payment.Version,
+	}, nil
+}
+
+type OverduePayment struct {
+	ID            string       `json:"id"`
+	MoneyPoolID   string       `json:"money_pool_id"`
+	MoneyPoolName string       `json:"money_pool_name"`
+	Date          time.Time    `json:"date"`
+	Title         string       `json:"title"`
+	Amount        domain.Money `json:"amount"`
+	StoreID       *string      `json:"store_id"`
+	StoreName     *string      `json:"store_name"`
+	// DaysOverdue は予定日から今日までの日数
+	DaysOverdue        int     `json:"days_overdue"`
+	RecurringPaymentID *string `json:"recurring_payment_id"`
+	// TransferID が設定されている場合、振替として実績にする
+	TransferID *string `json:"transfer_id"`
+}
+
+// GetOverduePayments retrieves the planned payments of the user whose date has passed without being realized.
+func (u *Usecase) GetOverduePayments(userID string) ([]OverduePayment, error) {
+	log.Printf("ユーザーID %s の期限切れの予定の支払いの取得を開始します。", userID)
+
+	now := today()
+	payments, err := u.db.GetOverduePlannedPayments(userID, now)
+	if err != nil {
+		log.Printf("ユーザーID %s の期限切れの予定の支払い取得に失敗しました。エラー: %v", userID, err)
+		return nil, err
+	}
+
+	poolNames := make(map[string]string)
+	response := make([]OverduePayment, 0, len(payments))
+	for _, payment := range payments {
+		name, ok := poolNames[payment.MoneyPoolID]
+		if !ok {
+			pool, err := u.db.GetMoneyPool(payment.MoneyPoolID)
+			if err != nil {
+				log.Printf("マネープールID %s の取得に失敗しました。エラー: %v", payment.MoneyPoolID, err)
+				return nil, err
+			}
+			name = pool.Name
+			poolNames[payment.MoneyPoolID] = name
+		}
+
+		paymentDate := time.Date(payment.Date.Year(), payment.Date.Month(), payment.Date.Day(), 0, 0, 0, 0, time.UTC)
+		response = append(response, OverduePayment{
+			ID:                 payment.ID,
+			MoneyPoolID:        payment.MoneyPoolID,
+			MoneyPoolName:      name,
+			Date:               payment.Date,
+			Title:              payment.Title,
+			Amount:             payment.Amount,
+			StoreID:            payment.StoreID,
+			StoreName:          payment.StoreName,
+			DaysOverdue:        int(now.Sub(paymentDate).Hours() / 24),
+			RecurringPaymentID: payment.RecurringPaymentID,
+			TransferID:         payment.TransferID,
+		})
+	}
+
+	log.Printf("ユーザーID %s の期限切れの予定の支払いは %d 件です。", userID, len(response))
+	return response, nil
+}
@@ -0,0 +1,466 @@
+package usecase
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/width"
+)
+
+// ErrInvalidPaymentImport はCSVや列の対応付け、取り込む行の指定が不正な場合に返されます。
+var ErrInvalidPaymentImport = fmt.Errorf("%w: invalid payment import", ErrValidation)
+
+const (
+	// MaxPaymentImportRows は1回のCSV取り込みで扱える最大行数です。
+	MaxPaymentImportRows = 5000
+
+	// 金額の符号の扱い
+	// ImportSignExpenseNegative: 支出がマイナスで書かれている（OpenChokinと同じ）
+	// ImportSignExpensePositive: 支出がプラスで書かれている（クレジットカードの明細など）。符号を反転して取り込む
+	ImportSignExpenseNegative = "expense_negative"
+	ImportSignExpensePositive = "expense_positive"
+)
+
+// importDateLayouts are the date formats accepted in imported CSVs. Japanese banks use all of them.
+var importDateLayouts = []string{"2006-01-02", "2006/01/02", "2006/1/2", "2006.01.02", "2006.1.2", "20060102", "2006年1月2日"}
+
+// PaymentImportMapping describes how the columns of a CSV map to payments.
+// A column is given either by its header name or by its 1-based position.
+type PaymentImportMapping struct {
+	// Encoding は utf-8 (既定) または shift_jis
+	Encoding string
+	// Delimiter は区切り文字。空の場合はカンマ
+	Delimiter rune
+	// SkipRows はヘッダーより前にある読み飛ばす行数（口座番号などが書かれた行）
+	SkipRows  int
+	HasHeader bool
+
+	DateColumn        string
+	TitleColumn       string
+	DescriptionColumn string
+	// AmountColumn か、WithdrawalColumn と DepositColumn の少なくとも一方を指定する
+	AmountColumn     string
+	WithdrawalColumn string
+	DepositColumn    string
+	// AmountSign は AmountColumn の符号の扱い。ImportSign〜 のいずれか
+	AmountSign string
+	IsPlanned  bool
+}
+
+type PaymentImportRow struct {
+	// Line はCSVの行番号（1始まり）。取り込む行の指定に使う
+	Line        int           `json:"line"`
+	Date        *time.Time    `json:"date"`
+	Title       string        `json:"title"`
+	Amount      *domain.Money `json:"amount"`
+	Description string        `json:"description"`
+	// DuplicateOf は日付・金額・タイトルが同じ既存の支払いのID
+	DuplicateOf *string `json:"duplicate_of"`
+	// Error は行を読み取れなかった理由。空でない行は取り込めない
+	Error string `json:"error"`
+}
+
+type PaymentImportPreview struct {
+	Rows           []PaymentImportRow `json:"rows"`
+	ValidCount     int                `json:"valid_count"`
+	DuplicateCount int                `json:"duplicate_count"`
+	ErrorCount     int                `json:"error_count"`
+}
+
+type PaymentImportResult struct {
+	ImportedCount int      `json:"imported_count"`
+	PaymentIDs    []string `json:"payment_ids"`
+}
+
+// importColumns holds the resolved 0-based column positions, -1 if not mapped.
+type importColumns struct {
+	date, title, description, amount, withdrawal, deposit int
+}
+
+// readImportRecords decodes the CSV and returns the data records with their line numbers and the header, if any.
+func readImportRecords(r io.Reader, mapping PaymentImportMapping) (records [][]string, lines []int, header []string, err error) {
+	switch strings.ToLower(strings.ReplaceAll(mapping.Encoding, "-", "_")) {
+	case "", "utf_8", "utf8":
+	case "shift_jis", "sjis", "cp932", "windows_31j":
+		r = transform.NewReader(r, japanese.ShiftJIS.NewDecoder())
+	default:
+		return nil, nil, nil, fmt.Errorf("%w: unsupported encoding %q", ErrInvalidPaymentImport, mapping.Encoding)
+	}
+
+	reader := csv.NewReader(r)
+	if mapping.Delimiter != 0 {
+		reader.Comma = mapping.Delimiter
+	}
+	// 銀行のCSVは行ごとに列数が違ったり、引用符が崩れていたりすることがある
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%w: failed to read csv: %v", ErrInvalidPaymentImport, err)
+		}
+		if line == 1 && len(record) > 0 {
+			// Excelが付けるBOMを取り除く
+			record[0] = strings.TrimPrefix(record[0], "\ufeff")
+		}
+		if line <= mapping.SkipRows || isBlankRecord(record) {
+			continue
+		}
+		if mapping.HasHeader && header == nil {
+			header = record
+			continue
+		}
+		if len(records) >= MaxPaymentImportRows {
+			return nil, nil, nil, fmt.Errorf("%w: csv has more than %d rows", ErrInvalidPaymentImport, MaxPaymentImportRows)
+		}
+		records = append(records, record)
+		lines = append(lines, line)
+	}
+	if len(records) == 0 {
+		return nil, nil, nil, fmt.Errorf("%w: csv has no rows", ErrInvalidPaymentImport)
+	}
+	return records, lines, header, nil
+}
+
+func isBlankRecord(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveImportColumn returns the position of a column given by header name or 1-based position, or -1 if name is empty.
+func resolveImportColumn(name string, header []string) (int, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return -1, nil
+	}
+	if position, err := strconv.Atoi(name); err == nil {
+		if position < 1 {
+			return 0, fmt.Errorf("%w: column position must be 1 or greater", ErrInvalidPaymentImport)
+		}
+		return position - 1, nil
+	}
+	for i, column := range header {
+		if strings.TrimSpace(column) == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: column %q not found in the header", ErrInvalidPaymentImport, name)
+}
+
+func resolveImportColumns(mapping PaymentImportMapping, header []string) (importColumns, error) {
+	var columns importColumns
+	for _, c := range []struct {
+		name string
+		dst  *int
+	}{
+		{mapping.DateColumn, &columns.date},
+		{mapping.TitleColumn, &columns.title},
+		{mapping.DescriptionColumn, &columns.description},
+		{mapping.AmountColumn, &columns.amount},
+		{mapping.WithdrawalColumn, &columns.withdrawal},
+		{mapping.DepositColumn, &columns.deposit},
+	} {
+		position, err := resolveImportColumn(c.name, header)
+		if err != nil {
+			return importColumns{}, err
+		}
+		*c.dst = position
+	}
+
+	if columns.date < 0 || columns.title < 0 {
+		return importColumns{}, fmt.Errorf("%w: date and title columns are required", ErrInvalidPaymentImport)
+	}
+	if columns.amount < 0 && columns.withdrawal < 0 && columns.deposit < 0 {
+		return importColumns{}, fmt.Errorf("%w: amount column or withdrawal/deposit columns are required", ErrInvalidPaymentImport)
+	}
+	if columns.amount >= 0 && (columns.withdrawal >= 0 || columns.deposit >= 0) {
+		return importColumns{}, fmt.Errorf("%w: amount column cannot be combined with withdrawal/deposit columns", ErrInvalidPaymentImport)
+	}
+	switch mapping.AmountSign {
+	case "", ImportSignExpenseNegative, ImportSignExpensePositive:
+	default:
+		return importColumns{}, fmt.Errorf("%w: unknown amount sign %q", ErrInvalidPaymentImport, mapping.AmountSign)
+	}
+	return columns, nil
+}
+
+func importField(record []string, column int) string {
+	if column < 0 || column >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[column])
+}
+
+// parseImportDate parses a date in one of importDateLayouts. Full-width digits are accepted.
+func parseImportDate(s string) (time.Time, error) {
+	s = width.Narrow.String(strings.TrimSpace(s))
+	for _, layout := range importDateLayouts {
+		if date, err := time.Parse(layout, s); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", s)
+}
+
+// parseImportAmount parses an amount as written in bank statements, e.g. "1,234", "￥1,234", "-1,234円",
+// "△1,234" or "(1,234)". Full-width digits are accepted. An empty field is zero.
+func parseImportAmount(s string) (domain.Money, error) {
+	s = width.Narrow.String(strings.TrimSpace(s))
+	s = strings.NewReplacer(",", "", "¥", "", "\\", "", "円", "", " ", "").Replace(s)
+	if s == "" {
+		return domain.Money{}, nil
+	}
+	negative := false
+	// 日本の帳票では△や▲でマイナスを表す
+	for _, prefix := range []string{"△", "▲", "-"} {
+		if strings.HasPrefix(s, prefix) {
+			negative = true
+			s = strings.TrimPrefix(s, prefix)
+			break
+		}
+	}
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = strings.TrimSuffix(strings.TrimPrefix(s, "("), ")")
+	}
+	s = strings.TrimPrefix(s, "+")
+	amount, err := domain.ParseMoney(s)
+	if err != nil {
+		return domain.Money{}, fmt.Errorf("unrecognized amount %q", s)
+	}
+	if negative {
+		amount = amount.Neg()
+	}
+	return amount, nil
+}
+
+// parseImportRow converts a record into a row. Problems with the record are reported in row.Error.
+func parseImportRow(record []string, line int, columns importColumns, mapping PaymentImportMapping) PaymentImportRow {
+	row := PaymentImportRow{
+		Line:        line,
+		Title:       importField(record, columns.title),
+		Description: importField(record, columns.description),
+	}
+
+	date, err := parseImportDate(importField(record, columns.date))
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	row.Date = &date
+
+	if row.Title == "" {
+		row.Error = "title is empty"
+		return row
+	}
+
+	var amount domain.Money
+	if columns.amount >= 0 {
+		amount, err = parseImportAmount(importField(record, columns.amount))
+		if err != nil {
+			row.Error = err.Error()
+			return row
+		}
+		if mapping.AmountSign == ImportSignExpensePositive {
+			amount = amount.Neg()
+		}
+	} else {
+		// 出金と入金が別の列の場合は、入金 - 出金 を金額とする
+		withdrawal, err := parseImportAmount(importField(record, columns.withdrawal))
+		if err != nil {
+			row.Error = err.Error()
+			return row
+		}
+		deposit, err := parseImportAmount(importField(record, columns.deposit))
+		if err != nil {
+			row.Error = err.Error()
+			return row
+		}
+		if amount, err = deposit.Sub(withdrawal.Abs()); err != nil {
+			row.Error = err.Error()
+			return row
+		}
+	}
+	if amount.IsZero() {
+		row.Error = "amount is zero or empty"
+		return row
+	}
+	row.Amount = &amount
+	return row
+}
+
+// paymentImportKey identifies payments that are regarded as the same when detecting duplicates.
+func paymentImportKey(date time.Time, amount domain.Money, title string) string {
+	return date.Format("2006-01-02") + "\x00" + amount.String() + "\x00" + strings.TrimSpace(title)
+}
+
+// parsePaymentImport parses the CSV for the money pool of the user and marks the rows that duplicate existing payments.
+// Each existing payment is matched with at most one row, so a statement with the same purchase twice
+// is reported as a duplicate only as many times as it is already recorded.
+func (u *Usecase) parsePaymentImport(userID string, moneyPoolID string, r io.Reader, mapping PaymentImportMapping) (PaymentImportPreview, error) {
+	moneyPool, err := u.db.GetMoneyPool(moneyPoolID)
+	if err != nil {
+		log.Printf("マネープールID %s の取得に失敗しました。エラー: %v", moneyPoolID, err)
+		return PaymentImportPreview{}, err
+	}
+	if moneyPool.OwnerID != userID || moneyPool.IsDeleted {
+		log.Printf("エラー: ユーザーID %s はマネープールID %s への取り込みに対して権限がありません。", userID, moneyPoolID)
+		return PaymentImportPreview{}, fmt.Errorf("%w: user %s is not the owner of the MoneyPool %s", ErrForbidden, userID, moneyPoolID)
+	}
+
+	records, lines, header, err := readImportRecords(r, mapping)
+	if err != nil {
+		return PaymentImportPreview{}, err
+	}
+	columns, err := resolveImportColumns(mapping, header)
+	if err != nil {
+		return PaymentImportPreview{}, err
+	}
+
+	preview := PaymentImportPreview{Rows: make([]PaymentImportRow, 0, len(records))}
+	var from, to *time.Time
+	for i, record := range records {
+		row := parseImportRow(record, lines[i], columns, mapping)
+		if row.Date != nil {
+			if from == nil || row.Date.Before(*from) {
+				from = row.Date
+			}
+			if to == nil || row.Date.After(*to) {
+				to = row.Date
+			}
+		}
+		preview.Rows = append(preview.Rows, row)
+	}
+
+	if from != nil {
+		existing, err := u.db.GetPayments(domain.PaymentFilter{MoneyPoolIDs: []string{moneyPoolID}, From: from, To: to, Sort: domain.PaymentSortDateAsc})
+		if err != nil {
+			log.Printf("マネープールID %s の既存の支払いの取得に失敗しました。エラー: %v", moneyPoolID, err)
+			return PaymentImportPreview{}, err
+		}
+		existingByKey := make(map[string][]string)
+		for _, payment := range existing {
+			key := paymentImportKey(payment.Date, payment.Amount, payment.Title)
+			existingByKey[key] = append(existingByKey[key], payment.ID)
+		}
+		for i, row := range preview.Rows {
+			if row.Error != "" {
+				continue
+			}
+			key := paymentImportKey(*row.Date, *row.Amount, row.Title)
+			if ids := existingByKey[key]; len(ids) > 0 {
+				preview.Rows[i].DuplicateOf = &ids[0]
+				existingByKey[key] = ids[1:]
+			}
+		}
+	}
+
+	for _, row := range preview.Rows {
+		switch {
+		case row.Error != "":
+			preview.ErrorCount++
+		case row.DuplicateOf != nil:
+			preview.DuplicateCount++
+		default:
+			preview.ValidCount++
+		}
+	}
+	return preview, nil
+}
+
+// PreviewPaymentImport parses a CSV statement without storing anything, so that the user can check the mapping
+// and choose the rows to import.
+func (u *Usecase) PreviewPaymentImport(userID string, moneyPoolID string, r io.Reader, mapping PaymentImportMapping) (PaymentImportPreview, error) {
+	log.Printf("CSV取り込みのプレビューを開始します。ユーザーID: %s, マネープールID: %s", userID, moneyPoolID)
+	preview, err := u.parsePaymentImport(userID, moneyPoolID, r, mapping)
+	if err != nil {
+		return PaymentImportPreview{}, err
+	}
+	log.Printf("CSV取り込みのプレビューが完了しました。取り込み可能: %d, 重複: %d, エラー: %d", preview.ValidCount, preview.DuplicateCount, preview.ErrorCount)
+	return preview, nil
+}
+
+// ImportPayments stores the rows of a CSV statement in the money pool in one transaction.
+// lines selects the rows by the line numbers returned from PreviewPaymentImport; selected duplicates are imported too.
+// If lines is nil, every row without errors that is not a duplicate is imported.
+func (u *Usecase) ImportPayments(userID string, moneyPoolID string, r io.Reader, mapping PaymentImportMapping, lines []int) (PaymentImportResult, error) {
+	log.Printf("CSV取り込みを開始します。ユーザーID: %s, マネープールID: %s", userID, moneyPoolID)
+	preview, err := u.parsePaymentImport(userID, moneyPoolID, r, mapping)
+	if err != nil {
+		return PaymentImportResult{}, err
+	}
+
+	rowsByLine := make(map[int]PaymentImportRow, len(preview.Rows))
+	for _, row := range preview.Rows {
+		rowsByLine[row.Line] = row
+	}
+	var selected []PaymentImportRow
+	if lines == nil {
+		for _, row := range preview.Rows {
+			if row.Error == "" && row.DuplicateOf == nil {
+				selected = append(selected, row)
+			}
+		}
+	} else {
+		seen := make(map[int]bool, len(lines))
+		for _, line := range lines {
+			row, ok := rowsByLine[line]
+			if !ok {
+				return PaymentImportResult{}, fmt.Errorf("%w: line %d is not a row of the csv", ErrInvalidPaymentImport, line)
+			}
+			if row.Error != "" {
+				return PaymentImportResult{}, fmt.Errorf("%w: line %d: %s", ErrInvalidPaymentImport, line, row.Error)
+			}
+			if !seen[line] {
+				seen[line] = true
+				selected = append(selected, row)
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return PaymentImportResult{}, fmt.Errorf("%w: no rows to import", ErrInvalidPaymentImport)
+	}
+
+	payments := make([]domain.Payment, 0, len(selected))
+	for _, row := range selected {
+		payments = append(payments, domain.Payment{
+			MoneyPoolID: moneyPoolID,
+			Date:        *row.Date,
+			Title:       row.Title,
+			Amount:      *row.Amount,
+			Description: row.Description,
+			IsPlanned:   mapping.IsPlanned,
+		})
+	}
+	created, err := u.db.NewPayments(payments, auditCreate(userID, domain.AuditEntityPayment, func(created domain.Payment) (string, *string, any) {
+		return created.ID, &created.MoneyPoolID, paymentSnapshot(created)
+	}))
+	if err != nil {
+		log.Printf("CSVの支払いの保存に失敗しました。マネープールID: %s, エラー: %v", moneyPoolID, err)
+		return PaymentImportResult{}, err
+	}
+
+	result := PaymentImportResult{ImportedCount: len(created), PaymentIDs: make([]string, 0, len(created))}
+	for _, payment := range created {
+		result.PaymentIDs = append(result.PaymentIDs, payment.ID)
+	}
+	log.Printf("CSVから %d 件の支払いを取り込みました。マネープールID: %s", result.ImportedCount, moneyPoolID)
+	return result, nil
+}
@@ -0,0 +1,163 @@
+package usecase
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+)
+
+// ErrInvalidPaymentQuery は支払い一覧の絞り込み条件やカーソルが不正な場合に返されます。
+var ErrInvalidPaymentQuery = fmt.Errorf("%w: invalid payment query", ErrValidation)
+
+// MaxPaymentPageSize は1ページで返す支払いの最大件数です。
+const MaxPaymentPageSize = 1000
+
+// PaymentQuery is the filters, sort order and page of a payment listing requested by the user.
+// Zero values mean no condition. Limit 0 returns every matching payment, as the listings did before pagination.
+type PaymentQuery struct {
+	From      *time.Time
+	To        *time.Time
+	MinAmount *domain.Money
+	MaxAmount *domain.Money
+	IsPlanned *bool
+	Title     string
+	StoreID   string
+	LabelID   string
+	Sort      string
+	Cursor    string
+	Limit     int
+}
+
+// paymentCursor is the JSON form of domain.PaymentCursor. It is sent to clients base64 encoded and is opaque to them.
+type paymentCursor struct {
+	Sort   string       `json:"s"`
+	Date   string       `json:"d"`
+	Amount domain.Money `json:"a"`
+	ID     string       `json:"i"`
+}
+
+func encodePaymentCursor(sort string, payment domain.Payment) string {
+	data, _ := json.Marshal(paymentCursor{
+		Sort:   sort,
+		Date:   payment.Date.Format("2006-01-02"),
+		Amount: payment.Amount,
+		ID:     payment.ID,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePaymentCursor(sort string, cursor string) (*domain.PaymentCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidPaymentQuery)
+	}
+	var c paymentCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidPaymentQuery)
+	}
+	// 並び順が変わるとカーソルの位置の意味が変わるため、同じ並び順でのみ使える
+	if c.Sort != sort {
+		return nil, fmt.Errorf("%w: cursor was issued for another sort order", ErrInvalidPaymentQuery)
+	}
+	date, err := time.Parse("2006-01-02", c.Date)
+	if err != nil || c.ID == "" {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidPaymentQuery)
+	}
+	return &domain.PaymentCursor{Date: date, Amount: c.Amount, ID: c.ID}, nil
+}
+
+// toFilter validates the query and converts it to a filter over the given money pools.
+func (q PaymentQuery) toFilter(moneyPoolIDs []string) (domain.PaymentFilter, error) {
+	sort := q.Sort
+	if sort == "" {
+		sort = domain.PaymentSortDateDesc
+	}
+	if !domain.IsValidPaymentSort(sort) {
+		return domain.PaymentFilter{}, fmt.Errorf("%w: unknown sort order %q", ErrInvalidPaymentQuery, q.Sort)
+	}
+	if q.Limit < 0 || q.Limit > MaxPaymentPageSize {
+		return domain.PaymentFilter{}, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidPaymentQuery, MaxPaymentPageSize)
+	}
+	if q.From != nil && q.To != nil && q.From.After(*q.To) {
+		return domain.PaymentFilter{}, fmt.Errorf("%w: from must not be after to", ErrInvalidPaymentQuery)
+	}
+	if q.MinAmount != nil && q.MaxAmount != nil && q.MinAmount.Cmp(*q.MaxAmount) > 0 {
+		return domain.PaymentFilter{}, fmt.Errorf("%w: min_amount must not be greater than max_amount", ErrInvalidPaymentQuery)
+	}
+
+	filter := domain.PaymentFilter{
+		MoneyPoolIDs: moneyPoolIDs,
+		From:         q.From,
+		To:           q.To,
+		MinAmount:    q.MinAmount,
+		MaxAmount:    q.MaxAmount,
+		IsPlanned:    q.IsPlanned,
+		Title:        q.Title,
+		Sort:         sort,
+		Limit:        q.Limit,
+	}
+	if q.StoreID != "" {
+		filter.StoreID = &q.StoreID
+	}
+	if q.LabelID != "" {
+		filter.LabelID = &q.LabelID
+	}
+	if q.Cursor != "" {
+		after, err := decodePaymentCursor(sort, q.Cursor)
+		if err != nil {
+			return domain.PaymentFilter{}, err
+		}
+		filter.After = after
+	}
+	return filter, nil
+}
+
+// getPaymentPage retrieves a page of payments matching the filter.
+// nextCursor is nil if there are no more payments after the page.
+func (u *Usecase) getPaymentPage(filter domain.PaymentFilter) (payments []domain.Payment, nextCursor *string, err error) {
+	limit := filter.Limit
+	if limit > 0 {
+		// 1件多く取得して、次のページがあるかを調べる
+		filter.Limit = limit + 1
+	}
+	payments, err = u.db.GetPayments(filter)
+	if err != nil {
+		log.Printf("支払い一覧の取得に失敗しました。エラー: %v", err)
+		return nil, nil, err
+	}
+	if limit > 0 && len(payments) > limit {
+		payments = payments[:limit]
+		cursor := encodePaymentCursor(filter.Sort, payments[limit-1])
+		nextCursor = &cursor
+	}
+	return payments, nextCursor, nil
+}
+
+// getPaymentDetails retrieves the line items and labels of the payments at once, grouped by payment ID.
+func (u *Usecase) getPaymentDetails(payments []domain.Payment) (map[string][]domain.ItemPayment, map[string][]domain.PaymentLabel, error) {
+	paymentIDs := make([]string, 0, len(payments))
+	for _, payment := range payments {
+		paymentIDs = append(paymentIDs, payment.ID)
+	}
+
+	items, err := u.db.GetPaymentItemsByPaymentIDs(paymentIDs)
+	if err != nil {
+		log.Printf("支払い明細の取得に失敗しました。エラー: %v", err)
+		return nil, nil, err
+	}
+	itemsByPayment := make(map[string][]domain.ItemPayment)
+	for _, item := range items {
+		itemsByPayment[item.PaymentID] = append(itemsByPayment[item.PaymentID], item)
+	}
+
+	labels, err := u.db.GetPaymentLabelsByPaymentIDs(paymentIDs)
+	if err != nil {
+		log.Printf("支払いラベルの取得に失敗しました。エラー: %v", err)
+		return nil, nil, err
+	}
+	return itemsByPayment, groupPaymentLabels(labels), nil
+}
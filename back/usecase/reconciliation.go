@@ -0,0 +1,249 @@
+package usecase
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+	"github.com/walnuts1018/openchokin/back/timeJST"
+)
+
+// ErrInvalidMoneyProvider はマネープールの割り当て先のマネープロバイダーが存在しない、または使用できない場合に返されます。
+var ErrInvalidMoneyProvider = fmt.Errorf("%w: invalid money provider", ErrValidation)
+
+type AllocatedMoneyPool struct {
+	ID       string       `json:"id"`
+	Name     string       `json:"name"`
+	Currency string       `json:"currency"`
+	Balance  domain.Money `json:"balance"`
+	// ConvertedBalance は照合先の通貨に換算した残高
+	ConvertedBalance domain.Money `json:"converted_balance"`
+}
+
+type ProviderReconciliation struct {
+	MoneyProviderID   *string      `json:"money_provider_id"`
+	MoneyProviderName string       `json:"money_provider_name"`
+	Currency          string       `json:"currency"`
+	ProviderBalance   domain.Money `json:"provider_balance"`
+	AllocatedPoolSum  domain.Money `json:"allocated_pool_sum"`
+	// Difference はプロバイダーの残高のうちどのマネープールにも割り当てられていない金額 (ProviderBalance - AllocatedPoolSum)
+	Difference domain.Money `json:"difference"`
+	// Pools は照合の履歴では記録されないため空になる
+	Pools []AllocatedMoneyPool `json:"pools"`
+}
+
+type ReconciliationResponse struct {
+	// ID は保存していない照合の場合は空
+	ID           string                   `json:"id"`
+	ReconciledAt time.Time                `json:"reconciled_at"`
+	Note         string                   `json:"note"`
+	Providers    []ProviderReconciliation `json:"providers"`
+	// UnallocatedPools はどのマネープロバイダーにも割り当てられていないマネープール（ユーザーの基準通貨で換算）
+	UnallocatedPools []AllocatedMoneyPool `json:"unallocated_pools"`
+}
+
+// AllocateMoneyPool sets the money provider which holds the money of a pool. A nil moneyProviderID removes the allocation.
+func (u *Usecase) AllocateMoneyPool(userID string, moneyPoolID string, moneyProviderID *string) error {
+	log.Printf("マネープールID %s のマネープロバイダーへの割り当てを開始します。ユーザーID: %s", moneyPoolID, userID)
+
+	pool, err := u.db.GetMoneyPool(moneyPoolID)
+	if err != nil {
+		log.Printf("マネープールID %s の取得に失敗しました。エラー: %v", moneyPoolID, err)
+		return err
+	}
+	if pool.OwnerID != userID {
+		log.Printf("ユーザーID %s はマネープールID %s の割り当てを変更する権限がありません。", userID, moneyPoolID)
+		return fmt.Errorf("%w: user %s is not the owner of the MoneyPool %s", ErrForbidden, userID, moneyPoolID)
+	}
+
+	if moneyProviderID != nil {
+		provider, err := u.db.GetMoneyProvider(*moneyProviderID)
+		if err != nil {
+			log.Printf("マネープロバイダーID %s の取得に失敗しました。エラー: %v", *moneyProviderID, err)
+			return fmt.Errorf("%w: money provider %s not found", ErrInvalidMoneyProvider, *moneyProviderID)
+		}
+		if provider.CreatorID != userID {
+			log.Printf("ユーザーID %s はマネープロバイダーID %s を使用できません。", userID, *moneyProviderID)
+			return fmt.Errorf("%w: money provider %s cannot be used", ErrInvalidMoneyProvider, *moneyProviderID)
+		}
+	}
+
+	after := pool
+	after.MoneyProviderID = moneyProviderID
+	audit := auditChange[string](userID, domain.AuditActionUpdate, domain.AuditEntityMoneyPool, moneyPoolID, &moneyPoolID, moneyPoolSnapshot(pool), moneyPoolSnapshot(after))
+	if err := u.db.SetMoneyPoolProvider(moneyPoolID, moneyProviderID, audit); err != nil {
+		log.Printf("マネープールID %s の割り当て中にエラーが発生しました。エラー: %v", moneyPoolID, err)
+		return err
+	}
+	return nil
+}
+
+// GetReconciliation compares the balance of each money provider of the user with the actual balances
+// of the money pools allocated to it. Pool balances are converted into the currency of the provider.
+func (u *Usecase) GetReconciliation(userID string) (ReconciliationResponse, error) {
+	log.Printf("ユーザーID %s の残高照合を開始します。", userID)
+	now := timeJST.Now()
+
+	providers, err := u.db.GetMoneyProvidersByUserID(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s のマネープロバイダー取得エラー: %v", userID, err)
+		return ReconciliationResponse{}, err
+	}
+	pools, err := u.db.GetMoneyPoolsByUserID(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s のマネープール取得エラー: %v", userID, err)
+		return ReconciliationResponse{}, err
+	}
+	converter, err := u.newCurrencyConverter(userID)
+	if err != nil {
+		return ReconciliationResponse{}, err
+	}
+	baseCurrency, err := u.resolveBaseCurrency(userID, "")
+	if err != nil {
+		return ReconciliationResponse{}, err
+	}
+
+	providerCurrencies := make(map[string]string, len(providers))
+	for _, provider := range providers {
+		providerCurrencies[provider.ID] = domain.NormalizeCurrencyCode(provider.Currency)
+	}
+
+	poolsByProvider := make(map[string][]AllocatedMoneyPool)
+	response := ReconciliationResponse{
+		ReconciledAt:     now,
+		Providers:        make([]ProviderReconciliation, 0, len(providers)),
+		UnallocatedPools: []AllocatedMoneyPool{},
+	}
+	for _, pool := range pools {
+		currency := baseCurrency
+		allocated := false
+		if pool.MoneyProviderID != nil {
+			currency, allocated = providerCurrencies[*pool.MoneyProviderID]
+			if !allocated {
+				currency = baseCurrency
+			}
+		}
+
+		balance, err := u.db.GetMoneyPoolBalance(pool.ID, false)
+		if err != nil {
+			log.Printf("マネープールID %s の残高取得エラー: %v", pool.ID, err)
+			return ReconciliationResponse{}, err
+		}
+		converted, err := u.convertMoneyPoolBalance(pool, nil, false, false, currency, converter)
+		if err != nil {
+			log.Printf("マネープールID %s の残高換算エラー: %v", pool.ID, err)
+			return ReconciliationResponse{}, err
+		}
+
+		allocatedPool := AllocatedMoneyPool{
+			ID:               pool.ID,
+			Name:             pool.Name,
+			Currency:         domain.NormalizeCurrencyCode(pool.Currency),
+			Balance:          balance,
+			ConvertedBalance: converted,
+		}
+		if allocated {
+			poolsByProvider[*pool.MoneyProviderID] = append(poolsByProvider[*pool.MoneyProviderID], allocatedPool)
+		} else {
+			response.UnallocatedPools = append(response.UnallocatedPools, allocatedPool)
+		}
+	}
+
+	for _, provider := range providers {
+		providerID := provider.ID
+		entry := ProviderReconciliation{
+			MoneyProviderID:   &providerID,
+			MoneyProviderName: provider.Name,
+			Currency:          providerCurrencies[provider.ID],
+			ProviderBalance:   provider.Balance,
+			Pools:             poolsByProvider[provider.ID],
+		}
+		if entry.Pools == nil {
+			entry.Pools = []AllocatedMoneyPool{}
+		}
+		var err error
+		for _, pool := range entry.Pools {
+			if entry.AllocatedPoolSum, err = entry.AllocatedPoolSum.Add(pool.ConvertedBalance); err != nil {
+				return ReconciliationResponse{}, err
+			}
+		}
+		if entry.Difference, err = entry.ProviderBalance.Sub(entry.AllocatedPoolSum); err != nil {
+			return ReconciliationResponse{}, err
+		}
+		response.Providers = append(response.Providers, entry)
+	}
+
+	log.Printf("ユーザーID %s の残高照合が完了しました。", userID)
+	return response, nil
+}
+
+// SaveReconciliation reconciles the balances like GetReconciliation and records the result in the history.
+func (u *Usecase) SaveReconciliation(userID string, note string) (ReconciliationResponse, error) {
+	response, err := u.GetReconciliation(userID)
+	if err != nil {
+		return ReconciliationResponse{}, err
+	}
+
+	reconciliation := domain.Reconciliation{
+		CreatorID:    userID,
+		ReconciledAt: response.ReconciledAt,
+		Note:         note,
+		Entries:      make([]domain.ReconciliationEntry, 0, len(response.Providers)),
+	}
+	for _, provider := range response.Providers {
+		reconciliation.Entries = append(reconciliation.Entries, domain.ReconciliationEntry{
+			MoneyProviderID:   provider.MoneyProviderID,
+			MoneyProviderName: provider.MoneyProviderName,
+			Currency:          provider.Currency,
+			ProviderBalance:   provider.ProviderBalance,
+			AllocatedPoolSum:  provider.AllocatedPoolSum,
+			Difference:        provider.Difference,
+		})
+	}
+
+	created, err := u.db.NewReconciliation(reconciliation)
+	if err != nil {
+		log.Printf("ユーザーID %s の照合結果の保存に失敗しました。エラー: %v", userID, err)
+		return ReconciliationResponse{}, err
+	}
+
+	log.Printf("照合結果を保存しました。ID: %s", created.ID)
+	response.ID = created.ID
+	response.Note = note
+	return response, nil
+}
+
+// GetReconciliationHistory retrieves the recorded reconciliations of the user, newest first.
+func (u *Usecase) GetReconciliationHistory(userID string) ([]ReconciliationResponse, error) {
+	log.Printf("ユーザーID %s の照合履歴の取得を開始します。", userID)
+	reconciliations, err := u.db.GetReconciliationsByUserID(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s の照合履歴取得エラー: %v", userID, err)
+		return nil, err
+	}
+
+	response := make([]ReconciliationResponse, 0, len(reconciliations))
+	for _, reconciliation := range reconciliations {
+		providers := make([]ProviderReconciliation, 0, len(reconciliation.Entries))
+		for _, entry := range reconciliation.Entries {
+			providers = append(providers, ProviderReconciliation{
+				MoneyProviderID:   entry.MoneyProviderID,
+				MoneyProviderName: entry.MoneyProviderName,
+				Currency:          entry.Currency,
+				ProviderBalance:   entry.ProviderBalance,
+				AllocatedPoolSum:  entry.AllocatedPoolSum,
+				Difference:        entry.Difference,
+				Pools:             []AllocatedMoneyPool{},
+			})
+		}
+		response = append(response, ReconciliationResponse{
+			ID:               reconciliation.ID,
+			ReconciledAt:     reconciliation.ReconciledAt,
+			Note:             reconciliation.Note,
+			Providers:        providers,
+			UnallocatedPools: []AllocatedMoneyPool{},
+		})
+	}
+	return response, nil
+}
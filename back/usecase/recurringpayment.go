@@ -0,0 +1,333 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+	"github.com/walnuts1018/openchokin/back/timeJST"
+)
+
+// ErrInvalidRecurringPayment は定期支払いのルールが不正な場合に返されます。
+var ErrInvalidRecurringPayment = fmt.Errorf("%w: invalid recurring payment", ErrValidation)
+
+// RecurringPaymentHorizonMonths は定期支払いを予定の支払いとして何か月先まで作成しておくかです。
+const RecurringPaymentHorizonMonths = 3
+
+// RecurringPaymentInput is the user input of a recurring payment rule.
+type RecurringPaymentInput struct {
+	Title       string
+	Amount      domain.Money
+	Description string
+	StoreID     *string
+	Frequency   string
+	Interval    int
+	// Weekday (0 = Sunday) and NthWeek (1-5, -1 = last) make a monthly rule occur on e.g. the 2nd Tuesday.
+	Weekday   *int
+	NthWeek   *int
+	StartDate time.Time
+	EndDate   *time.Time
+	Count     *int
+}
+
+type RecurringPaymentResponse struct {
+	ID          string       `json:"id"`
+	MoneyPoolID string       `json:"money_pool_id"`
+	Title       string       `json:"title"`
+	Amount      domain.Money `json:"amount"`
+	Description string       `json:"description"`
+	StoreID     *string      `json:"store_id"`
+	Frequency   string       `json:"frequency"`
+	Interval    int          `json:"interval"`
+	Weekday     *int         `json:"weekday"`
+	NthWeek     *int         `json:"nth_week"`
+	StartDate   time.Time    `json:"start_date"`
+	EndDate     *time.Time   `json:"end_date"`
+	Count       *int         `json:"count"`
+	IsPaused    bool         `json:"is_paused"`
+	// NextDate は次に発生する日。終了している場合はnull
+	NextDate *time.Time `json:"next_date"`
+}
+
+func toRecurringPaymentResponse(rule domain.RecurringPayment) RecurringPaymentResponse {
+	response := RecurringPaymentResponse{
+		ID:          rule.ID,
+		MoneyPoolID: rule.MoneyPoolID,
+		Title:       rule.Title,
+		Amount:      rule.Amount,
+		Description: rule.Description,
+		StoreID:     rule.StoreID,
+		Frequency:   rule.Frequency,
+		Interval:    rule.IntervalCount,
+		Weekday:     rule.Weekday,
+		NthWeek:     rule.NthWeek,
+		StartDate:   rule.StartDate,
+		Count:       rule.OccurrenceCount,
+		IsPaused:    rule.IsPaused,
+	}
+	if rule.EndDate.Valid {
+		response.EndDate = &rule.EndDate.Time
+	}
+	if !rule.IsPaused {
+		yesterday := today().AddDate(0, 0, -1)
+		// 最大で1年分の間隔しか空かないので、数年先まで見れば次の発生日が分かる
+		next := rule.Occurrences(sql.NullTime{Time: yesterday, Valid: true}, yesterday.AddDate(rule.IntervalCount+1, 0, 0))
+		if len(next) > 0 {
+			response.NextDate = &next[0]
+		}
+	}
+	return response
+}
+
+// today returns the current date in JST as a date at midnight UTC, which is how DATE columns are scanned.
+func today() time.Time {
+	now := timeJST.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// recurringPaymentHorizon returns the last date up to which planned payments are created.
+func recurringPaymentHorizon() time.Time {
+	return today().AddDate(0, RecurringPaymentHorizonMonths, 0)
+}
+
+// applyRecurringPaymentInput validates the input and sets it on the rule.
+func applyRecurringPaymentInput(rule *domain.RecurringPayment, input RecurringPaymentInput) error {
+	if input.Title == "" {
+		return fmt.Errorf("%w: title is required", ErrInvalidRecurringPayment)
+	}
+	switch input.Frequency {
+	case domain.RecurrenceDaily, domain.RecurrenceWeekly, domain.RecurrenceMonthly, domain.RecurrenceYearly:
+	default:
+		return fmt.Errorf("%w: frequency must be one of daily, weekly, monthly or yearly", ErrInvalidRecurringPayment)
+	}
+	interval := input.Interval
+	if interval == 0 {
+		interval = 1
+	}
+	if interval < 1 {
+		return fmt.Errorf("%w: interval must be positive", ErrInvalidRecurringPayment)
+	}
+	if (input.Weekday == nil) != (input.NthWeek == nil) {
+		return fmt.Errorf("%w: weekday and nth_week must be given together", ErrInvalidRecurringPayment)
+	}
+	if input.Weekday != nil {
+		if input.Frequency != domain.RecurrenceMonthly {
+			return fmt.Errorf("%w: weekday and nth_week can only be used with monthly", ErrInvalidRecurringPayment)
+		}
+		if *input.Weekday < 0 || *input.Weekday > 6 {
+			return fmt.Errorf("%w: weekday must be between 0 (Sunday) and 6 (Saturday)", ErrInvalidRecurringPayment)
+		}
+		if *input.NthWeek == 0 || *input.NthWeek < -1 || *input.NthWeek > 5 {
+			return fmt.Errorf("%w: nth_week must be between 1 and 5, or -1 for the last week", ErrInvalidRecurringPayment)
+		}
+	}
+	if input.StartDate.IsZero() {
+		return fmt.Errorf("%w: start_date is required", ErrInvalidRecurringPayment)
+	}
+	if input.EndDate != nil && input.EndDate.Before(input.StartDate) {
+		return fmt.Errorf("%w: end_date must not be before start_date", ErrInvalidRecurringPayment)
+	}
+	if input.Count != nil && *input.Count < 1 {
+		return fmt.Errorf("%w: count must be positive", ErrInvalidRecurringPayment)
+	}
+
+	rule.Title = input.Title
+	rule.Amount = input.Amount
+	rule.Description = input.Description
+	rule.StoreID = input.StoreID
+	rule.Frequency = input.Frequency
+	rule.IntervalCount = interval
+	rule.Weekday = input.Weekday
+	rule.NthWeek = input.NthWeek
+	rule.StartDate = input.StartDate
+	rule.EndDate = sql.NullTime{}
+	if input.EndDate != nil {
+		rule.EndDate = sql.NullTime{Time: *input.EndDate, Valid: true}
+	}
+	rule.OccurrenceCount = input.Count
+	return nil
+}
+
+// getOwnRecurringPayment retrieves a rule and checks that it was created by the user.
+func (u *Usecase) getOwnRecurringPayment(userID string, ruleID string) (domain.RecurringPayment, error) {
+	rule, err := u.db.GetRecurringPayment(ruleID)
+	if err != nil {
+		log.Printf("定期支払いID %s の取得に失敗しました。エラー: %v", ruleID, err)
+		return domain.RecurringPayment{}, err
+	}
+	if rule.CreatorID != userID {
+		log.Printf("ユーザーID %s は定期支払いID %s の操作が許可されていません。", userID, ruleID)
+		return domain.RecurringPayment{}, fmt.Errorf("%w: cannot access recurring payment %s", ErrForbidden, ruleID)
+	}
+	return rule, nil
+}
+
+// GetRecurringPayments retrieves the recurring payment rules of the user.
+// If moneyPoolID is not empty, only the rules of that money pool are returned.
+func (u *Usecase) GetRecurringPayments(userID string, moneyPoolID string) ([]RecurringPaymentResponse, error) {
+	log.Printf("ユーザーID %s の定期支払い一覧の取得を開始します。", userID)
+	rules, err := u.db.GetRecurringPaymentsByUserID(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s の定期支払い取得中にエラーが発生しました: %v", userID, err)
+		return nil, err
+	}
+
+	response := make([]RecurringPaymentResponse, 0, len(rules))
+	for _, rule := range rules {
+		if moneyPoolID != "" && rule.MoneyPoolID != moneyPoolID {
+			continue
+		}
+		response = append(response, toRecurringPaymentResponse(rule))
+	}
+	return response, nil
+}
+
+// AddRecurringPayment registers a recurring payment rule on a money pool and creates its planned payments.
+// Occurrences before today are not created.
+func (u *Usecase) AddRecurringPayment(userID string, moneyPoolID string, input RecurringPaymentInput) (RecurringPaymentResponse, error) {
+	log.Printf("定期支払いの追加を開始します。ユーザーID: %s, マネープールID: %s, タイトル: %s", userID, moneyPoolID, input.Title)
+
+	moneyPool, err := u.db.GetMoneyPool(moneyPoolID)
+	if err != nil {
+		log.Printf("マネープールID %s の取得に失敗しました。エラー: %v", moneyPoolID, err)
+		return RecurringPaymentResponse{}, err
+	}
+	if moneyPool.OwnerID != userID {
+		log.Printf("エラー: ユーザーID %s はマネープールID %s の定期支払い追加に対して権限がありません。", userID, moneyPoolID)
+		return RecurringPaymentResponse{}, fmt.Errorf("%w: user %s is not the owner of the MoneyPool %s", ErrForbidden, userID, moneyPoolID)
+	}
+
+	if _, err := u.resolvePaymentStore(userID, input.StoreID); err != nil {
+		return RecurringPaymentResponse{}, err
+	}
+
+	rule := domain.RecurringPayment{
+		MoneyPoolID:    moneyPoolID,
+		CreatorID:      userID,
+		GeneratedUntil: sql.NullTime{Time: today().AddDate(0, 0, -1), Valid: true},
+	}
+	if err := applyRecurringPaymentInput(&rule, input); err != nil {
+		return RecurringPaymentResponse{}, err
+	}
+
+	created, err := u.db.NewRecurringPayment(rule, recurringPaymentHorizon(), recurringPaymentAudit(userID, domain.AuditActionCreate, nil))
+	if err != nil {
+		log.Printf("定期支払いの保存に失敗しました。エラー: %v", err)
+		return RecurringPaymentResponse{}, err
+	}
+
+	log.Printf("定期支払いを追加しました。ID: %s", created.ID)
+	return toRecurringPaymentResponse(created), nil
+}
+
+// UpdateRecurringPayment edits a rule. Its planned payments from today on are recreated with the new details,
+// while payments in the past and payments which already happened are left untouched.
+func (u *Usecase) UpdateRecurringPayment(userID string, ruleID string, input RecurringPaymentInput) (RecurringPaymentResponse, error) {
+	log.Printf("定期支払いID %s の更新を開始します。ユーザーID: %s", ruleID, userID)
+
+	rule, err := u.getOwnRecurringPayment(userID, ruleID)
+	if err != nil {
+		return RecurringPaymentResponse{}, err
+	}
+	if _, err := u.resolvePaymentStore(userID, input.StoreID); err != nil {
+		return RecurringPaymentResponse{}, err
+	}
+	before := rule
+	if err := applyRecurringPaymentInput(&rule, input); err != nil {
+		return RecurringPaymentResponse{}, err
+	}
+
+	from := today()
+	rule.GeneratedUntil = sql.NullTime{Time: from.AddDate(0, 0, -1), Valid: true}
+	if err := u.db.UpdateRecurringPayment(rule, from, recurringPaymentHorizon(), recurringPaymentAudit(userID, domain.AuditActionUpdate, &before)); err != nil {
+		log.Printf("定期支払いID %s の更新中にエラーが発生しました。エラー: %v", ruleID, err)
+		return RecurringPaymentResponse{}, err
+	}
+
+	log.Printf("定期支払いID %s の更新が完了しました。", ruleID)
+	return toRecurringPaymentResponse(rule), nil
+}
+
+// SetRecurringPaymentPaused pauses or resumes a rule.
+// Pausing removes its planned payments from today on. Resuming does not create the occurrences skipped while paused.
+func (u *Usecase) SetRecurringPaymentPaused(userID string, ruleID string, paused bool) (RecurringPaymentResponse, error) {
+	log.Printf("定期支払いID %s の一時停止状態を %t に変更します。ユーザーID: %s", ruleID, paused, userID)
+
+	rule, err := u.getOwnRecurringPayment(userID, ruleID)
+	if err != nil {
+		return RecurringPaymentResponse{}, err
+	}
+	if rule.IsPaused == paused {
+		return toRecurringPaymentResponse(rule), nil
+	}
+	before := rule
+
+	from := today()
+	rule.IsPaused = paused
+	rule.GeneratedUntil = sql.NullTime{Time: from.AddDate(0, 0, -1), Valid: true}
+	// 再開した場合は、今日からの予定の支払いを同じトランザクションで作成する
+	if err := u.db.UpdateRecurringPayment(rule, from, recurringPaymentHorizon(), recurringPaymentAudit(userID, domain.AuditActionUpdate, &before)); err != nil {
+		log.Printf("定期支払いID %s の更新中にエラーが発生しました。エラー: %v", ruleID, err)
+		return RecurringPaymentResponse{}, err
+	}
+
+	return toRecurringPaymentResponse(rule), nil
+}
+
+// DeleteRecurringPayment deletes a rule and its planned payments from today on.
+func (u *Usecase) DeleteRecurringPayment(userID string, ruleID string) error {
+	log.Printf("定期支払いID %s の削除を試みます。ユーザーID: %s", ruleID, userID)
+
+	rule, err := u.getOwnRecurringPayment(userID, ruleID)
+	if err != nil {
+		return err
+	}
+	if err := u.db.DeleteRecurringPayment(ruleID, today(), recurringPaymentAudit(userID, domain.AuditActionDelete, &rule)); err != nil {
+		log.Printf("定期支払いID %s の削除中にエラーが発生しました。エラー: %v", ruleID, err)
+		return err
+	}
+
+	log.Printf("定期支払いID %s の削除が完了しました。", ruleID)
+	return nil
+}
+
+// GenerateRecurringPayments creates the planned payments of all active rules up to the horizon.
+// A failing rule is logged and skipped so that it does not block the others.
+func (u *Usecase) GenerateRecurringPayments() error {
+	ids, err := u.db.GetActiveRecurringPaymentIDs()
+	if err != nil {
+		log.Printf("定期支払いの取得に失敗しました。エラー: %v", err)
+		return err
+	}
+
+	until := recurringPaymentHorizon()
+	created := 0
+	for _, id := range ids {
+		// 自動で作成した予定の支払いは、ルールを作成したユーザーの変更として記録する
+		n, err := u.db.GenerateRecurringPayments(id, until, recurringPaymentAudit("", "", nil))
+		if err != nil {
+			log.Printf("定期支払いID %s の予定の作成に失敗しました。エラー: %v", id, err)
+			continue
+		}
+		created += n
+	}
+	log.Printf("定期支払いから予定の支払いを %d 件作成しました。", created)
+	return nil
+}
+
+// RunRecurringPaymentGenerator calls GenerateRecurringPayments immediately and then every interval until ctx is done.
+func (u *Usecase) RunRecurringPaymentGenerator(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		u.GenerateRecurringPayments()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
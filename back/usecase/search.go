@@ -0,0 +1,152 @@
+package usecase
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+)
+
+// ErrInvalidSearch は検索語や検索条件が不正な場合に返されます。
+var ErrInvalidSearch = fmt.Errorf("%w: invalid search", ErrValidation)
+
+const (
+	// DefaultSearchLimit と MaxSearchLimit は種類ごとに返す検索結果の件数です。
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+	// maxSearchTerms は1回の検索で使う検索語の最大数、maxSearchTermLength は検索語1つの最大文字数です。
+	maxSearchTerms      = 10
+	maxSearchTermLength = 100
+)
+
+type SearchPaymentResult struct {
+	ID            string       `json:"id"`
+	MoneyPoolID   string       `json:"money_pool_id"`
+	MoneyPoolName string       `json:"money_pool_name"`
+	Date          time.Time    `json:"date"`
+	Title         string       `json:"title"`
+	Amount        domain.Money `json:"amount"`
+	Description   string       `json:"description"`
+	IsPlanned     bool         `json:"is_planned"`
+	StoreID       *string      `json:"store_id"`
+	StoreName     *string      `json:"store_name"`
+	TransferID    *string      `json:"transfer_id"`
+}
+
+type SearchMoneyPoolResult struct {
+	ID       string      `json:"id"`
+	Name     string      `json:"name"`
+	Type     string      `json:"type"`
+	Emoji    string      `json:"emoji"`
+	Currency string      `json:"currency"`
+	OwnerID  string      `json:"owner_id"`
+	Owner    UserSummary `json:"owner"`
+}
+
+type SearchResponse struct {
+	Query      string                  `json:"query"`
+	Payments   []SearchPaymentResult   `json:"payments"`
+	MoneyPools []SearchMoneyPoolResult `json:"money_pools"`
+	Stores     []StoreResponse         `json:"stores"`
+}
+
+// Search looks for payments, money pools and stores matching all the words in query.
+// Payments and money pools are searched in the pools loginUserID may see, the same ones GetMoneyPool allows,
+// so a user who is not logged in (empty loginUserID) only finds public ones. Stores are searched among the user's own.
+func (u *Usecase) Search(loginUserID string, query string, from *time.Time, to *time.Time, limit int) (SearchResponse, error) {
+	log.Printf("検索を開始します。ログインユーザーID: %s, 検索語: %s", loginUserID, query)
+
+	// 全角スペースも区切りとして扱う（strings.FieldsはU+3000も空白とみなす）
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return SearchResponse{}, fmt.Errorf("%w: query must not be empty", ErrInvalidSearch)
+	}
+	if len(terms) > maxSearchTerms {
+		return SearchResponse{}, fmt.Errorf("%w: too many search terms (max %d)", ErrInvalidSearch, maxSearchTerms)
+	}
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) > maxSearchTermLength {
+			return SearchResponse{}, fmt.Errorf("%w: search term is too long", ErrInvalidSearch)
+		}
+	}
+	if limit == 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit < 0 || limit > MaxSearchLimit {
+		return SearchResponse{}, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidSearch, MaxSearchLimit)
+	}
+	if from != nil && to != nil && from.After(*to) {
+		return SearchResponse{}, fmt.Errorf("%w: from must not be after to", ErrInvalidSearch)
+	}
+
+	response := SearchResponse{
+		Query:      query,
+		Payments:   []SearchPaymentResult{},
+		MoneyPools: []SearchMoneyPoolResult{},
+		Stores:     []StoreResponse{},
+	}
+
+	payments, err := u.db.SearchPayments(loginUserID, terms, from, to, limit)
+	if err != nil {
+		log.Printf("支払いの検索に失敗しました。エラー: %v", err)
+		return SearchResponse{}, err
+	}
+	for _, payment := range payments {
+		response.Payments = append(response.Payments, SearchPaymentResult{
+			ID:            payment.ID,
+			MoneyPoolID:   payment.MoneyPoolID,
+			MoneyPoolName: payment.MoneyPoolName,
+			Date:          payment.Date,
+			Title:         payment.Title,
+			Amount:        payment.Amount,
+			Description:   payment.Description,
+			IsPlanned:     payment.IsPlanned,
+			StoreID:       payment.StoreID,
+			StoreName:     payment.StoreName,
+			TransferID:    payment.TransferID,
+		})
+	}
+
+	moneyPools, err := u.db.SearchMoneyPools(loginUserID, terms, limit)
+	if err != nil {
+		log.Printf("マネープールの検索に失敗しました。エラー: %v", err)
+		return SearchResponse{}, err
+	}
+	ownerIDs := make([]string, 0, len(moneyPools))
+	for _, pool := range moneyPools {
+		ownerIDs = append(ownerIDs, pool.OwnerID)
+	}
+	owners, err := u.userSummaries(ownerIDs)
+	if err != nil {
+		return SearchResponse{}, err
+	}
+	for _, pool := range moneyPools {
+		response.MoneyPools = append(response.MoneyPools, SearchMoneyPoolResult{
+			ID:       pool.ID,
+			Name:     pool.Name,
+			Type:     pool.Type,
+			Emoji:    pool.Emoji,
+			Currency: domain.NormalizeCurrencyCode(pool.Currency),
+			OwnerID:  pool.OwnerID,
+			Owner:    owners[pool.OwnerID],
+		})
+	}
+
+	// 店はユーザーごとのものなので、ログインしている場合のみ検索する
+	if loginUserID != "" {
+		stores, err := u.db.SearchStores(loginUserID, terms, limit)
+		if err != nil {
+			log.Printf("店の検索に失敗しました。エラー: %v", err)
+			return SearchResponse{}, err
+		}
+		for _, store := range stores {
+			response.Stores = append(response.Stores, StoreResponse{ID: store.ID, Name: store.Name})
+		}
+	}
+
+	log.Printf("検索が完了しました。支払い: %d件, マネープール: %d件, 店: %d件", len(response.Payments), len(response.MoneyPools), len(response.Stores))
+	return response, nil
+}
@@ -0,0 +1,135 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+)
+
+// ErrInvalidStore は支払いに指定された店舗が存在しない、または使用できない場合に返されます。
+var ErrInvalidStore = fmt.Errorf("%w: invalid store", ErrValidation)
+
+type StoreResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// GetStores retrieves all stores registered by the user.
+func (u Usecase) GetStores(userID string) ([]StoreResponse, error) {
+	log.Printf("ユーザーID %s の店舗一覧の取得を開始します。", userID)
+	stores, err := u.db.GetStoresByUserID(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s の店舗取得中にエラーが発生しました: %v", userID, err)
+		return nil, err
+	}
+
+	response := make([]StoreResponse, 0, len(stores))
+	for _, store := range stores {
+		response = append(response, StoreResponse{
+			ID:   store.ID,
+			Name: store.Name,
+		})
+	}
+
+	log.Printf("ユーザーID %s の店舗一覧の取得が完了しました。", userID)
+	return response, nil
+}
+
+func (u Usecase) AddStore(userID string, name string) (StoreResponse, error) {
+	log.Printf("新しい店舗の追加を開始します。ユーザーID: %s, 名前: %s", userID, name)
+
+	createdStore, err := u.db.NewStore(domain.Store{
+		Name:      name,
+		CreatorID: userID,
+	})
+	if err != nil {
+		log.Printf("新しい店舗の作成中にエラーが発生しました。エラー: %v", err)
+		return StoreResponse{}, err
+	}
+
+	log.Printf("新しい店舗が作成されました。ID: %s", createdStore.ID)
+	return StoreResponse{
+		ID:   createdStore.ID,
+		Name: createdStore.Name,
+	}, nil
+}
+
+func (u Usecase) UpdateStore(userID string, storeID string, name string) (StoreResponse, error) {
+	log.Printf("店舗ID %s の更新を開始します。ユーザーID: %s", storeID, userID)
+
+	existingStore, err := u.db.GetStore(storeID)
+	if err != nil {
+		log.Printf("店舗ID %s のデータ取得中にエラーが発生しました。エラー: %v", storeID, err)
+		return StoreResponse{}, err
+	}
+
+	if existingStore.CreatorID != userID {
+		log.Printf("ユーザーID %s は店舗ID %s の更新が許可されていません。", userID, storeID)
+		return StoreResponse{}, fmt.Errorf("%w: cannot update store %s", ErrForbidden, storeID)
+	}
+
+	updatedStore := domain.Store{
+		ID:        storeID,
+		Name:      name,
+		CreatorID: userID,
+	}
+	err = u.db.UpdateStore(updatedStore)
+	if err != nil {
+		log.Printf("店舗ID %s の更新中にエラーが発生しました。エラー: %v", storeID, err)
+		return StoreResponse{}, err
+	}
+
+	log.Printf("店舗ID %s の更新が完了しました。", storeID)
+	return StoreResponse{
+		ID:   updatedStore.ID,
+		Name: updatedStore.Name,
+	}, nil
+}
+
+// DeleteStore deletes a store. Payments attributed to the store keep existing without a store.
+func (u Usecase) DeleteStore(userID string, storeID string) error {
+	log.Printf("店舗ID %s の削除を試みます。ユーザーID: %s", storeID, userID)
+
+	store, err := u.db.GetStore(storeID)
+	if err != nil {
+		log.Printf("店舗ID %s のデータ取得中にエラーが発生しました。エラー: %v", storeID, err)
+		return err
+	}
+
+	if store.CreatorID != userID {
+		log.Printf("ユーザーID %s は店舗ID %s の削除が許可されていません。", userID, storeID)
+		return fmt.Errorf("%w: cannot delete store %s", ErrForbidden, storeID)
+	}
+
+	err = u.db.DeleteStore(storeID)
+	if err != nil {
+		log.Printf("店舗ID %s の削除中にエラーが発生しました。エラー: %v", storeID, err)
+		return err
+	}
+
+	log.Printf("店舗ID %s の削除が完了しました。", storeID)
+	return nil
+}
+
+// resolvePaymentStore checks that the store set on a payment belongs to the user and returns its name.
+func (u *Usecase) resolvePaymentStore(userID string, storeID *string) (*string, error) {
+	if storeID == nil {
+		return nil, nil
+	}
+	store, err := u.db.GetStore(*storeID)
+	if errors.Is(err, ErrNotFound) {
+		log.Printf("店舗ID %s が見つかりません。", *storeID)
+		return nil, fmt.Errorf("%w: store %s not found", ErrInvalidStore, *storeID)
+	}
+	if err != nil {
+		log.Printf("店舗ID %s の取得に失敗しました。エラー: %v", *storeID, err)
+		return nil, err
+	}
+	if store.CreatorID != userID {
+		log.Printf("ユーザーID %s は店舗ID %s を使用する権限がありません。", userID, *storeID)
+		return nil, fmt.Errorf("%w: store %s not found", ErrInvalidStore, *storeID)
+	}
+	return &store.Name, nil
+}
@@ -0,0 +1,265 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+)
+
+// ErrInvalidTransfer は振替の入力が不正な場合に返されます。
+var ErrInvalidTransfer = fmt.Errorf("%w: invalid transfer", ErrValidation)
+
+// TransferInput is the user input of a transfer between two money pools of the user.
+type TransferInput struct {
+	FromMoneyPoolID string
+	ToMoneyPoolID   string
+	Date            time.Time
+	Title           string
+	Description     string
+	IsPlanned       bool
+	// Amount is the positive amount leaving the source pool.
+	Amount domain.Money
+	// ToAmount is the amount arriving in the destination pool. It is required only if the pools use different currencies.
+	ToAmount *domain.Money
+}
+
+type TransferResponse struct {
+	ID                string       `json:"id"`
+	Date              time.Time    `json:"date"`
+	Title             string       `json:"title"`
+	Description       string       `json:"description"`
+	IsPlanned         bool         `json:"is_planned"`
+	FromMoneyPoolID   string       `json:"from_money_pool_id"`
+	FromMoneyPoolName string       `json:"from_money_pool_name"`
+	FromPaymentID     string       `json:"from_payment_id"`
+	Amount            domain.Money `json:"amount"`
+	ToMoneyPoolID     string       `json:"to_money_pool_id"`
+	ToMoneyPoolName   string       `json:"to_money_pool_name"`
+	ToPaymentID       string       `json:"to_payment_id"`
+	ToAmount          domain.Money `json:"to_amount"`
+}
+
+func toTransferResponse(transfer domain.Transfer, from domain.MoneyPool, to domain.MoneyPool) TransferResponse {
+	return TransferResponse{
+		ID:                transfer.ID,
+		Date:              transfer.Date,
+		Title:             transfer.Title,
+		Description:       transfer.Description,
+		IsPlanned:         transfer.IsPlanned,
+		FromMoneyPoolID:   transfer.FromMoneyPoolID,
+		FromMoneyPoolName: from.Name,
+		FromPaymentID:     transfer.FromPaymentID,
+		Amount:            transfer.FromAmount,
+		ToMoneyPoolID:     transfer.ToMoneyPoolID,
+		ToMoneyPoolName:   to.Name,
+		ToPaymentID:       transfer.ToPaymentID,
+		ToAmount:          transfer.ToAmount,
+	}
+}
+
+// getTransferPool retrieves a money pool used in a transfer and checks that the user owns it.
+func (u *Usecase) getTransferPool(userID string, moneyPoolID string) (domain.MoneyPool, error) {
+	pool, err := u.db.GetMoneyPool(moneyPoolID)
+	if err != nil {
+		log.Printf("マネープールID %s の取得に失敗しました。エラー: %v", moneyPoolID, err)
+		return domain.MoneyPool{}, fmt.Errorf("%w: money pool %s not found", ErrInvalidTransfer, moneyPoolID)
+	}
+	if pool.OwnerID != userID || pool.IsDeleted {
+		log.Printf("エラー: ユーザーID %s はマネープールID %s の振替に対して権限がありません。", userID, moneyPoolID)
+		return domain.MoneyPool{}, fmt.Errorf("%w: money pool %s cannot be used", ErrInvalidTransfer, moneyPoolID)
+	}
+	return pool, nil
+}
+
+// getTransferPoolIncludingTrash retrieves a money pool on one side of a transfer, including one in the trash.
+// Moving one of the pools to the trash keeps its payments, so the transfer is still shown from the other pool and has to stay readable.
+func (u *Usecase) getTransferPoolIncludingTrash(moneyPoolID string) (domain.MoneyPool, error) {
+	pool, err := u.db.GetMoneyPool(moneyPoolID)
+	if errors.Is(err, ErrNotFound) {
+		pool, err = u.db.GetDeletedMoneyPool(moneyPoolID)
+	}
+	if err != nil {
+		log.Printf("マネープールID %s の取得に失敗しました。エラー: %v", moneyPoolID, err)
+		return domain.MoneyPool{}, err
+	}
+	return pool, nil
+}
+
+// applyTransferInput validates the input and sets it on the transfer. It returns the pools on both sides.
+func (u *Usecase) applyTransferInput(userID string, transfer *domain.Transfer, input TransferInput) (domain.MoneyPool, domain.MoneyPool, error) {
+	if input.FromMoneyPoolID == input.ToMoneyPoolID {
+		return domain.MoneyPool{}, domain.MoneyPool{}, fmt.Errorf("%w: source and destination must be different money pools", ErrInvalidTransfer)
+	}
+	if input.Amount.Sign() <= 0 {
+		return domain.MoneyPool{}, domain.MoneyPool{}, fmt.Errorf("%w: amount must be positive", ErrInvalidTransfer)
+	}
+	from, err := u.getTransferPool(userID, input.FromMoneyPoolID)
+	if err != nil {
+		return domain.MoneyPool{}, domain.MoneyPool{}, err
+	}
+	to, err := u.getTransferPool(userID, input.ToMoneyPoolID)
+	if err != nil {
+		return domain.MoneyPool{}, domain.MoneyPool{}, err
+	}
+
+	toAmount := input.Amount
+	if domain.NormalizeCurrencyCode(from.Currency) == domain.NormalizeCurrencyCode(to.Currency) {
+		if input.ToAmount != nil && !input.ToAmount.Equal(input.Amount) {
+			return domain.MoneyPool{}, domain.MoneyPool{}, fmt.Errorf("%w: to_amount must equal amount between pools of the same currency", ErrInvalidTransfer)
+		}
+	} else {
+		if input.ToAmount == nil || input.ToAmount.Sign() <= 0 {
+			return domain.MoneyPool{}, domain.MoneyPool{}, fmt.Errorf("%w: a positive to_amount is required between pools of different currencies", ErrInvalidTransfer)
+		}
+		toAmount = *input.ToAmount
+	}
+
+	transfer.Date = input.Date
+	transfer.Title = input.Title
+	transfer.Description = input.Description
+	transfer.IsPlanned = input.IsPlanned
+	transfer.FromMoneyPoolID = from.ID
+	transfer.FromAmount = input.Amount
+	transfer.ToMoneyPoolID = to.ID
+	transfer.ToAmount = toAmount
+	return from, to, nil
+}
+
+// getOwnTransfer retrieves a transfer and checks that it was created by the user.
+func (u *Usecase) getOwnTransfer(userID string, transferID string) (domain.Transfer, error) {
+	transfer, err := u.db.GetTransfer(transferID)
+	if err != nil {
+		log.Printf("振替ID %s の取得に失敗しました。エラー: %v", transferID, err)
+		return domain.Transfer{}, err
+	}
+	if transfer.CreatorID != userID {
+		log.Printf("ユーザーID %s は振替ID %s の操作が許可されていません。", userID, transferID)
+		return domain.Transfer{}, fmt.Errorf("%w: cannot access transfer %s", ErrForbidden, transferID)
+	}
+	return transfer, nil
+}
+
+// GetTransfers retrieves the transfers of the user, newest first.
+func (u *Usecase) GetTransfers(userID string) ([]TransferResponse, error) {
+	log.Printf("ユーザーID %s の振替一覧の取得を開始します。", userID)
+	transfers, err := u.db.GetTransfersByUserID(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s の振替取得中にエラーが発生しました: %v", userID, err)
+		return nil, err
+	}
+	pools, err := u.db.GetMoneyPoolsByUserID(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s のマネープール取得に失敗しました。エラー: %v", userID, err)
+		return nil, err
+	}
+	// ゴミ箱にあるマネープールとの振替も一覧に出るので、その名前も引けるようにする
+	deletedPools, err := u.db.GetDeletedMoneyPoolsByUserID(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s のゴミ箱のマネープール取得に失敗しました。エラー: %v", userID, err)
+		return nil, err
+	}
+	poolsByID := make(map[string]domain.MoneyPool, len(pools)+len(deletedPools))
+	for _, pool := range append(pools, deletedPools...) {
+		poolsByID[pool.ID] = pool
+	}
+
+	response := make([]TransferResponse, 0, len(transfers))
+	for _, transfer := range transfers {
+		response = append(response, toTransferResponse(transfer, poolsByID[transfer.FromMoneyPoolID], poolsByID[transfer.ToMoneyPoolID]))
+	}
+	return response, nil
+}
+
+// GetTransfer retrieves a single transfer of the user. It stays readable when one of its pools is in the trash,
+// as long as the user still owns one of the pools.
+func (u *Usecase) GetTransfer(userID string, transferID string) (TransferResponse, error) {
+	transfer, err := u.getOwnTransfer(userID, transferID)
+	if err != nil {
+		return TransferResponse{}, err
+	}
+	from, err := u.getTransferPoolIncludingTrash(transfer.FromMoneyPoolID)
+	if err != nil {
+		return TransferResponse{}, err
+	}
+	to, err := u.getTransferPoolIncludingTrash(transfer.ToMoneyPoolID)
+	if err != nil {
+		return TransferResponse{}, err
+	}
+	if from.OwnerID != userID && to.OwnerID != userID {
+		log.Printf("ユーザーID %s は振替ID %s のどちらのマネープールも所有していません。", userID, transferID)
+		return TransferResponse{}, fmt.Errorf("%w: cannot access transfer %s", ErrForbidden, transferID)
+	}
+	return toTransferResponse(transfer, from, to), nil
+}
+
+// AddTransfer moves money from one money pool of the user to another.
+// Both legs are recorded together so that the books always stay balanced.
+func (u *Usecase) AddTransfer(userID string, input TransferInput) (TransferResponse, error) {
+	log.Printf("振替の追加を開始します。ユーザーID: %s, 振替元: %s, 振替先: %s", userID, input.FromMoneyPoolID, input.ToMoneyPoolID)
+
+	transfer := domain.Transfer{CreatorID: userID}
+	from, to, err := u.applyTransferInput(userID, &transfer, input)
+	if err != nil {
+		return TransferResponse{}, err
+	}
+
+	created, err := u.db.NewTransfer(transfer, func(created domain.Transfer) ([]domain.AuditLog, error) {
+		return transferAuditLogs(userID, domain.AuditActionCreate, nil, &created)
+	})
+	if err != nil {
+		log.Printf("振替の保存に失敗しました。エラー: %v", err)
+		return TransferResponse{}, err
+	}
+
+	log.Printf("振替を追加しました。ID: %s", created.ID)
+	return toTransferResponse(created, from, to), nil
+}
+
+// UpdateTransfer updates a transfer and both of its legs.
+func (u *Usecase) UpdateTransfer(userID string, transferID string, input TransferInput) (TransferResponse, error) {
+	log.Printf("振替ID %s の更新を開始します。ユーザーID: %s", transferID, userID)
+
+	transfer, err := u.getOwnTransfer(userID, transferID)
+	if err != nil {
+		return TransferResponse{}, err
+	}
+	before := transfer
+	from, to, err := u.applyTransferInput(userID, &transfer, input)
+	if err != nil {
+		return TransferResponse{}, err
+	}
+
+	err = u.db.UpdateTransfer(transfer, func(updated domain.Transfer) ([]domain.AuditLog, error) {
+		return transferAuditLogs(userID, domain.AuditActionUpdate, &before, &updated)
+	})
+	if err != nil {
+		log.Printf("振替ID %s の更新中にエラーが発生しました。エラー: %v", transferID, err)
+		return TransferResponse{}, err
+	}
+
+	log.Printf("振替ID %s の更新が完了しました。", transferID)
+	return toTransferResponse(transfer, from, to), nil
+}
+
+// DeleteTransfer deletes a transfer and both of its legs.
+func (u *Usecase) DeleteTransfer(userID string, transferID string) error {
+	log.Printf("振替ID %s の削除を試みます。ユーザーID: %s", transferID, userID)
+
+	transfer, err := u.getOwnTransfer(userID, transferID)
+	if err != nil {
+		return err
+	}
+	err = u.db.DeleteTransfer(transferID, func(string) ([]domain.AuditLog, error) {
+		return transferAuditLogs(userID, domain.AuditActionDelete, &transfer, nil)
+	})
+	if err != nil {
+		log.Printf("振替ID %s の削除中にエラーが発生しました。エラー: %v", transferID, err)
+		return err
+	}
+
+	log.Printf("振替ID %s の削除が完了しました。", transferID)
+	return nil
+}
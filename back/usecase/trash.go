@@ -0,0 +1,165 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+)
+
+// ErrMoneyPoolNotInTrash は指定されたマネープールがゴミ箱にない場合に返されます。
+var ErrMoneyPoolNotInTrash = fmt.Errorf("%w: money pool is not in the trash", ErrNotFound)
+
+type TrashedMoneyPool struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Description  string     `json:"description"`
+	Type         string     `json:"type"`
+	Emoji        string     `json:"emoji"`
+	Currency     string     `json:"currency"`
+	PaymentCount int64      `json:"payment_count"`
+	DeletedAt    *time.Time `json:"deleted_at"`
+	// PurgeAt はこの日以降に完全に削除される。自動で削除しない設定の場合はnull
+	PurgeAt *time.Time `json:"purge_at"`
+}
+
+type TrashResponse struct {
+	RetentionDays int                `json:"retention_days"`
+	MoneyPools    []TrashedMoneyPool `json:"money_pools"`
+}
+
+// trashPurgeDate returns the date a money pool deleted at deletedAt is purged, or nil if it is kept forever.
+func trashPurgeDate(deletedAt time.Time, retentionDays int) *time.Time {
+	if retentionDays <= 0 {
+		return nil
+	}
+	purgeAt := deletedAt.AddDate(0, 0, retentionDays+1)
+	return &purgeAt
+}
+
+// GetTrash returns the money pools of the user in the trash, most recently deleted first.
+func (u *Usecase) GetTrash(userID string, retentionDays int) (TrashResponse, error) {
+	log.Printf("ゴミ箱のマネープールを取得します。ユーザーID: %s", userID)
+	moneyPools, err := u.db.GetDeletedMoneyPoolsByUserID(userID)
+	if err != nil {
+		log.Printf("ユーザーID %s のゴミ箱のマネープールの取得に失敗しました。エラー: %v", userID, err)
+		return TrashResponse{}, err
+	}
+
+	response := TrashResponse{RetentionDays: retentionDays, MoneyPools: []TrashedMoneyPool{}}
+	if retentionDays < 0 {
+		response.RetentionDays = 0
+	}
+	for _, pool := range moneyPools {
+		stats, err := u.db.GetMoneyPoolPaymentStats(pool.ID)
+		if err != nil {
+			log.Printf("MoneyPoolの支払い件数の取得に失敗: Pool ID: %s, エラー: %v", pool.ID, err)
+			return TrashResponse{}, err
+		}
+		trashed := TrashedMoneyPool{
+			ID:           pool.ID,
+			Name:         pool.Name,
+			Description:  pool.Description,
+			Type:         pool.Type,
+			Emoji:        pool.Emoji,
+			Currency:     domain.NormalizeCurrencyCode(pool.Currency),
+			PaymentCount: stats.PaymentCount,
+		}
+		if pool.DeletedAt.Valid {
+			deletedAt := pool.DeletedAt.Time
+			trashed.DeletedAt = &deletedAt
+			trashed.PurgeAt = trashPurgeDate(deletedAt, retentionDays)
+		}
+		response.MoneyPools = append(response.MoneyPools, trashed)
+	}
+	return response, nil
+}
+
+// getTrashedMoneyPool retrieves a money pool of the user in the trash.
+func (u *Usecase) getTrashedMoneyPool(userID string, moneyPoolID string) (domain.MoneyPool, error) {
+	moneyPool, err := u.db.GetDeletedMoneyPool(moneyPoolID)
+	if err != nil {
+		log.Printf("ゴミ箱のマネープールID: %sの取得に失敗しました。エラー: %v", moneyPoolID, err)
+		return domain.MoneyPool{}, fmt.Errorf("%w: %s", ErrMoneyPoolNotInTrash, moneyPoolID)
+	}
+	if moneyPool.OwnerID != userID {
+		log.Printf("ユーザーID: %sはマネープールID: %sの所有者ではありません。", userID, moneyPoolID)
+		return domain.MoneyPool{}, fmt.Errorf("%w: cannot access money pool %s", ErrForbidden, moneyPoolID)
+	}
+	return moneyPool, nil
+}
+
+// RestoreMoneyPool moves a money pool of the user out of the trash, with all its payments.
+func (u *Usecase) RestoreMoneyPool(userID string, moneyPoolID string) error {
+	log.Printf("ユーザーID: %sがマネープールID: %sをゴミ箱から戻します。", userID, moneyPoolID)
+	moneyPool, err := u.getTrashedMoneyPool(userID, moneyPoolID)
+	if err != nil {
+		return err
+	}
+	after := moneyPool
+	after.IsDeleted = false
+	audit := auditChange[string](userID, domain.AuditActionRestore, domain.AuditEntityMoneyPool, moneyPoolID, &moneyPoolID, moneyPoolSnapshot(moneyPool), moneyPoolSnapshot(after))
+	if err := u.db.RestoreMoneyPool(moneyPoolID, audit); err != nil {
+		log.Printf("マネープールID: %sの復元中にエラーが発生しました: %v", moneyPoolID, err)
+		return err
+	}
+	log.Printf("マネープールID: %sをゴミ箱から戻しました。", moneyPoolID)
+	return nil
+}
+
+// PurgeMoneyPool permanently deletes a money pool of the user in the trash with its payments.
+// Pools that are not in the trash have to be deleted with DeleteMoneyPool first.
+func (u *Usecase) PurgeMoneyPool(userID string, moneyPoolID string) error {
+	log.Printf("ユーザーID: %sがマネープールID: %sを完全に削除します。", userID, moneyPoolID)
+	moneyPool, err := u.getTrashedMoneyPool(userID, moneyPoolID)
+	if err != nil {
+		return err
+	}
+	audit := auditChange[string](userID, domain.AuditActionDelete, domain.AuditEntityMoneyPool, moneyPoolID, &moneyPoolID, moneyPoolSnapshot(moneyPool), nil)
+	if err := u.db.PurgeMoneyPool(moneyPoolID, audit); err != nil {
+		log.Printf("マネープールID: %sの完全な削除中にエラーが発生しました: %v", moneyPoolID, err)
+		return err
+	}
+	log.Printf("マネープールID: %sを完全に削除しました。", moneyPoolID)
+	return nil
+}
+
+// PurgeExpiredMoneyPools permanently deletes the money pools that have been in the trash for more than retentionDays days.
+// A pool that fails is logged and retried the next time. These purges are not recorded in the audit log, which has no actor for them.
+func (u *Usecase) PurgeExpiredMoneyPools(retentionDays int) {
+	if retentionDays <= 0 {
+		return
+	}
+	ids, err := u.db.GetMoneyPoolIDsDeletedBefore(today().AddDate(0, 0, -retentionDays))
+	if err != nil {
+		log.Printf("ゴミ箱の期限切れのマネープールの取得に失敗しました。エラー: %v", err)
+		return
+	}
+	purged := 0
+	for _, id := range ids {
+		if err := u.db.PurgeMoneyPool(id, nil); err != nil {
+			log.Printf("マネープールID: %sの完全な削除に失敗しました。エラー: %v", id, err)
+			continue
+		}
+		purged++
+	}
+	if purged > 0 {
+		log.Printf("ゴミ箱のマネープールを%d件完全に削除しました。", purged)
+	}
+}
+
+// RunTrashPurger calls PurgeExpiredMoneyPools immediately and then every interval until ctx is done.
+func (u *Usecase) RunTrashPurger(ctx context.Context, interval time.Duration, retentionDays int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		u.PurgeExpiredMoneyPools(retentionDays)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/walnuts1018/openchokin/back/domain"
+	"golang.org/x/text/language"
+)
+
+var (
+	// ErrInvalidUserProfile は編集しようとしたプロフィールの値が不正な場合に返されます。
+	ErrInvalidUserProfile = fmt.Errorf("%w: invalid user profile", ErrValidation)
+	// ErrHandleTaken は設定しようとしたハンドルが他のユーザーに使われている場合に返されます。
+	ErrHandleTaken = fmt.Errorf("%w: handle is already taken", ErrConflict)
+)
+
+// handlePattern はハンドルに使える文字列。@なしで、保存するときは小文字にする
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,32}$`)
+
+// UserSummary is how a user is shown to other users: as a group member, the owner of a money pool or the actor of a change.
+// The email address is not included.
+type UserSummary struct {
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	Handle    *string `json:"handle"`
+	AvatarURL *string `json:"avatar_url"`
+}
+
+// UserProfileResponse is the profile of the login user.
+// DisplayName, AvatarURL, Locale and Timezone are the values the user set, or the ones from the OIDC provider if the user set none.
+type UserProfileResponse struct {
+	ID           string  `json:"id"`
+	Handle       *string `json:"handle"`
+	DisplayName  *string `json:"display_name"`
+	Email        *string `json:"email"`
+	AvatarURL    *string `json:"avatar_url"`
+	Locale       *string `json:"locale"`
+	Timezone     *string `json:"timezone"`
+	BaseCurrency string  `json:"base_currency"`
+}
+
+// UserProfileInput is a change to the profile of the login user.
+// Nil fields are left as they are, and empty strings clear the value so that the one from the OIDC provider is used again.
+type UserProfileInput struct {
+	Handle      *string `json:"handle"`
+	DisplayName *string `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url"`
+	Locale      *string `json:"locale"`
+	Timezone    *string `json:"timezone"`
+}
+
+// firstNonEmpty returns the first of values that is set and not empty.
+func firstNonEmpty(values ...*string) *string {
+	for _, value := range values {
+		if value != nil && *value != "" {
+			return value
+		}
+	}
+	return nil
+}
+
+// userName returns the name a user is shown with, or an empty string if the user has none.
+func userName(user domain.User) string {
+	if name := firstNonEmpty(user.DisplayName, user.OIDCName, user.Handle); name != nil {
+		return *name
+	}
+	return ""
+}
+
+func toUserSummary(user domain.User) UserSummary {
+	return UserSummary{
+		ID:        user.ID,
+		Name:      userName(user),
+		Handle:    user.Handle,
+		AvatarURL: firstNonEmpty(user.AvatarURL, user.OIDCPicture),
+	}
+}
+
+func toUserProfileResponse(user domain.User) UserProfileResponse {
+	return UserProfileResponse{
+		ID:           user.ID,
+		Handle:       user.Handle,
+		DisplayName:  firstNonEmpty(user.DisplayName, user.OIDCName),
+		Email:        user.Email,
+		AvatarURL:    firstNonEmpty(user.AvatarURL, user.OIDCPicture),
+		Locale:       firstNonEmpty(user.Locale, user.OIDCLocale),
+		Timezone:     firstNonEmpty(user.Timezone, user.OIDCZoneinfo),
+		BaseCurrency: domain.NormalizeCurrencyCode(user.BaseCurrency),
+	}
+}
+
+// userSummaries returns the summaries of the users with the given IDs, by ID.
+// A user that does not exist is shown with the ID only.
+func (u *Usecase) userSummaries(ids []string) (map[string]UserSummary, error) {
+	users, err := u.db.GetUsers(ids)
+	if err != nil {
+		log.Printf("ユーザー情報の取得に失敗しました。エラー: %v", err)
+		return nil, err
+	}
+	summaries := map[string]UserSummary{}
+	for _, id := range ids {
+		summaries[id] = UserSummary{ID: id}
+	}
+	for _, user := range users {
+		summaries[user.ID] = toUserSummary(user)
+	}
+	return summaries, nil
+}
+
+// mergeClaim copies a claim into the stored value. Claims the token does not carry keep the stored value.
+// It reports whether the stored value changed. The email address is not merged but always replaced, see LoginUser.
+func mergeClaim(stored **string, claim *string) bool {
+	if claim == nil || *claim == "" {
+		return false
+	}
+	if *stored != nil && **stored == *claim {
+		return false
+	}
+	*stored = claim
+	return true
+}
+
+// sameString reports whether two optional strings are equal.
+func sameString(a *string, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// LoginUser creates the user on the first login, and keeps the profile taken from the OIDC claims up to date.
+// claims holds the ID and the OIDC fields of the user.
+// The email address is replaced on every login, and cleared if the token has no verified one,
+// so that users are not looked up by an address they may no longer control.
+func (u Usecase) LoginUser(claims domain.User) error {
+	user, err := u.db.GetUser(claims.ID)
+	if errors.Is(err, ErrNotFound) {
+		_, err := u.NewUser(claims)
+		return err
+	}
+	if err != nil {
+		log.Printf("ユーザーID %s の取得に失敗しました。エラー: %v", claims.ID, err)
+		return err
+	}
+
+	changed := !sameString(user.Email, claims.Email)
+	user.Email = claims.Email
+	changed = mergeClaim(&user.OIDCName, claims.OIDCName) || changed
+	changed = mergeClaim(&user.OIDCPicture, claims.OIDCPicture) || changed
+	changed = mergeClaim(&user.OIDCLocale, claims.OIDCLocale) || changed
+	changed = mergeClaim(&user.OIDCZoneinfo, claims.OIDCZoneinfo) || changed
+	if !changed {
+		return nil
+	}
+
+	log.Printf("ユーザーID %s のOIDCのプロフィールを更新します。", user.ID)
+	if err := u.db.UpdateUserClaims(user); err != nil {
+		log.Printf("ユーザーID %s のOIDCのプロフィールの更新に失敗しました。エラー: %v", user.ID, err)
+		return err
+	}
+	return nil
+}
+
+// GetMe returns the profile of the login user.
+func (u Usecase) GetMe(userID string) (UserProfileResponse, error) {
+	user, err := u.GetUser(userID)
+	if err != nil {
+		return UserProfileResponse{}, err
+	}
+	return toUserProfileResponse(user), nil
+}
+
+// normalizeHandle returns the handle as it is stored: without a leading @ and in lower case.
+func normalizeHandle(handle string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+}
+
+// applyUserProfileInput validates input and applies it to user.
+func applyUserProfileInput(user *domain.User, input UserProfileInput) error {
+	// 空文字列はnilにして、OIDCの値に戻す
+	optional := func(value string) *string {
+		if value == "" {
+			return nil
+		}
+		return &value
+	}
+
+	if input.Handle != nil {
+		handle := normalizeHandle(*input.Handle)
+		if handle != "" && !handlePattern.MatchString(handle) {
+			return fmt.Errorf("%w: handle must be 3 to 32 letters, digits or underscores", ErrInvalidUserProfile)
+		}
+		user.Handle = optional(handle)
+	}
+	if input.DisplayName != nil {
+		displayName := strings.TrimSpace(*input.DisplayName)
+		if utf8.RuneCountInString(displayName) > 100 {
+			return fmt.Errorf("%w: display_name must be at most 100 characters", ErrInvalidUserProfile)
+		}
+		user.DisplayName = optional(displayName)
+	}
+	if input.AvatarURL != nil {
+		avatarURL := strings.TrimSpace(*input.AvatarURL)
+		if avatarURL != "" {
+			parsed, err := url.Parse(avatarURL)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || len(avatarURL) > 2048 {
+				return fmt.Errorf("%w: avatar_url must be an http or https URL", ErrInvalidUserProfile)
+			}
+		}
+		user.AvatarURL = optional(avatarURL)
+	}
+	if input.Locale != nil {
+		locale := strings.TrimSpace(*input.Locale)
+		if locale != "" {
+			tag, err := language.Parse(locale)
+			if err != nil {
+				return fmt.Errorf("%w: locale %q is not a BCP 47 language tag", ErrInvalidUserProfile, locale)
+			}
+			locale = tag.String()
+		}
+		user.Locale = optional(locale)
+	}
+	if input.Timezone != nil {
+		timezone := strings.TrimSpace(*input.Timezone)
+		if timezone != "" {
+			// "Local"はサーバーのタイムゾーンになってしまうので受け付けない
+			if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+				return fmt.Errorf("%w: timezone %q is not an IANA time zone", ErrInvalidUserProfile, timezone)
+			}
+		}
+		user.Timezone = optional(timezone)
+	}
+	return nil
+}
+
+// UpdateMe changes the profile of the login user.
+func (u Usecase) UpdateMe(userID string, input UserProfileInput) (UserProfileResponse, error) {
+	log.Printf("ユーザーID %s のプロフィールの更新を開始します。", userID)
+
+	user, err := u.GetUser(userID)
+	if err != nil {
+		return UserProfileResponse{}, err
+	}
+	if err := applyUserProfileInput(&user, input); err != nil {
+		return UserProfileResponse{}, err
+	}
+
+	// ハンドルの重複はデータベースの一意制約で確かめる。先に調べると同時に同じハンドルにした場合に500になる
+	err = u.UpdateUser(user)
+	if errors.Is(err, domain.ErrHandleTaken) {
+		return UserProfileResponse{}, fmt.Errorf("%w: @%s", ErrHandleTaken, *user.Handle)
+	}
+	if err != nil {
+		return UserProfileResponse{}, err
+	}
+	log.Printf("ユーザーID %s のプロフィールを更新しました。", userID)
+	return toUserProfileResponse(user), nil
+}
+
+// LookupUser finds a user by email address or handle, to add them to a user group.
+// Only exact matches are returned, so that users cannot be listed by guessing parts of their addresses.
+func (u Usecase) LookupUser(email string, handle string) (UserSummary, error) {
+	var user domain.User
+	var err error
+	if email != "" {
+		user, err = u.db.GetUserByEmail(strings.TrimSpace(email))
+	} else {
+		user, err = u.db.GetUserByHandle(normalizeHandle(handle))
+	}
+	if err != nil {
+		log.Printf("ユーザーが見つかりません。エラー: %v", err)
+		return UserSummary{}, err
+	}
+	return toUserSummary(user), nil
+}
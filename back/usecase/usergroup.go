@@ -8,13 +8,36 @@ import (
 	"github.com/walnuts1018/openchokin/back/domain"
 )
 
-type UserGroupMember struct {
-	ID string `json:"id"`
-}
 type UserGroupResponse struct {
-	ID      string            `json:"id"`
-	Name    string            `json:"name"`
-	Members []UserGroupMember `json:"members"`
+	ID      string        `json:"id"`
+	Name    string        `json:"name"`
+	Members []UserSummary `json:"members"`
+}
+
+// checkUserGroupMembers removes duplicated member IDs and checks that every member is a registered user.
+// It returns the IDs to store and the members to show in the response.
+func (u Usecase) checkUserGroupMembers(memberIDs []string) ([]string, []UserSummary, error) {
+	ids := []string{}
+	members := []UserSummary{}
+	seen := map[string]bool{}
+	for _, memberID := range memberIDs {
+		if seen[memberID] {
+			continue
+		}
+		seen[memberID] = true
+		member, err := u.db.GetUser(memberID)
+		if errors.Is(err, ErrNotFound) {
+			log.Printf("ユーザーID %s のユーザーが見つかりません。", memberID)
+			return nil, nil, fmt.Errorf("%w: user %s does not exist", ErrValidation, memberID)
+		}
+		if err != nil {
+			log.Printf("ユーザーID %s のユーザーの取得に失敗しました。エラー: %v", memberID, err)
+			return nil, nil, err
+		}
+		ids = append(ids, memberID)
+		members = append(members, toUserSummary(member))
+	}
+	return ids, members, nil
 }
 
 // AddUserGroup creates a new user group with the given members
@@ -22,6 +45,11 @@ func (u Usecase) AddUserGroup(userID string, name string, memberIDs []string) (U
 	// Log the action of adding a new user group
 	log.Printf("ユーザーID %s による新しいユーザーグループ %s の追加を開始します。", userID, name)
 
+	memberIDs, members, err := u.checkUserGroupMembers(memberIDs)
+	if err != nil {
+		return UserGroupResponse{}, err
+	}
+
 	// Create a new UserGroup object
 	newGroup := domain.UserGroup{
 		CreatorID: userID,
@@ -29,7 +57,9 @@ func (u Usecase) AddUserGroup(userID string, name string, memberIDs []string) (U
 	}
 
 	// Add the new user group using the DB interface
-	addedGroup, err := u.db.NewUserGroup(newGroup)
+	addedGroup, err := u.db.NewUserGroup(newGroup, memberIDs, auditCreate(userID, domain.AuditEntityUserGroup, func(created domain.UserGroup) (string, *string, any) {
+		return created.ID, nil, userGroupAuditSnapshot{ID: created.ID, Name: created.Name, MemberIDs: append([]string{}, memberIDs...)}
+	}))
 	if err != nil {
 		log.Printf("ユーザーグループ %s の追加中にエラーが発生しました: %v", name, err)
 		return UserGroupResponse{}, err
@@ -40,13 +70,9 @@ func (u Usecase) AddUserGroup(userID string, name string, memberIDs []string) (U
 
 	// Create a response object
 	response := UserGroupResponse{
-		ID:   addedGroup.ID,
-		Name: addedGroup.Name,
-	}
-
-	// For each member ID, create a UserGroupMember and add it to the response
-	for _, memberID := range memberIDs {
-		response.Members = append(response.Members, UserGroupMember{ID: memberID})
+		ID:      addedGroup.ID,
+		Name:    addedGroup.Name,
+		Members: members,
 	}
 
 	return response, nil
@@ -73,7 +99,7 @@ func (u *Usecase) GetUserGroups(userID string) ([]UserGroupResponse, error) {
 		if group.CreatorID != userID {
 			errMessage := fmt.Sprintf("ユーザー %s はユーザーグループ %s の作成者ではありません。", userID, group.ID)
 			log.Print(errMessage)
-			return nil, fmt.Errorf(errMessage)
+			return nil, fmt.Errorf("%w: %s", ErrForbidden, errMessage)
 		}
 
 		// Get the members of the current user group.
@@ -83,10 +109,10 @@ func (u *Usecase) GetUserGroups(userID string) ([]UserGroupResponse, error) {
 			return nil, err
 		}
 
-		// Map members data to UserGroupMember slice.
-		memberResponses := make([]UserGroupMember, len(members))
+		// Map members data to UserSummary slice.
+		memberResponses := make([]UserSummary, len(members))
 		for i, member := range members {
-			memberResponses[i] = UserGroupMember{ID: member.ID}
+			memberResponses[i] = toUserSummary(member)
 		}
 
 		// Add the constructed UserGroupResponse to the response slice.
@@ -117,11 +143,23 @@ func (u Usecase) UpdateUserGroup(userID string, userGroupID string, name string,
 	// Validate the userID against the CreatorID of the UserGroup
 	if userID != userGroup.CreatorID {
 		log.Printf("ユーザーID %s はユーザーグループID %s を更新する権限がありません。", userID, userGroupID)
-		return UserGroupResponse{}, errors.New("user is not authorized to update this user group")
+		return UserGroupResponse{}, fmt.Errorf("%w: user %s cannot update the user group %s", ErrForbidden, userID, userGroupID)
+	}
+
+	memberIDs, members, err := u.checkUserGroupMembers(memberIDs)
+	if err != nil {
+		return UserGroupResponse{}, err
+	}
+
+	before, err := u.userGroupSnapshot(userGroup)
+	if err != nil {
+		return UserGroupResponse{}, err
 	}
 
 	// Update the user group with the new member IDs
-	updatedGroup, err := u.db.UpdateUserGroup(userGroupID, name, memberIDs)
+	after := userGroupAuditSnapshot{ID: userGroupID, Name: name, MemberIDs: append([]string{}, memberIDs...)}
+	updatedGroup, err := u.db.UpdateUserGroup(userGroupID, name, memberIDs,
+		auditChange[string](userID, domain.AuditActionUpdate, domain.AuditEntityUserGroup, userGroupID, nil, before, after))
 	if err != nil {
 		log.Printf("ユーザーグループID %s の更新中にエラー: %v", userGroupID, err)
 		return UserGroupResponse{}, err
@@ -131,13 +169,9 @@ func (u Usecase) UpdateUserGroup(userID string, userGroupID string, name string,
 
 	// Create a response object
 	response := UserGroupResponse{
-		ID:   updatedGroup.ID,
-		Name: updatedGroup.Name,
-	}
-
-	// Populate the response with updated member information
-	for _, id := range memberIDs {
-		response.Members = append(response.Members, UserGroupMember{ID: id})
+		ID:      updatedGroup.ID,
+		Name:    updatedGroup.Name,
+		Members: members,
 	}
 
 	return response, nil
@@ -157,11 +191,16 @@ func (u Usecase) DeleteUserGroup(userID string, userGroupID string) error {
 	// Validate the userID against the CreatorID of the UserGroup
 	if userID != userGroup.CreatorID {
 		log.Printf("ユーザーID %s はユーザーグループID %s を削除する権限がありません。", userID, userGroupID)
-		return errors.New("user is not authorized to delete this user group")
+		return fmt.Errorf("%w: user %s cannot delete the user group %s", ErrForbidden, userID, userGroupID)
+	}
+
+	before, err := u.userGroupSnapshot(userGroup)
+	if err != nil {
+		return err
 	}
 
 	// Delete the user group using the DB interface
-	err = u.db.DeleteUserGroup(userGroupID)
+	err = u.db.DeleteUserGroup(userGroupID, auditChange[string](userID, domain.AuditActionDelete, domain.AuditEntityUserGroup, userGroupID, nil, before, nil))
 	if err != nil {
 		log.Printf("ユーザーグループID %s の削除中にエラー: %v", userGroupID, err)
 		return err
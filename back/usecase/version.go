@@ -0,0 +1,29 @@
+package usecase
+
+import (
+	"fmt"
+)
+
+// ErrVersionConflict は更新しようとしたデータが、クライアントが持っているバージョンから変更されている場合に返されます。
+var ErrVersionConflict = fmt.Errorf("%w: version has changed", ErrConflict)
+
+// VersionConflictError is returned when a resource was changed since the version the client read.
+// Current holds the current state of the resource, in the same form as the response of a successful update.
+type VersionConflictError struct {
+	Version int64
+	Current any
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("%v: the current version is %d", ErrVersionConflict, e.Version)
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
+
+// versionMatches reports whether the client may update a resource at version.
+// A nil expectedVersion means the client did not ask for a check.
+func versionMatches(expectedVersion *int64, version int64) bool {
+	return expectedVersion == nil || *expectedVersion == version
+}